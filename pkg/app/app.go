@@ -2,15 +2,21 @@ package app
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"tmux-ssh-manager/pkg/config"
 	"tmux-ssh-manager/pkg/credentials"
+	"tmux-ssh-manager/pkg/reconnect"
+	"tmux-ssh-manager/pkg/sessionlog"
 	"tmux-ssh-manager/pkg/sshconfig"
 	"tmux-ssh-manager/pkg/state"
 	"tmux-ssh-manager/pkg/termio"
@@ -19,8 +25,15 @@ import (
 )
 
 var credSet = credentials.Set
+var credSetMany = credentials.SetMany
 var credGet = credentials.Get
 var credDelete = credentials.Delete
+var credPut = credentials.Put
+var credReveal = credentials.Reveal
+
+// newFlagSet makes the flags of every command, so that tests can check them
+// against completionSpecs.
+var newFlagSet = flag.NewFlagSet
 
 var Version = "dev"
 
@@ -34,12 +47,50 @@ func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
 			return runList(args[1:], stdout)
 		case "connect":
 			return runConnect(args[1:], stdin, stdout, stderr)
+		case "reconnect":
+			return runReconnect(args[1:], stdin, stdout, stderr)
+		case "exec":
+			return runExec(args[1:], stdout, stderr)
 		case "add":
 			return runAdd(args[1:], stdout)
+		case "set":
+			return runSet(args[1:], stdout)
+		case "favorite":
+			return runFavorite(args[1:], stdout)
+		case "tag":
+			return runTag(args[1:], stdout)
+		case "delete":
+			return runDelete(args[1:], stdin, stdout)
+		case "export":
+			return runExport(args[1:], stdout)
+		case "rename":
+			return runRename(args[1:], stdout)
+		case "clone":
+			return runClone(args[1:], stdout)
+		case "workspace":
+			return runWorkspace(args[1:], stdout)
+		case "tunnel":
+			return runTunnel(args[1:], stdout)
+		case "logs":
+			return runLogs(args[1:], stdout)
 		case "cred":
 			return runCred(args[1:], stdout)
+		case "config":
+			return runConfig(args[1:], stdout)
+		case "check":
+			return runCheck(args[1:], stdout)
+		case "restore":
+			return runRestore(args[1:], stdout)
+		case "completion":
+			return runCompletion(args[1:], stdout)
+		case "__complete":
+			return runComplete(args[1:], stdout)
 		case "__askpass":
 			return runAskpass(args[1:], stdout)
+		case "__logpipe":
+			return runLogPipe(args[1:], stdin)
+		case "__ended":
+			return runEnded(args[1:])
 		case "ssh":
 			return runSSHPassthrough("ssh", args[1:])
 		case "scp":
@@ -54,14 +105,23 @@ func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
 		}
 	}
 
-	fs := flag.NewFlagSet("picker", flag.ContinueOnError)
-	fs.SetOutput(io.Discard)
-	mode := fs.String("mode", "search", "picker mode: search or normal")
-	fs.StringVar(mode, "m", "search", "picker mode (shorthand)")
-	implicitSelect := fs.Bool("implicit-select", true, "enter/v/s/w act on highlighted host in search mode")
-	enterMode := fs.String("enter-mode", "p", "enter key action: p (pane), w (window), s (split-h), v (split-v)")
+	// The flags override the config file; see config.Settings.
+	fs := pickerFlagSet()
 	_ = fs.Parse(args)
 
+	cfg, err := loadConfig(fs)
+	if err != nil {
+		return err
+	}
+	picker := cfg.Picker
+	keymap, err := tmuxui.NewKeymap(cfg.Keys)
+	if err != nil {
+		return err
+	}
+	theme, err := tmuxui.NewTheme(cfg, os.Getenv)
+	if err != nil {
+		return err
+	}
 	hosts, err := sshconfig.LoadDefault()
 	if err != nil {
 		return err
@@ -74,6 +134,8 @@ func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
 	if err != nil {
 		return err
 	}
+	styleFor := hostStyles(cfg, hosts)
+	autoPruneLogs(cfg.Logging)
 
 	// Build host→user map for credential lookups.
 	hostUsers := make(map[string]string, len(hosts))
@@ -91,34 +153,200 @@ func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
 		return credentials.Get(alias, user, "password") == nil
 	}
 
+	// nextLogPolicy is the picker's logging override for the connection it
+	// is about to open.
+	var nextLogPolicy config.LogPolicy
+	logPolicyFor := hostLogPolicies(cfg, hosts)
+
+	binPath, _ := os.Executable()
 	sess := tmuxrun.Session{
-		AskpassScript: askpassScript,
-		HostUsers:     hostUsers,
-		HasCredential: hasCred,
+		AskpassScript:     askpassScript,
+		AskpassOptions:    cfg.SSH.AskpassOptions,
+		HostUsers:         hostUsers,
+		HasCredential:     hasCred,
+		Binary:            binPath,
+		Reconnect:         picker.Reconnect,
+		ReconnectAttempts: picker.ReconnectAttempts,
+		MaxPanes:          picker.MaxPanes,
+		Style:             paneStyles(styleFor),
+		LogFormat:         cfg.Logging.Format,
+		LogKeepRaw:        cfg.Logging.KeepRaw,
+		LogRecord:         cfg.Logging.Record,
+		LogPolicy: func(alias string) string {
+			if nextLogPolicy != "" {
+				return string(nextLogPolicy)
+			}
+			return string(logPolicyFor(alias))
+		},
+		Opened: func(alias, paneID string) {
+			_ = state.StartConnection(storePath, alias, paneID, time.Now())
+		},
 	}
 
+	tunnels := tunnelManager{store: store, storePath: storePath, hosts: hosts, session: sess}
+
 	app := tmuxui.App{
-		Hosts:          hosts,
-		State:          store,
-		StatePath:      storePath,
-		StartInSearch:  *mode != "normal",
-		ImplicitSelect: *implicitSelect,
-		EnterMode:      normalizeEnterMode(*enterMode),
-		AddHost:        sshconfig.AddHostToPrimary,
-		ExecCredential: credentialCommand,
-		InTmux:         tmuxrun.InTmux,
+		Hosts:            hosts,
+		State:            store,
+		StatePath:        storePath,
+		StartInSearch:    picker.Mode != "normal",
+		ImplicitSelect:   picker.ImplicitSelect,
+		EnterMode:        normalizeEnterMode(picker.EnterMode),
+		Layout:           picker.Layout,
+		AddHost:          sshconfig.AddHost,
+		HostFiles:        hostFiles(),
+		RemoveHosts:      sshconfig.RemoveHosts,
+		EditTags:         sshconfig.EditTags,
+		RenameHost:       sshconfig.RenameHost,
+		ExportHosts:      sshconfig.ExportHosts,
+		LoadHosts:        sshconfig.LoadDefault,
+		RestoreBackup:    sshconfig.Restore,
+		ExecCredential:   credentialCommand,
+		DeleteCredential: deleteCredential,
+		InTmux:           tmuxrun.InTmux,
 		Connect: func(alias string) *exec.Cmd {
-			return sshCommandWithAskpass(alias, hostUsers[alias], askpassScript, hasCred)
+			if sess.Reconnect && binPath != "" {
+				return reconnectCommand(binPath, alias, sess.ReconnectAttempts)
+			}
+			return sshCommandWithAskpass(alias, "", hostUsers[alias], askpassScript, cfg.SSH.AskpassOptions, hasCred)
 		},
 		NewWindow:    sess.NewWindow,
 		SplitVert:    sess.SplitVertical,
 		SplitHoriz:   sess.SplitHorizontal,
 		Tiled:        sess.Tiled,
 		SetupLogging: sess.SetupPaneLogging,
+		OpenWorkspace: func(ws state.Workspace) error {
+			return openWorkspace(sess, ws)
+		},
+		Confirm: func(alias string) bool {
+			return styleFor(alias).Confirm
+		},
+		Tunnels: tunnels.active,
+		StartTunnel: func(alias string) (func() (state.Tunnel, error), error) {
+			return tunnels.prepare(alias, nil, false)
+		},
+		AddTunnel:  tunnels.record,
+		StopTunnel: tunnels.stopByID,
+		Panes:      sess.Panes,
+		JumpToPane: sess.JumpToPane,
+		KillPane:   sess.KillPane,
+		Logs:       hostSessions,
+		ViewLog: func(alias string, session sessionlog.Session) *exec.Cmd {
+			return viewLogCommand(binPath, alias, session)
+		},
+		PlayLog: func(session sessionlog.Session) *exec.Cmd {
+			return playLogCommand(binPath, session)
+		},
+		SetLogPolicy: func(policy config.LogPolicy) {
+			nextLogPolicy = policy
+		},
+		LogPolicy: logPolicyFor,
+		Keymap:    keymap,
+		Theme:     theme,
+		TreeView:  picker.View == "tree",
+		GroupBy:   picker.GroupBy,
+		Mouse:     picker.Mouse,
+		HealthTTL: cfg.Health.TTL,
+	}
+	if cfg.Health.Enabled {
+		app.CheckHealth = healthCheck(healthChecker(cfg.Health), hosts)
 	}
+	defer dropParkedCredentials()
 	return app.Run()
 }
 
+// pickerFlagSet defines the picker's flags.
+func pickerFlagSet() *flag.FlagSet {
+	defaults := config.DefaultPicker
+	fs := newFlagSet("picker", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	mode := fs.String("mode", defaults.Mode, "picker mode: search or normal")
+	fs.StringVar(mode, "m", defaults.Mode, "picker mode (shorthand)")
+	fs.Bool("implicit-select", defaults.ImplicitSelect, "enter/v/s/w act on highlighted host in search mode")
+	fs.String("enter-mode", defaults.EnterMode, "enter key action: p (pane), w (window), s (split-h), v (split-v)")
+	fs.Bool("reconnect", defaults.Reconnect, "wrap ssh in the reconnect loop")
+	fs.Int("reconnect-attempts", defaults.ReconnectAttempts, "max consecutive reconnect attempts")
+	fs.String("layout", defaults.Layout, "layout for multi-host windows: tmux preset, main-left, main-top, COLSxROWS or a tmux layout string")
+	fs.Int("max-panes", defaults.MaxPanes, "max panes per window before spilling into a new window (0: no limit)")
+	fs.String("view", defaults.View, "host list view: list or tree")
+	fs.String("group-by", defaults.GroupBy, "tree view grouping: file, tag, bastion or domain")
+	fs.Bool("mouse", defaults.Mouse, "click, double-click and scroll in the picker")
+	fs.String("theme", config.DefaultTheme.Name, "picker theme: auto, a built-in theme or a [themes.<name>] table")
+	fs.String("colors", config.DefaultTheme.Colors, "color depth: auto, truecolor, 256, 16 or none")
+	fs.Bool("health", config.DefaultHealth.Enabled, "check whether hosts are reachable and show their latency")
+	return fs
+}
+
+// hostFiles lists the ssh config files new hosts may be added to: the
+// primary config, even before it exists, then the files it includes.
+func hostFiles() []string {
+	primary, err := sshconfig.DefaultPrimaryPath()
+	if err != nil {
+		return nil
+	}
+	files, err := sshconfig.ConfigFiles(primary)
+	if err != nil || len(files) == 0 {
+		return []string{primary}
+	}
+	return files
+}
+
+// hostStyles resolves the configured style of each host alias.
+func hostStyles(cfg *config.Config, hosts []sshconfig.Host) func(string) config.Style {
+	tags := make(map[string][]string, len(hosts))
+	for _, h := range hosts {
+		tags[h.Alias] = h.Tags
+	}
+	return func(alias string) config.Style {
+		return cfg.StyleFor(alias, tags[alias])
+	}
+}
+
+// hostLogPolicies resolves the logging policy of each host alias.
+func hostLogPolicies(cfg *config.Config, hosts []sshconfig.Host) func(string) config.LogPolicy {
+	byAlias := make(map[string]sshconfig.Host, len(hosts))
+	for _, h := range hosts {
+		byAlias[h.Alias] = h
+	}
+	return func(alias string) config.LogPolicy {
+		h := byAlias[alias]
+		return cfg.Logging.PolicyFor(alias, h.Tags, h.Annotations["log"])
+	}
+}
+
+func paneStyles(styleFor func(string) config.Style) func(string) tmuxrun.PaneStyle {
+	return func(alias string) tmuxrun.PaneStyle {
+		style := styleFor(alias)
+		return tmuxrun.PaneStyle{
+			Border:       style.Border,
+			Title:        style.PaneTitle(alias),
+			WindowPrefix: style.WindowPrefix,
+		}
+	}
+}
+
+// applyConfig styles and logs panes opened by CLI commands the same way the
+// picker does. Hosts that fail to load simply match no tag rules.
+func applyConfig(s *tmuxrun.Session) error {
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		return err
+	}
+	s.AskpassOptions = cfg.SSH.AskpassOptions
+	hosts, _ := sshconfig.LoadDefault()
+	s.Style = paneStyles(hostStyles(cfg, hosts))
+	policyFor := hostLogPolicies(cfg, hosts)
+	s.LogPolicy = func(alias string) string { return string(policyFor(alias)) }
+	s.LogFormat = cfg.Logging.Format
+	s.LogKeepRaw = cfg.Logging.KeepRaw
+	s.LogRecord = cfg.Logging.Record
+	s.Opened = recordOpened
+	if s.Binary == "" {
+		s.Binary, _ = os.Executable()
+	}
+	return nil
+}
+
 func normalizeEnterMode(raw string) string {
 	switch strings.ToLower(strings.TrimSpace(raw)) {
 	case "p", "pane":
@@ -141,10 +369,11 @@ type listEntry struct {
 	Port          int      `json:"port,omitempty"`
 	ProxyJump     string   `json:"proxyjump,omitempty"`
 	IdentityFiles []string `json:"identity_files,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
 }
 
 func runList(args []string, stdout io.Writer) error {
-	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs := newFlagSet("list", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 	jsonOut := fs.Bool("json", false, "output hosts as JSON array")
 	if err := fs.Parse(args); err != nil {
@@ -164,6 +393,7 @@ func runList(args []string, stdout io.Writer) error {
 				Port:          h.Port,
 				ProxyJump:     h.ProxyJump,
 				IdentityFiles: h.IdentityFiles,
+				Tags:          h.Tags,
 			}
 		}
 		enc := json.NewEncoder(stdout)
@@ -179,30 +409,92 @@ func runList(args []string, stdout io.Writer) error {
 }
 
 func runConnect(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
-	fs := flag.NewFlagSet("connect", flag.ContinueOnError)
+	fs := newFlagSet("connect", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 	dryRun := fs.Bool("dry-run", false, "print the ssh command instead of executing it")
 	splitCount := fs.Int("split-count", 0, "open N connections (>1 creates panes/windows)")
 	splitMode := fs.String("split-mode", "window", "with --split-count: window|v|h")
-	layout := fs.String("layout", "", "tmux layout: tiled|even-horizontal|even-vertical|main-horizontal|main-vertical")
+	layout := fs.String("layout", "", "layout for --split-count v|h: tmux preset, main-left, main-top, COLSxROWS or a tmux layout string")
+	maxPanes := fs.Int("max-panes", 0, "max panes per window before spilling into a new window (0: no limit)")
+	reconnectOn := fs.Bool("reconnect", false, "wrap ssh in the reconnect loop")
+	reconnectAttempts := fs.Int("reconnect-attempts", reconnect.DefaultMaxAttempts, "max consecutive reconnect attempts")
+	setName := fs.String("set", "", "connect to every host of a saved set, tiled in one window")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
-	if fs.NArg() != 1 {
-		return fmt.Errorf("usage: tmux-ssh-manager connect [--dry-run] [--split-count N] [--split-mode window|v|h] [--layout tiled] <alias>")
+	if (*setName == "") == (fs.NArg() == 0) || fs.NArg() > 1 {
+		return fmt.Errorf("usage: tmux-ssh-manager connect [--dry-run] [--reconnect] [--split-count N] [--split-mode window|v|h] [--layout tiled] [--max-panes N] <alias> | --set <name>")
+	}
+	if _, err := tmuxrun.ParseLayout(*layout); err != nil {
+		return err
+	}
+	if *setName != "" {
+		aliases, err := setAliases(*setName, stderr)
+		if err != nil {
+			return err
+		}
+		s := tmuxrun.Session{MaxPanes: *maxPanes, Reconnect: *reconnectOn, ReconnectAttempts: *reconnectAttempts}
+		return runConnectSet(s, aliases, *layout, *dryRun, stdout)
 	}
 	alias := strings.TrimSpace(fs.Arg(0))
 	if *dryRun {
 		_, err := fmt.Fprintln(stdout, "ssh "+alias)
 		return err
 	}
+	s := tmuxrun.Session{MaxPanes: *maxPanes}
+	if *reconnectOn {
+		s.Binary, _ = os.Executable()
+		s.Reconnect = true
+		s.ReconnectAttempts = *reconnectAttempts
+	}
 	if *splitCount > 1 {
-		return runConnectSplit(alias, *splitCount, *splitMode, *layout)
+		if err := applyConfig(&s); err != nil {
+			return err
+		}
+		return runConnectSplit(s, alias, *splitCount, *splitMode, *layout)
 	}
-	return execConnectWithAskpass(alias, stdin, stdout, stderr)
+	recordOpened(alias, currentPane())
+	if *reconnectOn {
+		return runReconnect([]string{"--max-attempts", fmt.Sprint(*reconnectAttempts), alias}, stdin, stdout, stderr)
+	}
+	err := execConnectWithAskpass(alias, "", stdin, stdout, stderr)
+	recordEnded(alias, currentPane())
+	return err
 }
 
-func runConnectSplit(alias string, count int, mode, layout string) error {
+// runConnectSet opens a set's hosts tiled in a new window.
+func runConnectSet(s tmuxrun.Session, aliases []string, layout string, dryRun bool, stdout io.Writer) error {
+	if dryRun {
+		for _, alias := range aliases {
+			if _, err := fmt.Fprintln(stdout, "ssh "+alias); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !tmuxrun.InTmux() {
+		return fmt.Errorf("connect --set requires running inside tmux")
+	}
+	if err := applyConfig(&s); err != nil {
+		return err
+	}
+	if layout == "" {
+		layout = "tiled"
+	}
+	if err := s.Tiled(aliases, layout); err != nil {
+		return err
+	}
+	store, err := state.Load("")
+	if err != nil {
+		return err
+	}
+	for _, alias := range aliases {
+		store.AddRecent(alias)
+	}
+	return state.Save("", store)
+}
+
+func runConnectSplit(s tmuxrun.Session, alias string, count int, mode, layout string) error {
 	if !tmuxrun.InTmux() {
 		return fmt.Errorf("split-count requires running inside tmux")
 	}
@@ -210,7 +502,6 @@ func runConnectSplit(alias string, count int, mode, layout string) error {
 	if mode == "" {
 		mode = "window"
 	}
-	s := tmuxrun.Session{}
 	switch mode {
 	case "window":
 		for i := 0; i < count; i++ {
@@ -233,8 +524,83 @@ func runConnectSplit(alias string, count int, mode, layout string) error {
 	}
 }
 
+// runReconnect runs ssh to alias inside the reconnect loop. It is used as the
+// pane command when reconnect is enabled, and directly by connect --reconnect.
+func runReconnect(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("reconnect", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	maxAttempts := fs.Int("max-attempts", reconnect.DefaultMaxAttempts, "max consecutive reconnect attempts")
+	command := fs.String("command", "", "command to run on the host once connected")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: tmux-ssh-manager reconnect [--max-attempts N] [--command cmd] <alias>")
+	}
+	alias := strings.TrimSpace(fs.Arg(0))
+
+	// ctrl+c while ssh runs belongs to ssh; during a countdown it stops the loop.
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	loop := reconnect.Loop{
+		Label:       alias,
+		MaxAttempts: *maxAttempts,
+		Out:         stderr,
+		Run: func() (int, error) {
+			drainSignals(interrupts)
+			return exitStatus(execConnectWithAskpass(alias, *command, stdin, stdout, stderr))
+		},
+		Wait: func(d time.Duration) bool {
+			select {
+			case <-interrupts:
+				return false
+			case <-time.After(d):
+				return true
+			}
+		},
+	}
+	_, err := loop.Start()
+	if pane := currentPane(); pane != "" {
+		recordEnded(alias, pane)
+	}
+	return err
+}
+
+func reconnectCommand(binPath, alias string, maxAttempts int) *exec.Cmd {
+	cmd := exec.Command(binPath, "reconnect", "--max-attempts", fmt.Sprint(maxAttempts), alias)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// exitStatus converts the result of cmd.Run into an exit status. Errors other
+// than a non-zero exit (e.g. ssh missing from PATH) are returned as-is.
+func exitStatus(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	return -1, err
+}
+
+func drainSignals(ch <-chan os.Signal) {
+	for {
+		select {
+		case <-ch:
+		default:
+			return
+		}
+	}
+}
+
 func runAdd(args []string, stdout io.Writer) error {
-	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	fs := newFlagSet("add", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 	var input sshconfig.AddHostInput
 	fs.StringVar(&input.Alias, "alias", "", "Host alias")
@@ -253,13 +619,281 @@ func runAdd(args []string, stdout io.Writer) error {
 	return err
 }
 
+// runClone adds a copy of a host under a new alias, with every directive
+// and annotation of the source, to the file the source is defined in. The
+// flags replace the copied values.
+func runClone(args []string, stdout io.Writer) error {
+	fs := newFlagSet("clone", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	hostName := fs.String("hostname", "", "HostName value")
+	user := fs.String("user", "", "User value")
+	port := fs.Int("port", 0, "Port value")
+	proxyJump := fs.String("proxyjump", "", "ProxyJump value")
+	identityFile := fs.String("identity-file", "", "IdentityFile value")
+	tags := fs.String("tags", "", "comma-separated tags")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("usage: tmux-ssh-manager clone <alias> <new-alias> [--hostname H] [--user U] [--port N] [--proxyjump J] [--identity-file F] [--tags a,b]")
+	}
+
+	hosts, err := sshconfig.LoadDefault()
+	if err != nil {
+		return err
+	}
+	var src *sshconfig.Host
+	for i, h := range hosts {
+		switch h.Alias {
+		case positional[0]:
+			src = &hosts[i]
+		case positional[1]:
+			return fmt.Errorf("host alias already exists: %s", h.Alias)
+		}
+	}
+	if src == nil {
+		return fmt.Errorf("unknown host %q", positional[0])
+	}
+
+	input := sshconfig.CloneInput(*src, positional[1])
+	if *hostName != "" {
+		input.HostName = *hostName
+	}
+	if *user != "" {
+		input.User = *user
+	}
+	if *port != 0 {
+		input.Port = *port
+	}
+	if *proxyJump != "" {
+		input.ProxyJump = *proxyJump
+	}
+	if *identityFile != "" {
+		input.IdentityFile = *identityFile
+	}
+	if *tags != "" {
+		input.Tags = splitAliases(*tags)
+	}
+	if _, err := sshconfig.AddHost(src.SourcePath, input); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "cloned %s to %s in %s\n", src.Alias, input.Alias, src.SourcePath)
+	return err
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func runWorkspace(args []string, stdout io.Writer) error {
+	usage := fmt.Errorf("usage: tmux-ssh-manager workspace <list|save|open|delete> [flags] [name]")
+	if len(args) == 0 {
+		return usage
+	}
+	action := strings.TrimSpace(args[0])
+
+	fs := newFlagSet("workspace", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	jsonOut := fs.Bool("json", false, "list: output workspaces as JSON")
+	hostsFlag := fs.String("hosts", "", "save: comma-separated host aliases")
+	split := fs.String("split", "v", "save: split direction for --hosts: v|h")
+	layout := fs.String("layout", "tiled", "save: tmux layout for --hosts")
+	fromWindow := fs.Bool("from-window", false, "save: capture the current tmux window's panes")
+	var commands stringList
+	fs.Var(&commands, "command", "save: startup command as alias=command (repeatable)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	storePath, err := state.DefaultPath()
+	if err != nil {
+		return err
+	}
+	store, err := state.Load(storePath)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "list":
+		if *jsonOut {
+			enc := json.NewEncoder(stdout)
+			enc.SetIndent("", "  ")
+			workspaces := store.Workspaces
+			if workspaces == nil {
+				workspaces = []state.Workspace{}
+			}
+			return enc.Encode(workspaces)
+		}
+		for _, ws := range store.Workspaces {
+			if _, err := fmt.Fprintf(stdout, "%s\t%s\n", ws.Name, workspaceSummary(ws)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "save":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: tmux-ssh-manager workspace save [--hosts a,b | --from-window] [--split v|h] [--layout tiled] [--command alias=cmd] <name>")
+		}
+		name := strings.TrimSpace(fs.Arg(0))
+		var window state.WorkspaceWindow
+		switch {
+		case *fromWindow:
+			if !tmuxrun.InTmux() {
+				return fmt.Errorf("--from-window requires running inside tmux")
+			}
+			spec, err := tmuxrun.Session{}.CaptureWindow()
+			if err != nil {
+				return err
+			}
+			window = workspaceWindowFromSpec(spec)
+		case strings.TrimSpace(*hostsFlag) != "":
+			window = workspaceWindowFromHosts(name, splitAliases(*hostsFlag), *split, *layout)
+		default:
+			return fmt.Errorf("workspace save needs --hosts or --from-window")
+		}
+		if err := applyWorkspaceCommands(&window, commands); err != nil {
+			return err
+		}
+		if err := store.PutWorkspace(state.Workspace{Name: name, Windows: []state.WorkspaceWindow{window}}); err != nil {
+			return err
+		}
+		if err := state.Save(storePath, store); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(stdout, "saved workspace %s (%d panes)\n", name, len(window.Panes))
+		return err
+	case "open":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: tmux-ssh-manager workspace open <name>")
+		}
+		ws, ok := store.Workspace(fs.Arg(0))
+		if !ok {
+			return fmt.Errorf("unknown workspace %q", fs.Arg(0))
+		}
+		if !tmuxrun.InTmux() {
+			return fmt.Errorf("workspace open requires running inside tmux")
+		}
+		var sess tmuxrun.Session
+		if err := applyConfig(&sess); err != nil {
+			return err
+		}
+		sess.Opened = func(alias, paneID string) {
+			_ = state.StartConnection(storePath, alias, paneID, time.Now())
+		}
+		if err := openWorkspace(sess, ws); err != nil {
+			return err
+		}
+		for _, window := range ws.Windows {
+			for _, pane := range window.Panes {
+				store.AddRecent(pane.Alias)
+			}
+		}
+		return state.Save(storePath, store)
+	case "delete":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: tmux-ssh-manager workspace delete <name>")
+		}
+		if !store.DeleteWorkspace(fs.Arg(0)) {
+			return fmt.Errorf("unknown workspace %q", fs.Arg(0))
+		}
+		if err := state.Save(storePath, store); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(stdout, "deleted workspace %s\n", fs.Arg(0))
+		return err
+	default:
+		return fmt.Errorf("unknown workspace action %q (expected list|save|open|delete)", action)
+	}
+}
+
+func openWorkspace(sess tmuxrun.Session, ws state.Workspace) error {
+	for _, window := range ws.Windows {
+		spec := tmuxrun.WindowSpec{Name: window.Name, Layout: window.Layout}
+		for _, pane := range window.Panes {
+			spec.Panes = append(spec.Panes, tmuxrun.PaneSpec{Alias: pane.Alias, Split: pane.Split, Command: pane.Command})
+		}
+		if err := sess.OpenWindow(spec); err != nil {
+			return fmt.Errorf("open workspace %s: %w", ws.Name, err)
+		}
+	}
+	return nil
+}
+
+func workspaceWindowFromSpec(spec tmuxrun.WindowSpec) state.WorkspaceWindow {
+	window := state.WorkspaceWindow{Name: spec.Name, Layout: spec.Layout}
+	for _, pane := range spec.Panes {
+		window.Panes = append(window.Panes, state.WorkspacePane{Alias: pane.Alias, Split: pane.Split, Command: pane.Command})
+	}
+	return window
+}
+
+func workspaceWindowFromHosts(name string, aliases []string, split, layout string) state.WorkspaceWindow {
+	window := state.WorkspaceWindow{Name: name, Layout: layout}
+	for i, alias := range aliases {
+		pane := state.WorkspacePane{Alias: alias}
+		if i > 0 {
+			pane.Split = split
+		}
+		window.Panes = append(window.Panes, pane)
+	}
+	return window
+}
+
+// applyWorkspaceCommands attaches alias=command pairs to the matching panes.
+func applyWorkspaceCommands(window *state.WorkspaceWindow, commands []string) error {
+	for _, raw := range commands {
+		alias, command, ok := strings.Cut(raw, "=")
+		alias = strings.TrimSpace(alias)
+		if !ok || alias == "" {
+			return fmt.Errorf("--command must be alias=command, got %q", raw)
+		}
+		found := false
+		for i := range window.Panes {
+			if window.Panes[i].Alias == alias {
+				window.Panes[i].Command = strings.TrimSpace(command)
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("--command alias %q is not part of the workspace", alias)
+		}
+	}
+	return nil
+}
+
+func workspaceSummary(ws state.Workspace) string {
+	panes := 0
+	for _, window := range ws.Windows {
+		panes += len(window.Panes)
+	}
+	return fmt.Sprintf("%d windows, %d panes", len(ws.Windows), panes)
+}
+
+func splitAliases(raw string) []string {
+	var out []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
 func runCred(args []string, stdout io.Writer) error {
 	if len(args) == 0 {
-		return fmt.Errorf("usage: tmux-ssh-manager cred <set|get|delete> --host <alias> [--user <user>] [--kind password]")
+		return fmt.Errorf("usage: tmux-ssh-manager cred <set|get|delete> --host <alias> | --hosts a,b [--user <user>] [--kind password]")
 	}
 
 	action := strings.TrimSpace(args[0])
-	fs := flag.NewFlagSet("cred", flag.ContinueOnError)
+	fs := newFlagSet("cred", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 	var host string
 	var user string
@@ -267,10 +901,17 @@ func runCred(args []string, stdout io.Writer) error {
 	fs.StringVar(&host, "host", "", "Host alias or destination key")
 	fs.StringVar(&user, "user", "", "Optional username for the credential")
 	fs.StringVar(&kind, "kind", "password", "Credential kind")
+	hostsFlag := fs.String("hosts", "", "Comma-separated host aliases; set prompts once for all of them")
 	if err := fs.Parse(args[1:]); err != nil {
 		return err
 	}
 
+	if hosts := splitAliases(*hostsFlag); len(hosts) > 0 {
+		if strings.TrimSpace(host) != "" {
+			return fmt.Errorf("use either --host or --hosts")
+		}
+		return runCredMany(action, hosts, user, kind, stdout)
+	}
 	host = strings.TrimSpace(host)
 	if host == "" {
 		return fmt.Errorf("missing required --host")
@@ -313,8 +954,52 @@ func credentialCommand(action, host, user, kind string) (*exec.Cmd, error) {
 	return credentialCommandForPath(path, action, host, user, kind), nil
 }
 
+// deleteCredential deletes a credential for the picker. The secret is moved
+// to a parked keychain item rather than kept in memory, and restore moves it
+// back; the parked items go when the picker exits. A credential that cannot
+// be parked, such as one that cannot be read, is deleted without a restore.
+func deleteCredential(host, user, kind string) (func() error, error) {
+	parked := "deleted-" + kind
+	if err := moveCredential(host, user, kind, parked); err != nil {
+		_ = credDelete(host, user, parked)
+		return nil, credDelete(host, user, kind)
+	}
+	parkedCredentials = append(parkedCredentials, [3]string{host, user, parked})
+	return func() error { return moveCredential(host, user, parked, kind) }, nil
+}
+
+// parkedCredentials are the host, user and kind of the items deleteCredential
+// parked.
+var parkedCredentials [][3]string
+
+// dropParkedCredentials deletes the parked items once nothing can restore
+// them.
+func dropParkedCredentials() {
+	for _, item := range parkedCredentials {
+		_ = credDelete(item[0], item[1], item[2])
+	}
+	parkedCredentials = nil
+}
+
+func moveCredential(host, user, from, to string) error {
+	secret, err := credReveal(host, user, from)
+	if err != nil {
+		return err
+	}
+	if err := credPut(host, user, to, secret); err != nil {
+		return err
+	}
+	return credDelete(host, user, from)
+}
+
+// credentialCommandForPath runs "cred <action>" for host, or for every host
+// of a comma-separated list.
 func credentialCommandForPath(path, action, host, user, kind string) *exec.Cmd {
-	args := []string{"cred", action, "--host", strings.TrimSpace(host), "--kind", strings.TrimSpace(kind)}
+	hostFlag := "--host"
+	if strings.Contains(host, ",") {
+		hostFlag = "--hosts"
+	}
+	args := []string{"cred", action, hostFlag, strings.TrimSpace(host), "--kind", strings.TrimSpace(kind)}
 	if strings.TrimSpace(user) != "" {
 		args = append(args, "--user", strings.TrimSpace(user))
 	}
@@ -333,13 +1018,11 @@ func sshCommand(alias string) *exec.Cmd {
 	return cmd
 }
 
-func sshCommandWithAskpass(alias, user, askpassScript string, hasCred func(string) bool) *exec.Cmd {
+// sshCommandWithAskpass returns ssh to alias, running command on the host
+// if it is not empty.
+func sshCommandWithAskpass(alias, command, user, askpassScript string, options []string, hasCred func(string) bool) *exec.Cmd {
 	if askpassScript != "" && hasCred != nil && hasCred(alias) {
-		cmd := exec.Command("ssh",
-			"-o", "PubkeyAuthentication=no",
-			"-o", "PreferredAuthentications=keyboard-interactive,password",
-			alias,
-		)
+		cmd := exec.Command("ssh", append(sshOptionArgs(options), sshTargetArgs(alias, command)...)...)
 		cmd.Stdin = os.Stdin
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
@@ -352,13 +1035,31 @@ func sshCommandWithAskpass(alias, user, askpassScript string, hasCred func(strin
 		)
 		return cmd
 	}
-	cmd := exec.Command("ssh", alias)
+	cmd := exec.Command("ssh", sshTargetArgs(alias, command)...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd
 }
 
+// sshTargetArgs returns the destination arguments of ssh: the alias, or
+// with a startup command, a tty and the remote command.
+func sshTargetArgs(alias, command string) []string {
+	if strings.TrimSpace(command) == "" {
+		return []string{alias}
+	}
+	return []string{"-t", alias, "--", tmuxrun.RemoteCommand(command)}
+}
+
+// sshOptionArgs turns Name=value options into ssh -o arguments.
+func sshOptionArgs(options []string) []string {
+	args := make([]string, 0, 2*len(options))
+	for _, option := range options {
+		args = append(args, "-o", option)
+	}
+	return args
+}
+
 func createAskpassScript() string {
 	binPath, err := os.Executable()
 	if err != nil {
@@ -381,26 +1082,26 @@ func shellQuote(s string) string {
 }
 
 func connectInPlace(alias string) error {
-	return execConnectWithAskpass(alias, os.Stdin, os.Stdout, os.Stderr)
+	return execConnectWithAskpass(alias, "", os.Stdin, os.Stdout, os.Stderr)
 }
 
-func execSSH(alias string, stdin io.Reader, stdout, stderr io.Writer) error {
+func execSSH(alias, command string, stdin io.Reader, stdout, stderr io.Writer) error {
 	termio.SanitizeStdinBeforeExec(os.Stdin, os.Stderr)
-	cmd := exec.Command("ssh", alias)
+	cmd := exec.Command("ssh", sshTargetArgs(alias, command)...)
 	cmd.Stdin = stdin
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 	return cmd.Run()
 }
 
-func execConnectWithAskpass(alias string, stdin io.Reader, stdout, stderr io.Writer) error {
+func execConnectWithAskpass(alias, command string, stdin io.Reader, stdout, stderr io.Writer) error {
 	// Drain any stray terminal reply bytes before starting SSH.
 	termio.SanitizeStdinBeforeExec(os.Stdin, os.Stderr)
 
 	hosts, err := sshconfig.LoadDefault()
 	if err != nil {
 		// Fall back to plain ssh if we can't load config.
-		return execSSH(alias, stdin, stdout, stderr)
+		return execSSH(alias, command, stdin, stdout, stderr)
 	}
 
 	hostUsers := make(map[string]string, len(hosts))
@@ -418,7 +1119,11 @@ func execConnectWithAskpass(alias string, stdin io.Reader, stdout, stderr io.Wri
 		return credentials.Get(a, user, "password") == nil
 	}
 
-	cmd := sshCommandWithAskpass(alias, hostUsers[alias], askpassScript, hasCred)
+	options, err := askpassOptions()
+	if err != nil {
+		return err
+	}
+	cmd := sshCommandWithAskpass(alias, command, hostUsers[alias], askpassScript, options, hasCred)
 	// Ensure we respect the caller's stdio (important for non-picker flows).
 	cmd.Stdin = stdin
 	cmd.Stdout = stdout
@@ -426,8 +1131,105 @@ func execConnectWithAskpass(alias string, stdin io.Reader, stdout, stderr io.Wri
 	return cmd.Run()
 }
 
+// runLogPipe is the pipe-pane target for session logging: it reads a pane's
+// output from stdin and appends it to the host's log until the pane closes.
+func runLogPipe(args []string, stdin io.Reader) error {
+	fs := newFlagSet("__logpipe", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	alias := fs.String("alias", "", "Host alias")
+	session := fs.String("session", "", "Session ID")
+	pane := fs.String("pane", "", "tmux pane being logged")
+	format := fs.String("format", "text", "Log format: text, json or raw")
+	keepRaw := fs.Bool("keep-raw", false, "Also keep the unprocessed output")
+	record := fs.Bool("record", false, "Also write an asciicast recording")
+	cols := fs.Int("cols", 0, "Terminal width for the recording")
+	rows := fs.Int("rows", 0, "Terminal height for the recording")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*alias) == "" {
+		return fmt.Errorf("usage: tmux-ssh-manager __logpipe --alias <alias> [--session id] [--pane id] [--format text|json|raw] [--keep-raw] [--record --cols n --rows n]")
+	}
+	logFormat, err := sessionlog.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+	// A broken config must not stop logging; rotate with the defaults.
+	logging := config.DefaultLogging
+	if cfg, err := config.Load(""); err == nil {
+		logging = cfg.Logging
+	}
+	if *session == "" {
+		*session = sessionlog.NewSessionID(time.Now())
+	}
+	// Without its redactor the pane is not logged at all: returning ends
+	// pipe-pane.
+	redact, err := logRedactor(logging, *alias)
+	if err != nil {
+		return fmt.Errorf("session logging off for %s: %w", *alias, err)
+	}
+	dir, err := tmuxrun.LogDir(*alias)
+	if err != nil {
+		return err
+	}
+	w, err := sessionlog.Open(dir, sessionlog.Options{
+		Session:     *session,
+		Format:      logFormat,
+		KeepRaw:     *keepRaw,
+		MaxFileSize: logging.MaxFileSize,
+		Record:      *record,
+		Width:       *cols,
+		Height:      *rows,
+		Title:       *alias,
+		Redact:      redact,
+	})
+	if err != nil {
+		return err
+	}
+	_, copyErr := io.Copy(w, stdin)
+	// The pane closed: its connection is over.
+	if *pane != "" {
+		recordEnded(*alias, *pane)
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return copyErr
+}
+
+// logRedactor builds the redactor for a host's logs from the configured
+// patterns and the host's stored credentials. Only the kinds of credential
+// the host has are read, so the keychain is not asked for the others.
+func logRedactor(l config.Logging, alias string) (*sessionlog.Redactor, error) {
+	var patterns []string
+	if l.RedactDefaults {
+		patterns = append(patterns, sessionlog.DefaultRedactPatterns...)
+	}
+	patterns = append(patterns, l.Redact...)
+	var secrets []string
+	if l.RedactCredentials {
+		user := ""
+		if hosts, err := sshconfig.LoadDefault(); err == nil {
+			for _, h := range hosts {
+				if h.Alias == alias {
+					user = h.User
+				}
+			}
+		}
+		for _, kind := range []string{"password", "passphrase", "otp"} {
+			if credGet(alias, user, kind) != nil {
+				continue
+			}
+			if secret, err := credReveal(alias, user, kind); err == nil {
+				secrets = append(secrets, secret)
+			}
+		}
+	}
+	return sessionlog.NewRedactor(patterns, secrets)
+}
+
 func runAskpass(args []string, stdout io.Writer) error {
-	fs := flag.NewFlagSet("__askpass", flag.ContinueOnError)
+	fs := newFlagSet("__askpass", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 	var host, user, kind string
 	fs.StringVar(&host, "host", "", "Host alias")
@@ -470,16 +1272,17 @@ func runSSHPassthrough(binary string, args []string) error {
 			}
 			user, ok := resolveCredentialUser(dest.host, dest.user, hostUsers[dest.host])
 			if ok {
+				options, err := askpassOptions()
+				if err != nil {
+					return err
+				}
 				script := createAskpassScript()
 				if script != "" {
 					defer os.Remove(script)
-					// Disable pubkey auth so SSH doesn't burn auth attempts
-					// by sending the login password as key passphrases.
-					askpassArgs := []string{
-						"-o", "PubkeyAuthentication=no",
-						"-o", "PreferredAuthentications=keyboard-interactive,password",
-					}
-					askpassArgs = append(askpassArgs, args...)
+					// By default pubkey auth is disabled so SSH doesn't burn
+					// auth attempts by sending the login password as key
+					// passphrases.
+					askpassArgs := append(sshOptionArgs(options), args...)
 					cmd = exec.Command(binPath, askpassArgs...)
 					cmd.Stdin = os.Stdin
 					cmd.Stdout = os.Stdout
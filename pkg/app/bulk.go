@@ -0,0 +1,231 @@
+package app
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"tmux-ssh-manager/pkg/sshconfig"
+	"tmux-ssh-manager/pkg/state"
+)
+
+// Bulk commands act on the hosts named by --hosts, as the picker's bulk
+// keys act on its selection.
+
+// resolveHosts looks up every alias of a comma-separated list.
+func resolveHosts(raw string) ([]sshconfig.Host, error) {
+	aliases := splitAliases(raw)
+	if len(aliases) == 0 {
+		return nil, fmt.Errorf("missing required --hosts")
+	}
+	hosts, err := sshconfig.LoadDefault()
+	if err != nil {
+		return nil, err
+	}
+	byAlias := make(map[string]sshconfig.Host, len(hosts))
+	for _, h := range hosts {
+		byAlias[h.Alias] = h
+	}
+	out := make([]sshconfig.Host, 0, len(aliases))
+	for _, alias := range aliases {
+		h, ok := byAlias[alias]
+		if !ok {
+			return nil, fmt.Errorf("unknown host %q", alias)
+		}
+		out = append(out, h)
+	}
+	return out, nil
+}
+
+func runFavorite(args []string, stdout io.Writer) error {
+	fs := newFlagSet("favorite", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	hostsFlag := fs.String("hosts", "", "comma-separated host aliases")
+	remove := fs.Bool("remove", false, "unfavorite the hosts instead")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	hosts, err := resolveHosts(*hostsFlag)
+	if err != nil {
+		return err
+	}
+	storePath, err := state.DefaultPath()
+	if err != nil {
+		return err
+	}
+	store, err := state.Load(storePath)
+	if err != nil {
+		return err
+	}
+	for _, h := range hosts {
+		if store.IsFavorite(h.Alias) == *remove {
+			store.ToggleFavorite(h.Alias)
+		}
+	}
+	if err := state.Save(storePath, store); err != nil {
+		return err
+	}
+	verb := "favorited"
+	if *remove {
+		verb = "unfavorited"
+	}
+	_, err = fmt.Fprintf(stdout, "%s %d hosts\n", verb, len(hosts))
+	return err
+}
+
+func runTag(args []string, stdout io.Writer) error {
+	usage := fmt.Errorf("usage: tmux-ssh-manager tag <add|remove> --hosts a,b <tag>...")
+	if len(args) == 0 {
+		return usage
+	}
+	action := strings.TrimSpace(args[0])
+	fs := newFlagSet("tag", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	hostsFlag := fs.String("hosts", "", "comma-separated host aliases")
+	positional, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	var tags []string
+	for _, arg := range positional {
+		tags = append(tags, splitAliases(arg)...)
+	}
+	if len(tags) == 0 {
+		return usage
+	}
+	hosts, err := resolveHosts(*hostsFlag)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case "add":
+		_, err = sshconfig.EditTags(hosts, tags, nil)
+	case "remove":
+		_, err = sshconfig.EditTags(hosts, nil, tags)
+	default:
+		return fmt.Errorf("unknown tag action %q (expected add|remove)", action)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "%s %s on %d hosts\n", map[string]string{"add": "added", "remove": "removed"}[action], strings.Join(tags, ","), len(hosts))
+	return err
+}
+
+// runDelete removes the hosts' blocks after listing them and asking on
+// stdin, unless --yes is given.
+func runDelete(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("delete", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	hostsFlag := fs.String("hosts", "", "comma-separated host aliases")
+	yes := fs.Bool("yes", false, "delete without asking")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	hosts, err := resolveHosts(*hostsFlag)
+	if err != nil {
+		return err
+	}
+	if !*yes {
+		fmt.Fprintln(stdout, "These Host blocks will be removed:")
+		for _, h := range hosts {
+			fmt.Fprintf(stdout, "  %s\t%s:%d\n", h.Alias, h.SourcePath, h.SourceLine)
+		}
+		fmt.Fprintf(stdout, "Delete %d hosts? [y/N] ", len(hosts))
+		answer, _ := bufio.NewReader(stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return fmt.Errorf("delete cancelled")
+		}
+	}
+	if _, err := sshconfig.RemoveHosts(hosts); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "deleted %d hosts\n", len(hosts))
+	return err
+}
+
+// runRename renames a host in its ssh config file, then in the state, so
+// that its sets, favorites, workspace panes and cached health follow it.
+func runRename(args []string, stdout io.Writer) error {
+	usage := fmt.Errorf("usage: tmux-ssh-manager rename <alias> <new-alias>")
+	if len(args) != 2 || len(splitAliases(args[0])) != 1 {
+		return usage
+	}
+	hosts, err := resolveHosts(args[0])
+	if err != nil {
+		return err
+	}
+	old, alias := hosts[0].Alias, strings.TrimSpace(args[1])
+	if _, err := sshconfig.RenameHost(hosts[0], alias); err != nil {
+		return err
+	}
+	storePath, err := state.DefaultPath()
+	if err != nil {
+		return err
+	}
+	store, err := state.Load(storePath)
+	if err != nil {
+		return err
+	}
+	store.RenameAlias(old, alias)
+	if err := state.Save(storePath, store); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "renamed %s to %s\n", old, alias)
+	return err
+}
+
+func runExport(args []string, stdout io.Writer) error {
+	fs := newFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	hostsFlag := fs.String("hosts", "", "comma-separated host aliases")
+	output := fs.String("output", "", "file to write (default: stdout)")
+	fs.StringVar(output, "o", "", "file to write (shorthand)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	hosts, err := resolveHosts(*hostsFlag)
+	if err != nil {
+		return err
+	}
+	blocks, err := sshconfig.ExportHosts(hosts)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = io.WriteString(stdout, blocks)
+		return err
+	}
+	return os.WriteFile(*output, []byte(blocks), 0o600)
+}
+
+// runCredMany runs a cred action for several hosts; set prompts for the
+// secret only once.
+func runCredMany(action string, hosts []string, user, kind string, stdout io.Writer) error {
+	var err error
+	switch action {
+	case "set":
+		err = credSetMany(hosts, user, kind)
+	case "get", "delete":
+		run := credGet
+		if action == "delete" {
+			run = credDelete
+		}
+		for _, host := range hosts {
+			if err = run(host, user, kind); err != nil {
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("unknown cred action %q (expected set|get|delete)", action)
+	}
+	if err != nil {
+		return err
+	}
+	verb := map[string]string{"set": "stored", "get": "found", "delete": "deleted"}[action]
+	_, err = fmt.Fprintf(stdout, "%s %s for %d hosts\n", verb, strings.TrimSpace(kind), len(hosts))
+	return err
+}
@@ -0,0 +1,188 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"tmux-ssh-manager/pkg/config"
+	"tmux-ssh-manager/pkg/health"
+	"tmux-ssh-manager/pkg/sshconfig"
+	"tmux-ssh-manager/pkg/state"
+)
+
+// checkRecord is the JSON form of a health check.
+type checkRecord struct {
+	Alias     string  `json:"alias"`
+	Host      string  `json:"host"`
+	Port      int     `json:"port"`
+	Jump      string  `json:"jump,omitempty"`
+	Up        bool    `json:"up"`
+	Unknown   bool    `json:"unknown,omitempty"`
+	LatencyMS float64 `json:"latency_ms,omitempty"`
+	Banner    string  `json:"banner,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	CheckedAt string  `json:"checked_at"`
+}
+
+func runCheck(args []string, stdout io.Writer) error {
+	fs := newFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	jsonOut := fs.Bool("json", false, "output results as JSON array")
+	timeout := fs.Duration("timeout", 0, "time limit per host (default: health.timeout)")
+	noBanner := fs.Bool("no-banner", false, "only open the TCP connection, without waiting for the ssh banner")
+	aliases, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		return err
+	}
+	hosts, err := sshconfig.LoadDefault()
+	if err != nil {
+		return err
+	}
+	byAlias := make(map[string]sshconfig.Host, len(hosts))
+	for _, h := range hosts {
+		byAlias[h.Alias] = h
+	}
+	var targets []health.Target
+	if len(aliases) == 0 {
+		for _, h := range hosts {
+			targets = append(targets, health.TargetFor(h))
+		}
+	}
+	for _, alias := range aliases {
+		h, ok := byAlias[alias]
+		if !ok {
+			return fmt.Errorf("unknown host %q", alias)
+		}
+		targets = append(targets, health.TargetFor(h))
+	}
+
+	checker := healthChecker(cfg.Health)
+	if *timeout > 0 {
+		checker.Timeout = *timeout
+	}
+	if *noBanner {
+		checker.Banner = false
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	results := make(chan health.Result, len(targets))
+	checker.CheckAll(ctx, targets, results)
+	close(results)
+	if ctx.Err() != nil {
+		return fmt.Errorf("check interrupted")
+	}
+	byTarget := make(map[string]health.Result, len(targets))
+	for result := range results {
+		byTarget[result.Alias] = result
+	}
+
+	storePath, err := state.DefaultPath()
+	if err != nil {
+		return err
+	}
+	store, err := state.Load(storePath)
+	if err != nil {
+		return err
+	}
+	// Report in the order the hosts were asked for.
+	down := 0
+	records := make([]checkRecord, 0, len(targets))
+	for _, t := range targets {
+		result := byTarget[t.Alias]
+		cached := result.Record()
+		store.PutHealth(t.Alias, cached)
+		if !result.Up && !result.Unknown {
+			down++
+		}
+		records = append(records, checkRecord{
+			Alias:     t.Alias,
+			Host:      t.Host,
+			Port:      t.Port,
+			Jump:      t.Jump,
+			Up:        result.Up,
+			Unknown:   result.Unknown,
+			LatencyMS: cached.LatencyMS,
+			Banner:    result.Banner,
+			Error:     cached.Error,
+			CheckedAt: cached.CheckedAt,
+		})
+	}
+	if err := state.Save(storePath, store); err != nil {
+		return err
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(records); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range records {
+			status, latency, route, detail := "down", "-", "direct", r.Error
+			switch {
+			case r.Up:
+				status, latency, detail = "up", formatLatency(r.LatencyMS), r.Banner
+			case r.Unknown:
+				status = "unknown"
+			}
+			if r.Jump != "" {
+				route = "via " + r.Jump
+			}
+			if _, err := fmt.Fprintf(stdout, "%s\t%s\t%s\t%s\t%s\n", r.Alias, status, latency, route, detail); err != nil {
+				return err
+			}
+		}
+	}
+	if down > 0 {
+		return fmt.Errorf("%d of %d hosts unreachable", down, len(records))
+	}
+	return nil
+}
+
+// healthChecker builds the checker the [health] settings describe.
+func healthChecker(h config.Health) health.Checker {
+	return health.Checker{Timeout: h.Timeout, Banner: h.Banner, Concurrency: h.Concurrency}
+}
+
+// healthCheck runs the picker's checks in the background: every result is
+// sent as it arrives and the channel is closed once all are done.
+func healthCheck(checker health.Checker, hosts []sshconfig.Host) func(ctx context.Context, aliases []string) <-chan health.Result {
+	byAlias := make(map[string]sshconfig.Host, len(hosts))
+	for _, h := range hosts {
+		byAlias[h.Alias] = h
+	}
+	return func(ctx context.Context, aliases []string) <-chan health.Result {
+		targets := make([]health.Target, 0, len(aliases))
+		for _, alias := range aliases {
+			if h, ok := byAlias[alias]; ok {
+				targets = append(targets, health.TargetFor(h))
+			}
+		}
+		results := make(chan health.Result)
+		go func() {
+			defer close(results)
+			checker.CheckAll(ctx, targets, results)
+		}()
+		return results
+	}
+}
+
+func formatLatency(ms float64) string {
+	latency := time.Duration(ms * float64(time.Millisecond))
+	if latency < time.Millisecond {
+		return latency.Round(time.Microsecond).String()
+	}
+	return latency.Round(100 * time.Microsecond).String()
+}
@@ -0,0 +1,578 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"tmux-ssh-manager/pkg/sessionlog"
+	"tmux-ssh-manager/pkg/sshconfig"
+	"tmux-ssh-manager/pkg/state"
+	"tmux-ssh-manager/pkg/tmuxrun"
+)
+
+// The completion scripts send the words typed after the program name to
+// the hidden __complete command, which prints the candidates for the last
+// one, one per line. Knowing the commands and their flags here keeps the
+// three scripts small and the same.
+
+// What a flag's value or a positional argument completes to.
+const (
+	completeNothing   = ""
+	completeText      = "text" // a value, with nothing to complete
+	completeAlias     = "alias"
+	completeAliases   = "aliases" // comma-separated
+	completeFile      = "file"
+	completeKind      = "kind"
+	completeWorkspace = "workspace"
+	completeSet       = "set"
+	completeTunnel    = "tunnel"
+	completeLogFile   = "log-file"
+	completeRecording = "recording"
+	completeBackup    = "backup"
+	completeShell     = "shell"
+)
+
+// completionSpec describes a command for completion: its actions (the
+// first argument, as in "set save"), its flags and what each one's value
+// completes to (completeNothing for booleans), and what its positional
+// arguments complete to.
+type completionSpec struct {
+	actions []string
+	flags   map[string]string
+	// args is what every positional argument completes to; first only
+	// applies to the first one (clone's source). With actions, the first
+	// argument completes to both (logs' host).
+	args  string
+	first bool
+	// actionArgs overrides args per action.
+	actionArgs map[string]string
+	// choices lists the values of flags that take one of a few.
+	choices map[string][]string
+}
+
+// completionSpecs lists the flags each command defines; a test checks them
+// against the commands' flag sets, made with newFlagSet.
+var completionSpecs = map[string]completionSpec{
+	"list": {flags: map[string]string{"json": completeNothing}},
+	"connect": {
+		flags: map[string]string{
+			"dry-run": completeNothing, "split-count": completeText, "split-mode": completeText, "layout": completeText,
+			"max-panes": completeText, "reconnect": completeNothing, "reconnect-attempts": completeText, "set": completeSet,
+		},
+		args:    completeAlias,
+		first:   true,
+		choices: map[string][]string{"split-mode": {"window", "v", "h"}, "layout": layoutChoices},
+	},
+	"exec":      {flags: map[string]string{"dry-run": completeNothing, "set": completeSet}, args: completeAlias},
+	"reconnect": {flags: map[string]string{"max-attempts": completeText, "command": completeText}, args: completeAlias, first: true},
+	"add": {flags: map[string]string{
+		"alias": completeText, "hostname": completeText, "user": completeText, "port": completeText,
+		"proxyjump": completeAlias, "identity-file": completeFile,
+	}},
+	"clone": {
+		flags: map[string]string{
+			"hostname": completeText, "user": completeText, "port": completeText,
+			"proxyjump": completeAlias, "identity-file": completeFile, "tags": completeText,
+		},
+		args:  completeAlias,
+		first: true,
+	},
+	"set": {
+		actions:    []string{"list", "save", "delete"},
+		flags:      map[string]string{"json": completeNothing, "hosts": completeAliases},
+		actionArgs: map[string]string{"delete": completeSet},
+	},
+	"favorite": {flags: map[string]string{"hosts": completeAliases, "remove": completeNothing}},
+	"tag":      {actions: []string{"add", "remove"}, flags: map[string]string{"hosts": completeAliases}},
+	"delete":   {flags: map[string]string{"hosts": completeAliases, "yes": completeNothing}},
+	"export":   {flags: map[string]string{"hosts": completeAliases, "output": completeFile, "o": completeFile}},
+	"rename":   {args: completeAlias, first: true},
+	"workspace": {
+		actions: []string{"list", "save", "open", "delete"},
+		flags: map[string]string{
+			"json": completeNothing, "hosts": completeAliases, "split": completeText, "layout": completeText,
+			"from-window": completeNothing, "command": completeText,
+		},
+		actionArgs: map[string]string{"open": completeWorkspace, "delete": completeWorkspace},
+		choices:    map[string][]string{"split": {"v", "h"}, "layout": layoutChoices},
+	},
+	"tunnel": {
+		actions: []string{"start", "stop", "list"},
+		flags: map[string]string{
+			"json": completeNothing, "configured": completeNothing, "window": completeNothing, "all": completeNothing,
+			"L": completeText, "R": completeText, "D": completeText,
+		},
+		actionArgs: map[string]string{"start": completeAlias, "stop": completeTunnel},
+	},
+	"logs": {actions: []string{"show", "play", "prune"}, args: completeAlias},
+	"logs show": {
+		flags: map[string]string{
+			"since": completeText, "session": completeText, "file": completeLogFile, "grep": completeText, "C": completeText,
+			"follow": completeNothing, "open": completeNothing, "json": completeNothing,
+		},
+		args:  completeAlias,
+		first: true,
+	},
+	"logs play":  {flags: map[string]string{"speed": completeText, "max-idle": completeText}, args: completeRecording, first: true},
+	"logs prune": {},
+	"cred": {
+		actions: []string{"set", "get", "delete"},
+		flags:   map[string]string{"host": completeAlias, "hosts": completeAliases, "user": completeText, "kind": completeKind},
+	},
+	"config": {
+		actions:    []string{"path", "show", "validate"},
+		flags:      map[string]string{"defaults": completeNothing},
+		actionArgs: map[string]string{"validate": completeFile},
+	},
+	"check":                 {flags: map[string]string{"json": completeNothing, "timeout": completeText, "no-banner": completeNothing}, args: completeAlias},
+	"restore":               {flags: map[string]string{"list": completeNothing, "json": completeNothing}, args: completeBackup, first: true},
+	"completion":            {args: completeShell, first: true},
+	"print-ssh-config-path": {},
+}
+
+// pickerFlags are the flags of the picker, completed in place of a command.
+var pickerFlags = map[string]string{
+	"mode": completeText, "m": completeText, "implicit-select": completeNothing, "enter-mode": completeText,
+	"reconnect": completeNothing, "reconnect-attempts": completeText, "layout": completeText, "max-panes": completeText,
+	"view": completeText, "group-by": completeText, "mouse": completeNothing, "theme": completeText, "colors": completeText,
+	"health": completeNothing,
+}
+
+var pickerChoices = map[string][]string{
+	"mode":       {"search", "normal"},
+	"m":          {"search", "normal"},
+	"enter-mode": {"p", "w", "s", "v"},
+	"layout":     layoutChoices,
+	"view":       {"list", "tree"},
+	"group-by":   {"file", "tag", "bastion", "domain"},
+	"colors":     {"auto", "truecolor", "256", "16", "none"},
+}
+
+var layoutChoices = []string{"tiled", "even-horizontal", "even-vertical", "main-horizontal", "main-vertical", "main-left", "main-top"}
+
+var credentialKinds = []string{"password", "passphrase", "otp"}
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// sshValueFlags are the ssh and scp options that take a value, and what
+// the value completes to.
+var sshValueFlags = map[string]map[string]string{
+	"ssh": {
+		"-B": completeText, "-b": completeText, "-c": completeText, "-D": completeText, "-E": completeFile, "-e": completeText,
+		"-F": completeFile, "-I": completeText, "-i": completeFile, "-J": completeAlias, "-L": completeText,
+		"-l": completeText, "-m": completeText, "-O": completeText, "-o": completeText, "-p": completeText, "-Q": completeText,
+		"-R": completeText, "-S": completeFile, "-W": completeText, "-w": completeText,
+	},
+	"scp": {
+		"-c": completeText, "-D": completeText, "-F": completeFile, "-i": completeFile, "-J": completeAlias,
+		"-l": completeText, "-o": completeText, "-P": completeText, "-S": completeFile, "-X": completeText,
+	},
+}
+
+// commandNames lists the commands completed as the first word.
+func commandNames() []string {
+	names := []string{"ssh", "scp"}
+	for name := range completionSpecs {
+		if !strings.Contains(name, " ") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func runCompletion(args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: tmux-ssh-manager completion bash|zsh|fish")
+	}
+	script, ok := completionScripts[strings.TrimSpace(args[0])]
+	if !ok {
+		return fmt.Errorf("unknown shell %q (expected bash|zsh|fish)", args[0])
+	}
+	_, err := io.WriteString(stdout, script)
+	return err
+}
+
+// runComplete prints the candidates for the last of args, the words typed
+// after the program name.
+func runComplete(args []string, stdout io.Writer) error {
+	for _, candidate := range complete(args) {
+		if _, err := fmt.Fprintln(stdout, candidate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func complete(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+	before := words[:len(words)-1]
+	if len(before) == 0 {
+		if strings.HasPrefix(cur, "-") {
+			return completeFlags(pickerFlags, pickerChoices, cur)
+		}
+		return matching(commandNames(), cur)
+	}
+	name := before[0]
+	if strings.HasPrefix(name, "-") {
+		// The picker: its flags and their values.
+		if value, ok := flagValue(pickerFlags, before); ok {
+			return completeValue(value, pickerChoices[strings.TrimLeft(before[len(before)-1], "-")], cur)
+		}
+		return completeFlags(pickerFlags, pickerChoices, cur)
+	}
+	if name == "ssh" || name == "scp" {
+		return completeSSH(name, before[1:], cur)
+	}
+	args := before[1:]
+	if name == "logs" && len(args) > 0 {
+		// Past its first word, logs is logs show unless that is an action.
+		switch args[0] {
+		case "show", "play", "prune":
+			name, args = "logs "+args[0], args[1:]
+		default:
+			name = "logs show"
+		}
+	}
+	spec, ok := completionSpecs[name]
+	if !ok {
+		return nil
+	}
+	if value, ok := flagValue(spec.flags, before); ok {
+		return completeValue(value, spec.choices[strings.TrimLeft(before[len(before)-1], "-")], cur)
+	}
+	if strings.HasPrefix(cur, "-") {
+		return completeFlags(spec.flags, spec.choices, cur)
+	}
+	positional := positionals(spec.flags, args)
+	if len(spec.actions) > 0 {
+		if len(positional) == 0 {
+			return append(matching(spec.actions, cur), completeValue(spec.args, nil, cur)...)
+		}
+		value, ok := spec.actionArgs[positional[0]]
+		if !ok || len(positional) > 1 {
+			return nil
+		}
+		return completeValue(value, nil, cur)
+	}
+	if spec.first && len(positional) > 0 {
+		return nil
+	}
+	return completeValue(spec.args, nil, cur)
+}
+
+// flagValue reports what the value being typed completes to when the word
+// before it is a flag that takes one.
+func flagValue(flags map[string]string, before []string) (string, bool) {
+	last := before[len(before)-1]
+	if !strings.HasPrefix(last, "-") || strings.Contains(last, "=") {
+		return "", false
+	}
+	value, ok := flags[strings.TrimLeft(last, "-")]
+	return value, ok && value != completeNothing
+}
+
+// positionals returns the arguments of args that are not flags or their
+// values.
+func positionals(flags map[string]string, args []string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			out = append(out, arg)
+			continue
+		}
+		if strings.Contains(arg, "=") {
+			continue
+		}
+		if value := flags[strings.TrimLeft(arg, "-")]; value != completeNothing {
+			i++
+		}
+	}
+	return out
+}
+
+// completeFlags completes a flag, or the value of "--flag=" as typed.
+func completeFlags(flags map[string]string, choices map[string][]string, cur string) []string {
+	if name, value, ok := strings.Cut(cur, "="); ok {
+		kind, known := flags[strings.TrimLeft(name, "-")]
+		if !known || kind == completeNothing {
+			return nil
+		}
+		var out []string
+		for _, candidate := range completeValue(kind, choices[strings.TrimLeft(name, "-")], value) {
+			out = append(out, name+"="+candidate)
+		}
+		return out
+	}
+	var names []string
+	for name := range flags {
+		if len(name) == 1 {
+			names = append(names, "-"+name)
+		} else {
+			names = append(names, "--"+name)
+		}
+	}
+	sort.Strings(names)
+	return matching(names, cur)
+}
+
+func completeValue(value string, choices []string, cur string) []string {
+	if len(choices) > 0 {
+		return matching(choices, cur)
+	}
+	switch value {
+	case completeAlias:
+		return matching(hostAliases(), cur)
+	case completeAliases:
+		// Complete the last alias of the list, leaving out those typed.
+		prefix, last := "", cur
+		if i := strings.LastIndex(cur, ","); i >= 0 {
+			prefix, last = cur[:i+1], cur[i+1:]
+		}
+		typed := map[string]bool{}
+		for _, alias := range strings.Split(prefix, ",") {
+			typed[alias] = true
+		}
+		var out []string
+		for _, alias := range matching(hostAliases(), last) {
+			if !typed[alias] {
+				out = append(out, prefix+alias)
+			}
+		}
+		return out
+	case completeKind:
+		return matching(credentialKinds, cur)
+	case completeShell:
+		return matching(completionShells, cur)
+	case completeFile:
+		return completeFiles(cur)
+	case completeWorkspace, completeSet, completeTunnel:
+		return matching(stateNames(value), cur)
+	case completeLogFile, completeRecording:
+		return matching(logFileNames(value == completeRecording), cur)
+	case completeBackup:
+		backups, _ := sshconfig.Backups()
+		var ids []string
+		for _, backup := range backups {
+			ids = append(ids, backup.ID)
+		}
+		return matching(ids, cur)
+	}
+	return nil
+}
+
+// completeSSH completes the arguments of the ssh and scp wrappers: host
+// aliases ("alias:" for scp, where local files are completed too), and the
+// values of the options that take one.
+func completeSSH(binary string, before []string, cur string) []string {
+	if len(before) > 0 {
+		if value, ok := sshValueFlags[binary][before[len(before)-1]]; ok {
+			return completeValue(value, nil, cur)
+		}
+	}
+	if strings.HasPrefix(cur, "-") {
+		return nil
+	}
+	if binary == "ssh" {
+		user, host, ok := strings.Cut(cur, "@")
+		if !ok {
+			return matching(hostAliases(), cur)
+		}
+		var out []string
+		for _, alias := range matching(hostAliases(), host) {
+			out = append(out, user+"@"+alias)
+		}
+		return out
+	}
+	if strings.Contains(cur, ":") {
+		return nil
+	}
+	var out []string
+	for _, alias := range matching(hostAliases(), cur) {
+		out = append(out, alias+":")
+	}
+	return append(out, completeFiles(cur)...)
+}
+
+// hostAliases lists the aliases of ssh config, without patterns.
+func hostAliases() []string {
+	hosts, err := sshconfig.LoadDefault()
+	if err != nil {
+		return nil
+	}
+	aliases := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		aliases = append(aliases, h.Alias)
+	}
+	return aliases
+}
+
+// stateNames lists the workspaces, sets or tunnels (IDs and aliases) of
+// the state.
+func stateNames(kind string) []string {
+	path, err := state.DefaultPath()
+	if err != nil {
+		return nil
+	}
+	store, err := state.Load(path)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	switch kind {
+	case completeWorkspace:
+		for _, ws := range store.Workspaces {
+			names = append(names, ws.Name)
+		}
+	case completeSet:
+		for _, set := range store.Sets {
+			names = append(names, set.Name)
+		}
+	case completeTunnel:
+		for _, t := range store.Tunnels {
+			names = append(names, t.ID, t.Alias)
+		}
+	}
+	return names
+}
+
+// logFileNames lists the names of the session log files, or of the
+// recordings and their sessions, newest first.
+func logFileNames(recordings bool) []string {
+	base, err := tmuxrun.LogsBaseDir()
+	if err != nil {
+		return nil
+	}
+	files, err := sessionlog.ListFiles(base)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for i := len(files) - 1; i >= 0; i-- {
+		f := files[i]
+		if (f.Ext == sessionlog.CastExt) != recordings {
+			continue
+		}
+		names = append(names, filepath.Base(f.Path))
+		if recordings && f.Session != "" {
+			names = append(names, f.Session)
+		}
+	}
+	return names
+}
+
+// completeFiles completes a path, with a slash after directories.
+func completeFiles(cur string) []string {
+	dir, prefix := filepath.Split(cur)
+	read := dir
+	if read == "" {
+		read = "."
+	} else if strings.HasPrefix(read, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			read = filepath.Join(home, read[2:])
+		}
+	}
+	entries, err := os.ReadDir(read)
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".")) {
+			continue
+		}
+		if entry.IsDir() {
+			name += "/"
+		}
+		out = append(out, dir+name)
+	}
+	return out
+}
+
+// matching returns the candidates that start with prefix, each once.
+func matching(candidates []string, prefix string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) && !seen[candidate] {
+			seen[candidate] = true
+			out = append(out, candidate)
+		}
+	}
+	return out
+}
+
+// completionScripts are printed by "completion <shell>". Candidates that
+// end in "/", ":", "," or "=" are continued without a space.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for tmux-ssh-manager
+# Load it with: source <(tmux-ssh-manager completion bash)
+
+_tmux_ssh_manager() {
+    local line="${COMP_LINE:0:COMP_POINT}" words cur reply trim
+    read -ra words <<< "$line"
+    if [[ -z $line || $line == *[[:space:]] ]]; then
+        words+=("")
+    fi
+    cur="${words[${#words[@]}-1]}"
+    # bash splits words at = and :, so only the end of cur is replaced.
+    trim=$(( ${#cur} - ${#2} ))
+    (( trim < 0 )) && trim=0
+    COMPREPLY=()
+    while IFS= read -r reply; do
+        COMPREPLY+=("${reply:trim}")
+    done < <("${words[0]}" __complete "${words[@]:1}" 2>/dev/null)
+    if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == *[/:,=] ]]; then
+        compopt -o nospace
+    fi
+}
+complete -F _tmux_ssh_manager tmux-ssh-manager
+`,
+	"zsh": `#compdef tmux-ssh-manager
+# zsh completion for tmux-ssh-manager
+# Load it with: source <(tmux-ssh-manager completion zsh)
+# or save it as _tmux-ssh-manager in a directory of $fpath.
+
+_tmux-ssh-manager() {
+    local -a candidates spaced unspaced
+    local candidate
+    candidates=(${(f)"$(${words[1]} __complete "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+    for candidate in $candidates; do
+        if [[ $candidate == *[/:,=] ]]; then
+            unspaced+=("$candidate")
+        else
+            spaced+=("$candidate")
+        fi
+    done
+    (( $#spaced )) && compadd -U -Q -- $spaced
+    (( $#unspaced )) && compadd -U -Q -S '' -- $unspaced
+    return 0
+}
+
+if [[ $funcstack[1] == _tmux-ssh-manager ]]; then
+    _tmux-ssh-manager "$@"
+else
+    compdef _tmux-ssh-manager tmux-ssh-manager
+fi
+`,
+	"fish": `# fish completion for tmux-ssh-manager
+# Load it with: tmux-ssh-manager completion fish | source
+# or save it as ~/.config/fish/completions/tmux-ssh-manager.fish
+
+function __tmux_ssh_manager_complete
+    set -l tokens (commandline -opc) (commandline -ct)
+    $tokens[1] __complete $tokens[2..-1] 2>/dev/null
+end
+
+complete -c tmux-ssh-manager -f -a '(__tmux_ssh_manager_complete)'
+`,
+}
@@ -0,0 +1,175 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"tmux-ssh-manager/pkg/config"
+	"tmux-ssh-manager/pkg/tmuxrun"
+	"tmux-ssh-manager/pkg/tmuxui"
+)
+
+// tmuxOptions returns the global @tmux_ssh_manager_* options; a variable so
+// tests need no tmux server.
+var tmuxOptions = func() (map[string]string, error) {
+	return tmuxrun.Session{}.GlobalOptions("@tmux_ssh_manager_")
+}
+
+// loadConfig reads the config file and applies the overrides of
+// config.Settings from tmux options, then TSSM_* environment variables, then
+// the flags explicitly set in fs (which may be nil), so that later sources
+// win. The keymap and theme only matter to the picker, which checks them
+// itself, so a mistake there does not stop connect or workspace open.
+func loadConfig(fs *flag.FlagSet) (*config.Config, error) {
+	cfg, err := config.Load("")
+	if err != nil {
+		return nil, err
+	}
+	if tmuxrun.InTmux() {
+		// Without a reachable server there are simply no tmux options.
+		options, _ := tmuxOptions()
+		for _, s := range config.Settings {
+			value, ok := options[s.TmuxOption()]
+			if !ok || strings.TrimSpace(value) == "" {
+				continue
+			}
+			if err := cfg.Override(s.Key, value, "tmux option "+s.TmuxOption()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, s := range config.Settings {
+		value := os.Getenv(s.Env())
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		if err := cfg.Override(s.Key, value, "env "+s.Env()); err != nil {
+			return nil, err
+		}
+	}
+	if fs != nil {
+		fs.Visit(func(f *flag.Flag) {
+			s, ok := config.SettingForFlag(f.Name)
+			if !ok || err != nil {
+				return
+			}
+			err = cfg.Override(s.Key, f.Value.String(), "flag --"+f.Name)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tmuxrun.ParseLayout(cfg.Picker.Layout); err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.Source("picker.layout"), err)
+	}
+	return cfg, nil
+}
+
+// checkConfig validates what the config package cannot check itself,
+// including the picker's keymap and theme.
+func checkConfig(cfg *config.Config) error {
+	if _, err := tmuxrun.ParseLayout(cfg.Picker.Layout); err != nil {
+		return fmt.Errorf("%s: %w", cfg.Source("picker.layout"), err)
+	}
+	if _, err := tmuxui.NewKeymap(cfg.Keys); err != nil {
+		return err
+	}
+	_, err := tmuxui.NewTheme(cfg, os.Getenv)
+	return err
+}
+
+// askpassOptions returns the configured ssh options for askpass logins. They
+// have no tmux or environment override, so only the config file is read.
+func askpassOptions() ([]string, error) {
+	cfg, err := config.Load("")
+	if err != nil {
+		return nil, err
+	}
+	return cfg.SSH.AskpassOptions, nil
+}
+
+func runConfig(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: tmux-ssh-manager config show|validate|path")
+	}
+	switch args[0] {
+	case "path":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: tmux-ssh-manager config path")
+		}
+		path, err := config.DefaultPath()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(stdout, path)
+		return err
+	case "show":
+		fs := newFlagSet("config show", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		defaults := fs.Bool("defaults", false, "show the built-in defaults instead of the effective config")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 0 {
+			return fmt.Errorf("usage: tmux-ssh-manager config show [--defaults]")
+		}
+		if *defaults {
+			_, err := io.WriteString(stdout, config.Default().Render(false))
+			return err
+		}
+		cfg, err := loadConfig(nil)
+		if err != nil {
+			return err
+		}
+		path, err := config.DefaultPath()
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err != nil {
+			path += " (not found)"
+		}
+		_, err = fmt.Fprintf(stdout, "# %s\n# Each setting is followed by where its value came from.\n\n%s", path, cfg.Render(true))
+		return err
+	case "validate":
+		if len(args) > 2 {
+			return fmt.Errorf("usage: tmux-ssh-manager config validate [file]")
+		}
+		if len(args) == 2 {
+			if _, err := os.Stat(args[1]); err != nil {
+				return fmt.Errorf("read config: %w", err)
+			}
+			cfg, err := config.Load(args[1])
+			if err != nil {
+				return err
+			}
+			if err := checkConfig(cfg); err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(stdout, "%s: ok\n", args[1])
+			return err
+		}
+		path, err := config.DefaultPath()
+		if err != nil {
+			return err
+		}
+		// Overrides from tmux options and the environment are checked too.
+		cfg, err := loadConfig(nil)
+		if err != nil {
+			return err
+		}
+		if err := checkConfig(cfg); err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err != nil {
+			_, err = fmt.Fprintf(stdout, "%s: not found, using defaults\n", path)
+			return err
+		}
+		_, err = fmt.Fprintf(stdout, "%s: ok\n", path)
+		return err
+	default:
+		return fmt.Errorf("unknown config action %q (expected show|validate|path)", args[0])
+	}
+}
@@ -0,0 +1,131 @@
+package app
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"tmux-ssh-manager/pkg/credentials"
+	"tmux-ssh-manager/pkg/sshconfig"
+)
+
+const execUsage = "usage: tmux-ssh-manager exec [--dry-run] <alias>... | --set <name> -- <command>..."
+
+// runExec runs a command on hosts over ssh, one host after another, and
+// prefixes every line of their output with the host's alias. Every host is
+// tried; the error lists those where the command failed.
+func runExec(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("exec", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	dryRun := fs.Bool("dry-run", false, "print the ssh commands instead of running them")
+	setName := fs.String("set", "", "run on every host of a saved set")
+	split := slices.Index(args, "--")
+	if split < 0 {
+		return fmt.Errorf(execUsage)
+	}
+	aliases, err := parseInterspersed(fs, args[:split])
+	if err != nil {
+		return err
+	}
+	command := strings.TrimSpace(strings.Join(args[split+1:], " "))
+	if command == "" || (*setName == "") == (len(aliases) == 0) {
+		return fmt.Errorf(execUsage)
+	}
+	if *setName != "" {
+		if aliases, err = setAliases(*setName, stderr); err != nil {
+			return err
+		}
+	}
+	if *dryRun {
+		for _, alias := range aliases {
+			if _, err := fmt.Fprintf(stdout, "ssh -T %s -- %s\n", alias, command); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	hosts, _ := sshconfig.LoadDefault()
+	hostUsers := make(map[string]string, len(hosts))
+	for _, h := range hosts {
+		hostUsers[h.Alias] = h.User
+	}
+	askpassScript := createAskpassScript()
+	if askpassScript != "" {
+		defer os.Remove(askpassScript)
+	}
+	hasCred := func(alias string) bool {
+		return credentials.Get(alias, hostUsers[alias], "password") == nil
+	}
+	options, err := askpassOptions()
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, alias := range aliases {
+		out := &prefixWriter{w: stdout, prefix: alias + ": "}
+		errOut := &prefixWriter{w: stderr, prefix: alias + ": "}
+		cmd := execCommand(alias, command, sshCommandWithAskpass(alias, "", hostUsers[alias], askpassScript, options, hasCred))
+		cmd.Stdout, cmd.Stderr = out, errOut
+		err := cmd.Run()
+		out.finish()
+		errOut.finish()
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", alias, err)
+			failed = append(failed, alias)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("command failed on %d of %d hosts: %s", len(failed), len(aliases), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// execCommand turns cmd, ssh connecting to alias, into ssh running command
+// there without a tty or stdin, so that hosts run it one after another
+// without waiting for input.
+func execCommand(alias, command string, cmd *exec.Cmd) *exec.Cmd {
+	cmd.Args = append(cmd.Args[:len(cmd.Args)-1], "-T", alias, "--", command)
+	cmd.Stdin = nil
+	return cmd
+}
+
+// prefixWriter writes to w with prefix at the start of every line.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	// midLine is set while the last line written has no newline yet.
+	midLine bool
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	var out []byte
+	for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if !p.midLine {
+			out = append(out, p.prefix...)
+		}
+		out = append(out, line...)
+		p.midLine = line[len(line)-1] != '\n'
+	}
+	if _, err := p.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// finish ends a last line that had no newline.
+func (p *prefixWriter) finish() {
+	if p.midLine {
+		_, _ = io.WriteString(p.w, "\n")
+		p.midLine = false
+	}
+}
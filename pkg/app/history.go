@@ -0,0 +1,40 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"tmux-ssh-manager/pkg/state"
+)
+
+// The connection history is written by whichever process sees a connection
+// start or end: the command opening a pane; the pane's own command once ssh
+// exits, its logger or its reconnect loop; or connect itself when it runs
+// ssh in place. An end seen twice is recorded once. Failures are ignored;
+// the history must never get in the way of a connection.
+
+// recordOpened keeps a pane opened for alias in the history.
+func recordOpened(alias, paneID string) {
+	_ = state.StartConnection("", alias, paneID, time.Now())
+}
+
+// recordEnded notes that the connection to alias in paneID ended.
+func recordEnded(alias, paneID string) {
+	_ = state.EndConnection("", alias, paneID, time.Now())
+}
+
+// runEnded is run by a pane once its ssh exits, to record the end of the
+// connection.
+func runEnded(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: tmux-ssh-manager __ended <alias>")
+	}
+	recordEnded(args[0], currentPane())
+	return nil
+}
+
+// currentPane is the tmux pane this process runs in, if any.
+func currentPane() string {
+	return os.Getenv("TMUX_PANE")
+}
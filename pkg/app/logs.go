@@ -0,0 +1,633 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"tmux-ssh-manager/pkg/config"
+	"tmux-ssh-manager/pkg/sessionlog"
+	"tmux-ssh-manager/pkg/tmuxrun"
+)
+
+// autoPruneInterval is how often the picker prunes logs on startup.
+const autoPruneInterval = 24 * time.Hour
+
+// followInterval is how often logs --follow polls for new output.
+const followInterval = 500 * time.Millisecond
+
+// followBacklog is how many existing lines logs --follow prints first.
+const followBacklog = 10
+
+// runLogs dispatches the logs actions. Anything else, a host or flags,
+// shows logs; "logs show <alias>" reaches hosts called "play" or "prune".
+func runLogs(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return runLogsView(args, stdout)
+	}
+	switch strings.TrimSpace(args[0]) {
+	case "show":
+		return runLogsView(args[1:], stdout)
+	case "prune":
+		return runLogsPrune(args[1:], stdout)
+	case "play":
+		return runLogsPlay(args[1:], stdout)
+	default:
+		return runLogsView(args, stdout)
+	}
+}
+
+// logQuery selects the log lines a logs command looks at.
+type logQuery struct {
+	since   time.Time
+	session string
+	file    string
+}
+
+func (q logQuery) keepFile(f sessionlog.File) bool {
+	if q.file != "" && filepath.Base(f.Path) != q.file && strings.TrimSuffix(filepath.Base(f.Path), ".gz") != q.file {
+		return false
+	}
+	return q.since.IsZero() || f.Date.AddDate(0, 0, 1).After(q.since)
+}
+
+func (q logQuery) keep(r sessionlog.Record) bool {
+	if q.session != "" && r.Session != q.session {
+		return false
+	}
+	return q.since.IsZero() || r.Time.IsZero() || !r.Time.Before(q.since)
+}
+
+// logRecord is the JSON form of a log line.
+type logRecord struct {
+	Alias   string `json:"alias"`
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Time    string `json:"time,omitempty"`
+	Session string `json:"session,omitempty"`
+	Text    string `json:"text"`
+	Match   bool   `json:"match,omitempty"`
+}
+
+func runLogsView(args []string, stdout io.Writer) error {
+	usage := fmt.Errorf("usage: tmux-ssh-manager logs [show] [alias] [--since 7d|2006-01-02] [--session id] [--file name] [--grep pattern [-C n]] [--follow] [--open] [--json]")
+	fs := newFlagSet("logs show", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	since := fs.String("since", "", "only logs newer than a duration (2h, 7d) or date (2006-01-02)")
+	session := fs.String("session", "", "only lines of this session")
+	file := fs.String("file", "", "only this log file, e.g. 2006-01-02.log")
+	grep := fs.String("grep", "", "print lines matching this regular expression")
+	contextLines := fs.Int("C", 0, "lines of context around --grep matches")
+	follow := fs.Bool("follow", false, "print new lines of the host's newest log as they are written")
+	open := fs.Bool("open", false, "show the selected lines in $PAGER")
+	jsonOut := fs.Bool("json", false, "output as JSON")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 || *contextLines < 0 {
+		return usage
+	}
+	alias := ""
+	if len(positional) == 1 {
+		alias = strings.TrimSpace(positional[0])
+	}
+
+	query := logQuery{session: strings.TrimSpace(*session), file: strings.TrimSpace(*file)}
+	if *since != "" {
+		if query.since, err = parseSince(*since, time.Now()); err != nil {
+			return err
+		}
+	}
+	var pattern *regexp.Regexp
+	if *grep != "" {
+		if pattern, err = regexp.Compile(*grep); err != nil {
+			return fmt.Errorf("invalid --grep pattern: %w", err)
+		}
+	}
+
+	base, err := tmuxrun.LogsBaseDir()
+	if err != nil {
+		return err
+	}
+	hostDir := ""
+	if alias != "" {
+		dir, err := tmuxrun.LogDir(alias)
+		if err != nil {
+			return err
+		}
+		hostDir = filepath.Base(dir)
+	}
+
+	if *follow {
+		if alias == "" {
+			return fmt.Errorf("usage: tmux-ssh-manager logs show <alias> --follow")
+		}
+		stop := make(chan struct{})
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt)
+		defer signal.Stop(signals)
+		go func() {
+			<-signals
+			close(stop)
+		}()
+		out := newRecordPrinter(stdout, *jsonOut)
+		return followLogs(base, hostDir, query, pattern, followInterval, stop, out.print)
+	}
+
+	all, err := sessionlog.ListFiles(base)
+	if err != nil {
+		return err
+	}
+	var files []sessionlog.File
+	for _, f := range all {
+		if (hostDir == "" || f.Alias == hostDir) && query.keepFile(f) {
+			files = append(files, f)
+		}
+	}
+	if alias != "" && len(files) == 0 && !*jsonOut {
+		return fmt.Errorf("no logs for %s", alias)
+	}
+
+	listing := pattern == nil && query.session == "" && query.file == "" && !*open
+	if listing {
+		return listSessions(files, query, *jsonOut, stdout)
+	}
+	if *open && alias == "" && query.session == "" && pattern == nil {
+		return fmt.Errorf("usage: tmux-ssh-manager logs show <alias> --open [--session id]")
+	}
+
+	target := stdout
+	var paged bytes.Buffer
+	if *open {
+		target = &paged
+	}
+	out := newRecordPrinter(target, *jsonOut)
+	if pattern != nil {
+		err = searchLogs(files, pattern, *contextLines, query.keep, out.print, out.separate)
+	} else {
+		for _, f := range files {
+			if !f.Readable() {
+				continue
+			}
+			if err = sessionlog.ReadFile(f, func(r sessionlog.Record) error {
+				if !query.keep(r) {
+					return nil
+				}
+				return out.print(r, false)
+			}); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if *open {
+		return runPager(&paged, stdout)
+	}
+	return nil
+}
+
+// parseInterspersed parses flags that may come before or after positional
+// arguments, returning the positional ones.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// parseSince accepts a duration back from now (90m, 2h, 7d) or a date or
+// RFC 3339 timestamp.
+func parseSince(raw string, now time.Time) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(raw); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", raw, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q (expected a duration like 2h or 7d, or a date like 2006-01-02)", raw)
+}
+
+func listSessions(files []sessionlog.File, query logQuery, jsonOut bool, stdout io.Writer) error {
+	sessions, err := sessionlog.Sessions(files)
+	if err != nil {
+		return err
+	}
+	kept := []sessionlog.Session{}
+	for _, s := range sessions {
+		if !query.since.IsZero() && !s.End.IsZero() && s.End.Before(query.since) {
+			continue
+		}
+		kept = append(kept, s)
+	}
+	if jsonOut {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(kept)
+	}
+	for _, s := range kept {
+		id := s.ID
+		if id == "" {
+			id = "-"
+		}
+		names := make([]string, 0, len(s.Files))
+		for _, path := range s.Files {
+			names = append(names, filepath.Base(path))
+		}
+		if s.Recording != "" && (len(s.Files) == 0 || s.Files[len(s.Files)-1] != s.Recording) {
+			names = append(names, filepath.Base(s.Recording))
+		}
+		lines := fmt.Sprintf("%d lines", s.Lines)
+		if s.Redactions > 0 {
+			lines += fmt.Sprintf(", %d redacted", s.Redactions)
+		}
+		if _, err := fmt.Fprintf(stdout, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Alias, id, formatLogTime(s.Start), formatLogTime(s.End), lines, strings.Join(names, ",")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatLogTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(sessionlog.TimeLayout)
+}
+
+// searchLogs emits the lines matching pattern, with up to context lines
+// before and after each match from the same file, like grep -C.
+func searchLogs(files []sessionlog.File, pattern *regexp.Regexp, context int, keep func(sessionlog.Record) bool, emit func(sessionlog.Record, bool) error, separate func() error) error {
+	printed := false
+	for _, f := range files {
+		if !f.Readable() {
+			continue
+		}
+		var before []sessionlog.Record
+		after, last := 0, 0
+		err := sessionlog.ReadFile(f, func(r sessionlog.Record) error {
+			if !keep(r) {
+				return nil
+			}
+			if pattern.MatchString(r.Text) {
+				first := r.LineNo
+				if len(before) > 0 {
+					first = before[0].LineNo
+				}
+				if printed && context > 0 && (last == 0 || first > last+1) {
+					if err := separate(); err != nil {
+						return err
+					}
+				}
+				for _, b := range before {
+					if err := emit(b, false); err != nil {
+						return err
+					}
+				}
+				before = before[:0]
+				printed, last, after = true, r.LineNo, context
+				return emit(r, true)
+			}
+			if after > 0 {
+				after--
+				last = r.LineNo
+				return emit(r, false)
+			}
+			if context > 0 {
+				before = append(before, r)
+				if len(before) > context {
+					before = before[1:]
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// followLogs prints the newest log of the host in hostDir as it grows,
+// moving on to new files as the log rotates, until stop is closed.
+func followLogs(base, hostDir string, query logQuery, pattern *regexp.Regexp, interval time.Duration, stop <-chan struct{}, emit func(sessionlog.Record, bool) error) error {
+	newest := func() (sessionlog.File, bool, error) {
+		files, err := sessionlog.ListFiles(base)
+		if err != nil {
+			return sessionlog.File{}, false, err
+		}
+		for i := len(files) - 1; i >= 0; i-- {
+			f := files[i]
+			if f.Alias == hostDir && f.Readable() && !f.Compressed && query.keepFile(f) {
+				return f, true, nil
+			}
+		}
+		return sessionlog.File{}, false, nil
+	}
+	matches := func(r sessionlog.Record) bool {
+		return query.keep(r) && (pattern == nil || pattern.MatchString(r.Text))
+	}
+	emitMatch := func(r sessionlog.Record) error {
+		if !matches(r) {
+			return nil
+		}
+		return emit(r, pattern != nil)
+	}
+
+	var tailer *sessionlog.Tailer
+	if f, ok, err := newest(); err != nil {
+		return err
+	} else if ok {
+		tailer = &sessionlog.Tailer{File: f}
+		var backlog []sessionlog.Record
+		if err := tailer.Read(func(r sessionlog.Record) error {
+			if matches(r) {
+				backlog = append(backlog, r)
+				if len(backlog) > followBacklog {
+					backlog = backlog[1:]
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, r := range backlog {
+			if err := emitMatch(r); err != nil {
+				return err
+			}
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+		if tailer != nil {
+			if err := tailer.Read(emitMatch); err != nil {
+				return err
+			}
+		}
+		f, ok, err := newest()
+		if err != nil {
+			return err
+		}
+		if ok && (tailer == nil || f.Path != tailer.File.Path) {
+			tailer = &sessionlog.Tailer{File: f}
+			if err := tailer.Read(emitMatch); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// recordPrinter writes log lines as text prefixed with the host alias, or
+// as JSON objects one per line.
+type recordPrinter struct {
+	out  io.Writer
+	json bool
+}
+
+func newRecordPrinter(out io.Writer, jsonOut bool) recordPrinter {
+	return recordPrinter{out: out, json: jsonOut}
+}
+
+func (p recordPrinter) print(r sessionlog.Record, match bool) error {
+	if p.json {
+		record := logRecord{Alias: r.Alias, File: r.File, Line: r.LineNo, Session: r.Session, Text: r.Text, Match: match}
+		if !r.Time.IsZero() {
+			record.Time = r.Time.Format(sessionlog.TimeLayout)
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(p.out, "%s\n", data)
+		return err
+	}
+	prefix := r.Alias
+	if !r.Time.IsZero() {
+		prefix += " " + r.Time.Format(sessionlog.TimeLayout)
+	}
+	if r.Session != "" {
+		prefix += " [" + r.Session + "]"
+	}
+	_, err := fmt.Fprintf(p.out, "%s %s\n", prefix, r.Text)
+	return err
+}
+
+func (p recordPrinter) separate() error {
+	if p.json {
+		return nil
+	}
+	_, err := fmt.Fprintln(p.out, "--")
+	return err
+}
+
+// runPager shows content in $PAGER, falling back to less.
+func runPager(content io.Reader, stdout io.Writer) error {
+	pager := strings.TrimSpace(os.Getenv("PAGER"))
+	if pager == "" {
+		pager = "less"
+	}
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = content
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func runLogsPrune(args []string, stdout io.Writer) error {
+	fs := newFlagSet("logs prune", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := config.Load("")
+	if err != nil {
+		return err
+	}
+	base, err := tmuxrun.LogsBaseDir()
+	if err != nil {
+		return err
+	}
+	result, err := sessionlog.Prune(base, logPolicy(cfg.Logging), time.Now())
+	if err != nil {
+		return err
+	}
+	_ = touchPruneStamp(base)
+	_, err = fmt.Fprintf(stdout, "compressed %d files, removed %d files (%s freed)\n", result.Compressed, result.Removed, formatBytes(result.Freed))
+	return err
+}
+
+func runLogsPlay(args []string, stdout io.Writer) error {
+	fs := newFlagSet("logs play", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	speed := fs.Float64("speed", 1, "playback speed multiplier")
+	maxIdle := fs.Duration("max-idle", 0, "cap pauses between output (0: as recorded)")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 || *speed <= 0 || *maxIdle < 0 {
+		return fmt.Errorf("usage: tmux-ssh-manager logs play [--speed 2] [--max-idle 2s] <file|session>")
+	}
+	path, err := findRecording(strings.TrimSpace(positional[0]))
+	if err != nil {
+		return err
+	}
+	r, err := sessionlog.OpenFile(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return sessionlog.Play(r, stdout, sessionlog.PlayOptions{Speed: *speed, MaxIdle: *maxIdle})
+}
+
+// findRecording resolves a recording given as a path, a file name in the
+// logs directory or a session ID.
+func findRecording(target string) (string, error) {
+	if info, err := os.Stat(target); err == nil && !info.IsDir() {
+		return target, nil
+	}
+	base, err := tmuxrun.LogsBaseDir()
+	if err != nil {
+		return "", err
+	}
+	files, err := sessionlog.ListFiles(base)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range files {
+		name := filepath.Base(f.Path)
+		if f.Ext == sessionlog.CastExt && (f.Session == target || name == target || strings.TrimSuffix(name, ".gz") == target) {
+			return f.Path, nil
+		}
+	}
+	return "", fmt.Errorf("no recording %q", target)
+}
+
+func logPolicy(l config.Logging) sessionlog.Policy {
+	return sessionlog.Policy{
+		MaxAge:       time.Duration(l.MaxAgeDays) * 24 * time.Hour,
+		MaxHostSize:  l.MaxHostSize,
+		MaxTotalSize: l.MaxTotalSize,
+		Compress:     l.Compress,
+	}
+}
+
+// autoPruneLogs prunes logs in the background when the last prune is older
+// than autoPruneInterval. Errors are ignored: pruning must never get in the
+// way of connecting. The stamp is only touched once Prune returns, so a run
+// cut short by the picker exiting is finished by the next one.
+func autoPruneLogs(l config.Logging) {
+	base, err := tmuxrun.LogsBaseDir()
+	if err != nil {
+		return
+	}
+	if info, err := os.Stat(filepath.Join(base, pruneStampName)); err == nil && time.Since(info.ModTime()) < autoPruneInterval {
+		return
+	}
+	go func() {
+		_, _ = sessionlog.Prune(base, logPolicy(l), time.Now())
+		_ = touchPruneStamp(base)
+	}()
+}
+
+const pruneStampName = ".last-prune"
+
+func touchPruneStamp(base string) error {
+	if err := os.MkdirAll(base, 0o700); err != nil {
+		return err
+	}
+	path := filepath.Join(base, pruneStampName)
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		return err
+	}
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// hostSessions lists the sessions logged for alias, oldest first.
+func hostSessions(alias string) ([]sessionlog.Session, error) {
+	base, err := tmuxrun.LogsBaseDir()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := tmuxrun.LogDir(alias)
+	if err != nil {
+		return nil, err
+	}
+	all, err := sessionlog.ListFiles(base)
+	if err != nil {
+		return nil, err
+	}
+	var files []sessionlog.File
+	for _, f := range all {
+		if f.Alias == filepath.Base(dir) {
+			files = append(files, f)
+		}
+	}
+	return sessionlog.Sessions(files)
+}
+
+// playLogCommand replays a session's recording.
+func playLogCommand(binPath string, s sessionlog.Session) *exec.Cmd {
+	return exec.Command(binPath, "logs", "play", s.Recording)
+}
+
+// viewLogCommand pages one logged session through the logs command. Lines
+// logged without a session ID are selected by file instead.
+func viewLogCommand(binPath, alias string, s sessionlog.Session) *exec.Cmd {
+	args := []string{"logs", "show", alias, "--open"}
+	if s.ID != "" {
+		args = append(args, "--session", s.ID)
+	} else if len(s.Files) > 0 {
+		args = append(args, "--file", filepath.Base(s.Files[0]))
+	}
+	return exec.Command(binPath, args...)
+}
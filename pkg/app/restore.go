@@ -0,0 +1,62 @@
+package app
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"tmux-ssh-manager/pkg/sshconfig"
+)
+
+// runRestore lists the ssh config backups taken before every edit, or
+// writes one back.
+func runRestore(args []string, stdout io.Writer) error {
+	fs := newFlagSet("restore", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	list := fs.Bool("list", false, "list the backups, newest first")
+	jsonOut := fs.Bool("json", false, "list: output backups as JSON")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if *list {
+		backups, err := sshconfig.Backups()
+		if err != nil {
+			return err
+		}
+		if *jsonOut {
+			enc := json.NewEncoder(stdout)
+			enc.SetIndent("", "  ")
+			if backups == nil {
+				backups = []sshconfig.Backup{}
+			}
+			return enc.Encode(backups)
+		}
+		for _, backup := range backups {
+			files := make([]string, len(backup.Files))
+			for i, file := range backup.Files {
+				files[i] = file.Path
+			}
+			if _, err := fmt.Fprintf(stdout, "%s\t%s\t%s\t%s\n", backup.ID, backup.Created.Format("2006-01-02 15:04:05"), backup.Action, strings.Join(files, ",")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: tmux-ssh-manager restore --list [--json] | <id>")
+	}
+	id := strings.TrimSpace(positional[0])
+	current, err := sshconfig.Restore(id)
+	if err != nil {
+		return err
+	}
+	files := fmt.Sprintf("%d files", len(current.Files))
+	if len(current.Files) == 1 {
+		files = "1 file"
+	}
+	_, err = fmt.Fprintf(stdout, "restored %s (%s); undo with: tmux-ssh-manager restore %s\n", id, files, current.ID)
+	return err
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"tmux-ssh-manager/pkg/sshconfig"
+	"tmux-ssh-manager/pkg/state"
+)
+
+func runSet(args []string, stdout io.Writer) error {
+	usage := fmt.Errorf("usage: tmux-ssh-manager set <list|save|delete> [flags] [name]")
+	if len(args) == 0 {
+		return usage
+	}
+	action := strings.TrimSpace(args[0])
+
+	fs := newFlagSet("set", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	jsonOut := fs.Bool("json", false, "list: output sets as JSON")
+	hostsFlag := fs.String("hosts", "", "save: comma-separated host aliases")
+	positional, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return err
+	}
+
+	storePath, err := state.DefaultPath()
+	if err != nil {
+		return err
+	}
+	store, err := state.Load(storePath)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "list":
+		if *jsonOut {
+			enc := json.NewEncoder(stdout)
+			enc.SetIndent("", "  ")
+			sets := store.Sets
+			if sets == nil {
+				sets = []state.HostSet{}
+			}
+			return enc.Encode(sets)
+		}
+		for _, set := range store.Sets {
+			if _, err := fmt.Fprintf(stdout, "%s\t%s\n", set.Name, strings.Join(set.Aliases, ",")); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "save":
+		if len(positional) != 1 || strings.TrimSpace(*hostsFlag) == "" {
+			return fmt.Errorf("usage: tmux-ssh-manager set save --hosts a,b <name>")
+		}
+		set := state.HostSet{Name: positional[0], Aliases: splitAliases(*hostsFlag)}
+		if err := store.PutSet(set); err != nil {
+			return err
+		}
+		if err := state.Save(storePath, store); err != nil {
+			return err
+		}
+		set, _ = store.Set(set.Name)
+		_, err := fmt.Fprintf(stdout, "saved set %s (%d hosts)\n", set.Name, len(set.Aliases))
+		return err
+	case "delete":
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: tmux-ssh-manager set delete <name>")
+		}
+		if !store.DeleteSet(positional[0]) {
+			return fmt.Errorf("unknown set %q", positional[0])
+		}
+		if err := state.Save(storePath, store); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(stdout, "deleted set %s\n", positional[0])
+		return err
+	default:
+		return fmt.Errorf("unknown set action %q (expected list|save|delete)", action)
+	}
+}
+
+// setAliases returns the hosts of the named set that the ssh config still
+// defines, reporting the others on stderr.
+func setAliases(name string, stderr io.Writer) ([]string, error) {
+	store, err := state.Load("")
+	if err != nil {
+		return nil, err
+	}
+	set, ok := store.Set(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown set %q", name)
+	}
+	hosts, err := sshconfig.LoadDefault()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		known[h.Alias] = true
+	}
+	var aliases []string
+	for _, alias := range set.Aliases {
+		if !known[alias] {
+			fmt.Fprintf(stderr, "skipping %s: not in ssh config\n", alias)
+			continue
+		}
+		aliases = append(aliases, alias)
+	}
+	if len(aliases) == 0 {
+		return nil, fmt.Errorf("set %s has no hosts in ssh config", name)
+	}
+	return aliases, nil
+}
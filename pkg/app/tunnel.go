@@ -0,0 +1,305 @@
+package app
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tmux-ssh-manager/pkg/sshconfig"
+	"tmux-ssh-manager/pkg/state"
+	"tmux-ssh-manager/pkg/tmuxrun"
+	"tmux-ssh-manager/pkg/tunnel"
+)
+
+// tunnelManager starts and stops the background ssh tunnels recorded in the
+// state store.
+type tunnelManager struct {
+	store     *state.Store
+	storePath string
+	hosts     []sshconfig.Host
+	session   tmuxrun.Session
+}
+
+// active returns the recorded tunnels that are still running, forgetting the
+// ones whose process has exited.
+func (m tunnelManager) active() []state.Tunnel {
+	if removed := m.store.PruneTunnels(func(t state.Tunnel) bool { return tunnel.Running(t.PID, t.Process) }); len(removed) > 0 {
+		_ = state.Save(m.storePath, m.store)
+	}
+	return m.store.Tunnels
+}
+
+func (m tunnelManager) host(alias string) sshconfig.Host {
+	for _, h := range m.hosts {
+		if h.Alias == alias {
+			return h
+		}
+	}
+	return sshconfig.Host{Alias: alias}
+}
+
+// start opens a tunnel to alias with the given forwards plus the ones
+// configured for the host in ssh config, which ssh always opens as well. With
+// window set it runs in a background tmux window, otherwise as a detached
+// process.
+func (m tunnelManager) start(alias string, forwards []tunnel.Forward, window bool) (state.Tunnel, error) {
+	launch, err := m.prepare(alias, forwards, window)
+	if err != nil {
+		return state.Tunnel{}, err
+	}
+	record, err := launch()
+	if err != nil {
+		return state.Tunnel{}, err
+	}
+	return m.record(record)
+}
+
+// prepare checks the forwards of a tunnel to alias against the running
+// tunnels and the ports in use, and returns the function that starts ssh.
+// That function waits for ssh to come up and does not touch the store, so
+// the picker can run it in the background; record then adds the tunnel.
+func (m tunnelManager) prepare(alias string, forwards []tunnel.Forward, window bool) (func() (state.Tunnel, error), error) {
+	alias = strings.TrimSpace(alias)
+	forwards = tunnel.Merge(forwards, tunnel.Configured(m.host(alias)))
+	if len(forwards) == 0 {
+		return nil, fmt.Errorf("no forwards for %s: pass -L/-R/-D or add LocalForward to its ssh config", alias)
+	}
+
+	m.active()
+	var ports []int
+	for _, f := range forwards {
+		if !f.Local() {
+			continue
+		}
+		if existing, ok := m.store.TunnelOnPort(f.Port); ok {
+			return nil, fmt.Errorf("port %d is already forwarded by tunnel %s to %s", f.Port, existing.ID, existing.Alias)
+		}
+		if err := tunnel.CheckPort(f); err != nil {
+			return nil, err
+		}
+		ports = append(ports, f.Port)
+	}
+	if window && !tmuxrun.InTmux() {
+		return nil, fmt.Errorf("--window requires running inside tmux")
+	}
+
+	args := tunnel.Args(alias, forwards)
+	record := state.Tunnel{Alias: alias, Ports: ports, StartedAt: time.Now().UTC().Format(time.RFC3339)}
+	for _, f := range forwards {
+		record.Forwards = append(record.Forwards, f.String())
+	}
+	return func() (state.Tunnel, error) {
+		if window {
+			windowID, pid, err := m.session.BackgroundWindow("tunnel-"+alias, append([]string{"ssh"}, args...))
+			if err != nil {
+				return state.Tunnel{}, err
+			}
+			record.Window, record.PID = windowID, pid
+		} else {
+			logPath, err := tunnelLogPath(alias)
+			if err != nil {
+				return state.Tunnel{}, err
+			}
+			pid, err := tunnel.StartDetached(args, logPath)
+			if err != nil {
+				return state.Tunnel{}, err
+			}
+			record.PID = pid
+		}
+		record.Process = tunnel.Identity(record.PID)
+		return record, nil
+	}, nil
+}
+
+// record adds a started tunnel to the store and saves it.
+func (m tunnelManager) record(t state.Tunnel) (state.Tunnel, error) {
+	t = m.store.AddTunnel(t)
+	if err := state.Save(m.storePath, m.store); err != nil {
+		return t, err
+	}
+	return t, nil
+}
+
+func (m tunnelManager) stop(t state.Tunnel) error {
+	if err := tunnel.Stop(t.PID, t.Process); err != nil {
+		return err
+	}
+	m.store.RemoveTunnel(t.ID)
+	return state.Save(m.storePath, m.store)
+}
+
+// stopByID stops the tunnel with the given ID.
+func (m tunnelManager) stopByID(id string) error {
+	for _, t := range m.active() {
+		if t.ID == id {
+			return m.stop(t)
+		}
+	}
+	return fmt.Errorf("no active tunnel %q", id)
+}
+
+// tunnelLogPath is where a detached tunnel's ssh output goes, next to the
+// host's session logs.
+func tunnelLogPath(alias string) (string, error) {
+	dir, err := tmuxrun.LogDir(alias)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("create log dir: %w", err)
+	}
+	return filepath.Join(dir, "tunnel.log"), nil
+}
+
+type configuredForwards struct {
+	Alias    string   `json:"alias"`
+	Forwards []string `json:"forwards"`
+}
+
+func runTunnel(args []string, stdout io.Writer) error {
+	usage := fmt.Errorf("usage: tmux-ssh-manager tunnel <start|stop|list> [flags] [alias|id]")
+	if len(args) == 0 {
+		return usage
+	}
+	action := strings.TrimSpace(args[0])
+
+	fs := newFlagSet("tunnel", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	jsonOut := fs.Bool("json", false, "list: output as JSON")
+	configured := fs.Bool("configured", false, "list: show forwards configured in ssh config instead of running tunnels")
+	window := fs.Bool("window", false, "start: run the tunnel in a background tmux window")
+	all := fs.Bool("all", false, "stop: stop every tunnel")
+	var local, remote, dynamic stringList
+	fs.Var(&local, "L", "start: local forward [bind:]port:host:hostport (repeatable)")
+	fs.Var(&remote, "R", "start: remote forward [bind:]port:host:hostport (repeatable)")
+	fs.Var(&dynamic, "D", "start: dynamic SOCKS forward [bind:]port (repeatable)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	hosts, err := sshconfig.LoadDefault()
+	if err != nil {
+		return err
+	}
+	storePath, err := state.DefaultPath()
+	if err != nil {
+		return err
+	}
+	store, err := state.Load(storePath)
+	if err != nil {
+		return err
+	}
+	manager := tunnelManager{store: store, storePath: storePath, hosts: hosts}
+
+	switch action {
+	case "list":
+		if *configured {
+			entries := []configuredForwards{}
+			for _, h := range hosts {
+				entry := configuredForwards{Alias: h.Alias}
+				for _, f := range tunnel.Configured(h) {
+					entry.Forwards = append(entry.Forwards, f.String())
+				}
+				if len(entry.Forwards) > 0 {
+					entries = append(entries, entry)
+				}
+			}
+			if *jsonOut {
+				enc := json.NewEncoder(stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(entries)
+			}
+			for _, entry := range entries {
+				if _, err := fmt.Fprintf(stdout, "%s\t%s\n", entry.Alias, strings.Join(entry.Forwards, " ")); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		tunnels := manager.active()
+		if *jsonOut {
+			if tunnels == nil {
+				tunnels = []state.Tunnel{}
+			}
+			enc := json.NewEncoder(stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(tunnels)
+		}
+		for _, t := range tunnels {
+			if _, err := fmt.Fprintf(stdout, "%s\t%s\tpid %d\t%s\tsince %s\n", t.ID, t.Alias, t.PID, strings.Join(t.Forwards, " "), t.StartedAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "start":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: tmux-ssh-manager tunnel start [--window] [-L spec] [-R spec] [-D spec] <alias>")
+		}
+		var forwards []tunnel.Forward
+		for _, group := range []struct {
+			kind  string
+			specs []string
+		}{{"L", local}, {"R", remote}, {"D", dynamic}} {
+			for _, spec := range group.specs {
+				f, err := tunnel.ParseForward(group.kind, spec)
+				if err != nil {
+					return err
+				}
+				forwards = append(forwards, f)
+			}
+		}
+		t, err := manager.start(fs.Arg(0), forwards, *window)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(stdout, "started tunnel %s to %s (pid %d): %s\n", t.ID, t.Alias, t.PID, strings.Join(t.Forwards, " "))
+		return err
+	case "stop":
+		var targets []state.Tunnel
+		switch {
+		case *all:
+			targets = manager.active()
+		case fs.NArg() == 1:
+			targets = matchTunnels(manager.active(), strings.TrimSpace(fs.Arg(0)))
+			if len(targets) == 0 {
+				return fmt.Errorf("no active tunnel matches %q", fs.Arg(0))
+			}
+		default:
+			return fmt.Errorf("usage: tmux-ssh-manager tunnel stop <id|alias> | --all")
+		}
+		// Stopping mutates the store's slice, so work from a copy.
+		for _, t := range append([]state.Tunnel(nil), targets...) {
+			if err := manager.stop(t); err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(stdout, "stopped tunnel %s to %s\n", t.ID, t.Alias); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown tunnel action %q (expected start|stop|list)", action)
+	}
+}
+
+// matchTunnels selects the tunnel with the given ID, or else every tunnel to
+// the host alias.
+func matchTunnels(tunnels []state.Tunnel, target string) []state.Tunnel {
+	for _, t := range tunnels {
+		if t.ID == target {
+			return []state.Tunnel{t}
+		}
+	}
+	var out []state.Tunnel
+	for _, t := range tunnels {
+		if t.Alias == target {
+			out = append(out, t)
+		}
+	}
+	return out
+}
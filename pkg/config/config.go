@@ -0,0 +1,734 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"tmux-ssh-manager/pkg/reconnect"
+)
+
+// fileNames are the config files looked for, in order, in the config
+// directory.
+var fileNames = []string{"config.toml", "config.yaml", "config.yml"}
+
+// Config holds the tool's own settings from config.toml (or config.yaml).
+type Config struct {
+	Picker  Picker
+	SSH     SSH
+	Styles  []StyleRule
+	Logging Logging
+	Theme   Theme
+	Health  Health
+	// Themes are the custom themes of [themes.<name>] tables.
+	Themes []ThemeDef
+	// Keys rebind picker actions, in file order.
+	Keys []KeyBinding
+	// sources records where settings that differ from the defaults came
+	// from, by key ("picker.mode"); see Source.
+	sources map[string]string
+}
+
+// Picker holds the picker's defaults. Command-line flags, TSSM_* environment
+// variables and @tmux_ssh_manager_* tmux options override them; see
+// Settings.
+type Picker struct {
+	// Mode is "search" (type to filter) or "normal" (vim-style keys).
+	Mode string
+	// ImplicitSelect makes enter/v/s/w act on the highlighted host in search
+	// mode.
+	ImplicitSelect bool
+	// EnterMode is the enter key's action: p (pane), w (window), s (split-h)
+	// or v (split-v).
+	EnterMode         string
+	Reconnect         bool
+	ReconnectAttempts int
+	// Layout arranges multi-host windows: a tmux preset, main-left,
+	// main-top, COLSxROWS or a tmux layout string.
+	Layout string
+	// MaxPanes caps panes per window before spilling into a new window; 0
+	// means no limit.
+	MaxPanes int
+	// View is "list" or "tree" (hosts grouped by GroupBy: file, tag,
+	// bastion or domain).
+	View    string
+	GroupBy string
+	// Mouse lets clicks and the wheel drive the picker; off leaves the
+	// terminal's own text selection alone.
+	Mouse bool
+}
+
+// DefaultPicker holds the picker settings used when nothing overrides them.
+var DefaultPicker = Picker{
+	Mode:              "search",
+	ImplicitSelect:    true,
+	EnterMode:         "p",
+	ReconnectAttempts: reconnect.DefaultMaxAttempts,
+	Layout:            "tiled",
+	View:              "list",
+	GroupBy:           "file",
+	Mouse:             true,
+}
+
+// SSH configures how ssh is started.
+type SSH struct {
+	// AskpassOptions are passed to ssh as -o options when a stored password
+	// is supplied through SSH_ASKPASS. The defaults keep ssh from spending
+	// its authentication attempts on keys first.
+	AskpassOptions []string
+}
+
+// DefaultSSH holds the ssh settings used when config.toml leaves them out.
+var DefaultSSH = SSH{
+	AskpassOptions: []string{"PubkeyAuthentication=no", "PreferredAuthentications=keyboard-interactive,password"},
+}
+
+// Default returns the configuration used without a config file.
+func Default() *Config {
+	return &Config{Picker: DefaultPicker, SSH: DefaultSSH, Logging: DefaultLogging, Theme: DefaultTheme, Health: DefaultHealth}
+}
+
+// Logging configures session logs.
+type Logging struct {
+	// Format is "text" (timestamped, escape-free lines), "json" (one JSON
+	// object per line) or "raw" (pane bytes unchanged). Empty means "text".
+	Format string
+	// KeepRaw also keeps an unprocessed copy next to text and json logs.
+	KeepRaw bool
+	// Record also writes an asciicast recording of each connection.
+	Record bool
+	// MaxFileSize starts a new numbered file within the day once a log
+	// reaches it.
+	MaxFileSize int64
+	// MaxAgeDays, MaxHostSize and MaxTotalSize bound what "logs prune" keeps.
+	// 0 disables a limit.
+	MaxAgeDays   int
+	MaxHostSize  int64
+	MaxTotalSize int64
+	// Compress gzips logs from previous days when pruning.
+	Compress bool
+	// Redact lists extra regular expressions whose matches are removed from
+	// logs; RedactDefaults keeps the built-in patterns for common secrets.
+	Redact         []string
+	RedactDefaults bool
+	// RedactCredentials also removes the host's stored credentials, which
+	// each logged pane reads from the keychain.
+	RedactCredentials bool
+	// Policy is how hosts are logged unless a rule or the host's
+	// "# tssm:log" annotation says otherwise. Empty derives it from Format
+	// and Record.
+	Policy LogPolicy
+	Rules  []LogRule
+}
+
+// LogPolicy is how a host's sessions are logged.
+type LogPolicy string
+
+const (
+	LogOff LogPolicy = "off"
+	// LogText writes cleaned logs in the configured format (text or json).
+	LogText LogPolicy = "text"
+	// LogRaw writes the pane's bytes unchanged.
+	LogRaw LogPolicy = "raw"
+	// LogRecording writes cleaned logs plus an asciicast recording.
+	LogRecording LogPolicy = "recording"
+)
+
+// LogPolicies lists the policies in the order the picker cycles them.
+var LogPolicies = []LogPolicy{LogOff, LogText, LogRaw, LogRecording}
+
+func ParseLogPolicy(raw string) (LogPolicy, error) {
+	policy := LogPolicy(strings.ToLower(strings.TrimSpace(raw)))
+	for _, known := range LogPolicies {
+		if policy == known {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown log policy %q (expected off, text, raw or recording)", raw)
+}
+
+// LogRule sets the logging policy of matching hosts.
+type LogRule struct {
+	Name string
+	HostMatch
+	Policy LogPolicy
+	line   int
+}
+
+// DefaultLogging holds the logging settings used when config.toml leaves
+// them out.
+var DefaultLogging = Logging{
+	MaxFileSize:       10 << 20,
+	MaxAgeDays:        30,
+	MaxHostSize:       200 << 20,
+	MaxTotalSize:      1 << 30,
+	Compress:          true,
+	RedactDefaults:    true,
+	RedactCredentials: true,
+}
+
+// StyleRule styles the panes of hosts that carry one of Tags or whose alias
+// matches one of the Aliases glob patterns.
+type StyleRule struct {
+	Name string
+	HostMatch
+	Style
+	line int
+}
+
+// HostMatch selects hosts that carry one of Tags or whose alias matches one
+// of the Aliases glob patterns.
+type HostMatch struct {
+	Tags    []string
+	Aliases []string
+}
+
+// Style is how panes and windows of a matching host are decorated.
+type Style struct {
+	// Border is a tmux color ("red", "colour196", "#ff0000") or a full tmux
+	// style ("fg=red,bold") for the pane border.
+	Border string
+	// Title is the pane title; "{alias}" is replaced with the host alias.
+	Title string
+	// WindowPrefix is prepended to the names of windows holding the host.
+	WindowPrefix string
+	// Confirm asks before the picker connects to the host.
+	Confirm bool
+}
+
+// DefaultPath returns $TSSM_CONFIG if set, else the first of config.toml,
+// config.yaml and config.yml that exists in the config directory, else
+// config.toml.
+func DefaultPath() (string, error) {
+	if path := strings.TrimSpace(os.Getenv("TSSM_CONFIG")); path != "" {
+		return path, nil
+	}
+	dir := ""
+	if xdg := strings.TrimSpace(os.Getenv("XDG_CONFIG_HOME")); xdg != "" {
+		dir = filepath.Join(xdg, "tmux-ssh-manager")
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("resolve home: %w", err)
+		}
+		dir = filepath.Join(home, ".config", "tmux-ssh-manager")
+	}
+	for _, name := range fileNames {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return filepath.Join(dir, name), nil
+		}
+	}
+	return filepath.Join(dir, fileNames[0]), nil
+}
+
+// IsYAML reports whether path is read as YAML rather than TOML.
+func IsYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// Load reads the config at path (DefaultPath when empty), as YAML when it
+// ends in .yaml or .yml and as TOML otherwise. A missing file yields the
+// defaults.
+func Load(path string) (*Config, error) {
+	if strings.TrimSpace(path) == "" {
+		var err error
+		path, err = DefaultPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Default(), nil
+		}
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	parse := Parse
+	if IsYAML(path) {
+		parse = ParseYAML
+	}
+	cfg, err := parse(string(data))
+	if err != nil {
+		var perr *ParseError
+		if errors.As(err, &perr) {
+			perr.Path = path
+		}
+		return nil, err
+	}
+	for key, source := range cfg.sources {
+		if line, ok := strings.CutPrefix(source, "line "); ok {
+			cfg.sources[key] = path + ":" + line
+		}
+	}
+	for i, binding := range cfg.Keys {
+		if line, ok := strings.CutPrefix(binding.Source, "line "); ok {
+			cfg.Keys[i].Source = path + ":" + line
+		}
+	}
+	for i, def := range cfg.Themes {
+		if line, ok := strings.CutPrefix(def.Source, "line "); ok {
+			cfg.Themes[i].Source = path + ":" + line
+		}
+	}
+	return cfg, nil
+}
+
+// Parse decodes config.toml content.
+func Parse(data string) (*Config, error) {
+	entries, err := parseTOML(data)
+	if err != nil {
+		return nil, err
+	}
+	return decode(entries)
+}
+
+// ParseYAML decodes config.yaml content: the same settings as config.toml,
+// written as nested mappings.
+func ParseYAML(data string) (*Config, error) {
+	entries, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	return decode(entries)
+}
+
+func decode(entries []entry) (*Config, error) {
+	cfg := Default()
+	styles := map[string]int{}
+	logRules := map[string]int{}
+	themes := map[string]int{}
+	for _, e := range entries {
+		if len(e.Table) == 0 {
+			return nil, lineError(e.Line, "unknown key %q", e.Key)
+		}
+		switch e.Table[0] {
+		case "picker", "ssh", "theme", "health":
+			if len(e.Table) != 1 {
+				return nil, lineError(e.Line, "unknown section [%s]", strings.Join(e.Table, "."))
+			}
+			if err := cfg.set(e); err != nil {
+				return nil, err
+			}
+			cfg.setSource(e.Table[0]+"."+e.Key, fmt.Sprintf("line %d", e.Line))
+		case "keys":
+			if len(e.Table) != 1 {
+				return nil, lineError(e.Line, "key bindings belong in the [keys] table")
+			}
+			if err := cfg.setKey(e); err != nil {
+				return nil, err
+			}
+		case "themes":
+			if len(e.Table) != 2 {
+				return nil, lineError(e.Line, "theme settings belong in a [themes.<name>] table")
+			}
+			index, ok := themes[e.Table[1]]
+			if !ok {
+				index = len(cfg.Themes)
+				themes[e.Table[1]] = index
+				cfg.Themes = append(cfg.Themes, ThemeDef{Name: e.Table[1], Source: fmt.Sprintf("line %d", e.Line)})
+			}
+			if err := cfg.Themes[index].set(e); err != nil {
+				return nil, err
+			}
+		case "styles":
+			if len(e.Table) != 2 {
+				return nil, lineError(e.Line, "style settings belong in a [styles.<name>] table")
+			}
+			index, ok := styles[e.Table[1]]
+			if !ok {
+				index = len(cfg.Styles)
+				styles[e.Table[1]] = index
+				cfg.Styles = append(cfg.Styles, StyleRule{Name: e.Table[1], line: e.Line})
+			}
+			if err := cfg.Styles[index].set(e); err != nil {
+				return nil, err
+			}
+		case "logging":
+			switch {
+			case len(e.Table) == 1:
+				if err := cfg.set(e); err != nil {
+					return nil, err
+				}
+				cfg.setSource("logging."+e.Key, fmt.Sprintf("line %d", e.Line))
+			case len(e.Table) == 3 && e.Table[1] == "hosts":
+				index, ok := logRules[e.Table[2]]
+				if !ok {
+					index = len(cfg.Logging.Rules)
+					logRules[e.Table[2]] = index
+					cfg.Logging.Rules = append(cfg.Logging.Rules, LogRule{Name: e.Table[2], line: e.Line})
+				}
+				if err := cfg.Logging.Rules[index].set(e); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, lineError(e.Line, "unknown section [%s]", strings.Join(e.Table, "."))
+			}
+		default:
+			return nil, lineError(e.Line, "unknown section [%s]", strings.Join(e.Table, "."))
+		}
+	}
+	for _, rule := range cfg.Styles {
+		if len(rule.Tags) == 0 && len(rule.Aliases) == 0 {
+			return nil, lineError(rule.line, "style %q needs tags or aliases to match", rule.Name)
+		}
+	}
+	for _, rule := range cfg.Logging.Rules {
+		if len(rule.Tags) == 0 && len(rule.Aliases) == 0 {
+			return nil, lineError(rule.line, "logging rule %q needs tags or aliases to match", rule.Name)
+		}
+		if rule.Policy == "" {
+			return nil, lineError(rule.line, "logging rule %q needs a policy", rule.Name)
+		}
+	}
+	return cfg, nil
+}
+
+// set parses the tags and aliases keys, reporting whether e was one of them.
+func (m *HostMatch) set(e entry) (bool, error) {
+	var err error
+	switch e.Key {
+	case "tags":
+		m.Tags, err = asStrings(e)
+	case "aliases":
+		m.Aliases, err = asStrings(e)
+		for _, pattern := range m.Aliases {
+			if _, matchErr := path.Match(pattern, ""); matchErr != nil {
+				return true, lineError(e.Line, "invalid alias pattern %q", pattern)
+			}
+		}
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+func (r *StyleRule) set(e entry) error {
+	if ok, err := r.HostMatch.set(e); ok {
+		return err
+	}
+	var err error
+	switch e.Key {
+	case "border":
+		r.Border, err = asString(e)
+	case "title":
+		r.Title, err = asString(e)
+	case "window_prefix":
+		r.WindowPrefix, err = asString(e)
+	case "confirm":
+		r.Confirm, err = asBool(e)
+	default:
+		return lineError(e.Line, "unknown style setting %q", e.Key)
+	}
+	return err
+}
+
+// set applies a key of the picker, ssh, logging, theme or health section.
+func (c *Config) set(e entry) error {
+	switch e.Table[0] {
+	case "picker":
+		return c.Picker.set(e)
+	case "ssh":
+		return c.SSH.set(e)
+	case "theme":
+		return c.Theme.set(e)
+	case "health":
+		return c.Health.set(e)
+	default:
+		return c.Logging.set(e)
+	}
+}
+
+func (p *Picker) set(e entry) error {
+	var err error
+	switch e.Key {
+	case "mode":
+		p.Mode, err = asString(e)
+		if err == nil && p.Mode != "search" && p.Mode != "normal" {
+			err = lineError(e.Line, "mode must be search or normal")
+		}
+	case "implicit_select":
+		p.ImplicitSelect, err = asBool(e)
+	case "enter_mode":
+		p.EnterMode, err = asString(e)
+		switch p.EnterMode {
+		case "p", "pane", "w", "window", "s", "split", "split-h", "v", "split-v":
+		default:
+			if err == nil {
+				err = lineError(e.Line, "enter_mode must be p, w, s or v")
+			}
+		}
+	case "reconnect":
+		p.Reconnect, err = asBool(e)
+	case "reconnect_attempts":
+		var n int64
+		n, err = asInt(e)
+		p.ReconnectAttempts = int(n)
+	case "layout":
+		p.Layout, err = asString(e)
+		if err == nil && strings.TrimSpace(p.Layout) == "" {
+			err = lineError(e.Line, "layout must not be empty")
+		}
+	case "max_panes":
+		var n int64
+		n, err = asInt(e)
+		p.MaxPanes = int(n)
+	case "view":
+		p.View, err = asString(e)
+		if err == nil && p.View != "list" && p.View != "tree" {
+			err = lineError(e.Line, "view must be list or tree")
+		}
+	case "group_by":
+		p.GroupBy, err = asString(e)
+		switch p.GroupBy {
+		case "file", "tag", "bastion", "domain":
+		default:
+			if err == nil {
+				err = lineError(e.Line, "group_by must be file, tag, bastion or domain")
+			}
+		}
+	case "mouse":
+		p.Mouse, err = asBool(e)
+	default:
+		return lineError(e.Line, "unknown picker setting %q", e.Key)
+	}
+	return err
+}
+
+func (s *SSH) set(e entry) error {
+	if e.Key != "askpass_options" {
+		return lineError(e.Line, "unknown ssh setting %q", e.Key)
+	}
+	var err error
+	s.AskpassOptions, err = asStrings(e)
+	for _, option := range s.AskpassOptions {
+		if err == nil && !strings.Contains(option, "=") {
+			err = lineError(e.Line, "askpass option %q must look like Name=value", option)
+		}
+	}
+	return err
+}
+
+func (l *Logging) set(e entry) error {
+	var err error
+	switch e.Key {
+	case "format":
+		l.Format, err = asString(e)
+		switch l.Format {
+		case "text", "json", "raw":
+		default:
+			if err == nil {
+				err = lineError(e.Line, "format must be text, json or raw")
+			}
+		}
+	case "keep_raw":
+		l.KeepRaw, err = asBool(e)
+	case "record":
+		l.Record, err = asBool(e)
+	case "max_file_size":
+		l.MaxFileSize, err = asSize(e)
+	case "max_age_days":
+		var days int64
+		days, err = asInt(e)
+		l.MaxAgeDays = int(days)
+	case "max_host_size":
+		l.MaxHostSize, err = asSize(e)
+	case "max_total_size":
+		l.MaxTotalSize, err = asSize(e)
+	case "compress":
+		l.Compress, err = asBool(e)
+	case "redact":
+		l.Redact, err = asStrings(e)
+		for _, pattern := range l.Redact {
+			if err != nil {
+				break
+			}
+			if _, cerr := regexp.Compile(pattern); cerr != nil {
+				err = lineError(e.Line, "invalid redact pattern %q: %v", pattern, cerr)
+			}
+		}
+	case "redact_defaults":
+		l.RedactDefaults, err = asBool(e)
+	case "redact_credentials":
+		l.RedactCredentials, err = asBool(e)
+	case "policy":
+		l.Policy, err = asLogPolicy(e)
+	default:
+		return lineError(e.Line, "unknown logging setting %q", e.Key)
+	}
+	return err
+}
+
+func (r *LogRule) set(e entry) error {
+	if ok, err := r.HostMatch.set(e); ok {
+		return err
+	}
+	if e.Key != "policy" {
+		return lineError(e.Line, "unknown logging rule setting %q", e.Key)
+	}
+	var err error
+	r.Policy, err = asLogPolicy(e)
+	return err
+}
+
+func asLogPolicy(e entry) (LogPolicy, error) {
+	raw, err := asString(e)
+	if err != nil {
+		return "", err
+	}
+	policy, err := ParseLogPolicy(raw)
+	if err != nil {
+		return "", lineError(e.Line, "%v", err)
+	}
+	return policy, nil
+}
+
+// PolicyFor returns how a host is logged: its "# tssm:log" annotation if
+// valid, else the first matching rule, else the default policy.
+func (l Logging) PolicyFor(alias string, tags []string, annotation string) LogPolicy {
+	if policy, err := ParseLogPolicy(annotation); err == nil {
+		return policy
+	}
+	for _, rule := range l.Rules {
+		if rule.Matches(alias, tags) {
+			return rule.Policy
+		}
+	}
+	return l.DefaultPolicy()
+}
+
+// DefaultPolicy is Policy, or the policy implied by Format and Record.
+func (l Logging) DefaultPolicy() LogPolicy {
+	switch {
+	case l.Policy != "":
+		return l.Policy
+	case l.Record:
+		return LogRecording
+	case l.Format == "raw":
+		return LogRaw
+	default:
+		return LogText
+	}
+}
+
+// StyleFor returns the style of the first rule matching the host, or the
+// zero Style.
+func (c *Config) StyleFor(alias string, tags []string) Style {
+	if c == nil {
+		return Style{}
+	}
+	for _, rule := range c.Styles {
+		if rule.Matches(alias, tags) {
+			return rule.Style
+		}
+	}
+	return Style{}
+}
+
+// Matches reports whether the host with alias and tags is selected.
+func (m HostMatch) Matches(alias string, tags []string) bool {
+	for _, want := range m.Tags {
+		for _, tag := range tags {
+			if strings.EqualFold(want, tag) {
+				return true
+			}
+		}
+	}
+	for _, pattern := range m.Aliases {
+		if ok, _ := path.Match(pattern, alias); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PaneTitle renders the title template for alias.
+func (s Style) PaneTitle(alias string) string {
+	return strings.ReplaceAll(s.Title, "{alias}", alias)
+}
+
+func asString(e entry) (string, error) {
+	value, ok := e.Value.(string)
+	if !ok {
+		return "", lineError(e.Line, "%s must be a string", e.Key)
+	}
+	return value, nil
+}
+
+// asStrings accepts a single string or an array of strings.
+func asStrings(e entry) ([]string, error) {
+	switch value := e.Value.(type) {
+	case string:
+		return []string{value}, nil
+	case []any:
+		out := make([]string, 0, len(value))
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return nil, lineError(e.Line, "%s must be a list of strings", e.Key)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	default:
+		return nil, lineError(e.Line, "%s must be a list of strings", e.Key)
+	}
+}
+
+func asInt(e entry) (int64, error) {
+	value, ok := e.Value.(int64)
+	if !ok || value < 0 {
+		return 0, lineError(e.Line, "%s must be a non-negative integer", e.Key)
+	}
+	return value, nil
+}
+
+var sizeUnits = map[string]int64{"": 1, "b": 1, "k": 1 << 10, "kb": 1 << 10, "m": 1 << 20, "mb": 1 << 20, "g": 1 << 30, "gb": 1 << 30}
+
+// asSize accepts a byte count or a string such as "512KB", "10MB" or "1GB"
+// (binary multiples).
+func asSize(e entry) (int64, error) {
+	if _, ok := e.Value.(int64); ok {
+		return asInt(e)
+	}
+	raw, ok := e.Value.(string)
+	if !ok {
+		return 0, lineError(e.Line, "%s must be a size such as \"10MB\"", e.Key)
+	}
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	digits := strings.TrimRight(raw, "bkmg ")
+	unit, ok := sizeUnits[strings.TrimSpace(raw[len(digits):])]
+	n, err := strconv.ParseInt(strings.TrimSpace(digits), 10, 64)
+	if !ok || err != nil || n < 0 {
+		return 0, lineError(e.Line, "%s must be a size such as \"10MB\"", e.Key)
+	}
+	return n * unit, nil
+}
+
+// asDuration accepts a number of seconds or a string such as "30s" or "5m".
+func asDuration(e entry) (time.Duration, error) {
+	if n, ok := e.Value.(int64); ok && n >= 0 {
+		return time.Duration(n) * time.Second, nil
+	}
+	raw, _ := e.Value.(string)
+	d, err := time.ParseDuration(strings.TrimSpace(raw))
+	if err != nil || d < 0 {
+		return 0, lineError(e.Line, "%s must be a duration such as \"30s\" or \"5m\"", e.Key)
+	}
+	return d, nil
+}
+
+func asBool(e entry) (bool, error) {
+	value, ok := e.Value.(bool)
+	if !ok {
+		return false, lineError(e.Line, "%s must be true or false", e.Key)
+	}
+	return value, nil
+}
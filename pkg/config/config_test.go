@@ -0,0 +1,626 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleConfig = `
+# Production hosts get a red border and a confirmation prompt.
+[styles.prod]
+tags = ["prod", "production"]
+aliases = [
+  "*-prod",   # suffix match
+  "prod-*",
+]
+border = "red"
+title = "PROD {alias}"
+window_prefix = "!"
+confirm = true
+
+[styles.staging]
+aliases = "stg-*"
+border = 'fg=yellow,bold'
+`
+
+func TestParseStyles(t *testing.T) {
+	cfg, err := Parse(sampleConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Styles) != 2 {
+		t.Fatalf("expected 2 styles, got %d", len(cfg.Styles))
+	}
+	prod := cfg.Styles[0]
+	if prod.Name != "prod" || !prod.Confirm || prod.Border != "red" || prod.WindowPrefix != "!" {
+		t.Fatalf("unexpected prod style: %+v", prod)
+	}
+	if !reflect.DeepEqual(prod.Aliases, []string{"*-prod", "prod-*"}) {
+		t.Fatalf("unexpected aliases: %v", prod.Aliases)
+	}
+	if cfg.Styles[1].Border != "fg=yellow,bold" || !reflect.DeepEqual(cfg.Styles[1].Aliases, []string{"stg-*"}) {
+		t.Fatalf("unexpected staging style: %+v", cfg.Styles[1])
+	}
+}
+
+func TestStyleForMatchesTagsThenAliases(t *testing.T) {
+	cfg, err := Parse(sampleConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.StyleFor("db1", []string{"PROD"}); got.Border != "red" {
+		t.Fatalf("expected tag match, got %+v", got)
+	}
+	if got := cfg.StyleFor("api-prod", nil); !got.Confirm {
+		t.Fatalf("expected alias match, got %+v", got)
+	}
+	if got := cfg.StyleFor("stg-web", nil); got.Border != "fg=yellow,bold" {
+		t.Fatalf("expected staging style, got %+v", got)
+	}
+	if got := cfg.StyleFor("dev1", []string{"dev"}); got != (Style{}) {
+		t.Fatalf("expected no style, got %+v", got)
+	}
+	var nilConfig *Config
+	if got := nilConfig.StyleFor("api-prod", nil); got != (Style{}) {
+		t.Fatalf("expected nil config to yield no style, got %+v", got)
+	}
+}
+
+func TestPaneTitle(t *testing.T) {
+	if got := (Style{Title: "PROD {alias}"}).PaneTitle("db1"); got != "PROD db1" {
+		t.Fatalf("unexpected title %q", got)
+	}
+}
+
+func TestParseErrorsIncludeLine(t *testing.T) {
+	tests := []struct {
+		input string
+		line  string
+		msg   string
+	}{
+		{"[styles.prod]\nborder = red\n", "line 2", "expected value"},
+		{"[styles.prod]\ntags = [\"a\"]\ncolour = \"red\"\n", "line 3", "unknown style setting"},
+		{"[colors]\nfoo = 1\n", "line 2", "unknown section"},
+		{"[styles.prod]\nborder = \"red\"\n", "line 2", "needs tags or aliases"},
+		{"[styles.prod]\ntags = \"a\"\ntags = \"b\"\n", "line 3", "already been defined"},
+		{"[styles.prod]\nconfirm = \"yes\"\n", "line 2", "must be true or false"},
+		{"[[styles]]\n", "line 1", "arrays of tables"},
+		{"[logging]\nredact = [{a = 1}]\n", "line 2", "tables inside arrays"},
+		{"[styles.prod]\naliases = [\"[\"]\n", "line 2", "invalid alias pattern"},
+		{"[logging]\nformat = \"xml\"\n", "line 2", "format must be text, json or raw"},
+		{"[logging]\nrotate = 1\n", "line 2", "unknown logging setting"},
+		{"[logging]\nmax_file_size = \"10 parsecs\"\n", "line 2", "must be a size"},
+		{"[logging]\nmax_age_days = -1\n", "line 2", "non-negative integer"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input)
+		if err == nil {
+			t.Errorf("Parse(%q) expected error", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.line) || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("Parse(%q) error = %q, want %s containing %q", tt.input, err, tt.line, tt.msg)
+		}
+	}
+}
+
+func TestParseTOMLValues(t *testing.T) {
+	entries, err := parseTOML("a = \"x\\ty # not a comment\"\nb = 1_000\nc = false\nd = []\n[t.\"quoted key\"]\ne = 'lit\\eral'\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []any{"x\ty # not a comment", int64(1000), false, []any{}, `lit\eral`}
+	for i, e := range entries {
+		if !reflect.DeepEqual(e.Value, want[i]) {
+			t.Errorf("entry %d (%s) = %#v, want %#v", i, e.Key, e.Value, want[i])
+		}
+	}
+	if got := entries[4].Table; !reflect.DeepEqual(got, []string{"t", "quoted key"}) {
+		t.Fatalf("unexpected table path %v", got)
+	}
+}
+
+func TestLoadMissingFileReturnsDefaults(t *testing.T) {
+	cfg, err := Load(filepath.Join(t.TempDir(), "missing.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Styles) != 0 {
+		t.Fatalf("expected no styles, got %+v", cfg.Styles)
+	}
+}
+
+func TestLoadReportsPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("bogus\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Load(path)
+	if err == nil || !strings.HasPrefix(err.Error(), path+":1:") {
+		t.Fatalf("expected path-prefixed error, got %v", err)
+	}
+}
+
+func TestDefaultPathUsesXDG(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	got, err := DefaultPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(tmp, "tmux-ssh-manager", "config.toml"); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestParseLogging(t *testing.T) {
+	cfg, err := Parse("[logging]\nformat = \"json\"\nkeep_raw = true\nrecord = true\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Logging.Format != "json" || !cfg.Logging.KeepRaw || !cfg.Logging.Record {
+		t.Fatalf("unexpected logging config %+v", cfg.Logging)
+	}
+}
+
+func TestParseLoggingRedact(t *testing.T) {
+	cfg, err := Parse("[logging]\nredact = ['token=\\w+', 'secret-\\d+']\nredact_defaults = false\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.Logging.Redact, []string{`token=\w+`, `secret-\d+`}) || cfg.Logging.RedactDefaults {
+		t.Fatalf("unexpected redact config %+v", cfg.Logging)
+	}
+	if _, err := Parse("[logging]\nredact = ['(unclosed']\n"); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected line error for invalid pattern, got %v", err)
+	}
+}
+
+func TestParseLoggingLimits(t *testing.T) {
+	cfg, err := Parse("[logging]\nmax_file_size = \"5MB\"\nmax_host_size = 1024\nmax_total_size = \"2 GB\"\nmax_age_days = 0\ncompress = false\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Logging{MaxFileSize: 5 << 20, MaxHostSize: 1024, MaxTotalSize: 2 << 30, RedactDefaults: true, RedactCredentials: true}
+	if !reflect.DeepEqual(cfg.Logging, want) {
+		t.Fatalf("got %+v, want %+v", cfg.Logging, want)
+	}
+	defaults, err := Parse("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(defaults.Logging, DefaultLogging) {
+		t.Fatalf("expected defaults, got %+v", defaults.Logging)
+	}
+}
+
+func TestParseHealth(t *testing.T) {
+	cfg, err := Parse("[health]\nenabled = false\nttl = \"10m\"\ntimeout = 2\nconcurrency = 4\nbanner = false\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Health{TTL: 10 * time.Minute, Timeout: 2 * time.Second, Concurrency: 4}
+	if cfg.Health != want {
+		t.Fatalf("got %+v, want %+v", cfg.Health, want)
+	}
+	if !strings.Contains(cfg.Render(false), "[health]\nenabled = false\nttl = \"10m0s\"\ntimeout = \"2s\"\nconcurrency = 4\nbanner = false\n") {
+		t.Fatalf("unexpected rendering:\n%s", cfg.Render(false))
+	}
+	for input, want := range map[string]string{
+		"[health]\nttl = \"soon\"\n":   `line 2: ttl must be a duration such as "30s" or "5m"`,
+		"[health]\ntimeout = \"0s\"\n": "line 2: timeout must be positive",
+		"[health]\nconcurrency = 0\n":  "line 2: concurrency must be at least 1",
+		"[health]\nport = 22\n":        `line 2: unknown health setting "port"`,
+	} {
+		if _, err := Parse(input); err == nil || err.Error() != want {
+			t.Errorf("Parse(%q) = %v, want %q", input, err, want)
+		}
+	}
+}
+
+func TestLoggingPolicyRules(t *testing.T) {
+	cfg, err := Parse(`
+[logging]
+policy = "text"
+
+[logging.hosts.prod]
+tags = ["prod"]
+policy = "recording"
+
+[logging.hosts.scratch]
+aliases = ["tmp-*"]
+policy = "off"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		alias, annotation string
+		tags              []string
+		want              LogPolicy
+	}{
+		{"db1", "", []string{"prod"}, LogRecording},
+		{"tmp-1", "", nil, LogOff},
+		{"web1", "", nil, LogText},
+		{"db1", "raw", []string{"prod"}, LogRaw},
+		{"db1", "bogus", []string{"prod"}, LogRecording},
+	} {
+		if got := cfg.Logging.PolicyFor(tc.alias, tc.tags, tc.annotation); got != tc.want {
+			t.Fatalf("PolicyFor(%s, %v, %q) = %s, want %s", tc.alias, tc.tags, tc.annotation, got, tc.want)
+		}
+	}
+}
+
+func TestDefaultLogPolicyFollowsFormat(t *testing.T) {
+	if got := (Logging{Format: "raw"}).DefaultPolicy(); got != LogRaw {
+		t.Fatalf("expected raw, got %s", got)
+	}
+	if got := (Logging{Format: "json", Record: true}).DefaultPolicy(); got != LogRecording {
+		t.Fatalf("expected recording, got %s", got)
+	}
+	if got := DefaultLogging.DefaultPolicy(); got != LogText {
+		t.Fatalf("expected text, got %s", got)
+	}
+}
+
+func TestLoggingRuleErrors(t *testing.T) {
+	for input, want := range map[string]string{
+		"[logging.hosts.a]\ntags = [\"x\"]\npolicy = \"loud\"\n": "line 3: unknown log policy",
+		"[logging.hosts.a]\ntags = [\"x\"]\n":                    "needs a policy",
+		"[logging.hosts.a]\npolicy = \"off\"\n":                  "needs tags or aliases",
+		"[logging]\npolicy = \"sometimes\"\n":                    "line 2",
+	} {
+		if _, err := Parse(input); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("Parse(%q): expected %q, got %v", input, want, err)
+		}
+	}
+}
+
+func TestParsePicker(t *testing.T) {
+	cfg, err := Parse("[picker]\nmode = \"normal\"\nimplicit_select = false\nenter_mode = \"window\"\nreconnect = true\nreconnect_attempts = 3\nlayout = \"2x3\"\nmax_panes = 6\nview = \"tree\"\ngroup_by = \"bastion\"\nmouse = false\n\n[ssh]\naskpass_options = [\"PreferredAuthentications=password\"]\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Picker{Mode: "normal", EnterMode: "window", Reconnect: true, ReconnectAttempts: 3, Layout: "2x3", MaxPanes: 6, View: "tree", GroupBy: "bastion"}
+	if cfg.Picker != want {
+		t.Fatalf("got %+v, want %+v", cfg.Picker, want)
+	}
+	if !reflect.DeepEqual(cfg.SSH.AskpassOptions, []string{"PreferredAuthentications=password"}) {
+		t.Fatalf("unexpected ssh settings %+v", cfg.SSH)
+	}
+	defaults, err := Parse("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defaults.Picker != DefaultPicker || !reflect.DeepEqual(defaults.SSH, DefaultSSH) {
+		t.Fatalf("expected defaults, got %+v %+v", defaults.Picker, defaults.SSH)
+	}
+	for input, want := range map[string]string{
+		"[picker]\nmode = \"vim\"\n":                "line 2: mode must be search or normal",
+		"[picker]\nenter_mode = \"x\"\n":            "line 2: enter_mode must be p, w, s or v",
+		"[picker]\nzoom = true\n":                   "line 2: unknown picker setting",
+		"[picker]\nview = \"grid\"\n":               "line 2: view must be list or tree",
+		"[picker]\ngroup_by = \"owner\"\n":          "line 2: group_by must be file, tag, bastion or domain",
+		"[ssh]\naskpass_options = [\"-v\"]\n":       "line 2: askpass option \"-v\" must look like Name=value",
+		"[picker.extra]\nmode = \"normal\"\n":       "unknown section [picker.extra]",
+		"[picker]\nreconnect_attempts = \"many\"\n": "non-negative integer",
+	} {
+		if _, err := Parse(input); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%q): expected %q, got %v", input, want, err)
+		}
+	}
+}
+
+const sampleYAML = `---
+# The same settings as sampleConfig, plus logging.
+styles:
+  prod:
+    tags: [prod, "production"]
+    aliases:
+      - "*-prod"   # suffix match
+      - prod-*
+    border: red
+    title: 'PROD {alias}'
+    window_prefix: "!"
+    confirm: true
+  staging:
+    aliases: stg-*
+    border: fg=yellow,bold
+logging:
+  format: json
+  max_file_size: 5MB
+  hosts:
+    scratch:
+      aliases: [tmp-*]
+      policy: off
+`
+
+func TestParseYAMLMatchesTOML(t *testing.T) {
+	fromYAML, err := ParseYAML(sampleYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromTOML, err := Parse(sampleConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fromYAML.Styles) != len(fromTOML.Styles) {
+		t.Fatalf("expected %d styles, got %d", len(fromTOML.Styles), len(fromYAML.Styles))
+	}
+	for i := range fromTOML.Styles {
+		y, want := fromYAML.Styles[i], fromTOML.Styles[i]
+		y.line, want.line = 0, 0
+		if !reflect.DeepEqual(y, want) {
+			t.Fatalf("style %d: got %+v, want %+v", i, y, want)
+		}
+	}
+	l := fromYAML.Logging
+	if l.Format != "json" || l.MaxFileSize != 5<<20 || len(l.Rules) != 1 || l.Rules[0].Policy != LogOff {
+		t.Fatalf("unexpected logging %+v", l)
+	}
+}
+
+func TestParseYAMLErrorsIncludeLine(t *testing.T) {
+	for input, want := range map[string]string{
+		"picker:\n  mode: normal\n   layout: tiled\n": "line 3: mapping values are not allowed",
+		"picker:\n\tmode: normal\n":                   "line 2: found character that cannot start any token",
+		"picker:\nlogging:\n  format: text\n":         "line 1: missing value for \"picker\"",
+		"picker:\n  mode: {a: b}\n":                   "line 2: unknown section [picker.mode]",
+		"picker:\n  mode: normal\n  mode: search\n":   "line 3: duplicate key",
+		"picker:\n  mode normal\n":                    "line 1: unknown key \"picker\"",
+		"logging:\n  redact:\n  - a\n  -  - b\n":      "line 4: lists may only hold plain values",
+		"logging:\n  format: 'json\n":                 "line 2: found unexpected end of stream",
+		"ssh:\n  bogus: 1\n":                          "line 2: unknown ssh setting",
+	} {
+		if _, err := ParseYAML(input); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseYAML(%q): expected %q, got %v", input, want, err)
+		}
+	}
+}
+
+func TestParseYAMLValues(t *testing.T) {
+	entries, err := parseYAML("a: \"x\\ty # not a comment\"\nb: 1000\nc: false\nd: []\nt:\n  'quoted key':\n    e: it''s # comment\n    f: 'it''s'\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []any{"x\ty # not a comment", int64(1000), false, []any{}, "it''s", "it's"}
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), entries)
+	}
+	for i, e := range entries {
+		if !reflect.DeepEqual(e.Value, want[i]) {
+			t.Errorf("entry %d (%s) = %#v, want %#v", i, e.Key, e.Value, want[i])
+		}
+	}
+	if got := entries[4].Table; !reflect.DeepEqual(got, []string{"t", "quoted key"}) {
+		t.Fatalf("unexpected table path %v", got)
+	}
+}
+
+func TestLoadYAMLAndDefaultPath(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+	t.Setenv("TSSM_CONFIG", "")
+	dir := filepath.Join(tmp, "tmux-ssh-manager")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	yamlPath := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(yamlPath, []byte("picker:\n  mode: normal\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := DefaultPath(); got != yamlPath {
+		t.Fatalf("expected existing YAML file, got %q", got)
+	}
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Picker.Mode != "normal" || cfg.Source("picker.mode") != yamlPath+":2" {
+		t.Fatalf("unexpected picker %+v from %s", cfg.Picker, cfg.Source("picker.mode"))
+	}
+	tomlPath := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(tomlPath, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := DefaultPath(); got != tomlPath {
+		t.Fatalf("expected config.toml to win, got %q", got)
+	}
+	t.Setenv("TSSM_CONFIG", "/etc/tssm.yaml")
+	if got, _ := DefaultPath(); got != "/etc/tssm.yaml" {
+		t.Fatalf("expected TSSM_CONFIG, got %q", got)
+	}
+}
+
+func TestOverride(t *testing.T) {
+	cfg := Default()
+	for key, value := range map[string]string{
+		"picker.reconnect":       "on",
+		"picker.max_panes":       "4",
+		"picker.layout":          "main-left",
+		"logging.policy":         "off",
+		"logging.record":         "yes",
+		"picker.enter_mode":      "v",
+		"picker.mode":            " normal ",
+		"picker.implicit_select": "false",
+		"picker.view":            "tree",
+		"picker.group_by":        "domain",
+		"picker.mouse":           "yes",
+		"health.enabled":         "off",
+	} {
+		if err := cfg.Override(key, value, "env TEST"); err != nil {
+			t.Fatalf("Override(%s, %q): %v", key, value, err)
+		}
+	}
+	want := Picker{Mode: "normal", EnterMode: "v", Reconnect: true, ReconnectAttempts: DefaultPicker.ReconnectAttempts, Layout: "main-left", MaxPanes: 4, View: "tree", GroupBy: "domain", Mouse: true}
+	if cfg.Picker != want || cfg.Logging.Policy != LogOff || !cfg.Logging.Record || cfg.Health.Enabled {
+		t.Fatalf("unexpected config %+v %+v", cfg.Picker, cfg.Logging)
+	}
+	if got := cfg.Source("picker.layout"); got != "env TEST" {
+		t.Fatalf("unexpected source %q", got)
+	}
+	if err := cfg.Override("picker.reconnect", "sometimes", "flag --reconnect"); err == nil || err.Error() != "flag --reconnect: reconnect must be true or false" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := cfg.Override("styles.border", "red", "env TEST"); err == nil {
+		t.Fatal("expected error for a key without overrides")
+	}
+	if s, ok := SettingForFlag("m"); !ok || s.Key != "picker.mode" || s.Env() != "TSSM_MODE" || s.TmuxOption() != "@tmux_ssh_manager_mode" {
+		t.Fatalf("unexpected setting %+v", s)
+	}
+}
+
+func TestRenderRoundTrips(t *testing.T) {
+	cfg, err := ParseYAML(sampleYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Picker.Layout = "main-left"
+	cfg.Logging.Redact = []string{`token="\w+"`}
+	rendered := cfg.Render(false)
+	again, err := Parse(rendered)
+	if err != nil {
+		t.Fatalf("rendered config does not parse: %v\n%s", err, rendered)
+	}
+	if again.Picker != cfg.Picker || !reflect.DeepEqual(again.SSH, cfg.SSH) {
+		t.Fatalf("picker/ssh changed: %+v %+v", again.Picker, again.SSH)
+	}
+	for _, l := range []*Logging{&cfg.Logging, &again.Logging} {
+		for i := range l.Rules {
+			l.Rules[i].line = 0
+		}
+	}
+	if !reflect.DeepEqual(again.Logging, cfg.Logging) {
+		t.Fatalf("logging changed:\n%+v\n%+v", again.Logging, cfg.Logging)
+	}
+	if len(again.Styles) != 2 || again.Styles[0].Title != "PROD {alias}" || !again.Styles[0].Confirm {
+		t.Fatalf("styles changed: %+v", again.Styles)
+	}
+	if !strings.Contains(cfg.Render(true), "layout = \"main-left\"  # default") {
+		t.Fatalf("expected annotated output:\n%s", cfg.Render(true))
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	toml := "[keys]\nsplit-v = [\"V\", \"ctrl+v\"]\ntop = \"g  g\"\nfavorite = []\n"
+	yaml := "keys:\n  split-v:\n    - V\n    - ctrl+v\n  top: g  g\n  favorite: []\n"
+	want := []KeyBinding{
+		{Action: "split-v", Keys: []string{"V", "ctrl+v"}},
+		{Action: "top", Keys: []string{"g g"}},
+		{Action: "favorite", Keys: []string{}},
+	}
+	for name, parse := range map[string]func(string) (*Config, error){"toml": Parse, "yaml": ParseYAML} {
+		input := toml
+		if name == "yaml" {
+			input = yaml
+		}
+		cfg, err := parse(input)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for i := range cfg.Keys {
+			if cfg.Keys[i].Source == "" {
+				t.Fatalf("%s: binding %q has no source", name, cfg.Keys[i].Action)
+			}
+			cfg.Keys[i].Source = ""
+		}
+		if !reflect.DeepEqual(cfg.Keys, want) {
+			t.Fatalf("%s: unexpected keys %#v", name, cfg.Keys)
+		}
+		if rendered := cfg.Render(false); !strings.Contains(rendered, "[keys]\nsplit-v = [\"V\", \"ctrl+v\"]\ntop = [\"g g\"]\nfavorite = []\n") {
+			t.Fatalf("%s: unexpected rendered keys:\n%s", name, rendered)
+		}
+	}
+
+	for input, want := range map[string]string{
+		"[keys]\ntop = \"gg\"\n":            `line 2: top: unknown key "gg" (separate the keys of a sequence with spaces, e.g. "g g")`,
+		"[keys]\ntop = \"hyper+g\"\n":       `line 2: top: unknown key "hyper+g"`,
+		"[keys]\ntop = [\"\"]\n":            "line 2: top: empty key sequence",
+		"[keys]\ntop = 1\n":                 "line 2",
+		"[keys.extra]\ntop = \"g\"\n":       "line 2: key bindings belong in the [keys] table",
+		"[keys]\nquit = \"ctrl+shift+q\"\n": `line 2: quit: unknown key "ctrl+shift+q"`,
+	} {
+		if _, err := Parse(input); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%q): expected %q, got %v", input, want, err)
+		}
+	}
+}
+
+func TestParseThemes(t *testing.T) {
+	cfg, err := Parse(`
+[theme]
+name = "ocean"
+light = "paper"
+colors = 256
+
+[themes.ocean]
+base = "nord"
+selected = "fg=#ffffff,bg=#005f87,bold"
+help = 245
+
+[themes.paper]
+base = "light"
+warn = "brightred,underscore"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Theme{Name: "ocean", Dark: "dark", Light: "paper", Colors: "256"}
+	if cfg.Theme != want {
+		t.Fatalf("unexpected theme %+v", cfg.Theme)
+	}
+	ocean, ok := cfg.ThemeDef("ocean")
+	if !ok || ocean.Base != "nord" || ocean.Source != "line 8" {
+		t.Fatalf("unexpected theme def %+v", ocean)
+	}
+	if got := ocean.Styles["selected"]; got != (TextStyle{Fg: "#ffffff", Bg: "#005f87", Bold: true}) {
+		t.Fatalf("unexpected selected style %+v", got)
+	}
+	if got := ocean.Styles["help"]; got != (TextStyle{Fg: "245"}) {
+		t.Fatalf("unexpected help style %+v", got)
+	}
+	paper, _ := cfg.ThemeDef("paper")
+	if got := paper.Styles["warn"]; got != (TextStyle{Fg: "9", Underline: true}) {
+		t.Fatalf("unexpected warn style %+v", got)
+	}
+	if rendered := cfg.Render(false); !strings.Contains(rendered, "[themes.ocean]\nbase = \"nord\"\nhelp = \"fg=245\"\nselected = \"fg=#ffffff,bg=#005f87,bold\"\n") {
+		t.Fatalf("unexpected rendered themes:\n%s", rendered)
+	}
+
+	for input, want := range map[string]string{
+		"[theme]\ncolors = \"million\"\n":        "line 2: colors must be auto, truecolor, 256, 16 or none",
+		"[theme]\nname = \"\"\n":                 "line 2: name must not be empty",
+		"[theme]\nfont = \"mono\"\n":             `line 2: unknown theme setting "font"`,
+		"[themes.x]\nborder = \"red\"\n":         `line 2: unknown theme element "border"`,
+		"[themes.x]\nhelp = \"fg=#12345\"\n":     `line 2: help: bad color "#12345"`,
+		"[themes.x]\nhelp = \"fg=300\"\n":        "line 2: help: color 300 out of range 0-255",
+		"[themes.x]\nhelp = \"blink\"\n":         `line 2: help: unknown style "blink"`,
+		"[themes]\nhelp = \"red\"\n":             "line 2: theme settings belong in a [themes.<name>] table",
+		"[themes.x.y]\nhelp = \"red\"\n":         "line 2: theme settings belong in a [themes.<name>] table",
+		"[themes.x]\nselected = \"bg=purple\"\n": `line 2: selected: unknown color "purple"`,
+	} {
+		if _, err := Parse(input); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%q): expected %q, got %v", input, want, err)
+		}
+	}
+}
+
+func TestParseTOMLLines(t *testing.T) {
+	entries, err := parseTOML("# comment\n[picker]\nmode = \"normal\"\n\n[styles.prod]\ntags = [\n  \"a\",\n]\nstyles.dev.border = \"red\"\n[logging]\nhosts.x = { policy = \"off\" }\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, fmt.Sprintf("%s.%s:%d", strings.Join(e.Table, "."), e.Key, e.Line))
+	}
+	want := []string{"picker.mode:3", "styles.prod.tags:6", "styles.prod.styles.dev.border:9", "logging.hosts.x.policy:11"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
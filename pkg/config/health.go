@@ -0,0 +1,51 @@
+package config
+
+import "time"
+
+// Health configures the picker's reachability checks.
+type Health struct {
+	// Enabled runs checks when the picker opens. Checks open connections
+	// to every host, so they are off unless asked for.
+	Enabled bool
+	// TTL is how long a host's last check is reused before it is checked
+	// again.
+	TTL time.Duration
+	// Timeout bounds a single check.
+	Timeout time.Duration
+	// Concurrency caps the checks running at once.
+	Concurrency int
+	// Banner waits for the ssh identification line instead of only opening
+	// the TCP connection.
+	Banner bool
+}
+
+// DefaultHealth holds the health check settings used when nothing overrides
+// them.
+var DefaultHealth = Health{Enabled: false, TTL: 5 * time.Minute, Timeout: 3 * time.Second, Concurrency: 8, Banner: true}
+
+func (h *Health) set(e entry) error {
+	var err error
+	switch e.Key {
+	case "enabled":
+		h.Enabled, err = asBool(e)
+	case "ttl":
+		h.TTL, err = asDuration(e)
+	case "timeout":
+		h.Timeout, err = asDuration(e)
+		if err == nil && h.Timeout <= 0 {
+			err = lineError(e.Line, "timeout must be positive")
+		}
+	case "concurrency":
+		var n int64
+		n, err = asInt(e)
+		if err == nil && n < 1 {
+			err = lineError(e.Line, "concurrency must be at least 1")
+		}
+		h.Concurrency = int(n)
+	case "banner":
+		h.Banner, err = asBool(e)
+	default:
+		return lineError(e.Line, "unknown health setting %q", e.Key)
+	}
+	return err
+}
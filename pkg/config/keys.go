@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// KeyBinding binds a picker action to keys, replacing its default keys. An
+// empty Keys leaves the action unbound.
+type KeyBinding struct {
+	Action string
+	// Keys are key sequences such as "v", "ctrl+d" or "g g" (g, then g),
+	// in the form ParseKeySequence accepts.
+	Keys []string
+	// Source is where the binding was configured, for error messages: the
+	// config file's "<path>:<line>" ("line N" for Parse).
+	Source string
+}
+
+// namedKeys are the keys written by name rather than as the character they
+// type.
+var namedKeys = map[string]bool{
+	"enter": true, "esc": true, "tab": true, "space": true, "backspace": true,
+	"delete": true, "insert": true, "up": true, "down": true, "left": true,
+	"right": true, "home": true, "end": true, "pgup": true, "pgdown": true,
+}
+
+// ParseKeySequence splits a key sequence into its keys, written the way the
+// picker names them: a single character ("v", "G", "?"), a named key
+// ("enter", "space", "pgdown", "f5") or a modified one ("ctrl+d", "alt+x",
+// "shift+tab"). Keys of a sequence are separated by spaces.
+func ParseKeySequence(raw string) ([]string, error) {
+	keys := strings.Fields(raw)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("empty key sequence")
+	}
+	for _, key := range keys {
+		if !validKey(key) {
+			if utf8.RuneCountInString(key) > 1 && !strings.Contains(key, "+") {
+				return nil, fmt.Errorf("unknown key %q (separate the keys of a sequence with spaces, e.g. %q)", key, strings.Join(strings.Split(key, ""), " "))
+			}
+			return nil, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return keys, nil
+}
+
+func validKey(key string) bool {
+	if utf8.RuneCountInString(key) == 1 {
+		return key != " "
+	}
+	if namedKeys[key] {
+		return true
+	}
+	if rest, ok := strings.CutPrefix(key, "f"); ok {
+		if n, err := strconv.Atoi(rest); err == nil && strconv.Itoa(n) == rest && n >= 1 && n <= 20 {
+			return true
+		}
+	}
+	if rest, ok := strings.CutPrefix(key, "alt+"); ok {
+		return validKey(rest)
+	}
+	if rest, ok := strings.CutPrefix(key, "ctrl+"); ok {
+		if rest, ok := strings.CutPrefix(rest, "shift+"); ok {
+			return rest == "up" || rest == "down" || rest == "left" || rest == "right" || rest == "home" || rest == "end"
+		}
+		if len(rest) == 1 {
+			return rest[0] >= 'a' && rest[0] <= 'z' || strings.Contains(`@[\]^_`, rest)
+		}
+		return rest == "up" || rest == "down" || rest == "left" || rest == "right" || rest == "home" || rest == "end" || rest == "pgup" || rest == "pgdown"
+	}
+	if rest, ok := strings.CutPrefix(key, "shift+"); ok {
+		return rest == "tab" || rest == "up" || rest == "down" || rest == "left" || rest == "right" || rest == "home" || rest == "end"
+	}
+	return false
+}
+
+// setKey parses one "action = keys" entry of the [keys] section.
+func (c *Config) setKey(e entry) error {
+	sequences, err := asStrings(e)
+	if err != nil {
+		return err
+	}
+	binding := KeyBinding{Action: e.Key, Keys: []string{}, Source: fmt.Sprintf("line %d", e.Line)}
+	for _, sequence := range sequences {
+		keys, err := ParseKeySequence(sequence)
+		if err != nil {
+			return lineError(e.Line, "%s: %v", e.Key, err)
+		}
+		binding.Keys = append(binding.Keys, strings.Join(keys, " "))
+	}
+	c.Keys = append(c.Keys, binding)
+	return nil
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Render writes c as config.toml content. With annotate set, every setting
+// of the picker, ssh, logging, theme and health sections is followed by a
+// comment naming where its value came from (see Source).
+func (c *Config) Render(annotate bool) string {
+	var b strings.Builder
+	section := func(name string) {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "[%s]\n", name)
+	}
+	setting := func(key, value string) {
+		name := key[strings.IndexByte(key, '.')+1:]
+		if annotate {
+			fmt.Fprintf(&b, "%s = %s  # %s\n", name, value, c.Source(key))
+		} else {
+			fmt.Fprintf(&b, "%s = %s\n", name, value)
+		}
+	}
+
+	section("picker")
+	p := c.Picker
+	setting("picker.mode", tomlString(p.Mode))
+	setting("picker.implicit_select", strconv.FormatBool(p.ImplicitSelect))
+	setting("picker.enter_mode", tomlString(p.EnterMode))
+	setting("picker.reconnect", strconv.FormatBool(p.Reconnect))
+	setting("picker.reconnect_attempts", strconv.Itoa(p.ReconnectAttempts))
+	setting("picker.layout", tomlString(p.Layout))
+	setting("picker.max_panes", strconv.Itoa(p.MaxPanes))
+	setting("picker.view", tomlString(p.View))
+	setting("picker.group_by", tomlString(p.GroupBy))
+	setting("picker.mouse", strconv.FormatBool(p.Mouse))
+
+	section("ssh")
+	setting("ssh.askpass_options", tomlStrings(c.SSH.AskpassOptions))
+
+	section("logging")
+	l := c.Logging
+	format := l.Format
+	if format == "" {
+		format = "text"
+	}
+	setting("logging.format", tomlString(format))
+	setting("logging.keep_raw", strconv.FormatBool(l.KeepRaw))
+	setting("logging.record", strconv.FormatBool(l.Record))
+	if l.Policy != "" {
+		setting("logging.policy", tomlString(string(l.Policy)))
+	}
+	setting("logging.max_file_size", tomlSize(l.MaxFileSize))
+	setting("logging.max_age_days", strconv.Itoa(l.MaxAgeDays))
+	setting("logging.max_host_size", tomlSize(l.MaxHostSize))
+	setting("logging.max_total_size", tomlSize(l.MaxTotalSize))
+	setting("logging.compress", strconv.FormatBool(l.Compress))
+	setting("logging.redact", tomlStrings(l.Redact))
+	setting("logging.redact_defaults", strconv.FormatBool(l.RedactDefaults))
+	setting("logging.redact_credentials", strconv.FormatBool(l.RedactCredentials))
+
+	section("theme")
+	setting("theme.name", tomlString(c.Theme.Name))
+	setting("theme.dark", tomlString(c.Theme.Dark))
+	setting("theme.light", tomlString(c.Theme.Light))
+	setting("theme.colors", tomlString(c.Theme.Colors))
+
+	section("health")
+	h := c.Health
+	setting("health.enabled", strconv.FormatBool(h.Enabled))
+	setting("health.ttl", tomlString(h.TTL.String()))
+	setting("health.timeout", tomlString(h.Timeout.String()))
+	setting("health.concurrency", strconv.Itoa(h.Concurrency))
+	setting("health.banner", strconv.FormatBool(h.Banner))
+
+	for _, rule := range l.Rules {
+		section("logging.hosts." + tomlKey(rule.Name))
+		writeHostMatch(&b, rule.HostMatch)
+		fmt.Fprintf(&b, "policy = %s\n", tomlString(string(rule.Policy)))
+	}
+	for _, rule := range c.Styles {
+		section("styles." + tomlKey(rule.Name))
+		writeHostMatch(&b, rule.HostMatch)
+		if rule.Border != "" {
+			fmt.Fprintf(&b, "border = %s\n", tomlString(rule.Border))
+		}
+		if rule.Title != "" {
+			fmt.Fprintf(&b, "title = %s\n", tomlString(rule.Title))
+		}
+		if rule.WindowPrefix != "" {
+			fmt.Fprintf(&b, "window_prefix = %s\n", tomlString(rule.WindowPrefix))
+		}
+		if rule.Confirm {
+			b.WriteString("confirm = true\n")
+		}
+	}
+	for _, def := range c.Themes {
+		section("themes." + tomlKey(def.Name))
+		if def.Base != "" {
+			fmt.Fprintf(&b, "base = %s\n", tomlString(def.Base))
+		}
+		for _, element := range ThemeElements {
+			if style, ok := def.Styles[element]; ok {
+				fmt.Fprintf(&b, "%s = %s\n", element, tomlString(style.String()))
+			}
+		}
+	}
+	if len(c.Keys) > 0 {
+		section("keys")
+		for _, binding := range c.Keys {
+			fmt.Fprintf(&b, "%s = %s\n", tomlKey(binding.Action), tomlStrings(binding.Keys))
+		}
+	}
+	return b.String()
+}
+
+func writeHostMatch(b *strings.Builder, m HostMatch) {
+	if len(m.Tags) > 0 {
+		fmt.Fprintf(b, "tags = %s\n", tomlStrings(m.Tags))
+	}
+	if len(m.Aliases) > 0 {
+		fmt.Fprintf(b, "aliases = %s\n", tomlStrings(m.Aliases))
+	}
+}
+
+func tomlKey(name string) string {
+	if isBareKey(name) {
+		return name
+	}
+	return tomlString(name)
+}
+
+func isBareKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// tomlString quotes s as a TOML basic string.
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func tomlStrings(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = tomlString(v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// tomlSize writes whole multiples of KB, MB and GB the way they are usually
+// configured.
+func tomlSize(n int64) string {
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if n > 0 && n%unit.size == 0 {
+			return tomlString(strconv.FormatInt(n/unit.size, 10) + unit.suffix)
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Setting is a config key that can also be set outside the config file.
+// Sources take precedence in this order: command-line flag, environment
+// variable, tmux option, config file, built-in default.
+type Setting struct {
+	// Key is the setting's "section.key" in the config file.
+	Key string
+	// Name derives the environment variable (TSSM_<NAME>) and the tmux
+	// option (@tmux_ssh_manager_<name>).
+	Name string
+	// Flags are the picker's command-line flags for the setting, if any.
+	Flags []string
+}
+
+// Env is the environment variable that overrides the setting.
+func (s Setting) Env() string {
+	return "TSSM_" + strings.ToUpper(s.Name)
+}
+
+// TmuxOption is the global tmux option that overrides the setting.
+func (s Setting) TmuxOption() string {
+	return "@tmux_ssh_manager_" + s.Name
+}
+
+// Settings lists the settings that flags, environment variables and tmux
+// options can override.
+var Settings = []Setting{
+	{Key: "picker.mode", Name: "mode", Flags: []string{"mode", "m"}},
+	{Key: "picker.implicit_select", Name: "implicit_select", Flags: []string{"implicit-select"}},
+	{Key: "picker.enter_mode", Name: "enter_mode", Flags: []string{"enter-mode"}},
+	{Key: "picker.reconnect", Name: "reconnect", Flags: []string{"reconnect"}},
+	{Key: "picker.reconnect_attempts", Name: "reconnect_attempts", Flags: []string{"reconnect-attempts"}},
+	{Key: "picker.layout", Name: "layout", Flags: []string{"layout"}},
+	{Key: "picker.max_panes", Name: "max_panes", Flags: []string{"max-panes"}},
+	{Key: "picker.view", Name: "view", Flags: []string{"view"}},
+	{Key: "picker.group_by", Name: "group_by", Flags: []string{"group-by"}},
+	{Key: "picker.mouse", Name: "mouse", Flags: []string{"mouse"}},
+	{Key: "logging.format", Name: "log_format"},
+	{Key: "logging.policy", Name: "log_policy"},
+	{Key: "logging.record", Name: "log_record"},
+	{Key: "theme.name", Name: "theme", Flags: []string{"theme"}},
+	{Key: "theme.colors", Name: "colors", Flags: []string{"colors"}},
+	{Key: "health.enabled", Name: "health", Flags: []string{"health"}},
+}
+
+// SettingForFlag returns the setting a picker flag sets.
+func SettingForFlag(flag string) (Setting, bool) {
+	for _, s := range Settings {
+		for _, name := range s.Flags {
+			if name == flag {
+				return s, true
+			}
+		}
+	}
+	return Setting{}, false
+}
+
+// Override sets key from a string value, as given by a flag, environment
+// variable or tmux option. source names where it came from (for example
+// "env TSSM_MODE") and prefixes errors.
+func (c *Config) Override(key, raw, source string) error {
+	section, name, ok := strings.Cut(key, ".")
+	if !ok || (section != "picker" && section != "ssh" && section != "logging" && section != "theme" && section != "health") {
+		return fmt.Errorf("%s: unknown setting %q", source, key)
+	}
+	e := entry{Table: []string{section}, Key: name, Value: overrideValue(raw)}
+	err := c.set(e)
+	if _, isString := e.Value.(string); err != nil && !isString {
+		// "off" is a log policy as well as a boolean.
+		e.Value = strings.TrimSpace(raw)
+		err = c.set(e)
+	}
+	if err != nil {
+		var perr *ParseError
+		if errors.As(err, &perr) {
+			return fmt.Errorf("%s: %s", source, perr.Msg)
+		}
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	c.setSource(key, source)
+	return nil
+}
+
+// overrideValue types a string the way the config file would: booleans
+// (including on/off and yes/no, as tmux options are usually written),
+// integers, and strings for everything else. Override falls back to the
+// plain string when the setting wants one.
+func overrideValue(raw string) any {
+	raw = strings.TrimSpace(raw)
+	switch strings.ToLower(raw) {
+	case "true", "on", "yes":
+		return true
+	case "false", "off", "no":
+		return false
+	}
+	if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return n
+	}
+	return raw
+}
+
+// Source describes where key's value came from: "default", the config
+// file's "<path>:<line>" ("line N" for Parse), or the source passed to
+// Override.
+func (c *Config) Source(key string) string {
+	if source, ok := c.sources[key]; ok {
+		return source
+	}
+	return "default"
+}
+
+func (c *Config) setSource(key, source string) {
+	if c.sources == nil {
+		c.sources = map[string]string{}
+	}
+	c.sources[key] = source
+}
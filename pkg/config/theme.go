@@ -0,0 +1,223 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Theme selects the picker's colors.
+type Theme struct {
+	// Name is a built-in or [themes.<name>] theme, or "auto" to pick Dark or
+	// Light from the terminal's background.
+	Name string
+	// Dark and Light are the themes "auto" chooses between.
+	Dark  string
+	Light string
+	// Colors is the color depth: "auto" (from the environment), "truecolor",
+	// "256", "16" or "none" (attributes only, as with NO_COLOR).
+	Colors string
+}
+
+// DefaultTheme holds the theme settings used when nothing overrides them.
+var DefaultTheme = Theme{Name: "auto", Dark: "dark", Light: "light", Colors: "auto"}
+
+// ThemeElements are the parts of the picker a theme styles.
+var ThemeElements = []string{"help", "status", "selected", "favorite", "dim", "warn", "prompt", "placeholder", "group", "up", "down"}
+
+// ThemeDef is a [themes.<name>] table: a style per element, with the rest
+// taken from Base.
+type ThemeDef struct {
+	Name string
+	// Base is the theme elements left out are taken from; empty means
+	// "dark".
+	Base   string
+	Styles map[string]TextStyle
+	// Source is where the table starts, for error messages: the config
+	// file's "<path>:<line>" ("line N" for Parse).
+	Source string
+}
+
+// TextStyle is a style written the way tmux writes them: "fg=#d0d0d0,
+// bg=24,bold". A bare color ("241") sets the foreground and "default" is no
+// style. Colors are 0-255, #rgb or #rrggbb, or one of the sixteen ANSI names
+// ("red", "brightblue").
+type TextStyle struct {
+	Fg, Bg                                  string
+	Bold, Faint, Italic, Underline, Reverse bool
+}
+
+var ansiColors = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// ParseTextStyle parses a style.
+func ParseTextStyle(raw string) (TextStyle, error) {
+	var s TextStyle
+	if strings.TrimSpace(raw) == "" {
+		return s, fmt.Errorf("empty style")
+	}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		name, value, hasValue := strings.Cut(part, "=")
+		var err error
+		switch {
+		case hasValue && name == "fg":
+			s.Fg, err = parseColor(value)
+		case hasValue && name == "bg":
+			s.Bg, err = parseColor(value)
+		case part == "default":
+		case part == "bold":
+			s.Bold = true
+		case part == "dim" || part == "faint":
+			s.Faint = true
+		case part == "italics" || part == "italic":
+			s.Italic = true
+		case part == "underscore" || part == "underline":
+			s.Underline = true
+		case part == "reverse":
+			s.Reverse = true
+		case !hasValue:
+			if s.Fg, err = parseColor(part); err != nil {
+				err = fmt.Errorf("unknown style %q (expected a color, fg=, bg=, bold, dim, italics, underscore or reverse)", part)
+			}
+		default:
+			err = fmt.Errorf("unknown style %q", part)
+		}
+		if err != nil {
+			return TextStyle{}, err
+		}
+	}
+	return s, nil
+}
+
+// parseColor normalizes a color: ANSI names become their 0-15 number.
+func parseColor(raw string) (string, error) {
+	color := strings.ToLower(strings.TrimSpace(raw))
+	if rest, ok := strings.CutPrefix(color, "#"); ok {
+		if len(rest) == 3 || len(rest) == 6 {
+			if _, err := strconv.ParseUint(rest, 16, 32); err == nil {
+				return color, nil
+			}
+		}
+		return "", fmt.Errorf("bad color %q (expected #rgb or #rrggbb)", raw)
+	}
+	if n, err := strconv.Atoi(color); err == nil {
+		if n < 0 || n > 255 {
+			return "", fmt.Errorf("color %d out of range 0-255", n)
+		}
+		return strconv.Itoa(n), nil
+	}
+	name, bright := strings.CutPrefix(color, "bright")
+	for i, ansi := range ansiColors {
+		if name == ansi {
+			if bright {
+				i += 8
+			}
+			return strconv.Itoa(i), nil
+		}
+	}
+	return "", fmt.Errorf("unknown color %q", raw)
+}
+
+// String writes s back in the form ParseTextStyle reads.
+func (s TextStyle) String() string {
+	var parts []string
+	if s.Fg != "" {
+		parts = append(parts, "fg="+s.Fg)
+	}
+	if s.Bg != "" {
+		parts = append(parts, "bg="+s.Bg)
+	}
+	for _, attr := range []struct {
+		on   bool
+		name string
+	}{{s.Bold, "bold"}, {s.Faint, "dim"}, {s.Italic, "italics"}, {s.Underline, "underscore"}, {s.Reverse, "reverse"}} {
+		if attr.on {
+			parts = append(parts, attr.name)
+		}
+	}
+	if len(parts) == 0 {
+		return "default"
+	}
+	return strings.Join(parts, ",")
+}
+
+func (t *Theme) set(e entry) error {
+	if e.Key == "colors" {
+		colors, err := asString(e)
+		if n, ok := e.Value.(int64); ok {
+			// colors = 256 needs no quotes.
+			colors, err = strconv.FormatInt(n, 10), nil
+		}
+		if err != nil {
+			return err
+		}
+		switch colors {
+		case "auto", "truecolor", "256", "16", "none":
+			t.Colors = colors
+			return nil
+		}
+		return lineError(e.Line, "colors must be auto, truecolor, 256, 16 or none")
+	}
+	var field *string
+	switch e.Key {
+	case "name":
+		field = &t.Name
+	case "dark":
+		field = &t.Dark
+	case "light":
+		field = &t.Light
+	default:
+		return lineError(e.Line, "unknown theme setting %q", e.Key)
+	}
+	value, err := asString(e)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(value) == "" {
+		return lineError(e.Line, "%s must not be empty", e.Key)
+	}
+	*field = value
+	return nil
+}
+
+func (d *ThemeDef) set(e entry) error {
+	if e.Key == "base" {
+		var err error
+		d.Base, err = asString(e)
+		return err
+	}
+	known := false
+	for _, element := range ThemeElements {
+		known = known || element == e.Key
+	}
+	if !known {
+		return lineError(e.Line, "unknown theme element %q (expected base or one of %s)", e.Key, strings.Join(ThemeElements, ", "))
+	}
+	raw, err := asString(e)
+	if n, ok := e.Value.(int64); ok {
+		// A bare 256-color number needs no quotes.
+		raw, err = strconv.FormatInt(n, 10), nil
+	}
+	if err != nil {
+		return err
+	}
+	style, err := ParseTextStyle(raw)
+	if err != nil {
+		return lineError(e.Line, "%s: %v", e.Key, err)
+	}
+	if d.Styles == nil {
+		d.Styles = map[string]TextStyle{}
+	}
+	d.Styles[e.Key] = style
+	return nil
+}
+
+// ThemeDef returns the [themes.<name>] table called name.
+func (c *Config) ThemeDef(name string) (ThemeDef, bool) {
+	for _, def := range c.Themes {
+		if def.Name == name {
+			return def, true
+		}
+	}
+	return ThemeDef{}, false
+}
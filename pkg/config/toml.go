@@ -0,0 +1,154 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// entry is one key/value pair of a config file, in file order.
+type entry struct {
+	Table []string
+	Key   string
+	Value any // string, int64, bool or []any
+	Line  int
+}
+
+// ParseError reports a problem at a specific line of a config file.
+type ParseError struct {
+	Path string
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Msg)
+}
+
+func lineError(line int, format string, args ...any) error {
+	return &ParseError{Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parseTOML decodes data and flattens it into its keys, in file order.
+// Arrays of tables are not supported.
+func parseTOML(data string) ([]entry, error) {
+	var doc map[string]any
+	md, err := toml.Decode(data, &doc)
+	if err != nil {
+		var perr toml.ParseError
+		if errors.As(err, &perr) {
+			return nil, lineError(perr.Position.Line, "%s", perr.Message)
+		}
+		return nil, err
+	}
+	lines := tomlLines{lines: strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")}
+	var entries []entry
+	for _, key := range md.Keys() {
+		switch md.Type(key...) {
+		case "Hash":
+			if !lines.table(key) {
+				lines.value(key) // an inline table
+			}
+			continue
+		case "ArrayHash":
+			lines.table(key)
+			return nil, lineError(lines.line(), "arrays of tables are not supported")
+		}
+		lines.value(key)
+		value := any(doc)
+		for _, part := range key {
+			table, ok := value.(map[string]any)
+			if !ok {
+				return nil, lineError(lines.line(), "tables inside arrays are not supported")
+			}
+			value = table[part]
+		}
+		entries = append(entries, entry{
+			Table: append([]string(nil), key[:len(key)-1]...),
+			Key:   key[len(key)-1],
+			Value: value,
+			Line:  lines.line(),
+		})
+	}
+	return entries, nil
+}
+
+// tomlLines finds the lines of decoded keys, which the toml package does not
+// report. Keys come in file order, so each is looked for after the previous
+// one; a key that cannot be found (inside an inline table, say) keeps the
+// line of the previous one.
+type tomlLines struct {
+	lines []string
+	next  int // index of the line after the last key found
+}
+
+// table looks for the [table] or [[table]] header of key.
+func (l *tomlLines) table(key []string) bool {
+	for i := l.next; i < len(l.lines); i++ {
+		line := strings.TrimSpace(l.lines[i])
+		if !strings.HasPrefix(line, "[") {
+			continue
+		}
+		name, _, _ := strings.Cut(strings.TrimLeft(line, "["), "]")
+		if slices.Equal(splitKey(name), key) {
+			l.next = i + 1
+			return true
+		}
+	}
+	return false
+}
+
+// value looks for the key = value pair of key, which is in the current
+// table: the search stops at the next table header.
+func (l *tomlLines) value(key []string) bool {
+	for i := l.next; i < len(l.lines); i++ {
+		line := strings.TrimSpace(l.lines[i])
+		if strings.HasPrefix(line, "[") {
+			break
+		}
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			continue
+		}
+		parts := splitKey(line[:eq])
+		if len(parts) <= len(key) && slices.Equal(parts, key[len(key)-len(parts):]) {
+			l.next = i + 1
+			return true
+		}
+	}
+	return false
+}
+
+// line is the line of the last key found.
+func (l *tomlLines) line() int {
+	return max(l.next, 1)
+}
+
+// splitKey splits a dotted key such as styles."prod db".border.
+func splitKey(raw string) []string {
+	var parts []string
+	var part strings.Builder
+	var quote byte
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			part.WriteByte(c)
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '.':
+			parts = append(parts, strings.TrimSpace(part.String()))
+			part.Reset()
+		default:
+			part.WriteByte(c)
+		}
+	}
+	return append(parts, strings.TrimSpace(part.String()))
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlErrorLine matches the "yaml: line N: message" errors of the yaml
+// package.
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// parseYAML decodes data and flattens its nested mappings into keys, in file
+// order. Values are scalars or lists of scalars.
+func parseYAML(data string) ([]entry, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(data), &doc); err != nil {
+		if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			return nil, lineError(line, "%s", m[2])
+		}
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	var entries []entry
+	if err := walkYAML(doc.Content[0], nil, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func walkYAML(node *yaml.Node, table []string, entries *[]entry) error {
+	if node.Kind != yaml.MappingNode {
+		return lineError(node.Line, "expected key: value")
+	}
+	seen := map[string]int{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if first, ok := seen[key.Value]; ok {
+			return lineError(key.Line, "duplicate key %q (first set on line %d)", key.Value, first)
+		}
+		seen[key.Value] = key.Line
+		if value.Kind == yaml.AliasNode {
+			value = value.Alias
+		}
+		if value.Kind == yaml.MappingNode {
+			if err := walkYAML(value, append(table[:len(table):len(table)], key.Value), entries); err != nil {
+				return err
+			}
+			continue
+		}
+		if value.ShortTag() == "!!null" {
+			return lineError(key.Line, "missing value for %q", key.Value)
+		}
+		v, err := yamlValue(value)
+		if err != nil {
+			return err
+		}
+		*entries = append(*entries, entry{Table: append([]string(nil), table...), Key: key.Value, Value: v, Line: key.Line})
+	}
+	return nil
+}
+
+// yamlValue converts a scalar, or a list of scalars, to the types entries
+// hold.
+func yamlValue(node *yaml.Node) (any, error) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	switch node.Kind {
+	case yaml.SequenceNode:
+		items := []any{}
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode && item.Kind != yaml.AliasNode {
+				return nil, lineError(item.Line, "lists may only hold plain values")
+			}
+			value, err := yamlValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	case yaml.ScalarNode:
+	default:
+		return nil, lineError(node.Line, "unexpected value")
+	}
+	var value any = node.Value
+	var err error
+	switch node.ShortTag() {
+	case "!!bool":
+		var b bool
+		err = node.Decode(&b)
+		value = b
+	case "!!int":
+		var n int64
+		err = node.Decode(&n)
+		value = n
+	case "!!float":
+		var f float64
+		err = node.Decode(&f)
+		value = f
+	case "!!null":
+		err = fmt.Errorf("missing value")
+	}
+	if err != nil {
+		return nil, lineError(node.Line, "%v", err)
+	}
+	return value, nil
+}
@@ -16,22 +16,58 @@ var runSecurityCommand = defaultRunSecurityCommand
 var promptSecret = defaultPromptSecret
 
 func Set(host, user, kind string) error {
-	host, err := normalizeHost(host)
-	if err != nil {
-		return err
+	return SetMany([]string{host}, user, kind)
+}
+
+// SetMany prompts for the secret once and stores it for every host.
+func SetMany(hosts []string, user, kind string) error {
+	if len(hosts) == 0 {
+		return fmt.Errorf("host is required")
+	}
+	hosts = append([]string(nil), hosts...)
+	for i := range hosts {
+		host, err := normalizeHost(hosts[i])
+		if err != nil {
+			return err
+		}
+		hosts[i] = host
 	}
 	kind = normalizeKind(kind)
-	user = normalizeUser(host, user)
 
-	secret, err := promptSecret(fmt.Sprintf("Enter %s for %s", kind, itemLabel(host, user, kind)))
+	label := itemLabel(hosts[0], normalizeUser(hosts[0], user), kind)
+	if len(hosts) > 1 {
+		label = fmt.Sprintf("%s for %d hosts (%s)", kind, len(hosts), strings.Join(hosts, ", "))
+	}
+	secret, err := promptSecret("Enter " + label)
 	if err != nil {
 		return err
 	}
 	if strings.TrimSpace(secret) == "" {
 		return fmt.Errorf("empty secret refused")
 	}
+	for _, host := range hosts {
+		if err := store(host, normalizeUser(host, user), kind, secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	_, err = runSecurityCommand(
+// Put stores secret without prompting, as when a deleted credential is
+// put back.
+func Put(host, user, kind, secret string) error {
+	host, err := normalizeHost(host)
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		return fmt.Errorf("empty secret refused")
+	}
+	return store(host, normalizeUser(host, user), normalizeKind(kind), secret)
+}
+
+func store(host, user, kind, secret string) error {
+	_, err := runSecurityCommand(
 		"add-generic-password",
 		"-U",
 		"-s", serviceName(host, kind),
@@ -6,6 +6,14 @@ func Set(host, user, kind string) error {
 	return ErrUnsupported
 }
 
+func SetMany(hosts []string, user, kind string) error {
+	return ErrUnsupported
+}
+
+func Put(host, user, kind, secret string) error {
+	return ErrUnsupported
+}
+
 func Get(host, user, kind string) error {
 	return ErrUnsupported
 }
@@ -14,6 +14,20 @@ func TestStubSet(t *testing.T) {
 	}
 }
 
+func TestStubSetMany(t *testing.T) {
+	err := SetMany([]string{"host1", "host2"}, "", "password")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("SetMany() = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestStubPut(t *testing.T) {
+	err := Put("host1", "user1", "password", "secret")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Put() = %v, want ErrUnsupported", err)
+	}
+}
+
 func TestStubGet(t *testing.T) {
 	err := Get("host1", "user1", "password")
 	if !errors.Is(err, ErrUnsupported) {
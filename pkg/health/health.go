@@ -0,0 +1,299 @@
+// Package health checks whether ssh hosts are reachable.
+package health
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tmux-ssh-manager/pkg/sshconfig"
+	"tmux-ssh-manager/pkg/state"
+)
+
+// Target is where a host's ssh server listens.
+type Target struct {
+	Alias string
+	Host  string
+	Port  int
+	// Jump is the host's ProxyJump ("a,b" for a chain); empty when it is
+	// reached directly.
+	Jump string
+}
+
+// TargetFor resolves host's address the way ssh would: HostName (the alias
+// when unset), Port (22 when unset) and ProxyJump.
+func TargetFor(host sshconfig.Host) Target {
+	t := Target{Alias: host.Alias, Host: host.HostName, Port: host.Port}
+	if t.Host == "" {
+		t.Host = host.Alias
+	}
+	if t.Port == 0 {
+		t.Port = 22
+	}
+	if jump := strings.TrimSpace(host.ProxyJump); jump != "" && !strings.EqualFold(jump, "none") {
+		t.Jump = jump
+	}
+	return t
+}
+
+// Address is the target's host:port.
+func (t Target) Address() string {
+	return net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+}
+
+// ErrJumpAuth reports that a jump host wants a password or another
+// interactive login, which checks run in batch mode cannot give.
+var ErrJumpAuth = errors.New("jump host needs interactive authentication")
+
+// Result is the outcome of checking a target.
+type Result struct {
+	Target
+	Up bool
+	// Unknown reports that the check could not tell whether the host is up,
+	// because its jump host needs interactive authentication.
+	Unknown bool
+	// Latency is how long the TCP connection took, or until the banner
+	// arrived through a jump host.
+	Latency time.Duration
+	// Banner is the server's identification line ("SSH-2.0-OpenSSH_9.6").
+	Banner    string
+	Err       error
+	CheckedAt time.Time
+}
+
+// Record converts r for the state store's health cache.
+func (r Result) Record() state.HealthCheck {
+	check := state.HealthCheck{Up: r.Up, Unknown: r.Unknown, CheckedAt: r.CheckedAt.UTC().Format(time.RFC3339)}
+	if r.Up {
+		check.LatencyMS = float64(r.Latency.Microseconds()) / 1000
+	}
+	if r.Err != nil {
+		check.Error = r.Err.Error()
+	}
+	return check
+}
+
+// Checker probes targets.
+type Checker struct {
+	// Timeout bounds each check; zero means 5 seconds.
+	Timeout time.Duration
+	// Banner makes a check wait for the ssh identification line, so that a
+	// port that accepts connections without an ssh server behind it counts
+	// as down. Checks through a jump host always wait for it.
+	Banner bool
+	// Concurrency caps the checks CheckAll runs at once; zero means 8.
+	Concurrency int
+	// Dial opens direct connections; nil means a net.Dialer.
+	Dial func(ctx context.Context, network, address string) (net.Conn, error)
+	// DialJump opens a stream to address through jump; nil means
+	// "ssh -W address" in batch mode.
+	DialJump func(ctx context.Context, jump, address string) (io.ReadWriteCloser, error)
+}
+
+// Check probes t.
+func (c Checker) Check(ctx context.Context, t Target) Result {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	result := Result{Target: t, CheckedAt: start}
+
+	if t.Jump != "" {
+		dial := c.DialJump
+		if dial == nil {
+			dial = sshStream
+		}
+		stream, err := dial(ctx, t.Jump, t.Address())
+		if err != nil {
+			result.Err = err
+			result.Unknown = errors.Is(err, ErrJumpAuth)
+			return result
+		}
+		defer stream.Close()
+		result.Banner, result.Err = readBanner(ctx, stream)
+		result.Latency = time.Since(start)
+		result.Up = result.Err == nil
+		result.Unknown = errors.Is(result.Err, ErrJumpAuth)
+		return result
+	}
+
+	dial := c.Dial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(ctx, "tcp", t.Address())
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer conn.Close()
+	result.Latency = time.Since(start)
+	if c.Banner {
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetReadDeadline(deadline)
+		}
+		result.Banner, result.Err = readBanner(ctx, conn)
+	}
+	result.Up = result.Err == nil
+	return result
+}
+
+// CheckAll probes targets with at most Concurrency checks at a time and
+// sends each result on results as it completes. It returns once every
+// target is checked or ctx is done; results that nobody received by then
+// are dropped.
+func (c Checker) CheckAll(ctx context.Context, targets []Target, results chan<- Result) {
+	limit := c.Concurrency
+	if limit <= 0 {
+		limit = 8
+	}
+	slots := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(t Target) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			select {
+			case results <- c.Check(ctx, t):
+			case <-ctx.Done():
+			}
+		}(t)
+	}
+	wg.Wait()
+}
+
+// readBanner reads the ssh identification line; servers may send other
+// lines before it.
+func readBanner(ctx context.Context, r io.Reader) (string, error) {
+	type line struct {
+		text string
+		err  error
+	}
+	done := make(chan line, 1)
+	go func() {
+		reader := bufio.NewReaderSize(io.LimitReader(r, 8192), 256)
+		for {
+			text, err := reader.ReadString('\n')
+			text = strings.TrimRight(text, "\r\n")
+			if strings.HasPrefix(text, "SSH-") {
+				done <- line{text: text}
+				return
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = fmt.Errorf("connection closed before the ssh banner")
+				}
+				done <- line{err: err}
+				return
+			}
+		}
+	}()
+	select {
+	case l := <-done:
+		if l.err != nil {
+			return "", fmt.Errorf("no ssh banner: %w", l.err)
+		}
+		return l.text, nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("no ssh banner: %w", ctx.Err())
+	}
+}
+
+// sshStream runs "ssh -W address" to the last host of the jump chain,
+// through the ones before it, without prompting for passwords.
+func sshStream(ctx context.Context, jump, address string) (io.ReadWriteCloser, error) {
+	hops := strings.Split(jump, ",")
+	args := []string{"-o", "BatchMode=yes", "-W", address}
+	if deadline, ok := ctx.Deadline(); ok {
+		seconds := int(time.Until(deadline).Seconds())
+		args = append(args, "-o", "ConnectTimeout="+strconv.Itoa(max(seconds, 1)))
+	}
+	if len(hops) > 1 {
+		args = append(args, "-J", strings.Join(hops[:len(hops)-1], ","))
+	}
+	args = append(args, "--", strings.TrimSpace(hops[len(hops)-1]))
+	cmd := exec.CommandContext(ctx, "ssh", args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start ssh: %w", err)
+	}
+	return &sshProcess{cmd: cmd, stdin: stdin, stdout: stdout, stderr: &stderr}, nil
+}
+
+type sshProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.Reader
+	stderr *strings.Builder
+	waited sync.Once
+}
+
+func (p *sshProcess) wait() {
+	p.waited.Do(func() { _ = p.cmd.Wait() })
+}
+
+func (p *sshProcess) Read(b []byte) (int, error) {
+	n, err := p.stdout.Read(b)
+	if err == io.EOF {
+		// Report why ssh gave up, e.g. the jump host refused the channel.
+		p.wait()
+		if msg := strings.TrimSpace(p.stderr.String()); msg != "" {
+			return n, jumpError(msg)
+		}
+	}
+	return n, err
+}
+
+func (p *sshProcess) Write(b []byte) (int, error) {
+	return p.stdin.Write(b)
+}
+
+func (p *sshProcess) Close() error {
+	_ = p.stdin.Close()
+	_ = p.cmd.Process.Kill()
+	p.wait()
+	return nil
+}
+
+// jumpError turns what "ssh -W" printed before giving up into an error.
+// BatchMode makes a jump host that wants a password deny the login.
+func jumpError(stderr string) error {
+	line := lastLine(stderr)
+	if strings.Contains(stderr, "Permission denied") {
+		return fmt.Errorf("%w: %s", ErrJumpAuth, line)
+	}
+	return fmt.Errorf("ssh: %s", line)
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(s, "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
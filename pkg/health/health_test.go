@@ -0,0 +1,203 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tmux-ssh-manager/pkg/sshconfig"
+)
+
+// listen accepts connections on a local port and writes greeting to each.
+func listen(t *testing.T, greeting string) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = io.WriteString(conn, greeting)
+			_ = conn.Close()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// closedPort returns a local port nothing listens on.
+func closedPort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	_ = ln.Close()
+	return port
+}
+
+func TestTargetFor(t *testing.T) {
+	for _, tc := range []struct {
+		host sshconfig.Host
+		want Target
+	}{
+		{sshconfig.Host{Alias: "web"}, Target{Alias: "web", Host: "web", Port: 22}},
+		{sshconfig.Host{Alias: "db", HostName: "10.0.0.5", Port: 2222, ProxyJump: "bastion"}, Target{Alias: "db", Host: "10.0.0.5", Port: 2222, Jump: "bastion"}},
+		{sshconfig.Host{Alias: "lab", ProxyJump: "none"}, Target{Alias: "lab", Host: "lab", Port: 22}},
+	} {
+		if got := TargetFor(tc.host); got != tc.want {
+			t.Errorf("TargetFor(%+v) = %+v, want %+v", tc.host, got, tc.want)
+		}
+	}
+	if got := (Target{Host: "::1", Port: 22}).Address(); got != "[::1]:22" {
+		t.Fatalf("unexpected address %q", got)
+	}
+}
+
+func TestCheckLocalListeners(t *testing.T) {
+	sshPort := listen(t, "SSH-2.0-OpenSSH_9.6\r\n")
+	otherPort := listen(t, "220 smtp ready\r\n")
+	downPort := closedPort(t)
+	c := Checker{Timeout: 2 * time.Second, Banner: true}
+
+	up := c.Check(context.Background(), Target{Alias: "ssh", Host: "127.0.0.1", Port: sshPort})
+	if !up.Up || up.Banner != "SSH-2.0-OpenSSH_9.6" || up.Err != nil || up.Latency <= 0 || up.CheckedAt.IsZero() {
+		t.Fatalf("unexpected result %+v", up)
+	}
+	other := c.Check(context.Background(), Target{Alias: "smtp", Host: "127.0.0.1", Port: otherPort})
+	if other.Up || other.Err == nil || !strings.Contains(other.Err.Error(), "no ssh banner") {
+		t.Fatalf("expected a missing banner, got %+v", other)
+	}
+	c.Banner = false
+	if other := c.Check(context.Background(), Target{Host: "127.0.0.1", Port: otherPort}); !other.Up {
+		t.Fatalf("expected an open port to be up without the banner check, got %+v", other)
+	}
+	down := c.Check(context.Background(), Target{Alias: "down", Host: "127.0.0.1", Port: downPort})
+	if down.Up || down.Err == nil {
+		t.Fatalf("expected a refused connection, got %+v", down)
+	}
+}
+
+func TestCheckThroughJump(t *testing.T) {
+	var gotJump, gotAddress string
+	c := Checker{
+		Timeout: time.Second,
+		DialJump: func(ctx context.Context, jump, address string) (io.ReadWriteCloser, error) {
+			gotJump, gotAddress = jump, address
+			client, server := net.Pipe()
+			go func() {
+				_, _ = io.WriteString(server, "debug: welcome\nSSH-2.0-dropbear\n")
+				_ = server.Close()
+			}()
+			return client, nil
+		},
+	}
+	result := c.Check(context.Background(), Target{Alias: "db", Host: "10.0.0.5", Port: 22, Jump: "a,b"})
+	if !result.Up || result.Banner != "SSH-2.0-dropbear" || gotJump != "a,b" || gotAddress != "10.0.0.5:22" {
+		t.Fatalf("unexpected result %+v via %q to %q", result, gotJump, gotAddress)
+	}
+
+	c.DialJump = func(ctx context.Context, jump, address string) (io.ReadWriteCloser, error) {
+		client, server := net.Pipe()
+		t.Cleanup(func() { _ = server.Close() })
+		return client, nil
+	}
+	c.Timeout = 50 * time.Millisecond
+	if result := c.Check(context.Background(), Target{Host: "10.0.0.5", Port: 22, Jump: "a"}); result.Up || result.Err == nil {
+		t.Fatalf("expected a silent jump to time out, got %+v", result)
+	}
+}
+
+func TestCheckBehindPasswordJumpIsUnknown(t *testing.T) {
+	c := Checker{
+		Timeout: time.Second,
+		DialJump: func(ctx context.Context, jump, address string) (io.ReadWriteCloser, error) {
+			client, server := net.Pipe()
+			_ = server.Close()
+			return failingStream{client, jumpError("debug1: Authentications that can continue: password\nbastion: Permission denied (password).")}, nil
+		},
+	}
+	result := c.Check(context.Background(), Target{Host: "10.0.0.5", Port: 22, Jump: "bastion"})
+	if result.Up || !result.Unknown || !errors.Is(result.Err, ErrJumpAuth) || !result.Record().Unknown {
+		t.Fatalf("expected an unknown result, got %+v", result)
+	}
+	if err := jumpError("channel 0: open failed: connect failed: Connection refused"); errors.Is(err, ErrJumpAuth) || err.Error() != "ssh: channel 0: open failed: connect failed: Connection refused" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// failingStream fails every read with err.
+type failingStream struct {
+	io.ReadWriteCloser
+	err error
+}
+
+func (s failingStream) Read([]byte) (int, error) { return 0, s.err }
+
+func TestCheckAllBoundsConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+	c := Checker{
+		Concurrency: 3,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			client, server := net.Pipe()
+			_ = server.Close()
+			return client, nil
+		},
+	}
+	var targets []Target
+	for i := range 12 {
+		targets = append(targets, Target{Alias: "h" + strconv.Itoa(i), Host: "127.0.0.1", Port: 22})
+	}
+	results := make(chan Result, len(targets))
+	c.CheckAll(context.Background(), targets, results)
+	close(results)
+	seen := map[string]bool{}
+	for result := range results {
+		if !result.Up {
+			t.Fatalf("unexpected result %+v", result)
+		}
+		seen[result.Alias] = true
+	}
+	if len(seen) != len(targets) || peak > 3 {
+		t.Fatalf("checked %d targets with up to %d at once", len(seen), peak)
+	}
+}
+
+func TestCheckAllStopsWhenCancelled(t *testing.T) {
+	c := Checker{Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, errors.New("refused")
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		// Nobody receives the results: a picker that exited.
+		c.CheckAll(ctx, []Target{{Host: "a"}, {Host: "b"}}, make(chan Result))
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("CheckAll kept running after cancel")
+	}
+}
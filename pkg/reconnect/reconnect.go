@@ -0,0 +1,127 @@
+package reconnect
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// ExitConnectionLost is the status ssh uses for its own failures (dropped
+// connections, unreachable hosts, auth errors). Any other status is the
+// remote shell's own exit and ends the loop.
+const ExitConnectionLost = 255
+
+const (
+	DefaultMaxAttempts = 10
+	defaultBaseDelay   = time.Second
+	defaultMaxDelay    = 60 * time.Second
+	defaultResetAfter  = 30 * time.Second
+)
+
+// Loop restarts a session with exponential backoff while it keeps ending
+// with ExitConnectionLost.
+type Loop struct {
+	// Label names the session in banners, usually the host alias.
+	Label string
+	// MaxAttempts caps consecutive reconnects; <= 0 means DefaultMaxAttempts.
+	MaxAttempts int
+	// BaseDelay and MaxDelay bound the backoff between attempts.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// ResetAfter restores the full attempt budget when a session stayed up
+	// at least this long before dropping.
+	ResetAfter time.Duration
+	// Run starts one session and returns its exit status.
+	Run func() (int, error)
+	// Wait pauses for d and reports false if the user aborted.
+	Wait func(d time.Duration) bool
+	// Now defaults to time.Now.
+	Now func() time.Time
+	// Out receives the countdown banner.
+	Out io.Writer
+}
+
+// Start runs the session until it exits normally, fails to start, the
+// attempt budget is exhausted, or the user aborts a countdown. It returns the
+// last exit status.
+func (l Loop) Start() (int, error) {
+	l.defaults()
+	attempt := 0
+	for {
+		started := l.Now()
+		code, err := l.Run()
+		if err != nil {
+			return code, err
+		}
+		if code != ExitConnectionLost {
+			return code, nil
+		}
+		if l.Now().Sub(started) >= l.ResetAfter {
+			attempt = 0
+		}
+		attempt++
+		if attempt > l.MaxAttempts {
+			fmt.Fprintf(l.Out, "\r\n[tmux-ssh-manager] %s: giving up after %d reconnect attempts\r\n", l.Label, l.MaxAttempts)
+			return code, nil
+		}
+		if !l.countdown(attempt, code) {
+			fmt.Fprintf(l.Out, "\r\n[tmux-ssh-manager] %s: reconnect cancelled\r\n", l.Label)
+			return code, nil
+		}
+	}
+}
+
+// Backoff returns the delay before the given 1-based attempt.
+func (l Loop) Backoff(attempt int) time.Duration {
+	l.defaults()
+	delay := l.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= l.MaxDelay {
+			return l.MaxDelay
+		}
+	}
+	return delay
+}
+
+func (l Loop) countdown(attempt, code int) bool {
+	remaining := l.Backoff(attempt)
+	for remaining > 0 {
+		fmt.Fprintf(l.Out, "\r[tmux-ssh-manager] connection to %s lost (exit %d); reconnecting in %ds (attempt %d/%d, ctrl+c to stop) ",
+			l.Label, code, int((remaining+time.Second-1)/time.Second), attempt, l.MaxAttempts)
+		step := min(remaining, time.Second)
+		if !l.Wait(step) {
+			return false
+		}
+		remaining -= step
+	}
+	fmt.Fprintf(l.Out, "\r\n[tmux-ssh-manager] reconnecting to %s...\r\n", l.Label)
+	return true
+}
+
+func (l *Loop) defaults() {
+	if l.MaxAttempts <= 0 {
+		l.MaxAttempts = DefaultMaxAttempts
+	}
+	if l.BaseDelay <= 0 {
+		l.BaseDelay = defaultBaseDelay
+	}
+	if l.MaxDelay <= 0 {
+		l.MaxDelay = defaultMaxDelay
+	}
+	if l.ResetAfter <= 0 {
+		l.ResetAfter = defaultResetAfter
+	}
+	if l.Now == nil {
+		l.Now = time.Now
+	}
+	if l.Wait == nil {
+		l.Wait = func(d time.Duration) bool {
+			time.Sleep(d)
+			return true
+		}
+	}
+	if l.Out == nil {
+		l.Out = io.Discard
+	}
+}
@@ -0,0 +1,155 @@
+package reconnect
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoopStopsOnNormalExit(t *testing.T) {
+	runs := 0
+	code, err := Loop{
+		Run: func() (int, error) {
+			runs++
+			return 0, nil
+		},
+	}.Start()
+	if err != nil || code != 0 {
+		t.Fatalf("Start() = %d, %v", code, err)
+	}
+	if runs != 1 {
+		t.Fatalf("expected 1 run, got %d", runs)
+	}
+}
+
+func TestLoopStopsOnRemoteExitStatus(t *testing.T) {
+	runs := 0
+	code, _ := Loop{
+		Run: func() (int, error) {
+			runs++
+			return 130, nil
+		},
+	}.Start()
+	if code != 130 || runs != 1 {
+		t.Fatalf("expected single run with status 130, got runs=%d code=%d", runs, code)
+	}
+}
+
+func TestLoopRetriesConnectionLostWithBackoff(t *testing.T) {
+	codes := []int{255, 255, 0}
+	var waited time.Duration
+	var out bytes.Buffer
+	code, err := Loop{
+		Label: "edge1",
+		Run: func() (int, error) {
+			next := codes[0]
+			codes = codes[1:]
+			return next, nil
+		},
+		Wait: func(d time.Duration) bool {
+			waited += d
+			return true
+		},
+		Out: &out,
+	}.Start()
+	if err != nil || code != 0 {
+		t.Fatalf("Start() = %d, %v", code, err)
+	}
+	// 1s before the first retry, 2s before the second.
+	if waited != 3*time.Second {
+		t.Fatalf("expected 3s of backoff, got %s", waited)
+	}
+	if !strings.Contains(out.String(), "connection to edge1 lost (exit 255)") {
+		t.Fatalf("expected banner, got %q", out.String())
+	}
+}
+
+func TestLoopGivesUpAfterMaxAttempts(t *testing.T) {
+	runs := 0
+	var out bytes.Buffer
+	code, _ := Loop{
+		Label:       "edge1",
+		MaxAttempts: 2,
+		Run: func() (int, error) {
+			runs++
+			return 255, nil
+		},
+		Wait: func(time.Duration) bool { return true },
+		Out:  &out,
+	}.Start()
+	if code != 255 {
+		t.Fatalf("expected status 255, got %d", code)
+	}
+	if runs != 3 {
+		t.Fatalf("expected initial run plus 2 retries, got %d", runs)
+	}
+	if !strings.Contains(out.String(), "giving up after 2 reconnect attempts") {
+		t.Fatalf("expected give-up banner, got %q", out.String())
+	}
+}
+
+func TestLoopAbortDuringCountdown(t *testing.T) {
+	runs := 0
+	Loop{
+		Run: func() (int, error) {
+			runs++
+			return 255, nil
+		},
+		Wait: func(time.Duration) bool { return false },
+	}.Start()
+	if runs != 1 {
+		t.Fatalf("expected no retry after abort, got %d runs", runs)
+	}
+}
+
+func TestLoopResetsAttemptsAfterStableSession(t *testing.T) {
+	now := time.Unix(0, 0)
+	runs := 0
+	Loop{
+		MaxAttempts: 1,
+		ResetAfter:  time.Minute,
+		Now:         func() time.Time { return now },
+		Run: func() (int, error) {
+			runs++
+			if runs < 4 {
+				// Each session stays up long enough to earn a fresh budget.
+				now = now.Add(2 * time.Minute)
+				return 255, nil
+			}
+			return 0, nil
+		},
+		Wait: func(time.Duration) bool { return true },
+	}.Start()
+	if runs != 4 {
+		t.Fatalf("expected stable sessions to keep reconnecting, got %d runs", runs)
+	}
+}
+
+func TestLoopReturnsStartError(t *testing.T) {
+	want := errors.New("ssh not found")
+	_, err := Loop{Run: func() (int, error) { return -1, want }}.Start()
+	if !errors.Is(err, want) {
+		t.Fatalf("expected start error, got %v", err)
+	}
+}
+
+func TestBackoffCapsAtMaxDelay(t *testing.T) {
+	l := Loop{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{10, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := l.Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package sessionlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CastExt is the extension of asciicast recordings.
+const CastExt = ".cast"
+
+// CastHeader is the first line of an asciicast v2 recording.
+type CastHeader struct {
+	Version   int    `json:"version"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Title     string `json:"title,omitempty"`
+}
+
+// castName returns the file name of a session's recording. Recordings are
+// kept per connection rather than per day, so the session ID is part of the
+// name.
+func castName(date, session string) string {
+	var b strings.Builder
+	for _, r := range session {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		b.WriteString("session")
+	}
+	return date + "." + b.String() + CastExt
+}
+
+// Recorder writes terminal output as asciicast v2 output events, timed from
+// when the recorder was created.
+type Recorder struct {
+	out     io.Writer
+	now     func() time.Time
+	start   time.Time
+	pending []byte // incomplete UTF-8 sequence
+}
+
+// NewRecorder writes header to out and returns a Recorder for the events.
+// A zero terminal size defaults to 80x24.
+func NewRecorder(out io.Writer, header CastHeader, now func() time.Time) (*Recorder, error) {
+	if now == nil {
+		now = time.Now
+	}
+	r := &Recorder{out: out, now: now, start: now()}
+	header.Version = 2
+	if header.Width <= 0 {
+		header.Width = 80
+	}
+	if header.Height <= 0 {
+		header.Height = 24
+	}
+	if header.Timestamp == 0 {
+		header.Timestamp = r.start.Unix()
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(out, "%s\n", data); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write records p as one output event. A multi-byte character split across
+// writes is held back until it is complete.
+func (r *Recorder) Write(p []byte) (int, error) {
+	data := append(r.pending, p...)
+	r.pending = nil
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	if cut < len(data) {
+		r.pending = append([]byte(nil), data[cut:]...)
+	}
+	if err := r.event(data[:cut]); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (r *Recorder) event(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	elapsed := r.now().Sub(r.start).Round(time.Microsecond).Seconds()
+	line, err := json.Marshal([]any{elapsed, "o", string(data)})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(r.out, "%s\n", line)
+	return err
+}
+
+// Flush records a held-back partial character.
+func (r *Recorder) Flush() error {
+	data := r.pending
+	r.pending = nil
+	return r.event(data)
+}
+
+// PlayOptions control Play.
+type PlayOptions struct {
+	// Speed divides the delays between events; values <= 0 mean 1.
+	Speed float64
+	// MaxIdle caps any single delay (after Speed); 0 keeps delays as recorded.
+	MaxIdle time.Duration
+	// Sleep defaults to time.Sleep.
+	Sleep func(time.Duration)
+}
+
+// Play replays the output events of an asciicast v2 recording to out.
+func Play(in io.Reader, out io.Writer, opts PlayOptions) error {
+	if opts.Speed <= 0 {
+		opts.Speed = 1
+	}
+	if opts.Sleep == nil {
+		opts.Sleep = time.Sleep
+	}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("read recording: %w", err)
+		}
+		return fmt.Errorf("empty recording")
+	}
+	var header CastHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Version != 2 {
+		return fmt.Errorf("not an asciicast v2 recording")
+	}
+	previous := 0.0
+	for lineNo := 2; scanner.Scan(); lineNo++ {
+		var event []json.RawMessage
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || len(event) < 3 {
+			return fmt.Errorf("recording line %d: invalid event", lineNo)
+		}
+		var at float64
+		var kind, data string
+		if json.Unmarshal(event[0], &at) != nil || json.Unmarshal(event[1], &kind) != nil || json.Unmarshal(event[2], &data) != nil {
+			return fmt.Errorf("recording line %d: invalid event", lineNo)
+		}
+		if kind != "o" {
+			continue
+		}
+		delay := time.Duration((at - previous) / opts.Speed * float64(time.Second))
+		previous = at
+		if opts.MaxIdle > 0 && delay > opts.MaxIdle {
+			delay = opts.MaxIdle
+		}
+		if delay > 0 {
+			opts.Sleep(delay)
+		}
+		if _, err := io.WriteString(out, data); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read recording: %w", err)
+	}
+	return nil
+}
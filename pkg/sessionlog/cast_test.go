@@ -0,0 +1,129 @@
+package sessionlog
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorderWritesTimedEvents(t *testing.T) {
+	now := time.Unix(1_790_000_000, 0)
+	var out bytes.Buffer
+	r, err := NewRecorder(&out, CastHeader{Width: 120, Height: 40, Title: "db1"}, func() time.Time { return now })
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(1500 * time.Millisecond)
+	// "é" is split across two writes and must not be broken up.
+	if _, err := r.Write([]byte("caf\xc3")); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if _, err := r.Write([]byte("\xa9\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"version":2,"width":120,"height":40,"timestamp":1790000000,"title":"db1"}` + "\n" +
+		`[1.5,"o","caf"]` + "\n" +
+		`[2,"o","é\r\n"]` + "\n"
+	if out.String() != want {
+		t.Fatalf("unexpected recording:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestPlayHonorsSpeedAndMaxIdle(t *testing.T) {
+	recording := `{"version":2,"width":80,"height":24}` + "\n" +
+		`[1.0,"o","a"]` + "\n" +
+		`[1.5,"i","ignored"]` + "\n" +
+		`[11.0,"o","b"]` + "\n"
+	var out bytes.Buffer
+	var delays []time.Duration
+	err := Play(strings.NewReader(recording), &out, PlayOptions{
+		Speed:   2,
+		MaxIdle: 3 * time.Second,
+		Sleep:   func(d time.Duration) { delays = append(delays, d) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "ab" {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+	if len(delays) != 2 || delays[0] != 500*time.Millisecond || delays[1] != 3*time.Second {
+		t.Fatalf("unexpected delays %v", delays)
+	}
+}
+
+func TestPlayRejectsOtherFiles(t *testing.T) {
+	if err := Play(strings.NewReader("2026-10-18T09:00:00Z [s1] hi\n"), &bytes.Buffer{}, PlayOptions{}); err == nil {
+		t.Fatal("expected error for a text log")
+	}
+}
+
+func TestWriterRecordsSessionAlongsideLog(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "db1")
+	w, err := Open(dir, Options{Session: "20261018-093000-4f2a", Format: FormatText, Record: true, Width: 100, Height: 30, Title: "db1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("\x1b[1mhi\x1b[0m\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ListFiles(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected log and recording, got %+v", files)
+	}
+	sessions, err := Sessions(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].Recording == "" || sessions[0].Lines != 1 {
+		t.Fatalf("expected one recorded session, got %+v", sessions)
+	}
+	f, err := os.Open(sessions[0].Recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"version":2,"width":100,"height":30,`) || !strings.HasSuffix(lines[1], `"o","\u001b[1mhi\u001b[0m\r\n"]`) {
+		t.Fatalf("unexpected recording %q", lines)
+	}
+}
+
+func TestPruneKeepsRecordingsWrittenToday(t *testing.T) {
+	base := t.TempDir()
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1).Format("2006-01-02")
+	active := filepath.Join(base, "db1", castName(yesterday, "s1"))
+	finished := filepath.Join(base, "db1", castName(yesterday, "s2"))
+	writeLog(t, active, 100)
+	writeLog(t, finished, 100)
+	old := now.AddDate(0, 0, -1)
+	if err := os.Chtimes(finished, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Prune(base, Policy{Compress: true}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Compressed != 1 || !exists(active) || !exists(finished+gzipExt) {
+		t.Fatalf("expected only the finished recording to be compressed, got %+v", result)
+	}
+}
@@ -0,0 +1,180 @@
+package sessionlog
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Cleaner turns a terminal byte stream into plain text lines. It drops
+// ANSI/VT escape sequences (CSI, OSC, DCS and friends) and replays carriage
+// returns, backspaces and line erases the way a terminal would, so a line
+// that was redrawn in place is logged as it finally looked. Output of
+// full-screen programs running on the alternate screen is dropped.
+type Cleaner struct {
+	line    []rune
+	cursor  int
+	state   scanState
+	params  []byte
+	pending []byte // incomplete UTF-8 sequence
+	alt     bool
+}
+
+type scanState int
+
+const (
+	stateText scanState = iota
+	stateEscape
+	stateEscapeIntermediate
+	stateCSI
+	stateString       // OSC, DCS, SOS, PM, APC: runs until BEL or ST
+	stateStringEscape // ESC seen inside a string, expecting '\'
+)
+
+// Feed processes p and calls emit for every completed line.
+func (c *Cleaner) Feed(p []byte, emit func(string)) {
+	if len(c.pending) > 0 {
+		p = append(c.pending, p...)
+		c.pending = nil
+	}
+	for len(p) > 0 {
+		b := p[0]
+		if c.state == stateText && b >= utf8.RuneSelf {
+			if !utf8.FullRune(p) {
+				c.pending = append([]byte(nil), p...)
+				return
+			}
+			r, size := utf8.DecodeRune(p)
+			c.put(r)
+			p = p[size:]
+			continue
+		}
+		c.feedByte(b, emit)
+		p = p[1:]
+	}
+}
+
+func (c *Cleaner) feedByte(b byte, emit func(string)) {
+	switch c.state {
+	case stateText:
+		switch {
+		case b == 0x1b:
+			c.state = stateEscape
+		case b == '\n':
+			if !c.alt {
+				emit(strings.TrimRight(string(c.line), " "))
+			}
+			c.line = c.line[:0]
+			c.cursor = 0
+		case b == '\r':
+			c.cursor = 0
+		case b == '\b':
+			if c.cursor > 0 {
+				c.cursor--
+			}
+		case b == '\t':
+			c.put('\t')
+		case b < 0x20 || b == 0x7f:
+			// Other control characters (BEL, SI/SO, ...) have no text.
+		default:
+			c.put(rune(b))
+		}
+	case stateEscape:
+		switch {
+		case b == '[':
+			c.state = stateCSI
+			c.params = c.params[:0]
+		case b == ']' || b == 'P' || b == 'X' || b == '^' || b == '_':
+			c.state = stateString
+		case b >= 0x20 && b <= 0x2f:
+			c.state = stateEscapeIntermediate
+		default:
+			c.state = stateText
+		}
+	case stateEscapeIntermediate:
+		if b < 0x20 || b > 0x2f {
+			c.state = stateText
+		}
+	case stateCSI:
+		if b >= 0x40 && b <= 0x7e {
+			c.csi(b)
+			c.state = stateText
+		} else {
+			c.params = append(c.params, b)
+		}
+	case stateString:
+		switch b {
+		case 0x07:
+			c.state = stateText
+		case 0x1b:
+			c.state = stateStringEscape
+		}
+	case stateStringEscape:
+		if b == '\\' {
+			c.state = stateText
+		} else {
+			c.state = stateString
+		}
+	}
+}
+
+// csi applies the few control sequences that change a line's final text.
+func (c *Cleaner) csi(final byte) {
+	params := string(c.params)
+	if strings.HasPrefix(params, "?") {
+		switch strings.TrimPrefix(params, "?") {
+		case "1049", "1047", "47":
+			if final == 'h' || final == 'l' {
+				c.alt = final == 'h'
+			}
+		}
+		return
+	}
+	n := 1
+	if value, err := strconv.Atoi(params); err == nil && value > 0 {
+		n = value
+	}
+	switch final {
+	case 'K': // erase in line
+		switch params {
+		case "", "0":
+			c.line = c.line[:min(c.cursor, len(c.line))]
+		case "2":
+			c.line = c.line[:0]
+		}
+	case 'C': // cursor forward
+		c.cursor += n
+	case 'D': // cursor back
+		c.cursor = max(c.cursor-n, 0)
+	case 'G': // cursor to column
+		c.cursor = n - 1
+	}
+}
+
+func (c *Cleaner) put(r rune) {
+	for len(c.line) < c.cursor {
+		c.line = append(c.line, ' ')
+	}
+	if c.cursor < len(c.line) {
+		c.line[c.cursor] = r
+	} else {
+		c.line = append(c.line, r)
+	}
+	c.cursor++
+}
+
+// Pending reports whether a partial line is buffered.
+func (c *Cleaner) Pending() bool {
+	return len(c.line) > 0
+}
+
+// Flush returns the buffered partial line, if any, and resets it.
+func (c *Cleaner) Flush() (string, bool) {
+	if len(c.line) == 0 || c.alt {
+		return "", false
+	}
+	line := strings.TrimRight(string(c.line), " ")
+	c.line = c.line[:0]
+	c.cursor = 0
+	return line, true
+}
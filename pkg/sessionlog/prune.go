@@ -0,0 +1,264 @@
+package sessionlog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const gzipExt = ".gz"
+
+// logFilePattern matches the files Writer creates: <date>[.<n>]<ext>[.gz].
+var logFilePattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})(?:\.(\d+))?(\.log|\.jsonl|\.raw)(\.gz)?$`)
+
+// castFilePattern matches recordings: <date>.<session>.cast[.gz].
+var castFilePattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})\.([\w-]+)(\.cast)(\.gz)?$`)
+
+// Policy bounds how much log history is kept. Zero values disable a limit.
+type Policy struct {
+	MaxAge time.Duration
+	// MaxHostSize caps the logs of each host; MaxTotalSize all hosts together.
+	MaxHostSize  int64
+	MaxTotalSize int64
+	// Compress gzips logs from previous days.
+	Compress bool
+}
+
+// PruneResult summarizes what Prune did.
+type PruneResult struct {
+	Compressed int
+	Removed    int
+	Freed      int64
+}
+
+// File is one log file in the logs directory.
+type File struct {
+	Path  string
+	Alias string
+	Date  time.Time
+	// Index is the rotation number within the day.
+	Index      int
+	Ext        string
+	Compressed bool
+	Size       int64
+	ModTime    time.Time
+	// Session is set for recordings, which are kept per session.
+	Session string
+}
+
+// active reports whether f may still be written to: it is from today, or a
+// recording that was written to today.
+func (f File) active(today time.Time) bool {
+	return !f.Date.Before(today) || (f.Ext == CastExt && !f.ModTime.Before(today))
+}
+
+// ListFiles returns the log files under base (one directory per host),
+// oldest first. Other files, such as tunnel logs, are left out.
+func ListFiles(base string) ([]File, error) {
+	hosts, err := os.ReadDir(base)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read logs dir: %w", err)
+	}
+	var files []File
+	for _, host := range hosts {
+		if !host.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(base, host.Name()))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			var session string
+			match := logFilePattern.FindStringSubmatch(entry.Name())
+			if match == nil {
+				cast := castFilePattern.FindStringSubmatch(entry.Name())
+				if cast == nil {
+					continue
+				}
+				session = cast[2]
+				match = []string{cast[0], cast[1], "", cast[3], cast[4]}
+			}
+			date, err := time.ParseInLocation("2006-01-02", match[1], time.Local)
+			if err != nil {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			index, _ := strconv.Atoi(match[2])
+			files = append(files, File{
+				Path:       filepath.Join(base, host.Name(), entry.Name()),
+				Alias:      host.Name(),
+				Date:       date,
+				Index:      index,
+				Ext:        match[3],
+				Compressed: match[4] != "",
+				Size:       info.Size(),
+				ModTime:    info.ModTime(),
+				Session:    session,
+			})
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if !files[i].Date.Equal(files[j].Date) {
+			return files[i].Date.Before(files[j].Date)
+		}
+		if files[i].Index != files[j].Index {
+			return files[i].Index < files[j].Index
+		}
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
+}
+
+// Prune applies policy to the logs under base. Logs from today, and
+// recordings still written to today, are never touched, since sessions may
+// still be writing to them. Older logs are
+// compressed, then deleted oldest first while they exceed the age or size
+// limits.
+func Prune(base string, policy Policy, now time.Time) (PruneResult, error) {
+	var result PruneResult
+	files, err := ListFiles(base)
+	if err != nil {
+		return result, err
+	}
+	today, _ := time.ParseInLocation("2006-01-02", now.Format("2006-01-02"), time.Local)
+
+	if policy.Compress {
+		for i := range files {
+			f := &files[i]
+			if f.Compressed || f.active(today) {
+				continue
+			}
+			size, err := compressFile(f.Path)
+			if err != nil {
+				return result, err
+			}
+			f.Path += gzipExt
+			f.Compressed = true
+			f.Size = size
+			result.Compressed++
+		}
+	}
+
+	removed := map[string]bool{}
+	remove := func(f File) error {
+		if removed[f.Path] {
+			return nil
+		}
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove log: %w", err)
+		}
+		removed[f.Path] = true
+		result.Removed++
+		result.Freed += f.Size
+		return nil
+	}
+
+	if policy.MaxAge > 0 {
+		cutoff := now.Add(-policy.MaxAge)
+		for _, f := range files {
+			// A day's log is expired once the whole day is past the cutoff.
+			if !f.active(today) && f.Date.AddDate(0, 0, 1).Before(cutoff) {
+				if err := remove(f); err != nil {
+					return result, err
+				}
+			}
+		}
+	}
+
+	if policy.MaxHostSize > 0 {
+		byHost := map[string][]File{}
+		for _, f := range files {
+			byHost[f.Alias] = append(byHost[f.Alias], f)
+		}
+		for _, hostFiles := range byHost {
+			if err := trim(hostFiles, policy.MaxHostSize, today, removed, remove); err != nil {
+				return result, err
+			}
+		}
+	}
+	if policy.MaxTotalSize > 0 {
+		if err := trim(files, policy.MaxTotalSize, today, removed, remove); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// trim deletes files (oldest first, never today's) until the rest fit in
+// limit.
+func trim(files []File, limit int64, today time.Time, removed map[string]bool, remove func(File) error) error {
+	var total int64
+	for _, f := range files {
+		if !removed[f.Path] {
+			total += f.Size
+		}
+	}
+	for _, f := range files {
+		if total <= limit {
+			return nil
+		}
+		if removed[f.Path] || f.active(today) {
+			continue
+		}
+		if err := remove(f); err != nil {
+			return err
+		}
+		total -= f.Size
+	}
+	return nil
+}
+
+// compressFile replaces path with path.gz and returns the compressed size.
+// The archive is written under a temporary name first so an interrupted run
+// never leaves a truncated .gz behind.
+func compressFile(path string) (int64, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("compress log: %w", err)
+	}
+	defer src.Close()
+
+	tmp := path + gzipExt + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("compress log: %w", err)
+	}
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(path)
+	_, err = io.Copy(zw, src)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+gzipExt)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return 0, fmt.Errorf("compress log: %w", err)
+	}
+	_ = os.Remove(path)
+	info, err := os.Stat(path + gzipExt)
+	if err != nil {
+		return 0, fmt.Errorf("compress log: %w", err)
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,141 @@
+package sessionlog
+
+import (
+	"compress/gzip"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeLog creates a log of incompressible bytes, so sizes survive gzip.
+func writeLog(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriterRotatesBySizeAndDate(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 18, 23, 59, 0, 0, time.Local)
+	w, err := Open(dir, Options{Session: "s1", Format: FormatRaw, MaxFileSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Now = func() time.Time { return now }
+	w.Out.(*rotatingFile).now = w.Now
+	for _, chunk := range []string{"0123456789", "abc", "defghijklm"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := w.Write([]byte("tomorrow")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"2026-10-18.log":   "0123456789",
+		"2026-10-18.1.log": "abcdefghijklm",
+		"2026-10-19.log":   "tomorrow",
+	}
+	for name, content := range want {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != content {
+			t.Errorf("%s = %q (%v), want %q", name, data, err, content)
+		}
+	}
+	// A new writer appends to the newest file that still has room.
+	if got := (&rotatingFile{dir: dir, ext: ".log", maxSize: 10}).pick("2026-10-18"); filepath.Base(got) != "2026-10-18.2.log" {
+		t.Fatalf("expected next numbered file, got %s", got)
+	}
+}
+
+func TestRotatingFileCountsExistingAndWrittenBytes(t *testing.T) {
+	dir := t.TempDir()
+	writeLog(t, filepath.Join(dir, "2026-10-18.log"), 6)
+	now := func() time.Time { return time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local) }
+	r := &rotatingFile{dir: dir, ext: ".log", maxSize: 10, now: now}
+	defer r.Close()
+	for _, chunk := range []string{"abcd", "e"} {
+		if _, err := r.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "2026-10-18.1.log")); err != nil || string(data) != "e" {
+		t.Fatalf("expected the full file to rotate, got %q (%v)", data, err)
+	}
+}
+
+func TestPruneCompressesAndEnforcesLimits(t *testing.T) {
+	base := t.TempDir()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	writeLog(t, filepath.Join(base, "db1", "2026-08-01.log"), 100)   // expired
+	writeLog(t, filepath.Join(base, "db1", "2026-10-16.log"), 5000)  // over host limit
+	writeLog(t, filepath.Join(base, "db1", "2026-10-17.log"), 5000)  // kept, compressed
+	writeLog(t, filepath.Join(base, "db1", "2026-10-18.log"), 20000) // today: untouched
+	writeLog(t, filepath.Join(base, "db1", "tunnel.log"), 10)        // not a session log
+	writeLog(t, filepath.Join(base, "web1", "2026-10-17.jsonl"), 10)
+
+	result, err := Prune(base, Policy{MaxAge: 30 * 24 * time.Hour, MaxHostSize: 26000, Compress: true}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Compressed != 4 || result.Removed != 2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	for _, name := range []string{"db1/2026-08-01.log.gz", "db1/2026-10-16.log.gz", "db1/2026-10-17.log"} {
+		if _, err := os.Stat(filepath.Join(base, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be gone", name)
+		}
+	}
+	for _, name := range []string{"db1/2026-10-17.log.gz", "db1/2026-10-18.log", "db1/tunnel.log", "web1/2026-10-17.jsonl.gz"} {
+		if _, err := os.Stat(filepath.Join(base, name)); err != nil {
+			t.Errorf("expected %s to be kept: %v", name, err)
+		}
+	}
+
+	f, err := os.Open(filepath.Join(base, "db1", "2026-10-17.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(zr)
+	if len(data) != 5000 {
+		t.Fatalf("compressed log holds %d bytes, want 5000", len(data))
+	}
+}
+
+func TestPruneTotalLimitRemovesOldestAcrossHosts(t *testing.T) {
+	base := t.TempDir()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	writeLog(t, filepath.Join(base, "a", "2026-10-15.log"), 100)
+	writeLog(t, filepath.Join(base, "b", "2026-10-16.log"), 100)
+	writeLog(t, filepath.Join(base, "a", "2026-10-17.log"), 100)
+
+	result, err := Prune(base, Policy{MaxTotalSize: 200}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Removed != 1 || result.Freed != 100 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(base, "a", "2026-10-15.log")); !os.IsNotExist(err) {
+		t.Fatal("expected the oldest log to be removed")
+	}
+}
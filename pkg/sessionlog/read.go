@@ -0,0 +1,231 @@
+package sessionlog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Record is one line of a session log.
+type Record struct {
+	Alias string
+	File  string
+	// LineNo is the 1-based line number within File.
+	LineNo  int
+	Time    time.Time
+	Session string
+	Text    string
+}
+
+// Session summarizes the lines one session wrote to a host's logs. Logs
+// written without session IDs (raw format, older logs) yield one entry per
+// file with an empty ID.
+type Session struct {
+	Alias string    `json:"alias"`
+	ID    string    `json:"session"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Lines int       `json:"lines"`
+	Files []string  `json:"files"`
+	// Recording is the session's asciicast file, if it was recorded.
+	Recording string `json:"recording,omitempty"`
+	// Redactions is how many secrets were removed from the session's log.
+	Redactions int `json:"redactions,omitempty"`
+}
+
+// OpenFile opens a log file for reading, decompressing .gz files.
+func OpenFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open log: %w", err)
+	}
+	if !strings.HasSuffix(path, gzipExt) {
+		return f, nil
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("open log %s: %w", path, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{zr, f}, nil
+}
+
+// ParseLine decodes one line of a log with the given extension (".log" or
+// ".jsonl"). Lines that do not carry a timestamp and session, such as raw
+// logs, come back as plain text.
+func ParseLine(ext, line string) Record {
+	if ext == FormatJSON.Ext() {
+		var decoded struct {
+			Time    string `json:"time"`
+			Session string `json:"session"`
+			Line    string `json:"line"`
+		}
+		if json.Unmarshal([]byte(line), &decoded) == nil {
+			at, _ := time.Parse(time.RFC3339Nano, decoded.Time)
+			return Record{Time: at, Session: decoded.Session, Text: decoded.Line}
+		}
+		return Record{Text: line}
+	}
+	stamp, rest, ok := strings.Cut(line, " [")
+	if !ok {
+		return Record{Text: line}
+	}
+	at, err := time.Parse(TimeLayout, stamp)
+	if err != nil {
+		return Record{Text: line}
+	}
+	session, text, ok := strings.Cut(rest, "] ")
+	if !ok {
+		// An empty line is written as "<time> [<session>] " and may have
+		// lost its trailing space.
+		session, ok = strings.CutSuffix(rest, "]")
+		if !ok {
+			return Record{Text: line}
+		}
+	}
+	return Record{Time: at, Session: session, Text: text}
+}
+
+// Readable reports whether ReadFile understands f; raw copies and
+// recordings are skipped.
+func (f File) Readable() bool {
+	return f.Ext != RawExt && f.Ext != CastExt
+}
+
+// ReadFile calls fn for every line of f.
+func ReadFile(f File, fn func(Record) error) error {
+	r, err := OpenFile(f.Path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		record := ParseLine(f.Ext, scanner.Text())
+		record.Alias = f.Alias
+		record.File = f.Path
+		record.LineNo = lineNo
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read log %s: %w", f.Path, err)
+	}
+	return nil
+}
+
+// Sessions groups the lines of files by session, in order of first
+// appearance, and attaches recordings to their sessions.
+func Sessions(files []File) ([]Session, error) {
+	var out []Session
+	index := map[string]int{}
+	for _, f := range files {
+		if !f.Readable() {
+			continue
+		}
+		err := ReadFile(f, func(r Record) error {
+			key := r.Alias + "\x00" + r.Session
+			if r.Session == "" {
+				key += "\x00" + f.Path
+			}
+			i, ok := index[key]
+			if !ok {
+				i = len(out)
+				index[key] = i
+				out = append(out, Session{Alias: r.Alias, ID: r.Session, Start: r.Time})
+			}
+			s := &out[i]
+			s.Lines++
+			if !r.Time.IsZero() {
+				if s.Start.IsZero() || r.Time.Before(s.Start) {
+					s.Start = r.Time
+				}
+				if r.Time.After(s.End) {
+					s.End = r.Time
+				}
+			}
+			if len(s.Files) == 0 || s.Files[len(s.Files)-1] != f.Path {
+				s.Files = append(s.Files, f.Path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range files {
+		if f.Ext != CastExt {
+			continue
+		}
+		if i, ok := index[f.Alias+"\x00"+f.Session]; ok {
+			out[i].Recording = f.Path
+			continue
+		}
+		out = append(out, Session{Alias: f.Alias, ID: f.Session, Files: []string{f.Path}, Recording: f.Path})
+	}
+	metas := map[string]map[string]Meta{}
+	for i := range out {
+		s := &out[i]
+		if s.ID == "" || len(s.Files) == 0 {
+			continue
+		}
+		dir := filepath.Dir(s.Files[0])
+		if _, ok := metas[dir]; !ok {
+			metas[dir], _ = ReadMeta(dir)
+		}
+		s.Redactions = metas[dir][s.ID].Redactions
+	}
+	return out, nil
+}
+
+// Tailer reads the lines appended to a log that is still being written.
+type Tailer struct {
+	File   File
+	offset int64
+	lineNo int
+}
+
+// Read calls fn for every complete line added since the last call. A partial
+// last line is left for the next call.
+func (t *Tailer) Read(fn func(Record) error) error {
+	f, err := os.Open(t.File.Path)
+	if err != nil {
+		return fmt.Errorf("open log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(t.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("read log %s: %w", t.File.Path, err)
+	}
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read log %s: %w", t.File.Path, err)
+		}
+		t.offset += int64(len(line))
+		t.lineNo++
+		record := ParseLine(t.File.Ext, strings.TrimSuffix(line, "\n"))
+		record.Alias = t.File.Alias
+		record.File = t.File.Path
+		record.LineNo = t.lineNo
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
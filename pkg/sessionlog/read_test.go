@@ -0,0 +1,94 @@
+package sessionlog
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	text := ParseLine(".log", "2026-10-18T09:30:00Z [s1] $ uptime")
+	if text.Session != "s1" || text.Text != "$ uptime" || text.Time.IsZero() {
+		t.Fatalf("unexpected text record %+v", text)
+	}
+	empty := ParseLine(".log", "2026-10-18T09:30:00Z [s1]")
+	if empty.Session != "s1" || empty.Text != "" {
+		t.Fatalf("unexpected empty record %+v", empty)
+	}
+	structured := ParseLine(".jsonl", `{"time":"2026-10-18T09:30:00.5Z","session":"s2","line":"ok"}`)
+	if structured.Session != "s2" || structured.Text != "ok" || structured.Time.Nanosecond() != 5e8 {
+		t.Fatalf("unexpected json record %+v", structured)
+	}
+	raw := ParseLine(".log", "plain [output]")
+	if raw.Session != "" || raw.Text != "plain [output]" || !raw.Time.IsZero() {
+		t.Fatalf("unexpected raw record %+v", raw)
+	}
+}
+
+func TestSessionsReadCompressedLogs(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "db1")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(dir, "2026-10-17.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	_, _ = zw.Write([]byte("2026-10-17T23:59:00Z [s1] a\n2026-10-17T23:59:30Z [s2] b\n"))
+	_ = zw.Close()
+	_ = f.Close()
+	if err := os.WriteFile(filepath.Join(dir, "2026-10-18.log"), []byte("2026-10-18T00:00:10Z [s1] c\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "2026-10-18.raw"), []byte("\x1b[1mraw\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ListFiles(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := Sessions(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v", sessions)
+	}
+	s1 := sessions[0]
+	if s1.ID != "s1" || s1.Lines != 2 || len(s1.Files) != 2 || !s1.End.Equal(time.Date(2026, 10, 18, 0, 0, 10, 0, time.UTC)) {
+		t.Fatalf("unexpected session %+v", s1)
+	}
+}
+
+func TestTailerLeavesPartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "2026-10-18.log")
+	if err := os.WriteFile(path, []byte("2026-10-18T09:00:00Z [s1] one\n2026-10-18T09:00:01Z [s1] tw"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tailer := &Tailer{File: File{Path: path, Ext: ".log"}}
+	var got []string
+	read := func(r Record) error {
+		got = append(got, r.Text)
+		return nil
+	}
+	if err := tailer.Read(read); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("o\n")
+	_ = f.Close()
+	if err := tailer.Read(read); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != "one" || got[1] != "two" {
+		t.Fatalf("unexpected lines %q", got)
+	}
+}
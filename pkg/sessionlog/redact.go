@@ -0,0 +1,206 @@
+package sessionlog
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secrets in logs.
+const Redacted = "[REDACTED]"
+
+// DefaultRedactPatterns match common secrets. When a pattern has a group
+// named "secret" only that group is replaced, keeping the context readable.
+var DefaultRedactPatterns = []string{
+	// AWS access key IDs.
+	`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+	// AWS secret access keys in credential files and environment variables.
+	`(?i)aws_secret_access_key\s*[=:]\s*["']?(?P<secret>[A-Za-z0-9/+=]{40})`,
+	// Bearer tokens, e.g. in Authorization headers.
+	`(?i)\bbearer\s+(?P<secret>[A-Za-z0-9._~+/-]+=*)`,
+	// GitHub tokens.
+	`\bgh[pousr]_[A-Za-z0-9]{36,}\b`,
+}
+
+// MinSecretLength is the shortest stored credential that is redacted
+// literally; shorter values would blank out ordinary output.
+const MinSecretLength = 4
+
+var (
+	keyBegin = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+	keyEnd   = regexp.MustCompile(`-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+)
+
+// Redactor removes secrets from log output: matches of its patterns, literal
+// secret values and whole private key blocks. It keeps state across lines
+// (a key block spans many), so each output stream needs its own Redactor;
+// see Clone.
+type Redactor struct {
+	patterns []*regexp.Regexp
+	secrets  []string
+	inKey    bool
+	count    int
+	// pending is the tail of the last chunk that Bytes held back; see Flush.
+	pending []byte
+}
+
+// NewRedactor compiles patterns and returns a Redactor that also replaces
+// the literal secrets.
+func NewRedactor(patterns, secrets []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	for _, secret := range secrets {
+		if len(secret) >= MinSecretLength {
+			r.secrets = append(r.secrets, secret)
+		}
+	}
+	return r, nil
+}
+
+// Clone returns a Redactor with the same patterns and secrets and fresh
+// state.
+func (r *Redactor) Clone() *Redactor {
+	if r == nil {
+		return nil
+	}
+	return &Redactor{patterns: r.patterns, secrets: r.secrets}
+}
+
+// Count is how many secrets were redacted so far. A private key block counts
+// once.
+func (r *Redactor) Count() int {
+	if r == nil {
+		return 0
+	}
+	return r.count
+}
+
+// Line redacts one line. It returns false for lines inside a private key
+// block, which should be left out.
+func (r *Redactor) Line(line string) (string, bool) {
+	if r == nil {
+		return line, true
+	}
+	if r.inKey {
+		loc := keyEnd.FindStringIndex(line)
+		if loc == nil {
+			return "", false
+		}
+		r.inKey = false
+		rest := r.redact(line[loc[1]:])
+		return rest, rest != ""
+	}
+	return r.redact(line), true
+}
+
+// Bytes redacts a chunk of a raw stream line by line, dropping the lines of
+// private key blocks. A chunk that ends with the start of a stored secret
+// has that tail held back until the next chunk (or Flush) shows whether the
+// rest of the secret follows. Pattern matches split across chunks are not
+// detected.
+func (r *Redactor) Bytes(p []byte) []byte {
+	if r == nil {
+		return p
+	}
+	if len(r.pending) > 0 {
+		p = append(r.pending, p...)
+		r.pending = nil
+	}
+	if hold := r.secretPrefix(p); hold > 0 {
+		r.pending = append([]byte(nil), p[len(p)-hold:]...)
+		p = p[:len(p)-hold]
+	}
+	return r.lines(p)
+}
+
+// Flush redacts and returns the tail that Bytes held back, at the end of
+// the stream.
+func (r *Redactor) Flush() []byte {
+	if r == nil || len(r.pending) == 0 {
+		return nil
+	}
+	p := r.pending
+	r.pending = nil
+	return r.lines(p)
+}
+
+// secretPrefix is the length of the longest tail of p that starts a stored
+// secret without completing it.
+func (r *Redactor) secretPrefix(p []byte) int {
+	longest := 0
+	for _, secret := range r.secrets {
+		for n := min(len(secret)-1, len(p)); n > longest; n-- {
+			if bytes.HasSuffix(p, []byte(secret[:n])) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
+
+func (r *Redactor) lines(p []byte) []byte {
+	var out bytes.Buffer
+	for len(p) > 0 {
+		segment := p
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			segment = p[:i+1]
+		}
+		p = p[len(segment):]
+		text := string(segment)
+		body := strings.TrimRight(text, "\r\n")
+		ending := text[len(body):]
+		if redacted, keep := r.Line(body); keep {
+			out.WriteString(redacted)
+			out.WriteString(ending)
+		}
+	}
+	return out.Bytes()
+}
+
+// redact handles a line outside any key block.
+func (r *Redactor) redact(line string) string {
+	if loc := keyBegin.FindStringIndex(line); loc != nil {
+		r.count++
+		before := r.redactText(line[:loc[0]]) + Redacted
+		rest := line[loc[1]:]
+		end := keyEnd.FindStringIndex(rest)
+		if end == nil {
+			r.inKey = true
+			return before
+		}
+		return before + r.redact(rest[end[1]:])
+	}
+	return r.redactText(line)
+}
+
+func (r *Redactor) redactText(text string) string {
+	for _, secret := range r.secrets {
+		if n := strings.Count(text, secret); n > 0 {
+			r.count += n
+			text = strings.ReplaceAll(text, secret, Redacted)
+		}
+	}
+	for _, re := range r.patterns {
+		group := re.SubexpIndex("secret")
+		text = re.ReplaceAllStringFunc(text, func(match string) string {
+			r.count++
+			if group < 0 {
+				return Redacted
+			}
+			sub := re.FindStringSubmatchIndex(match)
+			if sub == nil || sub[2*group] < 0 {
+				return Redacted
+			}
+			return match[:sub[2*group]] + Redacted + match[sub[2*group+1]:]
+		})
+	}
+	return text
+}
@@ -0,0 +1,113 @@
+package sessionlog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// rotatingFile appends to the day's log in dir, moving on to the next
+// numbered file (2026-10-18.1.log, .2.log, ...) once the current one reaches
+// maxSize, and to a new day's file after midnight. Several writers may share
+// a host's log; each picks the newest file that still has room.
+type rotatingFile struct {
+	dir     string
+	ext     string
+	maxSize int64
+	now     func() time.Time
+
+	f    *os.File
+	date string
+	// size is the length of f, counted as it is written so that writes need
+	// not stat the file; other writers' appends are seen on the next open.
+	size int64
+}
+
+// logName returns the name of the n-th file of a day.
+func logName(date string, n int, ext string) string {
+	if n == 0 {
+		return date + ext
+	}
+	return fmt.Sprintf("%s.%d%s", date, n, ext)
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if err := r.ensure(); err != nil {
+		return 0, err
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// ensure opens the file the next write belongs in.
+func (r *rotatingFile) ensure() error {
+	date := r.now().Format("2006-01-02")
+	if r.f != nil && date == r.date && (r.maxSize <= 0 || r.size < r.maxSize) {
+		return nil
+	}
+	path := r.pick(date)
+	if r.f != nil && r.f.Name() == path {
+		return r.stat()
+	}
+	f, err := openAppend(path)
+	if err != nil {
+		return err
+	}
+	if r.f != nil {
+		r.f.Close()
+	}
+	r.f, r.date = f, date
+	return r.stat()
+}
+
+// stat reads the size of the open file.
+func (r *rotatingFile) stat() error {
+	info, err := r.f.Stat()
+	if err != nil {
+		return err
+	}
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) full(path string) bool {
+	if r.maxSize <= 0 {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Size() >= r.maxSize
+}
+
+// pick returns the newest file of the day with room left, or the next
+// unused name.
+func (r *rotatingFile) pick(date string) string {
+	last := -1
+	for n := 0; ; n++ {
+		path := filepath.Join(r.dir, logName(date, n, r.ext))
+		if !exists(path) && !exists(path+gzipExt) {
+			break
+		}
+		last = n
+	}
+	if last >= 0 {
+		path := filepath.Join(r.dir, logName(date, last, r.ext))
+		if exists(path) && !r.full(path) {
+			return path
+		}
+	}
+	return filepath.Join(r.dir, logName(date, last+1, r.ext))
+}
+
+func (r *rotatingFile) Close() error {
+	if r.f == nil {
+		return nil
+	}
+	return r.f.Close()
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
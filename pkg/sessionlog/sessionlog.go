@@ -0,0 +1,320 @@
+package sessionlog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Format selects how session output is written.
+type Format string
+
+const (
+	// FormatText writes cleaned lines prefixed with a timestamp and the
+	// session ID.
+	FormatText Format = "text"
+	// FormatJSON writes cleaned lines as JSON objects, one per line.
+	FormatJSON Format = "json"
+	// FormatRaw writes the pane's bytes unchanged.
+	FormatRaw Format = "raw"
+)
+
+// TimeLayout is the timestamp format of text log lines.
+const TimeLayout = time.RFC3339
+
+func ParseFormat(raw string) (Format, error) {
+	switch Format(strings.ToLower(strings.TrimSpace(raw))) {
+	case "", FormatText:
+		return FormatText, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	case FormatRaw:
+		return FormatRaw, nil
+	default:
+		return "", fmt.Errorf("unknown log format %q (expected text, json or raw)", raw)
+	}
+}
+
+// Ext is the file extension of logs in the format.
+func (f Format) Ext() string {
+	if f == FormatJSON {
+		return ".jsonl"
+	}
+	return ".log"
+}
+
+// RawExt is the extension of the raw copy kept next to a cleaned log.
+const RawExt = ".raw"
+
+// NewSessionID returns an ID that tells sessions in the same log apart.
+func NewSessionID(now time.Time) string {
+	var buf [2]byte
+	_, _ = rand.Read(buf[:])
+	return now.Format("20060102-150405") + "-" + hex.EncodeToString(buf[:])
+}
+
+// Options configure a Writer.
+type Options struct {
+	Session string
+	Format  Format
+	// KeepRaw also keeps an unprocessed copy of the output.
+	KeepRaw bool
+	// MaxFileSize rotates to a new numbered file once the current one
+	// reaches it; 0 disables rotation by size.
+	MaxFileSize int64
+	// Record also writes an asciicast recording of the session, for a
+	// terminal of Width x Height, titled Title.
+	Record bool
+	Width  int
+	Height int
+	Title  string
+	// Redact, if set, removes secrets from everything written, including
+	// raw copies and recordings.
+	Redact *Redactor
+}
+
+// Writer receives raw pane output and writes it in the configured format.
+type Writer struct {
+	Options
+	// Out receives the formatted log; Raw, if set, the unprocessed bytes
+	// and Cast, if set, a timed recording of them.
+	Out  io.Writer
+	Raw  io.Writer
+	Cast *Recorder
+	// Now defaults to time.Now.
+	Now func() time.Time
+
+	cleaner   Cleaner
+	lineStart time.Time
+	err       error
+	closers   []io.Closer
+
+	// Set by Open: where to record the session's metadata, when it began,
+	// and the redactors of the raw copy and recording.
+	dir          string
+	started      time.Time
+	rawRedact    *Redactor
+	recordRedact *Redactor
+}
+
+// MetaFile is the file in a host's log directory that gets one JSON object
+// per finished session.
+const MetaFile = "sessions.jsonl"
+
+// Meta describes a finished session.
+type Meta struct {
+	Session    string    `json:"session"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Redactions int       `json:"redactions"`
+}
+
+// Open creates a Writer appending to the day's log files in dir (and the raw
+// copy when KeepRaw is set), rotating them by date and MaxFileSize. With
+// Record set it also starts the session's recording.
+func Open(dir string, opts Options) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create log dir: %w", err)
+	}
+	w := &Writer{Options: opts, dir: dir, rawRedact: opts.Redact.Clone(), recordRedact: opts.Redact.Clone()}
+	w.started = w.now()
+	out := &rotatingFile{dir: dir, ext: opts.Format.Ext(), maxSize: opts.MaxFileSize, now: w.now}
+	if err := out.ensure(); err != nil {
+		return nil, err
+	}
+	w.Out = out
+	w.closers = append(w.closers, out)
+	if opts.KeepRaw && opts.Format != FormatRaw {
+		raw := &rotatingFile{dir: dir, ext: RawExt, maxSize: opts.MaxFileSize, now: w.now}
+		if err := raw.ensure(); err != nil {
+			out.Close()
+			return nil, err
+		}
+		w.Raw = raw
+		w.closers = append(w.closers, raw)
+	}
+	if opts.Record {
+		if err := w.startRecording(dir); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (w *Writer) startRecording(dir string) error {
+	now := w.now()
+	f, err := os.OpenFile(filepath.Join(dir, castName(now.Format("2006-01-02"), w.Session)), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open recording: %w", err)
+	}
+	w.closers = append(w.closers, f)
+	w.Cast, err = NewRecorder(f, CastHeader{Width: w.Width, Height: w.Height, Title: w.Title}, w.now)
+	return err
+}
+
+func openAppend(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open log: %w", err)
+	}
+	return f, nil
+}
+
+func (w *Writer) now() time.Time {
+	if w.Now != nil {
+		return w.Now()
+	}
+	return time.Now()
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.Cast != nil {
+		if _, err := w.Cast.Write(w.recordRedact.Bytes(p)); err != nil {
+			return 0, err
+		}
+	}
+	if w.Raw != nil {
+		if _, err := w.Raw.Write(w.rawRedact.Bytes(p)); err != nil {
+			return 0, err
+		}
+	}
+	if w.Format == FormatRaw {
+		if _, err := w.Out.Write(w.Redact.Bytes(p)); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	now := w.now()
+	if w.lineStart.IsZero() {
+		w.lineStart = now
+	}
+	w.cleaner.Feed(p, func(line string) {
+		w.writeLine(w.lineStart, line)
+		w.lineStart = now
+	})
+	if !w.cleaner.Pending() {
+		w.lineStart = time.Time{}
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	return len(p), nil
+}
+
+// writeLine formats one cleaned line, stamped with the time its first byte
+// arrived.
+func (w *Writer) writeLine(at time.Time, line string) {
+	if w.err != nil {
+		return
+	}
+	line, keep := w.Redact.Line(line)
+	if !keep {
+		return
+	}
+	var record string
+	if w.Format == FormatJSON {
+		data, err := json.Marshal(struct {
+			Time    string `json:"time"`
+			Session string `json:"session,omitempty"`
+			Line    string `json:"line"`
+		}{at.Format(time.RFC3339Nano), w.Session, line})
+		if err != nil {
+			w.err = err
+			return
+		}
+		record = string(data) + "\n"
+	} else {
+		record = fmt.Sprintf("%s [%s] %s\n", at.Format(TimeLayout), w.Session, line)
+	}
+	_, w.err = io.WriteString(w.Out, record)
+}
+
+// Close writes out a trailing partial line and any output the redactors held
+// back, and closes files opened by Open.
+func (w *Writer) Close() error {
+	if w.Format != FormatRaw {
+		if line, ok := w.cleaner.Flush(); ok {
+			at := w.lineStart
+			if at.IsZero() {
+				at = w.now()
+			}
+			w.writeLine(at, line)
+		}
+	}
+	if w.Cast != nil {
+		if _, err := w.Cast.Write(w.recordRedact.Flush()); err != nil && w.err == nil {
+			w.err = err
+		}
+	}
+	if w.Raw != nil {
+		if _, err := w.Raw.Write(w.rawRedact.Flush()); err != nil && w.err == nil {
+			w.err = err
+		}
+	}
+	if w.Format == FormatRaw {
+		if _, err := w.Out.Write(w.Redact.Flush()); err != nil && w.err == nil {
+			w.err = err
+		}
+	}
+	err := w.err
+	if w.Cast != nil {
+		if cerr := w.Cast.Flush(); err == nil {
+			err = cerr
+		}
+	}
+	for _, c := range w.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if w.dir != "" {
+		if merr := w.writeMeta(); err == nil {
+			err = merr
+		}
+	}
+	return err
+}
+
+func (w *Writer) writeMeta() error {
+	data, err := json.Marshal(Meta{Session: w.Session, Start: w.started, End: w.now(), Redactions: w.Redact.Count()})
+	if err != nil {
+		return err
+	}
+	f, err := openAppend(filepath.Join(w.dir, MetaFile))
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ReadMeta returns the recorded metadata of the sessions logged in dir, by
+// session ID.
+func ReadMeta(dir string) (map[string]Meta, error) {
+	data, err := os.ReadFile(filepath.Join(dir, MetaFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]Meta{}, nil
+		}
+		return nil, fmt.Errorf("read session metadata: %w", err)
+	}
+	out := map[string]Meta{}
+	for _, line := range strings.Split(string(data), "\n") {
+		var meta Meta
+		if line == "" || json.Unmarshal([]byte(line), &meta) != nil {
+			continue
+		}
+		out[meta.Session] = meta
+	}
+	return out, nil
+}
@@ -0,0 +1,134 @@
+package sessionlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func clean(chunks ...string) []string {
+	var c Cleaner
+	var lines []string
+	for _, chunk := range chunks {
+		c.Feed([]byte(chunk), func(line string) { lines = append(lines, line) })
+	}
+	if line, ok := c.Flush(); ok {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestCleanerStripsEscapes(t *testing.T) {
+	got := clean(
+		"\x1b[1;32muser@db1\x1b[0m:~$ ls\r\n",
+		"\x1b]0;user@db1: ~\x07file\x1b(B.txt\r\n",
+		"\x1bP1$r0m\x1b\\done\n",
+	)
+	want := []string{"user@db1:~$ ls", "file.txt", "done"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestCleanerReplaysOverwrites(t *testing.T) {
+	got := clean(
+		"progress 10%\rprogress 100%\n",
+		"typo\b\b\b\bfixed\n",
+		"long line\r\x1b[Kshort\n",
+		"abc\x1b[2Dz\n",
+	)
+	want := []string{"progress 100%", "fixed", "short", "azc"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestCleanerHandlesSplitSequences(t *testing.T) {
+	got := clean("caf\xc3", "\xa9 \x1b[3", "1mred\x1b", "[0m\n")
+	if want := []string{"café red"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestCleanerSkipsAlternateScreen(t *testing.T) {
+	got := clean("$ vim\r\n\x1b[?1049h~\r\n~\r\n\x1b[?1049l$ exit\r\n")
+	if want := []string{"$ vim", "$ exit"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestWriterTextFormat(t *testing.T) {
+	var out, raw bytes.Buffer
+	at := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	w := &Writer{Options: Options{Session: "s1", Format: FormatText}, Out: &out, Raw: &raw, Now: func() time.Time { return at }}
+	input := "\x1b[32mok\x1b[0m\r\npartial"
+	if _, err := w.Write([]byte(input)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := "2026-10-18T09:30:00Z [s1] ok\n2026-10-18T09:30:00Z [s1] partial\n"
+	if out.String() != want {
+		t.Fatalf("got %q, want %q", out.String(), want)
+	}
+	if raw.String() != input {
+		t.Fatalf("raw copy %q", raw.String())
+	}
+}
+
+func TestWriterJSONFormat(t *testing.T) {
+	var out bytes.Buffer
+	w := &Writer{Options: Options{Session: "s1", Format: FormatJSON}, Out: &out}
+	if _, err := w.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	var record map[string]string
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out.String(), err)
+	}
+	if record["line"] != "hello" || record["session"] != "s1" || record["time"] == "" {
+		t.Fatalf("unexpected record %v", record)
+	}
+}
+
+func TestOpenCreatesFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db1")
+	w, err := Open(dir, Options{Session: "s1", Format: FormatText, KeepRaw: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("\x1b[1mhi\x1b[0m\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	date := time.Now().Format("2006-01-02")
+	text, err := os.ReadFile(filepath.Join(dir, date+".log"))
+	if err != nil || !strings.HasSuffix(string(text), " [s1] hi\n") {
+		t.Fatalf("unexpected text log %q (%v)", text, err)
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, date+RawExt))
+	if err != nil || string(raw) != "\x1b[1mhi\x1b[0m\n" {
+		t.Fatalf("unexpected raw log %q (%v)", raw, err)
+	}
+	info, err := os.Stat(filepath.Join(dir, date+".log"))
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected 0600 log file, got %v (%v)", info.Mode(), err)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if f, err := ParseFormat(""); err != nil || f != FormatText {
+		t.Fatalf("expected text default, got %q %v", f, err)
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
@@ -0,0 +1,225 @@
+package sshconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every edit of ssh config files first copies the files it is about to
+// write into a backup, so that it can be undone with Restore. Only the
+// newest backupLimit backups are kept.
+const backupLimit = 100
+
+// Backup is a copy of ssh config files taken before an edit.
+type Backup struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	// Action describes the edit the files were backed up for.
+	Action string       `json:"action"`
+	Files  []BackupFile `json:"files"`
+}
+
+// BackupFile is one file of a backup.
+type BackupFile struct {
+	Path string `json:"path"`
+	// Missing records that the file did not exist; restoring removes it.
+	Missing bool `json:"missing,omitempty"`
+}
+
+const backupManifest = "backup.json"
+
+// backupStamp is the layout of the time that backup IDs start with.
+const backupStamp = "20060102-150405"
+
+// BackupDir is the directory holding the backups.
+func BackupDir() (string, error) {
+	if xdg := strings.TrimSpace(os.Getenv("XDG_CONFIG_HOME")); xdg != "" {
+		return filepath.Join(xdg, "tmux-ssh-manager", "backups"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home: %w", err)
+	}
+	return filepath.Join(home, ".config", "tmux-ssh-manager", "backups"), nil
+}
+
+// Backups lists the backups, newest first.
+func Backups() ([]Backup, error) {
+	base, err := BackupDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read backups: %w", err)
+	}
+	var backups []Backup
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		backup, err := readBackup(filepath.Join(base, entry.Name()))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup)
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		if !backups[i].Created.Equal(backups[j].Created) {
+			return backups[i].Created.After(backups[j].Created)
+		}
+		stampI, nI := backupSeq(backups[i].ID)
+		stampJ, nJ := backupSeq(backups[j].ID)
+		if stampI != stampJ {
+			return stampI > stampJ
+		}
+		return nI > nJ
+	})
+	return backups, nil
+}
+
+// backupSeq splits a backup ID into its timestamp and the number that tells
+// apart the backups of the same second: 1 for the first, which has none.
+func backupSeq(id string) (string, int) {
+	if i := strings.LastIndexByte(id, '-'); i == len(backupStamp) {
+		if n, err := strconv.Atoi(id[i+1:]); err == nil {
+			return id[:i], n
+		}
+	}
+	return id, 1
+}
+
+// Restore writes the files of backup id back, removing those that did not
+// exist then. The files are backed up first, and that backup is returned:
+// restoring it undoes the restore.
+func Restore(id string) (Backup, error) {
+	base, err := BackupDir()
+	if err != nil {
+		return Backup{}, err
+	}
+	dir := filepath.Join(base, filepath.Base(id))
+	backup, err := readBackup(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Backup{}, fmt.Errorf("unknown backup %q", id)
+		}
+		return Backup{}, err
+	}
+	paths := make([]string, len(backup.Files))
+	for i, file := range backup.Files {
+		paths[i] = file.Path
+	}
+	current, err := takeBackup("restore "+backup.ID, paths)
+	if err != nil {
+		return Backup{}, err
+	}
+	for i, file := range backup.Files {
+		if file.Missing {
+			if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+				return Backup{}, fmt.Errorf("restore %s: %w", file.Path, err)
+			}
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, backupFileName(i, file.Path)))
+		if err != nil {
+			return Backup{}, fmt.Errorf("read backup: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(file.Path), 0o700); err != nil {
+			return Backup{}, fmt.Errorf("create ssh config dir: %w", err)
+		}
+		if err := replaceFile(file.Path, data); err != nil {
+			return Backup{}, err
+		}
+	}
+	return current, nil
+}
+
+// takeBackup copies the files at paths into a new backup for action.
+func takeBackup(action string, paths []string) (Backup, error) {
+	base, err := BackupDir()
+	if err != nil {
+		return Backup{}, err
+	}
+	now := time.Now()
+	backup := Backup{Created: now, Action: action}
+	if err := os.MkdirAll(base, 0o700); err != nil {
+		return Backup{}, fmt.Errorf("create backup dir: %w", err)
+	}
+	stamp := now.Format(backupStamp)
+	var dir string
+	for n := 1; ; n++ {
+		backup.ID = stamp
+		if n > 1 {
+			backup.ID += "-" + strconv.Itoa(n)
+		}
+		dir = filepath.Join(base, backup.ID)
+		if err := os.Mkdir(dir, 0o700); err == nil {
+			break
+		} else if !os.IsExist(err) {
+			return Backup{}, fmt.Errorf("create backup dir: %w", err)
+		}
+	}
+	for i, path := range paths {
+		path = expandPath(path)
+		file := BackupFile{Path: path}
+		data, err := os.ReadFile(path)
+		switch {
+		case os.IsNotExist(err):
+			file.Missing = true
+		case err != nil:
+			return Backup{}, fmt.Errorf("back up %s: %w", path, err)
+		default:
+			if err := os.WriteFile(filepath.Join(dir, backupFileName(i, path)), data, 0o600); err != nil {
+				return Backup{}, fmt.Errorf("write backup: %w", err)
+			}
+		}
+		backup.Files = append(backup.Files, file)
+	}
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return Backup{}, fmt.Errorf("encode backup: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, backupManifest), append(data, '\n'), 0o600); err != nil {
+		return Backup{}, fmt.Errorf("write backup: %w", err)
+	}
+	pruneBackups(base)
+	return backup, nil
+}
+
+func readBackup(dir string) (Backup, error) {
+	data, err := os.ReadFile(filepath.Join(dir, backupManifest))
+	if err != nil {
+		return Backup{}, err
+	}
+	var backup Backup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return Backup{}, fmt.Errorf("parse backup %s: %w", filepath.Base(dir), err)
+	}
+	return backup, nil
+}
+
+// pruneBackups drops the oldest backups beyond backupLimit.
+func pruneBackups(base string) {
+	backups, err := Backups()
+	if err != nil || len(backups) <= backupLimit {
+		return
+	}
+	for _, backup := range backups[backupLimit:] {
+		_ = os.RemoveAll(filepath.Join(base, backup.ID))
+	}
+}
+
+// backupFileName names the copy of the index-th file of a backup; the
+// original's name keeps the directory readable.
+func backupFileName(index int, path string) string {
+	return fmt.Sprintf("%d-%s", index+1, filepath.Base(path))
+}
@@ -0,0 +1,114 @@
+package sshconfig
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain keeps the backups every edit takes out of the real config
+// directory.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "sshconfig-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestEditsAreBackedUpAndRestored(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path, hosts := loadEdited(t, editConfig)
+	extra := filepath.Join(filepath.Dir(path), "extra")
+
+	removed, err := RemoveHosts([]Host{hosts["db1"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := AddHost(extra, AddHostInput{Alias: "lab", HostName: "10.0.0.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backups, err := Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 || backups[0].Action != "add lab" || backups[1].Action != "delete db1" {
+		t.Fatalf("expected both edits backed up, newest first, got %+v", backups)
+	}
+	if backups[0].ID != added.ID || backups[1].ID != removed.ID {
+		t.Fatalf("expected the edits to return their backups, got %q %q", added.ID, removed.ID)
+	}
+	if !backups[0].Files[0].Missing || backups[1].Files[0].Path != path {
+		t.Fatalf("unexpected files %+v %+v", backups[0].Files, backups[1].Files)
+	}
+
+	undo, err := Restore(backups[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readConfig(t, path); got != editConfig {
+		t.Fatalf("expected the config before the delete, got:\n%s", got)
+	}
+	if _, err := Restore(backups[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(extra); !os.IsNotExist(err) {
+		t.Fatalf("expected the added file removed, got %v", err)
+	}
+
+	// Restoring the backup a restore took undoes it.
+	if undo.Action != "restore "+backups[1].ID {
+		t.Fatalf("unexpected action %q", undo.Action)
+	}
+	if _, err := Restore(undo.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := readConfig(t, path); strings.Contains(got, "db1") {
+		t.Fatalf("expected the delete back, got:\n%s", got)
+	}
+	if _, err := Restore("nope"); err == nil || !strings.Contains(err.Error(), "unknown backup") {
+		t.Fatalf("expected an unknown backup error, got %v", err)
+	}
+}
+
+func TestBackupsOfTheSameSecondSortNumerically(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	base, err := BackupDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for n := 1; n <= 12; n++ {
+		id := created.Format(backupStamp)
+		if n > 1 {
+			id += "-" + strconv.Itoa(n)
+		}
+		data, err := json.Marshal(Backup{ID: id, Created: created, Action: "edit " + strconv.Itoa(n)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(base, id), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(base, id, backupManifest), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, err := Backups()
+	if err != nil || len(backups) != 12 {
+		t.Fatalf("expected 12 backups, got %d (%v)", len(backups), err)
+	}
+	for i, backup := range backups {
+		if want := "edit " + strconv.Itoa(12-i); backup.Action != want {
+			t.Fatalf("expected %q at %d, got %q", want, i, backup.Action)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package sshconfig
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// A host's block runs from its Host line to the next Host, Match or Include
+// line, less the blank lines and plain comments just before that line: those
+// introduce what follows. Edits find blocks by Host.SourceLine, so hosts
+// must come from a fresh Load of the files being edited. The files are
+// backed up before they are written, and the edits return that backup:
+// restoring it undoes the edit.
+
+// RemoveHosts deletes the hosts' blocks from the files that define them. A
+// host that shares its block with other patterns ("Host a b") is only
+// dropped from the Host line.
+func RemoveHosts(hosts []Host) (Backup, error) {
+	return editBlocks("delete "+hostAliases(hosts), hosts, func(lines []string, start, end int, host Host) ([]string, error) {
+		patterns := blockPatterns(lines[start])
+		if len(patterns) > 1 {
+			lines[start] = indentOf(lines[start]) + "Host " + strings.Join(without(patterns, host.Alias), " ")
+			return lines, nil
+		}
+		lines = append(lines[:start], lines[end:]...)
+		// Keep a single blank line between the blocks around the gap.
+		if start < len(lines) && isBlank(lines[start]) && (start == 0 || isBlank(lines[start-1])) {
+			lines = append(lines[:start], lines[start+1:]...)
+		}
+		for len(lines) > 0 && isBlank(lines[len(lines)-1]) {
+			lines = lines[:len(lines)-1]
+		}
+		return lines, nil
+	})
+}
+
+// RenameHost renames host to alias on its Host line; other patterns sharing
+// the line keep theirs. The alias must not be taken in the host's file.
+func RenameHost(host Host, alias string) (Backup, error) {
+	alias = strings.TrimSpace(alias)
+	if alias == "" || strings.ContainsAny(alias, " \t*?!") {
+		return Backup{}, fmt.Errorf("invalid alias %q", alias)
+	}
+	if alias == host.Alias {
+		return Backup{}, fmt.Errorf("host is already called %s", alias)
+	}
+	current, err := Load(host.SourcePath)
+	if err != nil {
+		return Backup{}, err
+	}
+	for _, existing := range current {
+		if existing.Alias == alias {
+			return Backup{}, fmt.Errorf("host alias already exists: %s", alias)
+		}
+	}
+	return editBlocks("rename "+host.Alias+" to "+alias, []Host{host}, func(lines []string, start, end int, host Host) ([]string, error) {
+		patterns := blockPatterns(lines[start])
+		for i, pattern := range patterns {
+			if pattern == host.Alias {
+				patterns[i] = alias
+			}
+		}
+		lines[start] = indentOf(lines[start]) + "Host " + strings.Join(patterns, " ")
+		return lines, nil
+	})
+}
+
+// EditTags adds and removes tags in the hosts' "# tssm:tags" annotations,
+// writing the annotation when a host had no tags and dropping it when none
+// are left. Tags are per block: hosts sharing a block share them.
+func EditTags(hosts []Host, add, remove []string) (Backup, error) {
+	action := "tag"
+	if len(add) > 0 {
+		action += " +" + strings.Join(add, ",")
+	}
+	if len(remove) > 0 {
+		action += " -" + strings.Join(remove, ",")
+	}
+	return editBlocks(action+" on "+hostAliases(hosts), hosts, func(lines []string, start, end int, host Host) ([]string, error) {
+		line := -1
+		var tags []string
+		for i := start + 1; i < end; i++ {
+			if key, value, ok := parseAnnotation(lines[i]); ok && key == "tags" {
+				line, tags = i, splitTags(value)
+			}
+		}
+		next := make([]string, 0, len(tags)+len(add))
+		for _, tag := range append(tags, add...) {
+			if !containsString(next, tag) && !containsString(remove, tag) {
+				next = append(next, tag)
+			}
+		}
+		switch {
+		case line >= 0 && len(next) == 0:
+			return append(lines[:line], lines[line+1:]...), nil
+		case line >= 0:
+			lines[line] = indentOf(lines[line]) + "# " + annotationPrefix + "tags " + strings.Join(next, ",")
+			return lines, nil
+		case len(next) > 0:
+			indent := "  "
+			if start+1 < end && !isBlank(lines[start+1]) {
+				indent = indentOf(lines[start+1])
+			}
+			annotation := indent + "# " + annotationPrefix + "tags " + strings.Join(next, ",")
+			return append(lines[:start+1], append([]string{annotation}, lines[start+1:]...)...), nil
+		}
+		return lines, nil
+	})
+}
+
+// ExportHosts returns the hosts' blocks as written in their files, one
+// after the other. A block shared with other patterns is exported under
+// the host's alias alone.
+func ExportHosts(hosts []Host) (string, error) {
+	files := map[string][]string{}
+	var blocks []string
+	for _, host := range hosts {
+		lines, ok := files[host.SourcePath]
+		if !ok {
+			var err error
+			if lines, err = readLines(host.SourcePath); err != nil {
+				return "", err
+			}
+			files[host.SourcePath] = lines
+		}
+		start, end, err := findBlock(lines, host)
+		if err != nil {
+			return "", err
+		}
+		block := append([]string{"Host " + host.Alias}, lines[start+1:end]...)
+		blocks = append(blocks, strings.Join(block, "\n")+"\n")
+	}
+	return strings.Join(blocks, "\n"), nil
+}
+
+// editBlocks applies edit to each host's block, file by file, and writes
+// the files once every block was edited, after backing them up for action.
+// It returns the backup.
+// Blocks are edited from the bottom of a file up, so that an edit never
+// moves the blocks still to do.
+func editBlocks(action string, hosts []Host, edit func(lines []string, start, end int, host Host) ([]string, error)) (Backup, error) {
+	byPath := map[string][]Host{}
+	var paths []string
+	for _, host := range hosts {
+		if _, ok := byPath[host.SourcePath]; !ok {
+			paths = append(paths, host.SourcePath)
+		}
+		byPath[host.SourcePath] = append(byPath[host.SourcePath], host)
+	}
+	edited := make([][]string, len(paths))
+	for i, path := range paths {
+		lines, err := readLines(path)
+		if err != nil {
+			return Backup{}, err
+		}
+		inFile := byPath[path]
+		sort.SliceStable(inFile, func(i, j int) bool { return inFile[i].SourceLine > inFile[j].SourceLine })
+		for _, host := range inFile {
+			start, end, err := findBlock(lines, host)
+			if err != nil {
+				return Backup{}, err
+			}
+			if lines, err = edit(lines, start, end, host); err != nil {
+				return Backup{}, err
+			}
+		}
+		edited[i] = lines
+	}
+	backup, err := takeBackup(action, paths)
+	if err != nil {
+		return Backup{}, err
+	}
+	for i, path := range paths {
+		if err := writeLines(path, edited[i]); err != nil {
+			return Backup{}, err
+		}
+	}
+	return backup, nil
+}
+
+func hostAliases(hosts []Host) string {
+	aliases := make([]string, len(hosts))
+	for i, host := range hosts {
+		aliases[i] = host.Alias
+	}
+	return strings.Join(aliases, ", ")
+}
+
+// findBlock locates host's block: [start, end) in lines.
+func findBlock(lines []string, host Host) (int, int, error) {
+	start := host.SourceLine - 1
+	if start < 0 || start >= len(lines) || !containsString(blockPatterns(lines[start]), host.Alias) {
+		return 0, 0, fmt.Errorf("host %s is no longer at %s:%d; reload and try again", host.Alias, host.SourcePath, host.SourceLine)
+	}
+	end := len(lines)
+	for i := start + 1; i < len(lines); i++ {
+		key, _, ok := splitDirective(strings.TrimSpace(stripInlineComment(lines[i])))
+		if ok && (strings.EqualFold(key, "host") || strings.EqualFold(key, "match") || strings.EqualFold(key, "include")) {
+			end = i
+			break
+		}
+	}
+	for end > start+1 {
+		line := strings.TrimSpace(lines[end-1])
+		if _, _, annotation := parseAnnotation(line); line != "" && (!strings.HasPrefix(line, "#") || annotation) {
+			break
+		}
+		end--
+	}
+	return start, end, nil
+}
+
+// blockPatterns returns the patterns of a Host line, or nil for any other
+// line.
+func blockPatterns(line string) []string {
+	key, value, ok := splitDirective(strings.TrimSpace(stripInlineComment(line)))
+	if !ok || !strings.EqualFold(key, "host") {
+		return nil
+	}
+	return strings.Fields(value)
+}
+
+func readLines(path string) ([]string, error) {
+	data, err := os.ReadFile(expandPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("read ssh config: %w", err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
+
+// writeLines replaces path with lines, through a temporary file.
+func writeLines(path string, lines []string) error {
+	data := strings.Join(lines, "\n")
+	if data != "" {
+		data += "\n"
+	}
+	return replaceFile(expandPath(path), []byte(data))
+}
+
+func replaceFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write ssh config: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("replace ssh config: %w", err)
+	}
+	return nil
+}
+
+func indentOf(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func without(items []string, item string) []string {
+	var out []string
+	for _, i := range items {
+		if i != item {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+func containsString(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const editConfig = `# web servers
+Host web1 web2
+  HostName web.example.com
+
+Host db1
+  # tssm:tags prod,db
+  HostName 10.0.0.5
+
+# staging
+Host db2
+  HostName 10.0.0.6
+`
+
+func loadEdited(t *testing.T, content string) (string, map[string]Host) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path, reload(t, path)
+}
+
+func reload(t *testing.T, path string) map[string]Host {
+	t.Helper()
+	hosts, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byAlias := map[string]Host{}
+	for _, h := range hosts {
+		byAlias[h.Alias] = h
+	}
+	return byAlias
+}
+
+func readConfig(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRemoveHostsKeepsNeighbours(t *testing.T) {
+	path, hosts := loadEdited(t, editConfig)
+	if _, err := RemoveHosts([]Host{hosts["db1"], hosts["web2"]}); err != nil {
+		t.Fatal(err)
+	}
+	want := "# web servers\nHost web1\n  HostName web.example.com\n\n# staging\nHost db2\n  HostName 10.0.0.6\n"
+	if got := readConfig(t, path); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if _, err := RemoveHosts([]Host{hosts["db1"]}); err == nil || !strings.Contains(err.Error(), "reload") {
+		t.Fatalf("expected a stale host error, got %v", err)
+	}
+}
+
+func TestRenameHostRewritesTheHostLine(t *testing.T) {
+	path, hosts := loadEdited(t, editConfig)
+	backup, err := RenameHost(hosts["web2"], "web3")
+	if err != nil || backup.Action != "rename web2 to web3" {
+		t.Fatalf("unexpected backup %+v (%v)", backup, err)
+	}
+	if got := readConfig(t, path); !strings.HasPrefix(got, "# web servers\nHost web1 web3\n  HostName web.example.com\n") {
+		t.Fatalf("expected web2 renamed in its shared block:\n%s", got)
+	}
+	hosts = reload(t, path)
+	if _, err := RenameHost(hosts["db1"], "db2"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected a taken alias error, got %v", err)
+	}
+	if _, err := RenameHost(hosts["db1"], "db*"); err == nil {
+		t.Fatal("expected a pattern to be refused")
+	}
+	if _, err := RenameHost(hosts["db1"], "pg1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := reload(t, path)["pg1"]; strings.Join(got.Tags, ",") != "prod,db" {
+		t.Fatalf("expected pg1 to keep db1's block, got %+v", got)
+	}
+}
+
+func TestEditTagsAddsAndRemovesAnnotations(t *testing.T) {
+	path, hosts := loadEdited(t, editConfig)
+	if _, err := EditTags([]Host{hosts["db1"], hosts["db2"]}, []string{"sql"}, []string{"prod"}); err != nil {
+		t.Fatal(err)
+	}
+	hosts = reload(t, path)
+	if got := strings.Join(hosts["db1"].Tags, ","); got != "db,sql" {
+		t.Fatalf("db1 tags %q", got)
+	}
+	if got := strings.Join(hosts["db2"].Tags, ","); got != "sql" {
+		t.Fatalf("db2 tags %q", got)
+	}
+	if _, err := EditTags([]Host{hosts["db2"]}, nil, []string{"sql"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readConfig(t, path); !strings.HasSuffix(got, "# staging\nHost db2\n  HostName 10.0.0.6\n") {
+		t.Fatalf("expected the empty annotation dropped:\n%s", got)
+	}
+}
+
+func TestExportHostsCopiesBlocks(t *testing.T) {
+	_, hosts := loadEdited(t, editConfig)
+	got, err := ExportHosts([]Host{hosts["web2"], hosts["db1"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Host web2\n  HostName web.example.com\n\nHost db1\n  # tssm:tags prod,db\n  HostName 10.0.0.5\n"
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
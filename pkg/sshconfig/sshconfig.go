@@ -17,8 +17,28 @@ type Host struct {
 	Port          int
 	ProxyJump     string
 	IdentityFiles []string
-	SourcePath    string
-	SourceLine    int
+	// LocalForwards, RemoteForwards and DynamicForwards hold the block's
+	// forwarding directives in ssh's command-line syntax, e.g.
+	// "5432:db.internal:5432" for "LocalForward 5432 db.internal:5432".
+	LocalForwards   []string
+	RemoteForwards  []string
+	DynamicForwards []string
+	// Tags come from a "# tssm:tags a,b" annotation inside the Host block.
+	Tags []string
+	// Annotations holds every "# tssm:<key> <value>" comment of the block,
+	// keyed by lowercase key.
+	Annotations map[string]string
+	// Directives are all of the block's directives in order, keys as
+	// written, including those Host has no field for.
+	Directives []Directive
+	SourcePath string
+	SourceLine int
+}
+
+// Directive is a "Key value" line of a Host block.
+type Directive struct {
+	Key   string
+	Value string
 }
 
 type AddHostInput struct {
@@ -28,6 +48,12 @@ type AddHostInput struct {
 	Port         int
 	ProxyJump    string
 	IdentityFile string
+	// Extra directives are written after the fields above, in order.
+	Extra []Directive
+	// Tags and Annotations become "# tssm:" comments; Annotations holds
+	// any other keys than "tags".
+	Tags        []string
+	Annotations map[string]string
 }
 
 func DefaultPrimaryPath() (string, error) {
@@ -86,10 +112,13 @@ func AddHostToPrimary(input AddHostInput) error {
 	if err != nil {
 		return err
 	}
-	return AddHost(path, input)
+	_, err = AddHost(path, input)
+	return err
 }
 
-func AddHost(path string, input AddHostInput) error {
+// AddHost appends a Host block for input to the file at path. It returns the
+// backup of the file taken first.
+func AddHost(path string, input AddHostInput) (Backup, error) {
 	input.Alias = strings.TrimSpace(input.Alias)
 	input.HostName = strings.TrimSpace(input.HostName)
 	input.User = strings.TrimSpace(input.User)
@@ -97,7 +126,7 @@ func AddHost(path string, input AddHostInput) error {
 	input.IdentityFile = strings.TrimSpace(input.IdentityFile)
 
 	if input.Alias == "" {
-		return fmt.Errorf("alias is required")
+		return Backup{}, fmt.Errorf("alias is required")
 	}
 	if input.HostName == "" {
 		input.HostName = input.Alias
@@ -105,17 +134,17 @@ func AddHost(path string, input AddHostInput) error {
 
 	current, err := Load(path)
 	if err != nil && !os.IsNotExist(err) {
-		return err
+		return Backup{}, err
 	}
 	for _, host := range current {
 		if host.Alias == input.Alias {
-			return fmt.Errorf("host alias already exists: %s", input.Alias)
+			return Backup{}, fmt.Errorf("host alias already exists: %s", input.Alias)
 		}
 	}
 
 	path = expandPath(path)
 	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
-		return fmt.Errorf("create ssh config dir: %w", err)
+		return Backup{}, fmt.Errorf("create ssh config dir: %w", err)
 	}
 
 	var builder strings.Builder
@@ -126,50 +155,166 @@ func AddHost(path string, input AddHostInput) error {
 		}
 		builder.WriteByte('\n')
 	}
+	builder.WriteString(RenderHostBlock(input))
 
-	builder.WriteString("Host ")
-	builder.WriteString(input.Alias)
-	builder.WriteByte('\n')
-	builder.WriteString("  HostName ")
-	builder.WriteString(input.HostName)
-	builder.WriteByte('\n')
-	if input.User != "" {
-		builder.WriteString("  User ")
-		builder.WriteString(input.User)
-		builder.WriteByte('\n')
+	backup, err := takeBackup("add "+input.Alias, []string{path})
+	if err != nil {
+		return Backup{}, err
+	}
+	return backup, replaceFile(path, []byte(builder.String()))
+}
+
+// RenderHostBlock returns the Host block AddHost writes for input. HostName
+// defaults to the alias.
+func RenderHostBlock(input AddHostInput) string {
+	alias := strings.TrimSpace(input.Alias)
+	hostName := strings.TrimSpace(input.HostName)
+	if hostName == "" {
+		hostName = alias
+	}
+	var builder strings.Builder
+	builder.WriteString("Host " + alias + "\n")
+	builder.WriteString("  HostName " + hostName + "\n")
+	if user := strings.TrimSpace(input.User); user != "" {
+		builder.WriteString("  User " + user + "\n")
 	}
 	if input.Port > 0 {
-		builder.WriteString("  Port ")
-		builder.WriteString(strconv.Itoa(input.Port))
-		builder.WriteByte('\n')
+		builder.WriteString("  Port " + strconv.Itoa(input.Port) + "\n")
 	}
-	if input.ProxyJump != "" {
-		builder.WriteString("  ProxyJump ")
-		builder.WriteString(input.ProxyJump)
-		builder.WriteByte('\n')
+	if jump := strings.TrimSpace(input.ProxyJump); jump != "" {
+		builder.WriteString("  ProxyJump " + jump + "\n")
 	}
-	if input.IdentityFile != "" {
-		builder.WriteString("  IdentityFile ")
-		builder.WriteString(input.IdentityFile)
-		builder.WriteByte('\n')
+	if identity := strings.TrimSpace(input.IdentityFile); identity != "" {
+		builder.WriteString("  IdentityFile " + identity + "\n")
+	}
+	for _, d := range input.Extra {
+		builder.WriteString("  " + d.Key + " " + d.Value + "\n")
+	}
+	if len(input.Tags) > 0 {
+		builder.WriteString("  # " + annotationPrefix + "tags " + strings.Join(input.Tags, ",") + "\n")
 	}
+	keys := make([]string, 0, len(input.Annotations))
+	for key := range input.Annotations {
+		if key != "tags" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		builder.WriteString(strings.TrimRight("  # "+annotationPrefix+key+" "+input.Annotations[key], " ") + "\n")
+	}
+	return builder.String()
+}
 
-	tmp := path + ".tmp"
-	if err := os.WriteFile(tmp, []byte(builder.String()), 0o600); err != nil {
-		return fmt.Errorf("write ssh config: %w", err)
+// formFields are the directives AddHostInput has a field for.
+var formFields = map[string]bool{"hostname": true, "user": true, "port": true, "proxyjump": true, "identityfile": true}
+
+// CloneInput copies every directive and annotation of src into an
+// AddHostInput for a new host called alias. The first value of each
+// directive AddHostInput has a field for fills that field; everything else,
+// such as a second IdentityFile, is kept in Extra.
+func CloneInput(src Host, alias string) AddHostInput {
+	input := AddHostInput{Alias: alias, Tags: append([]string(nil), src.Tags...)}
+	seen := map[string]bool{}
+	for _, d := range src.Directives {
+		key := strings.ToLower(d.Key)
+		if !formFields[key] || seen[key] {
+			input.Extra = append(input.Extra, d)
+			continue
+		}
+		seen[key] = true
+		switch key {
+		case "hostname":
+			input.HostName = d.Value
+		case "user":
+			input.User = d.Value
+		case "port":
+			if input.Port = parsePort(d.Value); input.Port == 0 {
+				input.Extra = append(input.Extra, d)
+			}
+		case "proxyjump":
+			input.ProxyJump = d.Value
+		case "identityfile":
+			input.IdentityFile = d.Value
+		}
 	}
-	if err := os.Rename(tmp, path); err != nil {
-		_ = os.Remove(tmp)
-		return fmt.Errorf("replace ssh config: %w", err)
+	for key, value := range src.Annotations {
+		if key == "tags" {
+			continue
+		}
+		if input.Annotations == nil {
+			input.Annotations = map[string]string{}
+		}
+		input.Annotations[key] = value
 	}
-	return nil
+	return input
+}
+
+// ConfigFiles lists path and every existing file it includes, directly or
+// through other includes, in the order ssh reads them.
+func ConfigFiles(path string) ([]string, error) {
+	var files []string
+	visited := map[string]struct{}{}
+	var walk func(path string) error
+	walk = func(path string) error {
+		abs, err := filepath.Abs(expandPath(path))
+		if err != nil {
+			return err
+		}
+		if _, ok := visited[abs]; ok {
+			return nil
+		}
+		visited[abs] = struct{}{}
+		f, err := os.Open(abs)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return fmt.Errorf("open ssh config %s: %w", abs, err)
+		}
+		defer f.Close()
+		files = append(files, abs)
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 2*1024*1024)
+		for scanner.Scan() {
+			key, value, ok := splitDirective(strings.TrimSpace(stripInlineComment(scanner.Text())))
+			if !ok || !strings.EqualFold(key, "include") {
+				continue
+			}
+			for _, includePath := range expandIncludes(abs, value) {
+				if err := walk(includePath); err != nil {
+					return err
+				}
+			}
+		}
+		return scanner.Err()
+	}
+	if err := walk(path); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// annotationPrefix marks comments inside a Host block that carry metadata for
+// this tool, e.g. "# tssm:tags prod,db". ssh itself ignores them.
+const annotationPrefix = "tssm:"
+
+// multiValued lists directives that may repeat within a Host block.
+var multiValued = map[string]bool{
+	"identityfile":   true,
+	"localforward":   true,
+	"remoteforward":  true,
+	"dynamicforward": true,
 }
 
 type hostBlock struct {
-	patterns  []string
-	settings  map[string][]string
-	source    string
-	startLine int
+	patterns    []string
+	settings    map[string][]string
+	directives  []Directive
+	annotations map[string]string
+	source      string
+	startLine   int
 }
 
 func parseRecursive(path string, visited map[string]struct{}) ([]Host, error) {
@@ -208,6 +353,12 @@ func parseRecursive(path string, visited map[string]struct{}) ([]Host, error) {
 	scanner.Buffer(make([]byte, 0, 64*1024), 2*1024*1024)
 	for scanner.Scan() {
 		lineNo++
+		if current != nil {
+			if key, value, ok := parseAnnotation(scanner.Text()); ok {
+				current.annotations[key] = value
+				continue
+			}
+		}
 		line := strings.TrimSpace(stripInlineComment(scanner.Text()))
 		if line == "" {
 			continue
@@ -222,10 +373,11 @@ func parseRecursive(path string, visited map[string]struct{}) ([]Host, error) {
 		case "host":
 			flush()
 			current = &hostBlock{
-				patterns:  strings.Fields(value),
-				settings:  map[string][]string{},
-				source:    abs,
-				startLine: lineNo,
+				patterns:    strings.Fields(value),
+				settings:    map[string][]string{},
+				annotations: map[string]string{},
+				source:      abs,
+				startLine:   lineNo,
 			}
 		case "include":
 			flush()
@@ -243,7 +395,8 @@ func parseRecursive(path string, visited map[string]struct{}) ([]Host, error) {
 				continue
 			}
 			lkey := strings.ToLower(strings.TrimSpace(key))
-			if lkey == "identityfile" {
+			current.directives = append(current.directives, Directive{Key: strings.TrimSpace(key), Value: strings.TrimSpace(value)})
+			if multiValued[lkey] {
 				current.settings[lkey] = append(current.settings[lkey], strings.TrimSpace(value))
 			} else {
 				current.settings[lkey] = []string{strings.TrimSpace(value)}
@@ -268,19 +421,83 @@ func (b *hostBlock) toHosts() []Host {
 			continue
 		}
 		hosts = append(hosts, Host{
-			Alias:         pattern,
-			HostName:      b.last("hostname"),
-			User:          b.last("user"),
-			Port:          parsePort(b.last("port")),
-			ProxyJump:     b.last("proxyjump"),
-			IdentityFiles: append([]string(nil), b.settings["identityfile"]...),
-			SourcePath:    b.source,
-			SourceLine:    b.startLine,
+			Alias:           pattern,
+			HostName:        b.last("hostname"),
+			User:            b.last("user"),
+			Port:            parsePort(b.last("port")),
+			ProxyJump:       b.last("proxyjump"),
+			IdentityFiles:   append([]string(nil), b.settings["identityfile"]...),
+			LocalForwards:   forwardSpecs(b.settings["localforward"]),
+			RemoteForwards:  forwardSpecs(b.settings["remoteforward"]),
+			DynamicForwards: forwardSpecs(b.settings["dynamicforward"]),
+			Tags:            splitTags(b.annotations["tags"]),
+			Annotations:     b.copyAnnotations(),
+			Directives:      append([]Directive(nil), b.directives...),
+			SourcePath:      b.source,
+			SourceLine:      b.startLine,
 		})
 	}
 	return hosts
 }
 
+func (b *hostBlock) copyAnnotations() map[string]string {
+	if len(b.annotations) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(b.annotations))
+	for key, value := range b.annotations {
+		out[key] = value
+	}
+	return out
+}
+
+// parseAnnotation recognizes "# tssm:<key> <value>" (or "<key>=<value>")
+// comment lines.
+func parseAnnotation(line string) (string, string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+	line = strings.TrimSpace(strings.TrimLeft(line, "#"))
+	if !strings.HasPrefix(strings.ToLower(line), annotationPrefix) {
+		return "", "", false
+	}
+	line = strings.TrimSpace(line[len(annotationPrefix):])
+	key, value := line, ""
+	if index := strings.IndexAny(line, " \t="); index >= 0 {
+		key = line[:index]
+		value = strings.TrimLeft(line[index:], " \t=")
+	}
+	key = strings.ToLower(key)
+	if key == "" {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(value), true
+}
+
+// forwardSpecs converts "LocalForward [bind:]port host:hostport" style values
+// into ssh's "-L [bind:]port:host:hostport" argument syntax.
+func forwardSpecs(values []string) []string {
+	var out []string
+	for _, value := range values {
+		if fields := strings.Fields(value); len(fields) > 0 {
+			out = append(out, strings.Join(fields, ":"))
+		}
+	}
+	return out
+}
+
+// splitTags splits a comma- or space-separated tag list.
+func splitTags(raw string) []string {
+	fields := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
 func (b *hostBlock) last(key string) string {
 	values := b.settings[key]
 	if len(values) == 0 {
@@ -44,7 +44,7 @@ func TestAddHostAppendsBlock(t *testing.T) {
 		t.Fatalf("write file: %v", err)
 	}
 
-	err := AddHost(path, AddHostInput{
+	_, err := AddHost(path, AddHostInput{
 		Alias:        "newbox",
 		HostName:     "10.0.0.10",
 		User:         "matt",
@@ -68,20 +68,89 @@ func TestAddHostAppendsBlock(t *testing.T) {
 	}
 }
 
+func TestRenderHostBlock(t *testing.T) {
+	got := RenderHostBlock(AddHostInput{Alias: " web ", Port: 2222, ProxyJump: "bastion"})
+	if want := "Host web\n  HostName web\n  Port 2222\n  ProxyJump bastion\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestCloneInputCopiesDirectives(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	content := "Host db\n  # tssm:tags prod,sql\n  # tssm:log off\n  HostName 10.0.0.7\n  User admin\n  IdentityFile ~/.ssh/a\n  IdentityFile ~/.ssh/b\n  ForwardAgent yes\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := Load(path)
+	if err != nil || len(hosts) != 1 {
+		t.Fatalf("load: %v %v", hosts, err)
+	}
+	input := CloneInput(hosts[0], "db2")
+	input.HostName = "10.0.0.8"
+	if _, err := AddHost(path, input); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err = Load(path)
+	if err != nil || len(hosts) != 2 {
+		t.Fatalf("reload: %v %v", hosts, err)
+	}
+	clone := hosts[1]
+	if clone.Alias != "db2" || clone.HostName != "10.0.0.8" || clone.User != "admin" || strings.Join(clone.Tags, ",") != "prod,sql" || clone.Annotations["log"] != "off" {
+		t.Fatalf("unexpected clone %+v", clone)
+	}
+	var directives []string
+	for _, d := range clone.Directives {
+		directives = append(directives, d.Key+" "+d.Value)
+	}
+	if got, want := strings.Join(directives, "; "), "HostName 10.0.0.8; User admin; IdentityFile ~/.ssh/a; IdentityFile ~/.ssh/b; ForwardAgent yes"; got != want {
+		t.Fatalf("got directives %q, want %q", got, want)
+	}
+}
+
+func TestConfigFilesFollowsIncludes(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "conf.d"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	primary := filepath.Join(root, "config")
+	files := map[string]string{
+		primary:                                 "Include conf.d/*.conf\nHost a\n  Include extra # inside a block\n",
+		filepath.Join(root, "conf.d", "b.conf"): "Include " + primary + "\n",
+		filepath.Join(root, "conf.d", "a.conf"): "Host x\n",
+		filepath.Join(root, "extra"):            "Host y\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := ConfigFiles(primary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{primary, filepath.Join(root, "conf.d", "a.conf"), filepath.Join(root, "conf.d", "b.conf"), filepath.Join(root, "extra")}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, err := ConfigFiles(filepath.Join(root, "missing")); err != nil || len(got) != 0 {
+		t.Fatalf("expected no files, got %v (%v)", got, err)
+	}
+}
+
 func TestAddHostRejectsDuplicate(t *testing.T) {
 	root := t.TempDir()
 	path := filepath.Join(root, "config")
 	if err := os.WriteFile(path, []byte("Host existing\n  HostName 1.2.3.4\n"), 0o600); err != nil {
 		t.Fatal(err)
 	}
-	err := AddHost(path, AddHostInput{Alias: "existing", HostName: "5.6.7.8"})
+	_, err := AddHost(path, AddHostInput{Alias: "existing", HostName: "5.6.7.8"})
 	if err == nil || !strings.Contains(err.Error(), "already exists") {
 		t.Fatalf("expected duplicate error, got %v", err)
 	}
 }
 
 func TestAddHostRequiresAlias(t *testing.T) {
-	err := AddHost(filepath.Join(t.TempDir(), "config"), AddHostInput{HostName: "1.2.3.4"})
+	_, err := AddHost(filepath.Join(t.TempDir(), "config"), AddHostInput{HostName: "1.2.3.4"})
 	if err == nil || !strings.Contains(err.Error(), "alias is required") {
 		t.Fatalf("expected alias required error, got %v", err)
 	}
@@ -196,3 +265,71 @@ func TestSplitDirective(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadParsesAnnotations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	content := "# tssm:tags ignored-outside-block\nHost db1\n  HostName 10.0.0.1\n  # tssm:tags prod, db\n  #tssm:log=off\n  # regular comment\n\nHost web1\n  HostName 10.0.0.2\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 2 {
+		t.Fatalf("expected 2 hosts, got %d", len(hosts))
+	}
+	db := hosts[0]
+	if strings.Join(db.Tags, ",") != "prod,db" {
+		t.Fatalf("unexpected tags %v", db.Tags)
+	}
+	if db.Annotations["log"] != "off" {
+		t.Fatalf("unexpected annotations %v", db.Annotations)
+	}
+	if hosts[1].Tags != nil || hosts[1].Annotations != nil {
+		t.Fatalf("expected no annotations on web1, got %+v", hosts[1])
+	}
+}
+
+func TestParseAnnotation(t *testing.T) {
+	tests := []struct {
+		input, key, value string
+		ok                bool
+	}{
+		{"# tssm:tags prod,db", "tags", "prod,db", true},
+		{"  #tssm:Tags=prod", "tags", "prod", true},
+		{"## tssm:log off", "log", "off", true},
+		{"# tssm:confirm", "confirm", "", true},
+		{"# tags prod", "", "", false},
+		{"HostName x", "", "", false},
+		{"# tssm:", "", "", false},
+	}
+	for _, tt := range tests {
+		key, value, ok := parseAnnotation(tt.input)
+		if ok != tt.ok || key != tt.key || value != tt.value {
+			t.Errorf("parseAnnotation(%q) = (%q, %q, %v), want (%q, %q, %v)", tt.input, key, value, ok, tt.key, tt.value, tt.ok)
+		}
+	}
+}
+
+func TestLoadParsesForwards(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	content := "Host db1\n  LocalForward 5432 localhost:5432\n  LocalForward 127.0.0.1:6379 cache:6379\n  RemoteForward 9000 localhost:3000\n  DynamicForward 1080\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	hosts, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	db := hosts[0]
+	if strings.Join(db.LocalForwards, " ") != "5432:localhost:5432 127.0.0.1:6379:cache:6379" {
+		t.Fatalf("unexpected local forwards %v", db.LocalForwards)
+	}
+	if len(db.RemoteForwards) != 1 || db.RemoteForwards[0] != "9000:localhost:3000" {
+		t.Fatalf("unexpected remote forwards %v", db.RemoteForwards)
+	}
+	if len(db.DynamicForwards) != 1 || db.DynamicForwards[0] != "1080" {
+		t.Fatalf("unexpected dynamic forwards %v", db.DynamicForwards)
+	}
+}
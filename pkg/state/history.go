@@ -0,0 +1,175 @@
+package state
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The connection history is kept apart from the rest of the state, in
+// history.jsonl next to state.json. Several processes record connections
+// at once (the picker, the panes' loggers and reconnect loops, the commands
+// that end a pane), so each start and end is appended as one line rather
+// than the file being read, changed and written back.
+
+// historyRotateSize is the size past which the history file is moved to
+// history.jsonl.1, replacing the previous one; both are read.
+const historyRotateSize = 64 << 10
+
+// Connection is an ssh connection opened by this tool.
+type Connection struct {
+	Alias string `json:"alias"`
+	// Pane is the tmux pane the connection ran in, if any.
+	Pane      string `json:"pane,omitempty"`
+	StartedAt string `json:"started_at"`
+	// EndedAt is empty while the connection is open, and when its end was
+	// never seen.
+	EndedAt string `json:"ended_at,omitempty"`
+}
+
+// Duration is how long the connection lasted, if it ended.
+func (c Connection) Duration() (time.Duration, bool) {
+	started, err := time.Parse(time.RFC3339, c.StartedAt)
+	if err != nil {
+		return 0, false
+	}
+	ended, err := time.Parse(time.RFC3339, c.EndedAt)
+	if err != nil {
+		return 0, false
+	}
+	return ended.Sub(started), true
+}
+
+// historyEvent is one line of the history file.
+type historyEvent struct {
+	// Event is "start" or "end".
+	Event string `json:"event"`
+	Alias string `json:"alias"`
+	Pane  string `json:"pane,omitempty"`
+	At    string `json:"at"`
+}
+
+// HistoryPath is the history file kept with the state at statePath ("" for
+// the default).
+func HistoryPath(statePath string) (string, error) {
+	if strings.TrimSpace(statePath) == "" {
+		var err error
+		statePath, err = DefaultPath()
+		if err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(filepath.Dir(statePath), "history.jsonl"), nil
+}
+
+// StartConnection records a connection to alias opened at at in pane ("" when
+// it does not run in tmux).
+func StartConnection(statePath, alias, pane string, at time.Time) error {
+	return appendHistory(statePath, historyEvent{Event: "start", Alias: alias, Pane: pane, At: at.UTC().Format(time.RFC3339)})
+}
+
+// EndConnection records the end of the newest connection to alias in pane.
+// It is ignored when there is none, or when that one already ended.
+func EndConnection(statePath, alias, pane string, at time.Time) error {
+	return appendHistory(statePath, historyEvent{Event: "end", Alias: alias, Pane: pane, At: at.UTC().Format(time.RFC3339)})
+}
+
+func appendHistory(statePath string, event historyEvent) error {
+	event.Alias = strings.TrimSpace(event.Alias)
+	if event.Alias == "" {
+		return nil
+	}
+	path, err := HistoryPath(statePath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encode history: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("open history: %w", err)
+	}
+	// A single write of a whole line, so that lines appended at once by
+	// other processes do not interleave.
+	_, err = f.Write(append(data, '\n'))
+	info, statErr := f.Stat()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write history: %w", err)
+	}
+	if statErr == nil && info.Size() >= historyRotateSize {
+		_ = os.Rename(path, path+".1")
+	}
+	return nil
+}
+
+// History lists the recorded connections, newest first.
+func History(statePath string) ([]Connection, error) {
+	path, err := HistoryPath(statePath)
+	if err != nil {
+		return nil, err
+	}
+	var connections []Connection
+	for _, file := range []string{path + ".1", path} {
+		if err := readHistory(file, &connections); err != nil {
+			return nil, err
+		}
+	}
+	for i, j := 0, len(connections)-1; i < j; i, j = i+1, j-1 {
+		connections[i], connections[j] = connections[j], connections[i]
+	}
+	if len(connections) > historyLimit {
+		connections = connections[:historyLimit]
+	}
+	return connections, nil
+}
+
+// readHistory applies the events of file to connections, oldest first.
+// Lines that cannot be read, such as one cut short by a crash, are skipped.
+func readHistory(file string, connections *[]Connection) error {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read history: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event historyEvent
+		if json.Unmarshal(scanner.Bytes(), &event) != nil || event.Alias == "" {
+			continue
+		}
+		switch event.Event {
+		case "start":
+			*connections = append(*connections, Connection{Alias: event.Alias, Pane: event.Pane, StartedAt: event.At})
+		case "end":
+			for i := len(*connections) - 1; i >= 0; i-- {
+				c := &(*connections)[i]
+				if c.Alias != event.Alias || c.Pane != event.Pane {
+					continue
+				}
+				if c.EndedAt == "" {
+					c.EndedAt = event.At
+				}
+				break
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read history: %w", err)
+	}
+	return nil
+}
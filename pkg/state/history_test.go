@@ -0,0 +1,129 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConnectionHistoryStartsAndEnds(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	record := func(record func(string, string, string, time.Time) error, alias, pane string, at time.Time) {
+		t.Helper()
+		if err := record(statePath, alias, pane, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history := func() []Connection {
+		t.Helper()
+		connections, err := History(statePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return connections
+	}
+	record(StartConnection, "web1", "%3", start)
+	record(StartConnection, "db1", "", start.Add(time.Minute))
+	record(StartConnection, "web1", "%3", start.Add(2*time.Minute))
+	if got := history(); len(got) != 3 || got[0].Alias != "web1" || got[1].Alias != "db1" {
+		t.Fatalf("expected newest first, got %+v", got)
+	}
+
+	record(EndConnection, "web1", "%3", start.Add(5*time.Minute))
+	if d, ok := history()[0].Duration(); !ok || d != 3*time.Minute {
+		t.Fatalf("expected 3m, got %v %v", d, ok)
+	}
+	// A second end, from another process seeing the same pane close, does
+	// not move it nor end the older connection.
+	record(EndConnection, "web1", "%3", start.Add(6*time.Minute))
+	got := history()
+	if d, _ := got[0].Duration(); d != 3*time.Minute {
+		t.Fatalf("expected the end to stay at 3m, got %v", d)
+	}
+	if _, ok := got[2].Duration(); ok {
+		t.Fatal("expected the older web1 connection to have no end")
+	}
+	record(EndConnection, "db1", "%1", start)
+	if _, ok := history()[1].Duration(); ok {
+		t.Fatal("expected no match in another pane")
+	}
+
+	for i := 0; i < historyLimit+10; i++ {
+		record(StartConnection, "web1", "", start)
+	}
+	if got := history(); len(got) != historyLimit {
+		t.Fatalf("expected history capped at %d, got %d", historyLimit, len(got))
+	}
+}
+
+func TestConnectionHistoryKeepsConcurrentWriters(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	panes := []string{"%1", "%2", "%3", "%4", "%5", "%6", "%7", "%8"}
+	for _, pane := range panes {
+		if err := StartConnection(statePath, "web1", pane, start); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The panes' loggers end their connections at once.
+	var wg sync.WaitGroup
+	for _, pane := range panes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = EndConnection(statePath, "web1", pane, start.Add(time.Minute))
+		}()
+	}
+	wg.Wait()
+	got, err := History(statePath)
+	if err != nil || len(got) != len(panes) {
+		t.Fatalf("expected %d connections, got %+v (%v)", len(panes), got, err)
+	}
+	for _, c := range got {
+		if c.EndedAt == "" {
+			t.Fatalf("lost the end of %+v", c)
+		}
+	}
+}
+
+func TestConnectionHistoryRotates(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	path, err := HistoryPath(statePath)
+	if err != nil || filepath.Base(path) != "history.jsonl" {
+		t.Fatalf("unexpected history path %q (%v)", path, err)
+	}
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := StartConnection(statePath, "db1", "%1", start); err != nil {
+		t.Fatal(err)
+	}
+	// Grow the file past the limit so that the next line rotates it.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padding := make([]byte, historyRotateSize)
+	for i := range padding {
+		padding[i] = '\n'
+	}
+	if _, err := f.Write(padding); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if err := StartConnection(statePath, "web1", "%2", start.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatalf("expected the file rotated: %v", err)
+	}
+	// The end lands in the new file and still finds its start in the old one.
+	if err := EndConnection(statePath, "db1", "%1", start.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := History(statePath)
+	if err != nil || len(got) != 2 || got[0].Alias != "web1" || got[1].EndedAt == "" {
+		t.Fatalf("unexpected history %+v (%v)", got, err)
+	}
+}
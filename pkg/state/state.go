@@ -5,17 +5,82 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
-const recentsLimit = 100
+const (
+	recentsLimit = 100
+	historyLimit = 200
+)
 
 type Store struct {
-	Version   int      `json:"version"`
-	Favorites []string `json:"favorites,omitempty"`
-	Recents   []string `json:"recents,omitempty"`
-	UpdatedAt string   `json:"updated_at,omitempty"`
+	Version    int         `json:"version"`
+	Favorites  []string    `json:"favorites,omitempty"`
+	Recents    []string    `json:"recents,omitempty"`
+	Workspaces []Workspace `json:"workspaces,omitempty"`
+	Tunnels    []Tunnel    `json:"tunnels,omitempty"`
+	Sets       []HostSet   `json:"sets,omitempty"`
+	// Health caches the last reachability check of each host alias.
+	Health    map[string]HealthCheck `json:"health,omitempty"`
+	UpdatedAt string                 `json:"updated_at,omitempty"`
+}
+
+// HostSet is a named selection of hosts, kept in the order they were
+// selected in.
+type HostSet struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+}
+
+// Workspace is a named set of tmux windows, each holding one ssh pane per host.
+type Workspace struct {
+	Name    string            `json:"name"`
+	Windows []WorkspaceWindow `json:"windows"`
+}
+
+type WorkspaceWindow struct {
+	Name string `json:"name,omitempty"`
+	// Layout is a tmux layout name or a captured layout string.
+	Layout string          `json:"layout,omitempty"`
+	Panes  []WorkspacePane `json:"panes"`
+}
+
+type WorkspacePane struct {
+	Alias string `json:"alias"`
+	// Split is the direction used to create the pane: "v" or "h". It is
+	// ignored for the first pane of a window.
+	Split string `json:"split,omitempty"`
+	// Command is run on the host through ssh once it is connected; the pane
+	// then stays open in a login shell.
+	Command string `json:"command,omitempty"`
+}
+
+// Tunnel is a background ssh process holding port forwards open.
+type Tunnel struct {
+	ID    string `json:"id"`
+	Alias string `json:"alias"`
+	// Forwards are ssh arguments such as "-L 5432:localhost:5432".
+	Forwards []string `json:"forwards"`
+	// Ports are the local ports the forwards listen on.
+	Ports []int `json:"ports,omitempty"`
+	PID   int   `json:"pid"`
+	// Process identifies the process PID was given to (see
+	// tunnel.Identity), so that a reused PID is not taken for the tunnel.
+	Process string `json:"process,omitempty"`
+	// Window is the tmux window running the tunnel, if it was started in one.
+	Window    string `json:"window,omitempty"`
+	StartedAt string `json:"started_at"`
+}
+
+// HealthCheck is the outcome of a reachability check.
+type HealthCheck struct {
+	Up        bool    `json:"up"`
+	Unknown   bool    `json:"unknown,omitempty"`
+	LatencyMS float64 `json:"latency_ms,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	CheckedAt string  `json:"checked_at"`
 }
 
 func DefaultPath() (string, error) {
@@ -135,12 +200,207 @@ func (s *Store) AddRecent(alias string) {
 	s.Recents = next
 }
 
+// PutWorkspace adds ws, replacing any workspace with the same name.
+func (s *Store) PutWorkspace(ws Workspace) error {
+	ws.Name = strings.TrimSpace(ws.Name)
+	if ws.Name == "" {
+		return fmt.Errorf("workspace name is required")
+	}
+	panes := 0
+	for _, window := range ws.Windows {
+		panes += len(window.Panes)
+	}
+	if panes == 0 {
+		return fmt.Errorf("workspace %s has no panes", ws.Name)
+	}
+	for i, existing := range s.Workspaces {
+		if existing.Name == ws.Name {
+			s.Workspaces[i] = ws
+			return nil
+		}
+	}
+	s.Workspaces = append(s.Workspaces, ws)
+	return nil
+}
+
+func (s *Store) Workspace(name string) (Workspace, bool) {
+	name = strings.TrimSpace(name)
+	for _, ws := range s.Workspaces {
+		if ws.Name == name {
+			return ws, true
+		}
+	}
+	return Workspace{}, false
+}
+
+func (s *Store) DeleteWorkspace(name string) bool {
+	name = strings.TrimSpace(name)
+	for i, ws := range s.Workspaces {
+		if ws.Name == name {
+			s.Workspaces = append(s.Workspaces[:i], s.Workspaces[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// PutSet adds set, replacing any set with the same name.
+func (s *Store) PutSet(set HostSet) error {
+	set.Name = strings.TrimSpace(set.Name)
+	if set.Name == "" {
+		return fmt.Errorf("set name is required")
+	}
+	set.Aliases = uniqueNonEmpty(set.Aliases)
+	if len(set.Aliases) == 0 {
+		return fmt.Errorf("set %s has no hosts", set.Name)
+	}
+	for i, existing := range s.Sets {
+		if existing.Name == set.Name {
+			s.Sets[i] = set
+			return nil
+		}
+	}
+	s.Sets = append(s.Sets, set)
+	return nil
+}
+
+func (s *Store) Set(name string) (HostSet, bool) {
+	name = strings.TrimSpace(name)
+	for _, set := range s.Sets {
+		if set.Name == name {
+			return set, true
+		}
+	}
+	return HostSet{}, false
+}
+
+func (s *Store) DeleteSet(name string) bool {
+	name = strings.TrimSpace(name)
+	for i, set := range s.Sets {
+		if set.Name == name {
+			s.Sets = append(s.Sets[:i], s.Sets[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// RenameAlias follows a host renamed from old to alias in everything the
+// store keeps by alias: favorites, recents, sets, workspace panes and the
+// health cache. The connection history keeps the name each connection had.
+func (s *Store) RenameAlias(old, alias string) {
+	old, alias = strings.TrimSpace(old), strings.TrimSpace(alias)
+	if old == "" || alias == "" || old == alias {
+		return
+	}
+	rename := func(items []string) {
+		for i, item := range items {
+			if item == old {
+				items[i] = alias
+			}
+		}
+	}
+	rename(s.Favorites)
+	rename(s.Recents)
+	for i := range s.Sets {
+		rename(s.Sets[i].Aliases)
+	}
+	for _, ws := range s.Workspaces {
+		for _, window := range ws.Windows {
+			for i := range window.Panes {
+				if window.Panes[i].Alias == old {
+					window.Panes[i].Alias = alias
+				}
+			}
+		}
+	}
+	if check, ok := s.Health[old]; ok {
+		delete(s.Health, old)
+		s.Health[alias] = check
+	}
+	s.normalize()
+}
+
+// AddTunnel records t under the next free numeric ID and returns it.
+func (s *Store) AddTunnel(t Tunnel) Tunnel {
+	next := 1
+	for _, existing := range s.Tunnels {
+		if id, err := strconv.Atoi(existing.ID); err == nil && id >= next {
+			next = id + 1
+		}
+	}
+	t.ID = strconv.Itoa(next)
+	s.Tunnels = append(s.Tunnels, t)
+	return t
+}
+
+func (s *Store) RemoveTunnel(id string) bool {
+	for i, t := range s.Tunnels {
+		if t.ID == id {
+			s.Tunnels = append(s.Tunnels[:i], s.Tunnels[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// PruneTunnels drops tunnels whose process is no longer running and returns
+// them.
+func (s *Store) PruneTunnels(alive func(Tunnel) bool) []Tunnel {
+	var kept, removed []Tunnel
+	for _, t := range s.Tunnels {
+		if alive(t) {
+			kept = append(kept, t)
+		} else {
+			removed = append(removed, t)
+		}
+	}
+	s.Tunnels = kept
+	return removed
+}
+
+// TunnelOnPort returns the recorded tunnel listening on a local port.
+func (s *Store) TunnelOnPort(port int) (Tunnel, bool) {
+	for _, t := range s.Tunnels {
+		for _, p := range t.Ports {
+			if p == port {
+				return t, true
+			}
+		}
+	}
+	return Tunnel{}, false
+}
+
+// PutHealth records the latest check of alias.
+func (s *Store) PutHealth(alias string, check HealthCheck) {
+	if s.Health == nil {
+		s.Health = map[string]HealthCheck{}
+	}
+	s.Health[alias] = check
+}
+
+// FreshHealth returns the check of alias when it is younger than ttl.
+func (s *Store) FreshHealth(alias string, ttl time.Duration, now time.Time) (HealthCheck, bool) {
+	check, ok := s.Health[alias]
+	if !ok {
+		return HealthCheck{}, false
+	}
+	checked, err := time.Parse(time.RFC3339, check.CheckedAt)
+	if err != nil || now.Sub(checked) >= ttl {
+		return HealthCheck{}, false
+	}
+	return check, true
+}
+
 func (s *Store) normalize() {
 	if s.Version == 0 {
 		s.Version = 1
 	}
 	s.Favorites = uniqueNonEmpty(s.Favorites)
 	s.Recents = uniqueNonEmpty(s.Recents)
+	for i := range s.Sets {
+		s.Sets[i].Aliases = uniqueNonEmpty(s.Sets[i].Aliases)
+	}
 	if len(s.Recents) > recentsLimit {
 		s.Recents = s.Recents[:recentsLimit]
 	}
@@ -3,7 +3,9 @@ package state
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestToggleFavoriteAndRecents(t *testing.T) {
@@ -113,3 +115,133 @@ func TestSaveCreatesDirectory(t *testing.T) {
 		t.Fatalf("expected file to exist: %v", err)
 	}
 }
+
+func TestWorkspacePutReplaceDelete(t *testing.T) {
+	store := &Store{}
+	ws := Workspace{Name: "db", Windows: []WorkspaceWindow{{Panes: []WorkspacePane{{Alias: "db1"}, {Alias: "db2", Split: "h"}}}}}
+	if err := store.PutWorkspace(ws); err != nil {
+		t.Fatal(err)
+	}
+	ws.Windows[0].Layout = "tiled"
+	if err := store.PutWorkspace(ws); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.Workspaces) != 1 {
+		t.Fatalf("expected replace by name, got %d workspaces", len(store.Workspaces))
+	}
+	got, ok := store.Workspace("db")
+	if !ok || got.Windows[0].Layout != "tiled" {
+		t.Fatalf("unexpected workspace: %+v", got)
+	}
+	if !store.DeleteWorkspace("db") || store.DeleteWorkspace("db") {
+		t.Fatal("expected delete to succeed exactly once")
+	}
+}
+
+func TestPutWorkspaceValidates(t *testing.T) {
+	store := &Store{}
+	if err := store.PutWorkspace(Workspace{Windows: []WorkspaceWindow{{Panes: []WorkspacePane{{Alias: "a"}}}}}); err == nil {
+		t.Fatal("expected error for missing name")
+	}
+	if err := store.PutWorkspace(Workspace{Name: "empty"}); err == nil {
+		t.Fatal("expected error for workspace without panes")
+	}
+}
+
+func TestSetsPutDeleteAndRename(t *testing.T) {
+	store := &Store{Favorites: []string{"db1"}, Recents: []string{"web", "db1"}}
+	if err := store.PutSet(HostSet{Name: "db", Aliases: []string{"db1", "db2", "db1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutSet(HostSet{Name: "empty"}); err == nil {
+		t.Fatal("expected error for set without hosts")
+	}
+	if err := store.PutWorkspace(Workspace{Name: "db", Windows: []WorkspaceWindow{{Panes: []WorkspacePane{{Alias: "db1"}}}}}); err != nil {
+		t.Fatal(err)
+	}
+	store.PutHealth("db1", HealthCheck{Up: true})
+
+	store.RenameAlias("db1", "pg1")
+	set, ok := store.Set("db")
+	if !ok || strings.Join(set.Aliases, ",") != "pg1,db2" {
+		t.Fatalf("unexpected set after rename: %+v", set)
+	}
+	if !store.IsFavorite("pg1") || strings.Join(store.Recents, ",") != "web,pg1" || store.Workspaces[0].Windows[0].Panes[0].Alias != "pg1" {
+		t.Fatalf("rename not followed: %+v", store)
+	}
+	if _, ok := store.Health["pg1"]; !ok {
+		t.Fatal("expected the health check to follow the rename")
+	}
+	if !store.DeleteSet("db") || store.DeleteSet("db") {
+		t.Fatal("expected delete to succeed exactly once")
+	}
+}
+
+func TestWorkspacesRoundtrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := &Store{Version: 1}
+	if err := store.PutWorkspace(Workspace{Name: "web", Windows: []WorkspaceWindow{{Name: "web", Panes: []WorkspacePane{{Alias: "web1", Command: "htop"}}}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Save(path, store); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, ok := loaded.Workspace("web")
+	if !ok || ws.Windows[0].Panes[0].Command != "htop" {
+		t.Fatalf("workspace not preserved: %+v", loaded.Workspaces)
+	}
+}
+
+func TestTunnelsAddPruneRemove(t *testing.T) {
+	store := &Store{}
+	first := store.AddTunnel(Tunnel{Alias: "db1", Ports: []int{5432}, PID: 100})
+	second := store.AddTunnel(Tunnel{Alias: "db2", Ports: []int{6379}, PID: 200})
+	if first.ID != "1" || second.ID != "2" {
+		t.Fatalf("unexpected ids %q %q", first.ID, second.ID)
+	}
+	if tunnel, ok := store.TunnelOnPort(6379); !ok || tunnel.Alias != "db2" {
+		t.Fatalf("expected db2 on 6379, got %+v", tunnel)
+	}
+
+	removed := store.PruneTunnels(func(t Tunnel) bool { return t.PID != 100 })
+	if len(removed) != 1 || removed[0].ID != "1" || len(store.Tunnels) != 1 {
+		t.Fatalf("unexpected prune result %+v, remaining %+v", removed, store.Tunnels)
+	}
+	if third := store.AddTunnel(Tunnel{Alias: "db3"}); third.ID != "3" {
+		t.Fatalf("expected id 3 after pruning, got %q", third.ID)
+	}
+	if !store.RemoveTunnel("2") || store.RemoveTunnel("2") {
+		t.Fatal("expected tunnel 2 to be removed exactly once")
+	}
+}
+
+func TestHealthCacheExpires(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	checked := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := &Store{}
+	store.PutHealth("web1", HealthCheck{Up: true, LatencyMS: 12.5, CheckedAt: checked.Format(time.RFC3339)})
+	store.PutHealth("db1", HealthCheck{Error: "connection refused", CheckedAt: "yesterday"})
+	if err := Save(path, store); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check, ok := loaded.FreshHealth("web1", 5*time.Minute, checked.Add(time.Minute)); !ok || !check.Up || check.LatencyMS != 12.5 {
+		t.Fatalf("expected a fresh check, got %+v %v", check, ok)
+	}
+	if _, ok := loaded.FreshHealth("web1", 5*time.Minute, checked.Add(5*time.Minute)); ok {
+		t.Fatal("expected the check to expire after the ttl")
+	}
+	if _, ok := loaded.FreshHealth("db1", time.Hour, checked); ok {
+		t.Fatal("expected an unparsable time to count as stale")
+	}
+	if _, ok := loaded.FreshHealth("lab", time.Hour, checked); ok {
+		t.Fatal("expected no check for an unknown host")
+	}
+}
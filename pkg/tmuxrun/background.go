@@ -0,0 +1,30 @@
+package tmuxrun
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BackgroundWindow runs argv in a new tmux window without switching to it and
+// returns the window ID and the PID of the process. The window closes when
+// the process exits.
+func (s Session) BackgroundWindow(name string, argv []string) (string, int, error) {
+	if len(argv) == 0 {
+		return "", 0, fmt.Errorf("no command for background window")
+	}
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		quoted[i] = shellQuote(arg)
+	}
+	out, err := s.output("new-window", "-d", "-P", "-F", "#{window_id} #{pane_pid}", "-n", name, loginShell(), "-lc", "exec "+strings.Join(quoted, " "))
+	if err != nil {
+		return "", 0, err
+	}
+	windowID, rawPID, _ := strings.Cut(out, " ")
+	pid, err := strconv.Atoi(strings.TrimSpace(rawPID))
+	if err != nil {
+		return "", 0, fmt.Errorf("parse pane pid %q: %w", rawPID, err)
+	}
+	return windowID, pid, nil
+}
@@ -0,0 +1,194 @@
+package tmuxrun
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Layout is a parsed layout spec for multi-host windows.
+type Layout struct {
+	// Preset is a built-in tmux layout name (tiled, main-vertical, ...).
+	Preset string
+	// Cols and Rows describe a fixed grid; host N fills cell N in row-major
+	// order.
+	Cols, Rows int
+	// Raw is a tmux layout string as printed by #{window_layout}.
+	Raw string
+	// Capacity is the number of panes the layout holds, or 0 if unbounded.
+	Capacity int
+}
+
+var (
+	presetLayouts = map[string]string{
+		"tiled":           "tiled",
+		"even-horizontal": "even-horizontal",
+		"even-vertical":   "even-vertical",
+		"main-horizontal": "main-horizontal",
+		"main-vertical":   "main-vertical",
+		// One large pane with the rest stacked beside or below it.
+		"main-left":       "main-vertical",
+		"main-left+stack": "main-vertical",
+		"main-top":        "main-horizontal",
+		"main-top+stack":  "main-horizontal",
+	}
+	gridPattern      = regexp.MustCompile(`^(\d+)x(\d+)$`)
+	rawLayoutPattern = regexp.MustCompile(`^[0-9a-f]{4},\d+x\d+,\d+,\d+[,{\[]`)
+	rawLeafPattern   = regexp.MustCompile(`\d+x\d+,\d+,\d+,\d+`)
+)
+
+// ParseLayout parses a layout spec: a tmux preset name (or one of the
+// main-left/main-top aliases), a COLSxROWS grid such as "2x3", or a raw tmux
+// layout string. An empty spec means "tiled".
+func ParseLayout(spec string) (Layout, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Layout{Preset: "tiled"}, nil
+	}
+	if preset, ok := presetLayouts[strings.ToLower(spec)]; ok {
+		return Layout{Preset: preset}, nil
+	}
+	if match := gridPattern.FindStringSubmatch(strings.ToLower(spec)); match != nil {
+		cols, _ := strconv.Atoi(match[1])
+		rows, _ := strconv.Atoi(match[2])
+		if cols < 1 || rows < 1 {
+			return Layout{}, fmt.Errorf("grid layout %q needs at least one column and row", spec)
+		}
+		return Layout{Cols: cols, Rows: rows, Capacity: cols * rows}, nil
+	}
+	if rawLayoutPattern.MatchString(spec) {
+		return Layout{Raw: spec, Capacity: len(rawLeafPattern.FindAllString(spec, -1))}, nil
+	}
+	return Layout{}, fmt.Errorf("unknown layout %q (expected tiled, even-horizontal, even-vertical, main-horizontal, main-vertical, main-left, main-top, COLSxROWS or a tmux layout string)", spec)
+}
+
+// String returns the spec the layout was parsed from, in canonical form.
+func (l Layout) String() string {
+	switch {
+	case l.Raw != "":
+		return l.Raw
+	case l.Cols > 0:
+		return fmt.Sprintf("%dx%d", l.Cols, l.Rows)
+	default:
+		return l.Preset
+	}
+}
+
+// PerWindow returns how many panes go into one window given an optional
+// user-configured maximum (<= 0 for none). 0 means no limit.
+func (l Layout) PerWindow(maxPanes int) int {
+	limit := l.Capacity
+	if maxPanes > 0 && (limit == 0 || maxPanes < limit) {
+		limit = maxPanes
+	}
+	return limit
+}
+
+// Chunk splits aliases into consecutive per-window groups.
+func (l Layout) Chunk(aliases []string, maxPanes int) [][]string {
+	limit := l.PerWindow(maxPanes)
+	if limit <= 0 || len(aliases) <= limit {
+		if len(aliases) == 0 {
+			return nil
+		}
+		return [][]string{aliases}
+	}
+	var chunks [][]string
+	for start := 0; start < len(aliases); start += limit {
+		end := min(start+limit, len(aliases))
+		chunks = append(chunks, aliases[start:end])
+	}
+	return chunks
+}
+
+// applyLayout selects the layout for windowID whose panes are paneIDs in order.
+func (s Session) applyLayout(windowID string, layout Layout, paneIDs []string) error {
+	switch {
+	case layout.Raw != "":
+		return s.Run("select-layout", "-t", windowID, layout.Raw)
+	case layout.Cols > 0:
+		size, err := s.output("display-message", "-p", "-t", windowID, "#{window_width} #{window_height}")
+		if err != nil {
+			return err
+		}
+		var width, height int
+		if _, err := fmt.Sscanf(size, "%d %d", &width, &height); err != nil {
+			return fmt.Errorf("parse window size %q: %w", size, err)
+		}
+		return s.Run("select-layout", "-t", windowID, gridLayout(width, height, layout.Cols, paneIDs))
+	default:
+		return s.Run("select-layout", "-t", windowID, layout.Preset)
+	}
+}
+
+// gridLayout builds a tmux layout string that places the panes row by row in
+// a grid cols wide. The last row may hold fewer panes, which then share its
+// width. tmux assigns panes to cells in window order, so host N lands in
+// cell N as long as panes were created in order.
+func gridLayout(width, height, cols int, paneIDs []string) string {
+	count := len(paneIDs)
+	if count == 0 {
+		return ""
+	}
+	cols = min(cols, count)
+	rows := (count + cols - 1) / cols
+	rowHeights := splitSpan(height, rows)
+
+	var rowCells []string
+	y := 0
+	next := 0
+	for r := 0; r < rows; r++ {
+		inRow := min(cols, count-next)
+		widths := splitSpan(width, inRow)
+		var cells []string
+		x := 0
+		for c := 0; c < inRow; c++ {
+			cells = append(cells, fmt.Sprintf("%dx%d,%d,%d,%s", widths[c], rowHeights[r], x, y, paneNumber(paneIDs[next])))
+			x += widths[c] + 1
+			next++
+		}
+		if len(cells) == 1 {
+			rowCells = append(rowCells, cells[0])
+		} else {
+			rowCells = append(rowCells, fmt.Sprintf("%dx%d,0,%d{%s}", width, rowHeights[r], y, strings.Join(cells, ",")))
+		}
+		y += rowHeights[r] + 1
+	}
+
+	body := rowCells[0]
+	if len(rowCells) > 1 {
+		body = fmt.Sprintf("%dx%d,0,0[%s]", width, height, strings.Join(rowCells, ","))
+	}
+	return fmt.Sprintf("%04x,%s", layoutChecksum(body), body)
+}
+
+// splitSpan divides total cells into n parts separated by 1-cell borders.
+func splitSpan(total, n int) []int {
+	available := total - (n - 1)
+	if available < n {
+		available = n
+	}
+	parts := make([]int, n)
+	for i := range parts {
+		parts[i] = available / n
+		if i < available%n {
+			parts[i]++
+		}
+	}
+	return parts
+}
+
+func paneNumber(paneID string) string {
+	return strings.TrimPrefix(paneID, "%")
+}
+
+// layoutChecksum is tmux's layout_checksum.
+func layoutChecksum(layout string) uint16 {
+	var csum uint16
+	for i := 0; i < len(layout); i++ {
+		csum = (csum >> 1) + ((csum & 1) << 15)
+		csum += uint16(layout[i])
+	}
+	return csum
+}
@@ -0,0 +1,94 @@
+package tmuxrun
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLayout(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Layout
+	}{
+		{"", Layout{Preset: "tiled"}},
+		{"tiled", Layout{Preset: "tiled"}},
+		{"even-horizontal", Layout{Preset: "even-horizontal"}},
+		{"main-left", Layout{Preset: "main-vertical"}},
+		{"main-left+stack", Layout{Preset: "main-vertical"}},
+		{"main-top", Layout{Preset: "main-horizontal"}},
+		{"2x3", Layout{Cols: 2, Rows: 3, Capacity: 6}},
+		{"4X1", Layout{Cols: 4, Rows: 1, Capacity: 4}},
+	}
+	for _, tt := range tests {
+		got, err := ParseLayout(tt.spec)
+		if err != nil {
+			t.Errorf("ParseLayout(%q) error: %v", tt.spec, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLayout(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseLayoutRawString(t *testing.T) {
+	raw := "6006,200x50,0,0[200x25,0,0{66x25,0,0,0,66x25,67,0,1,66x25,134,0,2},200x24,0,26{100x24,0,26,3,99x24,101,26,4}]"
+	got, err := ParseLayout(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Raw != raw || got.Capacity != 5 {
+		t.Fatalf("unexpected raw layout: %+v", got)
+	}
+}
+
+func TestParseLayoutRejectsUnknown(t *testing.T) {
+	for _, spec := range []string{"diagonal", "0x2", "2x", "abcd"} {
+		if _, err := ParseLayout(spec); err == nil {
+			t.Errorf("ParseLayout(%q) expected error", spec)
+		}
+	}
+}
+
+func TestLayoutChunkSpillsOver(t *testing.T) {
+	aliases := []string{"a", "b", "c", "d", "e"}
+	grid, _ := ParseLayout("2x1")
+	got := grid.Chunk(aliases, 0)
+	want := [][]string{{"a", "b"}, {"c", "d"}, {"e"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("grid chunks = %v, want %v", got, want)
+	}
+
+	tiled, _ := ParseLayout("tiled")
+	if got := tiled.Chunk(aliases, 0); len(got) != 1 {
+		t.Fatalf("expected unbounded preset to use one window, got %v", got)
+	}
+	if got := tiled.Chunk(aliases, 3); !reflect.DeepEqual(got, [][]string{{"a", "b", "c"}, {"d", "e"}}) {
+		t.Fatalf("unexpected max-panes chunks: %v", got)
+	}
+	// The smaller of capacity and max-panes wins.
+	big, _ := ParseLayout("3x3")
+	if got := big.PerWindow(4); got != 4 {
+		t.Fatalf("PerWindow(4) = %d, want 4", got)
+	}
+}
+
+func TestGridLayoutMatchesTmux(t *testing.T) {
+	// Captured from tmux 3.3 after applying this layout to a 200x50 window.
+	want := "6006,200x50,0,0[200x25,0,0{66x25,0,0,0,66x25,67,0,1,66x25,134,0,2},200x24,0,26{100x24,0,26,3,99x24,101,26,4}]"
+	got := gridLayout(200, 50, 3, []string{"%0", "%1", "%2", "%3", "%4"})
+	if got != want {
+		t.Fatalf("gridLayout =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGridLayoutSinglePaneAndRow(t *testing.T) {
+	if got := gridLayout(80, 24, 2, []string{"%7"}); !strings.HasSuffix(got, ",80x24,0,0,7") {
+		t.Fatalf("unexpected single-pane layout %q", got)
+	}
+	got := gridLayout(81, 24, 2, []string{"%1", "%2"})
+	if !strings.HasSuffix(got, ",81x24,0,0{40x24,0,0,1,40x24,41,0,2}") {
+		t.Fatalf("unexpected single-row layout %q", got)
+	}
+}
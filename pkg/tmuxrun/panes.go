@@ -0,0 +1,77 @@
+package tmuxrun
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pane is a tmux pane opened by this tool for a host.
+type Pane struct {
+	ID    string
+	Alias string
+	// Session, WindowIndex and WindowName locate the pane.
+	Session     string
+	WindowIndex string
+	WindowName  string
+	// Started is when the pane was opened; zero for panes tagged before it
+	// was recorded.
+	Started time.Time
+	// Logging is the policy the pane is logged with, if it is.
+	Logging string
+}
+
+// paneFormat lists a pane's fields, the window name last since it may hold
+// anything.
+const paneFormat = "#{pane_id}\t#{" + PaneAliasOption + "}\t#{" + PaneStartedOption + "}\t#{" + LoggingOption + "}\t#{session_name}\t#{window_index}\t#{window_name}"
+
+// Panes lists the panes of every session that this tool opened.
+func (s Session) Panes() ([]Pane, error) {
+	listing, err := s.output("list-panes", "-a", "-F", paneFormat)
+	if err != nil {
+		return nil, err
+	}
+	return parsePanes(listing), nil
+}
+
+// parsePanes reads list-panes output in paneFormat, skipping panes without
+// an alias.
+func parsePanes(listing string) []Pane {
+	var panes []Pane
+	for _, line := range strings.Split(listing, "\n") {
+		fields := strings.SplitN(line, "\t", 7)
+		if len(fields) < 7 || fields[1] == "" {
+			continue
+		}
+		pane := Pane{
+			ID:          fields[0],
+			Alias:       fields[1],
+			Logging:     fields[3],
+			Session:     fields[4],
+			WindowIndex: fields[5],
+			WindowName:  fields[6],
+		}
+		if unix, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+			pane.Started = time.Unix(unix, 0)
+		}
+		panes = append(panes, pane)
+	}
+	return panes
+}
+
+// JumpToPane switches the client to the pane's session and window and
+// selects it.
+func (s Session) JumpToPane(id string) error {
+	if err := s.Run("switch-client", "-t", id); err != nil {
+		return err
+	}
+	if err := s.Run("select-window", "-t", id); err != nil {
+		return err
+	}
+	return s.Run("select-pane", "-t", id)
+}
+
+// KillPane closes the pane, ending its connection.
+func (s Session) KillPane(id string) error {
+	return s.Run("kill-pane", "-t", id)
+}
@@ -0,0 +1,27 @@
+package tmuxrun
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePanesKeepsTaggedPanes(t *testing.T) {
+	listing := "%1\t\t\t\twork\t0\tzsh\n" +
+		"%4\tweb1\t1767268800\ttext\twork\t2\tweb1\n" +
+		"%7\tdb1\t\t\tops\t1\ttiled\twith\ttabs\n" +
+		"garbage"
+	panes := parsePanes(listing)
+	if len(panes) != 2 {
+		t.Fatalf("expected 2 tagged panes, got %+v", panes)
+	}
+	web := panes[0]
+	if web.ID != "%4" || web.Alias != "web1" || web.Logging != "text" || web.Session != "work" || web.WindowIndex != "2" || web.WindowName != "web1" {
+		t.Fatalf("unexpected pane %+v", web)
+	}
+	if !web.Started.Equal(time.Unix(1767268800, 0)) {
+		t.Fatalf("unexpected start %v", web.Started)
+	}
+	if db := panes[1]; !db.Started.IsZero() || db.WindowName != "tiled\twith\ttabs" {
+		t.Fatalf("expected no start and the whole window name, got %+v", db)
+	}
+}
@@ -6,16 +6,58 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+
+	"tmux-ssh-manager/pkg/sessionlog"
 )
 
 type Session struct {
 	AskpassScript string
-	HostUsers     map[string]string
-	HasCredential func(alias string) bool
+	// AskpassOptions are the ssh -o options used with the askpass script;
+	// nil means DefaultAskpassOptions.
+	AskpassOptions []string
+	HostUsers      map[string]string
+	HasCredential  func(alias string) bool
+	// Binary is the path to this executable. When Reconnect is set, panes run
+	// "<Binary> reconnect" instead of exec'ing ssh directly so dropped
+	// connections are retried.
+	Binary            string
+	Reconnect         bool
+	ReconnectAttempts int
+	// MaxPanes caps panes per window in Tiled; 0 leaves it to the layout.
+	MaxPanes int
+	// Style decorates the panes and windows opened for a host.
+	Style func(alias string) PaneStyle
+	// LogFormat, LogKeepRaw and LogRecord are passed to "<Binary>
+	// __logpipe", which cleans and timestamps pane output and optionally
+	// records it. Without a Binary, raw output is appended with cat.
+	LogFormat  string
+	LogKeepRaw bool
+	LogRecord  bool
+	// LogPolicy, if set, overrides them per host: "off", "text", "raw" or
+	// "recording".
+	LogPolicy func(alias string) string
+	// Opened, if set, is told about every pane opened for a host, so the
+	// connection can be kept in the history.
+	Opened func(alias, paneID string)
+}
+
+// PaneStyle is the decoration applied to a host's pane and window.
+type PaneStyle struct {
+	// Border is a tmux color or a full tmux style for the pane border.
+	Border string
+	// Title is shown in the pane border.
+	Title string
+	// WindowPrefix is prepended to the window name.
+	WindowPrefix string
 }
 
+// DefaultAskpassOptions keep ssh from spending its authentication attempts
+// on keys before the stored password is offered.
+var DefaultAskpassOptions = []string{"PubkeyAuthentication=no", "PreferredAuthentications=keyboard-interactive,password"}
+
 func InTmux() bool {
 	return strings.TrimSpace(os.Getenv("TMUX")) != ""
 }
@@ -69,22 +111,106 @@ func (s Session) output(args ...string) (string, error) {
 	return strings.TrimSpace(stdout.String()), nil
 }
 
+// GlobalOptions returns the global tmux options whose names start with
+// prefix, such as "@tmux_ssh_manager_".
+func (s Session) GlobalOptions(prefix string) (map[string]string, error) {
+	listing, err := s.output("show-options", "-g")
+	if err != nil {
+		return nil, err
+	}
+	return parseOptions(listing, prefix), nil
+}
+
+// parseOptions reads "show-options" output, which quotes values containing
+// spaces or quotes.
+func parseOptions(listing, prefix string) map[string]string {
+	out := map[string]string{}
+	for _, line := range strings.Split(listing, "\n") {
+		name, value, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+		out[name] = value
+	}
+	return out
+}
+
 func SSHCommand(alias string) string {
 	return fmt.Sprintf("exec ssh %s", shellQuote(alias))
 }
 
-func (s Session) sshCommand(alias string) string {
+// RemoteCommand is what ssh runs on the host for a pane's startup command:
+// the command, then a login shell, so that the pane stays open as when the
+// command is typed at the prompt.
+func RemoteCommand(command string) string {
+	return command + `; exec "$SHELL" -l`
+}
+
+// sshTarget returns the destination arguments of ssh: the alias, or with a
+// startup command, a tty and the remote command.
+func sshTarget(alias, command string) string {
+	if strings.TrimSpace(command) == "" {
+		return shellQuote(alias)
+	}
+	return "-t " + shellQuote(alias) + " -- " + shellQuote(RemoteCommand(command))
+}
+
+// ReconnectCommand returns the pane command that wraps ssh in the reconnect
+// loop of the given binary; command, if any, is run on the host.
+func ReconnectCommand(binary, alias string, maxAttempts int, command string) string {
+	line := "exec " + shellQuote(binary) + " reconnect"
+	if maxAttempts > 0 {
+		line += fmt.Sprintf(" --max-attempts %d", maxAttempts)
+	}
+	if strings.TrimSpace(command) != "" {
+		line += " --command " + shellQuote(command)
+	}
+	return line + " " + shellQuote(alias)
+}
+
+// sshCommand returns the pane command connecting to alias. A startup
+// command is given to ssh to run once the session is up, never typed into
+// the pane, where it could reach a password prompt or the local shell.
+func (s Session) sshCommand(alias, command string) string {
+	if s.Reconnect && s.Binary != "" {
+		// The reconnect subcommand resolves credentials itself on every
+		// attempt, so no askpass environment is exported here.
+		return ReconnectCommand(s.Binary, alias, s.ReconnectAttempts, command)
+	}
 	if s.AskpassScript != "" && s.HasCredential != nil && s.HasCredential(alias) {
 		user := ""
 		if s.HostUsers != nil {
 			user = s.HostUsers[alias]
 		}
+		options := s.AskpassOptions
+		if options == nil {
+			options = DefaultAskpassOptions
+		}
+		var flags strings.Builder
+		for _, option := range options {
+			flags.WriteString("-o " + shellQuote(option) + " ")
+		}
 		return fmt.Sprintf(
-			"export TSSM_HOST=%s TSSM_USER=%s SSH_ASKPASS=%s SSH_ASKPASS_REQUIRE=force DISPLAY=1; exec ssh -o PubkeyAuthentication=no -o PreferredAuthentications=keyboard-interactive,password %s",
-			shellQuote(alias), shellQuote(user), shellQuote(s.AskpassScript), shellQuote(alias),
+			"export TSSM_HOST=%s TSSM_USER=%s SSH_ASKPASS=%s SSH_ASKPASS_REQUIRE=force DISPLAY=1; %s",
+			shellQuote(alias), shellQuote(user), shellQuote(s.AskpassScript), s.endedAfter(alias, "ssh "+flags.String()+sshTarget(alias, command)),
 		)
 	}
-	return SSHCommand(alias)
+	return s.endedAfter(alias, "ssh "+sshTarget(alias, command))
+}
+
+// endedAfter runs ssh, then records in the history that the connection
+// ended, whether or not the pane was logged. Without a binary to record it
+// with, ssh replaces the shell.
+func (s Session) endedAfter(alias, ssh string) string {
+	if s.Binary == "" {
+		return "exec " + ssh
+	}
+	return ssh + "; exec " + shellQuote(s.Binary) + " __ended " + shellQuote(alias)
 }
 
 func loginShell() string {
@@ -95,68 +221,83 @@ func loginShell() string {
 }
 
 func (s Session) NewWindow(alias string) error {
-	paneID, err := s.output("new-window", "-P", "-F", "#{pane_id}", "-n", alias, loginShell(), "-lc", s.sshCommand(alias))
+	paneID, err := s.output("new-window", "-P", "-F", "#{pane_id}", "-n", alias, loginShell(), "-lc", s.sshCommand(alias, ""))
 	if err != nil {
 		return err
 	}
-	s.setupLogging(paneID, alias)
+	s.ownWindow(paneID)
+	s.setupPane(paneID, alias)
 	return nil
 }
 
 func (s Session) SplitVertical(alias string) error {
-	paneID, err := s.output("split-window", "-P", "-F", "#{pane_id}", "-v", "-c", "#{pane_current_path}", loginShell(), "-lc", s.sshCommand(alias))
+	paneID, err := s.output("split-window", "-P", "-F", "#{pane_id}", "-v", "-c", "#{pane_current_path}", loginShell(), "-lc", s.sshCommand(alias, ""))
 	if err != nil {
 		return err
 	}
-	s.setupLogging(paneID, alias)
+	s.setupPane(paneID, alias)
 	return nil
 }
 
 func (s Session) SplitHorizontal(alias string) error {
-	paneID, err := s.output("split-window", "-P", "-F", "#{pane_id}", "-h", "-c", "#{pane_current_path}", loginShell(), "-lc", s.sshCommand(alias))
+	paneID, err := s.output("split-window", "-P", "-F", "#{pane_id}", "-h", "-c", "#{pane_current_path}", loginShell(), "-lc", s.sshCommand(alias, ""))
 	if err != nil {
 		return err
 	}
-	s.setupLogging(paneID, alias)
+	s.setupPane(paneID, alias)
 	return nil
 }
 
-// Tiled opens multiple hosts in a single tmux window with a tiled layout.
-// The first alias gets a new window; remaining aliases are added as vertical
-// splits. After each split, select-layout is called with the given layout
-// (default "tiled") to continuously rebalance panes.
+// Tiled opens multiple hosts in tmux windows arranged by the layout spec (see
+// ParseLayout; default "tiled"). Host N becomes pane N. When the hosts exceed
+// what one window holds (the layout's capacity or MaxPanes), the rest spill
+// over into additional windows with the same layout.
 func (s Session) Tiled(aliases []string, layout string) error {
 	if len(aliases) == 0 {
 		return nil
 	}
-	if layout == "" {
-		layout = "tiled"
+	parsed, err := ParseLayout(layout)
+	if err != nil {
+		return err
 	}
+	for index, chunk := range parsed.Chunk(aliases, s.MaxPanes) {
+		name := "tiled"
+		if index > 0 {
+			name = fmt.Sprintf("tiled-%d", index+1)
+		}
+		if err := s.tiledWindow(name, chunk, parsed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+func (s Session) tiledWindow(name string, aliases []string, layout Layout) error {
 	// First host → new window.
-	windowID, err := s.output("new-window", "-P", "-F", "#{window_id}", "-n", "tiled", loginShell(), "-lc", s.sshCommand(aliases[0]))
+	out, err := s.output("new-window", "-P", "-F", "#{window_id} #{pane_id}", "-n", name, loginShell(), "-lc", s.sshCommand(aliases[0], ""))
 	if err != nil {
 		return err
 	}
-	// Also get the pane ID of the first window for logging.
-	if paneID, perr := s.output("display-message", "-p", "-t", windowID, "#{pane_id}"); perr == nil {
-		s.setupLogging(paneID, aliases[0])
-	}
+	windowID, paneID, _ := strings.Cut(out, " ")
+	s.ownWindow(paneID)
+	s.setupPane(paneID, aliases[0])
+	paneIDs := []string{paneID}
 
-	// Remaining hosts → splits within that window.
+	// Remaining hosts → splits off the newest pane so window order matches
+	// host order.
 	for _, alias := range aliases[1:] {
-		paneID, serr := s.output("split-window", "-P", "-F", "#{pane_id}", "-v", "-t", windowID, loginShell(), "-lc", s.sshCommand(alias))
+		paneID, serr := s.output("split-window", "-P", "-F", "#{pane_id}", "-v", "-t", paneIDs[len(paneIDs)-1], loginShell(), "-lc", s.sshCommand(alias, ""))
 		if serr != nil {
 			return serr
 		}
-		s.setupLogging(paneID, alias)
-		// Rebalance after each split.
-		_ = s.Run("select-layout", "-t", windowID, layout)
+		s.setupPane(paneID, alias)
+		paneIDs = append(paneIDs, paneID)
+		// Rebalance after each split so the next one has room.
+		_ = s.Run("select-layout", "-t", windowID, "tiled")
 	}
 
 	// Final layout pass.
-	_ = s.Run("select-layout", "-t", windowID, layout)
-	return nil
+	return s.applyLayout(windowID, layout, paneIDs)
 }
 
 // SelectLayout applies a tmux layout to the current window.
@@ -176,17 +317,171 @@ func (s Session) SetupPaneLogging(alias string) {
 	s.setupLogging(paneID, alias)
 }
 
+// PaneAliasOption is the pane user option that tags panes opened by this tool
+// with their host alias.
+const PaneAliasOption = "@tssm_alias"
+
+// PaneStartedOption is the pane user option holding when a pane opened by
+// this tool was created, in Unix seconds.
+const PaneStartedOption = "@tssm_started"
+
+// WindowOption is the window user option that marks windows this tool
+// created. Only those get pane titles turned on; other windows keep the
+// user's pane-border-status.
+const WindowOption = "@tssm_window"
+
+// ownWindow marks the window of paneID as created by this tool.
+func (s Session) ownWindow(paneID string) {
+	_ = s.Run("set-option", "-w", "-t", paneID, WindowOption, "1")
+}
+
+// showTitles turns on pane titles in the window of paneID if this tool
+// created the window.
+func (s Session) showTitles(paneID string) {
+	if own, err := s.output("show-options", "-wqv", "-t", paneID, WindowOption); err != nil || own != "1" {
+		return
+	}
+	_ = s.Run("set-option", "-w", "-t", paneID, "pane-border-status", "top")
+}
+
+// setupPane tags and configures a pane this tool just created.
+func (s Session) setupPane(paneID, alias string) {
+	_ = s.Run("set-option", "-p", "-t", paneID, PaneAliasOption, alias)
+	_ = s.Run("set-option", "-p", "-t", paneID, PaneStartedOption, strconv.FormatInt(time.Now().Unix(), 10))
+	if s.Opened != nil {
+		s.Opened(alias, paneID)
+	}
+	s.stylePane(paneID, alias)
+	s.setupLogging(paneID, alias)
+}
+
+func (s Session) stylePane(paneID, alias string) {
+	if s.Style == nil {
+		return
+	}
+	style := s.Style(alias)
+	if style.Border != "" {
+		border := borderStyle(style.Border)
+		_ = s.Run("set-option", "-p", "-t", paneID, "pane-border-style", border)
+		_ = s.Run("set-option", "-p", "-t", paneID, "pane-active-border-style", border)
+	}
+	if style.Title != "" {
+		_ = s.Run("select-pane", "-t", paneID, "-T", style.Title)
+		s.showTitles(paneID)
+	}
+	if style.WindowPrefix != "" {
+		if name, err := s.output("display-message", "-p", "-t", paneID, "#{window_name}"); err == nil && !strings.HasPrefix(name, style.WindowPrefix) {
+			_ = s.Run("rename-window", "-t", paneID, style.WindowPrefix+name)
+		}
+	}
+}
+
+// borderStyle turns a bare color into a tmux style; full styles pass through.
+func borderStyle(value string) string {
+	if strings.Contains(value, "=") {
+		return value
+	}
+	return "fg=" + value
+}
+
 func (s Session) setupLogging(paneID, alias string) {
 	if loggingDisabled() {
 		return
 	}
-	logPath, err := ensureLogFile(alias)
-	if err != nil {
+	command := s.logPipeCommand(alias)
+	if command == "" {
 		return
 	}
 	// Use output-only piping and discard any logger stderr so it can never
 	// interfere with the pane.
-	_ = s.Run("pipe-pane", "-O", "-t", paneID, "-o", "cat >> "+shellQuote(logPath)+" 2>/dev/null")
+	if s.Run("pipe-pane", "-O", "-t", paneID, "-o", command) != nil {
+		return
+	}
+	s.markLogged(paneID, alias)
+}
+
+// LoggingOption is the pane user option holding the policy a pane is logged
+// with, for use in tmux formats.
+const LoggingOption = "@tssm_logging"
+
+// markLogged shows in the pane title that the pane is logged.
+func (s Session) markLogged(paneID, alias string) {
+	policy := s.logPolicy(alias)
+	_ = s.Run("set-option", "-p", "-t", paneID, LoggingOption, policy)
+	title := alias
+	if s.Style != nil {
+		if styled := s.Style(alias).Title; styled != "" {
+			title = styled
+		}
+	}
+	marker := "[log] "
+	if policy == "recording" {
+		marker = "[rec] "
+	}
+	_ = s.Run("select-pane", "-t", paneID, "-T", marker+title)
+	s.showTitles(paneID)
+}
+
+// logPolicy is the policy alias is logged with.
+func (s Session) logPolicy(alias string) string {
+	if s.LogPolicy != nil {
+		if policy := s.LogPolicy(alias); policy != "" {
+			return policy
+		}
+	}
+	switch {
+	case s.LogRecord:
+		return "recording"
+	case s.LogFormat == "raw":
+		return "raw"
+	default:
+		return "text"
+	}
+}
+
+// logPipeCommand is the pipe-pane command that writes a pane's output to the
+// host's log, or "" if the host is not logged or the log cannot be created.
+func (s Session) logPipeCommand(alias string) string {
+	policy := s.logPolicy(alias)
+	if policy == "off" {
+		return ""
+	}
+	if s.Binary == "" {
+		logPath, err := ensureLogFile(alias)
+		if err != nil {
+			return ""
+		}
+		return "cat >> " + formatQuote(logPath) + " 2>/dev/null"
+	}
+	// pipe-pane expands formats, so the logger learns its pane and can
+	// record when the connection ended.
+	command := "exec " + formatQuote(s.Binary) + " __logpipe --alias " + formatQuote(alias) +
+		" --session " + shellQuote(sessionlog.NewSessionID(time.Now())) + " --pane '#{pane_id}'"
+	format := s.LogFormat
+	switch {
+	case policy == "raw":
+		format = "raw"
+	case format == "raw":
+		// Text and recording policies need a cleaned log.
+		format = "text"
+	}
+	if format != "" {
+		command += " --format " + shellQuote(format)
+	}
+	if s.LogKeepRaw && format != "raw" {
+		command += " --keep-raw"
+	}
+	if policy == "recording" {
+		// The recording gets the pane's size the same way.
+		command += " --record --cols '#{pane_width}' --rows '#{pane_height}'"
+	}
+	return command + " 2>/dev/null"
+}
+
+// formatQuote shell-quotes s for a command that tmux expands formats in
+// first, doubling "#" so that it reaches the shell unchanged.
+func formatQuote(s string) string {
+	return strings.ReplaceAll(shellQuote(s), "#", "##")
 }
 
 func loggingDisabled() bool {
@@ -200,14 +495,15 @@ func loggingDisabled() bool {
 
 // LogDir returns the log directory path for a host alias.
 func LogDir(alias string) (string, error) {
-	base, err := logsBaseDir()
+	base, err := LogsBaseDir()
 	if err != nil {
 		return "", err
 	}
 	return filepath.Join(base, sanitizeAlias(alias)), nil
 }
 
-func logsBaseDir() (string, error) {
+// LogsBaseDir returns the directory holding every host's log directory.
+func LogsBaseDir() (string, error) {
 	if xdg := strings.TrimSpace(os.Getenv("XDG_CONFIG_HOME")); xdg != "" {
 		return filepath.Join(xdg, "tmux-ssh-manager", "logs"), nil
 	}
@@ -38,7 +38,7 @@ func TestSessionSSHCommandDisablesPubkey(t *testing.T) {
 		HostUsers:     map[string]string{"edge1": "admin"},
 		HasCredential: func(alias string) bool { return alias == "edge1" },
 	}
-	got := s.sshCommand("edge1")
+	got := s.sshCommand("edge1", "")
 	if !strings.Contains(got, "PubkeyAuthentication=no") {
 		t.Fatalf("expected PubkeyAuthentication=no in command, got %q", got)
 	}
@@ -53,7 +53,7 @@ func TestSessionSSHCommandWithoutCredential(t *testing.T) {
 		HostUsers:     map[string]string{"edge1": "admin"},
 		HasCredential: func(alias string) bool { return false },
 	}
-	got := s.sshCommand("edge1")
+	got := s.sshCommand("edge1", "")
 	if strings.Contains(got, "PubkeyAuthentication") {
 		t.Fatalf("should not restrict auth when no credential, got %q", got)
 	}
@@ -184,3 +184,156 @@ func TestEnsureLogFileCreatesFile(t *testing.T) {
 		t.Fatalf("expected empty file, got size %d", info.Size())
 	}
 }
+
+func TestSessionSSHCommandWithReconnect(t *testing.T) {
+	s := Session{
+		AskpassScript:     "/tmp/tssm-askpass.sh",
+		HasCredential:     func(string) bool { return true },
+		Binary:            "/opt/tssm/bin/tmux-ssh-manager",
+		Reconnect:         true,
+		ReconnectAttempts: 5,
+	}
+	got := s.sshCommand("edge1", "")
+	want := "exec '/opt/tssm/bin/tmux-ssh-manager' reconnect --max-attempts 5 'edge1'"
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSessionSSHCommandRecordsTheEnd(t *testing.T) {
+	s := Session{Binary: "/opt/tssm/bin/tmux-ssh-manager"}
+	want := "ssh 'edge1'; exec '/opt/tssm/bin/tmux-ssh-manager' __ended 'edge1'"
+	if got := s.sshCommand("edge1", ""); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	s.AskpassScript = "/tmp/tssm-askpass.sh"
+	s.HasCredential = func(string) bool { return true }
+	s.AskpassOptions = []string{}
+	want = "export TSSM_HOST='edge1' TSSM_USER='' SSH_ASKPASS='/tmp/tssm-askpass.sh' SSH_ASKPASS_REQUIRE=force DISPLAY=1; ssh 'edge1'; exec '/opt/tssm/bin/tmux-ssh-manager' __ended 'edge1'"
+	if got := s.sshCommand("edge1", ""); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSessionSSHCommandReconnectNeedsBinary(t *testing.T) {
+	s := Session{Reconnect: true}
+	if got := s.sshCommand("edge1", ""); got != SSHCommand("edge1") {
+		t.Fatalf("expected plain ssh without a binary path, got %q", got)
+	}
+}
+
+func TestSessionSSHCommandRunsStartupCommandOnHost(t *testing.T) {
+	s := Session{}
+	want := `exec ssh -t 'edge1' -- 'htop; exec "$SHELL" -l'`
+	if got := s.sshCommand("edge1", "htop"); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	s = Session{Binary: "/opt/tssm/bin/tmux-ssh-manager", Reconnect: true}
+	want = "exec '/opt/tssm/bin/tmux-ssh-manager' reconnect --command 'tail -f '\"'\"'/var/log/x'\"'\"'' 'edge1'"
+	if got := s.sshCommand("edge1", "tail -f '/var/log/x'"); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestBorderStyle(t *testing.T) {
+	if got := borderStyle("red"); got != "fg=red" {
+		t.Fatalf("expected fg=red, got %q", got)
+	}
+	if got := borderStyle("fg=red,bold"); got != "fg=red,bold" {
+		t.Fatalf("expected full style to pass through, got %q", got)
+	}
+}
+
+func TestLogPipeCommandUsesBinary(t *testing.T) {
+	s := Session{Binary: "/opt/tssm/bin/tmux-ssh-manager", LogFormat: "json", LogKeepRaw: true}
+	got := s.logPipeCommand("edge1")
+	if !strings.HasPrefix(got, "exec '/opt/tssm/bin/tmux-ssh-manager' __logpipe --alias 'edge1' --session '") {
+		t.Fatalf("unexpected command %q", got)
+	}
+	if !strings.HasSuffix(got, " --format 'json' --keep-raw 2>/dev/null") {
+		t.Fatalf("expected format and raw flags, got %q", got)
+	}
+	if !strings.Contains(got, " --pane '#{pane_id}' ") {
+		t.Fatalf("expected the pane id, got %q", got)
+	}
+}
+
+func TestLogPipeCommandPassesPaneSizeForRecording(t *testing.T) {
+	s := Session{Binary: "/bin/tssm", LogRecord: true}
+	got := s.logPipeCommand("edge1")
+	if !strings.HasSuffix(got, " --record --cols '#{pane_width}' --rows '#{pane_height}' 2>/dev/null") {
+		t.Fatalf("expected record flags, got %q", got)
+	}
+}
+
+func TestLogPipeCommandFollowsHostPolicy(t *testing.T) {
+	policies := map[string]string{"quiet": "off", "bytes": "raw", "rec": "recording"}
+	s := Session{Binary: "/bin/tssm", LogFormat: "raw", LogKeepRaw: true, LogPolicy: func(alias string) string {
+		return policies[alias]
+	}}
+	if got := s.logPipeCommand("quiet"); got != "" {
+		t.Fatalf("expected no command for an unlogged host, got %q", got)
+	}
+	if got := s.logPipeCommand("bytes"); !strings.HasSuffix(got, " --format 'raw' 2>/dev/null") {
+		t.Fatalf("expected raw log without raw copy, got %q", got)
+	}
+	got := s.logPipeCommand("rec")
+	if !strings.Contains(got, " --format 'text' --keep-raw --record ") {
+		t.Fatalf("expected cleaned log with recording, got %q", got)
+	}
+	if got := s.logPipeCommand("other"); !strings.Contains(got, " --format 'raw' ") {
+		t.Fatalf("expected configured format for hosts without a policy, got %q", got)
+	}
+}
+
+func TestLogPipeCommandEscapesFormats(t *testing.T) {
+	got := Session{Binary: "/opt/#tools/tssm"}.logPipeCommand("db#1")
+	if !strings.HasPrefix(got, "exec '/opt/##tools/tssm' __logpipe --alias 'db##1' ") {
+		t.Fatalf("expected # doubled for tmux, got %q", got)
+	}
+	if !strings.Contains(got, " --pane '#{pane_id}'") {
+		t.Fatalf("expected the pane format to stay, got %q", got)
+	}
+}
+
+func TestLogPipeCommandFallsBackToCat(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	got := Session{}.logPipeCommand("edge1")
+	if !strings.HasPrefix(got, "cat >> '") {
+		t.Fatalf("expected cat fallback, got %q", got)
+	}
+}
+
+func TestSessionSSHCommandUsesAskpassOptions(t *testing.T) {
+	s := Session{
+		AskpassScript:  "/tmp/tssm-askpass.sh",
+		AskpassOptions: []string{"PreferredAuthentications=password"},
+		HasCredential:  func(string) bool { return true },
+	}
+	got := s.sshCommand("edge1", "")
+	if !strings.Contains(got, "exec ssh -o 'PreferredAuthentications=password' 'edge1'") || strings.Contains(got, "Pubkey") {
+		t.Fatalf("unexpected command %q", got)
+	}
+	s.AskpassOptions = []string{}
+	if got := s.sshCommand("edge1", ""); !strings.Contains(got, "exec ssh 'edge1'") {
+		t.Fatalf("expected no options, got %q", got)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	listing := "status on\n@tmux_ssh_manager_mode normal\n@tmux_ssh_manager_layout \"main left \\\"x\\\"\"\n@other_plugin 1\n@tmux_ssh_manager_key 's'\n"
+	got := parseOptions(listing, "@tmux_ssh_manager_")
+	want := map[string]string{
+		"@tmux_ssh_manager_mode":   "normal",
+		"@tmux_ssh_manager_layout": `main left "x"`,
+		"@tmux_ssh_manager_key":    "s",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Fatalf("%s = %q, want %q", name, got[name], value)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package tmuxrun
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PaneSpec describes one ssh pane of a workspace window.
+type PaneSpec struct {
+	Alias string
+	// Split is "v" (stacked) or "h" (side by side); ignored for the first pane.
+	Split string
+	// Command is run on the host once ssh is connected; the pane then
+	// stays open in a login shell.
+	Command string
+}
+
+// WindowSpec describes a tmux window of ssh panes.
+type WindowSpec struct {
+	Name string
+	// Layout is any spec accepted by ParseLayout, typically a layout string
+	// captured from tmux.
+	Layout string
+	Panes  []PaneSpec
+}
+
+// OpenWindow creates a new tmux window from spec. Panes are created in order,
+// each split off the previous one, and the layout is applied once all panes
+// exist. A layout tmux rejects (e.g. a captured string whose pane count no
+// longer matches) falls back to "tiled".
+func (s Session) OpenWindow(spec WindowSpec) error {
+	if len(spec.Panes) == 0 {
+		return nil
+	}
+	name := spec.Name
+	if name == "" {
+		name = spec.Panes[0].Alias
+	}
+
+	first := spec.Panes[0]
+	out, err := s.output("new-window", "-P", "-F", "#{window_id} #{pane_id}", "-n", name, loginShell(), "-lc", s.sshCommand(first.Alias, first.Command))
+	if err != nil {
+		return err
+	}
+	windowID, paneID, _ := strings.Cut(out, " ")
+	s.ownWindow(paneID)
+	s.setupPane(paneID, first.Alias)
+	paneIDs := []string{paneID}
+
+	for _, pane := range spec.Panes[1:] {
+		direction := "-v"
+		if pane.Split == "h" {
+			direction = "-h"
+		}
+		paneID, err := s.output("split-window", "-P", "-F", "#{pane_id}", direction, "-t", paneIDs[len(paneIDs)-1], loginShell(), "-lc", s.sshCommand(pane.Alias, pane.Command))
+		if err != nil {
+			return err
+		}
+		s.setupPane(paneID, pane.Alias)
+		paneIDs = append(paneIDs, paneID)
+		// Rebalance so later splits have room.
+		_ = s.Run("select-layout", "-t", windowID, "tiled")
+	}
+
+	layout, err := ParseLayout(spec.Layout)
+	if err != nil || s.applyLayout(windowID, layout, paneIDs) != nil {
+		_ = s.Run("select-layout", "-t", windowID, "tiled")
+	}
+	return nil
+}
+
+// CaptureWindow describes the panes of the current tmux window that were
+// opened by this tool, in pane order.
+func (s Session) CaptureWindow() (WindowSpec, error) {
+	info, err := s.output("display-message", "-p", "#{window_name}\t#{window_layout}")
+	if err != nil {
+		return WindowSpec{}, err
+	}
+	name, layout, _ := strings.Cut(info, "\t")
+	listing, err := s.output("list-panes", "-F", "#{"+PaneAliasOption+"}\t#{pane_top}")
+	if err != nil {
+		return WindowSpec{}, err
+	}
+	return parseCapturedPanes(name, layout, listing)
+}
+
+// parseCapturedPanes builds a WindowSpec from list-panes output of
+// "<alias>\t<pane_top>" lines. Untagged panes are skipped; split directions
+// are inferred from whether a pane shares the previous pane's top edge.
+func parseCapturedPanes(name, layout, listing string) (WindowSpec, error) {
+	spec := WindowSpec{Name: name}
+	total := 0
+	prevTop := ""
+	for _, line := range strings.Split(strings.Trim(listing, "\r\n"), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		total++
+		alias, top, _ := strings.Cut(line, "\t")
+		alias = strings.TrimSpace(alias)
+		if alias == "" {
+			continue
+		}
+		pane := PaneSpec{Alias: alias}
+		if len(spec.Panes) > 0 {
+			pane.Split = "v"
+			if top == prevTop {
+				pane.Split = "h"
+			}
+		}
+		prevTop = top
+		spec.Panes = append(spec.Panes, pane)
+	}
+	if len(spec.Panes) == 0 {
+		return WindowSpec{}, fmt.Errorf("no panes in the current window were opened by tmux-ssh-manager")
+	}
+	// A captured layout string only fits when every pane is restored.
+	spec.Layout = "tiled"
+	if len(spec.Panes) == total && layout != "" {
+		spec.Layout = layout
+	}
+	return spec, nil
+}
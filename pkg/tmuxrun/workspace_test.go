@@ -0,0 +1,42 @@
+package tmuxrun
+
+import "testing"
+
+func TestParseCapturedPanesInfersSplits(t *testing.T) {
+	listing := "web1\t0\nweb2\t0\ndb1\t25\n"
+	spec, err := parseCapturedPanes("prod", "a1b2,200x50,0,0{...}", listing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Name != "prod" || spec.Layout != "a1b2,200x50,0,0{...}" {
+		t.Fatalf("unexpected window: %+v", spec)
+	}
+	want := []PaneSpec{{Alias: "web1"}, {Alias: "web2", Split: "h"}, {Alias: "db1", Split: "v"}}
+	if len(spec.Panes) != len(want) {
+		t.Fatalf("expected %d panes, got %+v", len(want), spec.Panes)
+	}
+	for i := range want {
+		if spec.Panes[i] != want[i] {
+			t.Errorf("pane %d = %+v, want %+v", i, spec.Panes[i], want[i])
+		}
+	}
+}
+
+func TestParseCapturedPanesSkipsUntaggedPanes(t *testing.T) {
+	spec, err := parseCapturedPanes("mixed", "a1b2,200x50,0,0{...}", "\t0\nweb1\t0\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Panes) != 1 || spec.Panes[0].Alias != "web1" {
+		t.Fatalf("unexpected panes: %+v", spec.Panes)
+	}
+	if spec.Layout != "tiled" {
+		t.Fatalf("expected tiled fallback when panes are skipped, got %q", spec.Layout)
+	}
+}
+
+func TestParseCapturedPanesRequiresTaggedPane(t *testing.T) {
+	if _, err := parseCapturedPanes("shell", "", "\t0\n"); err == nil {
+		t.Fatal("expected error when no panes are tagged")
+	}
+}
@@ -0,0 +1,195 @@
+package tmuxui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"tmux-ssh-manager/pkg/sshconfig"
+)
+
+// Fields of the add host form, in tab order; addFile is the target-file
+// chooser after the text inputs.
+const (
+	addAlias = iota
+	addHostName
+	addUser
+	addPort
+	addProxyJump
+	addIdentityFile
+	addTags
+	addFile
+	addFieldCount
+)
+
+func (m *model) addFields() []*textinput.Model {
+	return []*textinput.Model{&m.add.alias, &m.add.hostName, &m.add.user, &m.add.port, &m.add.proxyJump, &m.add.identityFile, &m.add.tags}
+}
+
+// addHostErrors checks each field of the form as it is typed; an empty
+// string means the field is fine. A missing alias is only reported once
+// saving was tried.
+func (m model) addHostErrors() [addFile]string {
+	var errs [addFile]string
+	value := func(field int) string {
+		return strings.TrimSpace(m.addFields()[field].Value())
+	}
+
+	alias := value(addAlias)
+	switch {
+	case alias == "":
+		if m.add.submitted {
+			errs[addAlias] = "required"
+		}
+	case strings.ContainsAny(alias, " \t"):
+		errs[addAlias] = "must be a single word"
+	case strings.ContainsAny(alias, "*?[]!"):
+		errs[addAlias] = "must not contain * ? [ ] or !"
+	default:
+		if host, ok := m.hostByAlias(alias); ok {
+			errs[addAlias] = "already defined in " + displayPath(host.SourcePath)
+		}
+	}
+	for _, field := range []int{addHostName, addUser} {
+		if strings.ContainsAny(value(field), " \t") {
+			errs[field] = "must not contain spaces"
+		}
+	}
+	if port := value(addPort); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			errs[addPort] = "must be 1-65535"
+		}
+	}
+	errs[addProxyJump] = m.checkProxyJump(value(addProxyJump), alias)
+	if identity := value(addIdentityFile); identity != "" {
+		if info, err := os.Stat(expandHome(identity)); err != nil {
+			errs[addIdentityFile] = "no such file"
+		} else if info.IsDir() {
+			errs[addIdentityFile] = "is a directory"
+		}
+	}
+	return errs
+}
+
+// checkProxyJump requires each hop of jump to be a known host alias. Hops
+// written as a hostname (with a dot), user@host or host:port are taken as
+// they are, since ssh resolves them without the config.
+func (m model) checkProxyJump(jump, alias string) string {
+	if jump == "" || strings.EqualFold(jump, "none") {
+		return ""
+	}
+	for _, hop := range strings.Split(jump, ",") {
+		hop = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(hop), "ssh://"))
+		switch {
+		case hop == "":
+			return "empty hop"
+		case hop == alias:
+			return "cannot jump through the host itself"
+		case strings.ContainsAny(hop, ".@:"):
+			continue
+		}
+		if _, ok := m.hostByAlias(hop); !ok {
+			return fmt.Sprintf("unknown host %q", hop)
+		}
+	}
+	return ""
+}
+
+func (m model) hostByAlias(alias string) (sshconfig.Host, bool) {
+	for _, c := range m.candidates {
+		if c.host.Alias == alias {
+			return c.host, true
+		}
+	}
+	return sshconfig.Host{}, false
+}
+
+// addTarget is the file the form writes to; without HostFiles, the primary
+// config.
+func (m model) addTarget() string {
+	if len(m.app.HostFiles) == 0 {
+		path, _ := sshconfig.DefaultPrimaryPath()
+		return path
+	}
+	return m.app.HostFiles[m.add.file%len(m.app.HostFiles)]
+}
+
+// cycleAddFile picks the next (or previous) file of App.HostFiles.
+func (m *model) cycleAddFile(delta int) {
+	if n := len(m.app.HostFiles); n > 0 {
+		m.add.file = (m.add.file + delta + n) % n
+	}
+}
+
+// viewAddFile renders the target-file chooser.
+func (m model) viewAddFile() string {
+	target := displayPath(m.addTarget())
+	line := "File: " + target
+	if len(m.app.HostFiles) > 1 {
+		line = fmt.Sprintf("File: ◂ %s ▸  %s", target, m.dimStyle.Render(fmt.Sprintf("(%d of %d)", m.add.file+1, len(m.app.HostFiles))))
+	}
+	if m.add.field == addFile {
+		return m.selectedStyle.Render(line)
+	}
+	return line
+}
+
+// viewAddPreview renders the block that saving would append.
+func (m model) viewAddPreview() []string {
+	input, err := m.addInput()
+	if err != nil || input.Alias == "" {
+		return nil
+	}
+	lines := []string{m.dimStyle.Render("Preview:")}
+	for _, line := range strings.Split(strings.TrimRight(sshconfig.RenderHostBlock(input), "\n"), "\n") {
+		lines = append(lines, m.dimStyle.Render("  "+line))
+	}
+	return lines
+}
+
+// openClone fills the add form from the host under the cursor, to be
+// written into the same file; only the alias is left to type.
+func (m model) openClone() (tea.Model, tea.Cmd) {
+	current := m.current()
+	if current == nil {
+		return m, nil
+	}
+	src := current.host
+	input := sshconfig.CloneInput(src, "")
+	m.showAddHost = true
+	m.add.status = ""
+	m.resetAddHostFields()
+	m.add.hostName.SetValue(input.HostName)
+	m.add.user.SetValue(input.User)
+	if input.Port > 0 {
+		m.add.port.SetValue(strconv.Itoa(input.Port))
+	}
+	m.add.proxyJump.SetValue(input.ProxyJump)
+	m.add.identityFile.SetValue(input.IdentityFile)
+	m.add.tags.SetValue(strings.Join(input.Tags, ","))
+	m.add.cloneOf = src.Alias
+	m.add.extra = input.Extra
+	m.add.annotations = input.Annotations
+	for i, path := range m.app.HostFiles {
+		if path == src.SourcePath {
+			m.add.file = i
+		}
+	}
+	m.add.field = addAlias
+	m.focusAddField()
+	return m, nil
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
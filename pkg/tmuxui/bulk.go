@@ -0,0 +1,297 @@
+package tmuxui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"tmux-ssh-manager/pkg/sshconfig"
+	"tmux-ssh-manager/pkg/state"
+)
+
+// promptModel asks for what a bulk action on the selection needs: the tags
+// to add or remove, or the file to export to. It also asks for the new
+// alias of the highlighted host.
+type promptModel struct {
+	action Action
+	hosts  []string
+	input  textinput.Model
+	status string
+}
+
+func (m model) openPrompt(action Action) (tea.Model, tea.Cmd) {
+	hosts := m.targets()
+	if action == ActionRename {
+		hosts = nil
+		if current := m.current(); current != nil {
+			hosts = []string{current.host.Alias}
+		}
+	}
+	if len(hosts) == 0 {
+		return m, nil
+	}
+	m.prompt.action = action
+	m.prompt.hosts = hosts
+	m.prompt.status = ""
+	m.prompt.input.SetValue("")
+	switch action {
+	case ActionRename:
+		m.prompt.input.Prompt = "Alias: "
+		m.prompt.input.Placeholder = "new alias"
+		m.prompt.input.SetValue(hosts[0])
+	case ActionExport:
+		m.prompt.input.Prompt = "File: "
+		m.prompt.input.Placeholder = "path to write the Host blocks to"
+	default:
+		m.prompt.input.Prompt = "Tags: "
+		m.prompt.input.Placeholder = "comma separated"
+	}
+	m.prompt.input.Focus()
+	m.showPrompt = true
+	return m, textinput.Blink
+}
+
+func (m model) handlePrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "ctrl+c":
+		m.showPrompt = false
+		m.prompt.input.Blur()
+		return m, nil
+	case "enter":
+		value := strings.TrimSpace(m.prompt.input.Value())
+		if value == "" {
+			m.prompt.status = "nothing entered"
+			return m, nil
+		}
+		if m.prompt.action == ActionRename {
+			return m.renameHost(value)
+		}
+		hosts := m.hostsFor(m.prompt.hosts)
+		var backup sshconfig.Backup
+		var err error
+		switch m.prompt.action {
+		case ActionTagAdd:
+			backup, err = m.editTags(hosts, splitList(value), nil)
+		case ActionTagRemove:
+			backup, err = m.editTags(hosts, nil, splitList(value))
+		case ActionExport:
+			err = m.exportHosts(hosts, expandHome(value))
+		}
+		if err != nil {
+			m.prompt.status = err.Error()
+			return m, nil
+		}
+		m.showPrompt = false
+		m.prompt.input.Blur()
+		switch m.prompt.action {
+		case ActionTagAdd:
+			m.status = fmt.Sprintf("tagged %s with %s", countHosts(len(hosts)), strings.Join(splitList(value), ", "))
+			m = m.rememberConfig("tag "+countHosts(len(hosts)), backup)
+		case ActionTagRemove:
+			m.status = fmt.Sprintf("removed %s from %s", strings.Join(splitList(value), ", "), countHosts(len(hosts)))
+			m = m.rememberConfig("untag "+countHosts(len(hosts)), backup)
+		case ActionExport:
+			m.status = fmt.Sprintf("exported %s to %s", countHosts(len(hosts)), displayPath(expandHome(value)))
+			return m, nil
+		}
+		return m.reloadHosts(), nil
+	}
+	var cmd tea.Cmd
+	m.prompt.input, cmd = m.prompt.input.Update(msg)
+	m.prompt.status = ""
+	return m, cmd
+}
+
+func (m model) editTags(hosts []sshconfig.Host, add, remove []string) (sshconfig.Backup, error) {
+	if m.app.EditTags == nil {
+		return sshconfig.Backup{}, fmt.Errorf("editing tags is not available")
+	}
+	return m.app.EditTags(hosts, add, remove)
+}
+
+func (m model) exportHosts(hosts []sshconfig.Host, path string) error {
+	if m.app.ExportHosts == nil {
+		return fmt.Errorf("exporting hosts is not available")
+	}
+	blocks, err := m.app.ExportHosts(hosts)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(blocks), 0o600)
+}
+
+// renameHost renames the prompt's host to alias in ssh config, then in the
+// state, so that its sets, favorites and workspace panes follow it.
+func (m model) renameHost(alias string) (tea.Model, tea.Cmd) {
+	hosts := m.hostsFor(m.prompt.hosts)
+	if m.app.RenameHost == nil || len(hosts) != 1 {
+		m.prompt.status = "renaming hosts is not available"
+		return m, nil
+	}
+	old := hosts[0].Alias
+	before := m.captureState()
+	backup, err := m.app.RenameHost(hosts[0], alias)
+	if err != nil {
+		m.prompt.status = err.Error()
+		return m, nil
+	}
+	m.showPrompt = false
+	m.prompt.input.Blur()
+	if m.app.State != nil {
+		m.app.State.RenameAlias(old, alias)
+		_ = state.Save(m.app.StatePath, m.app.State)
+	}
+	if _, ok := m.selectedAliases[old]; ok {
+		delete(m.selectedAliases, old)
+		m.selectedAliases[alias] = struct{}{}
+	}
+	m.status = fmt.Sprintf("renamed %s to %s", old, alias)
+	m = m.rememberRename("rename "+old, backup, before)
+	return m.reloadHosts(), nil
+}
+
+// toggleFavorites favorites every target, or unfavorites them all when
+// they all are favorites already.
+func (m model) toggleFavorites() (tea.Model, tea.Cmd) {
+	hosts := m.targets()
+	if len(hosts) == 0 {
+		return m, nil
+	}
+	before := m.captureState()
+	on := false
+	for _, alias := range hosts {
+		if !m.app.State.IsFavorite(alias) {
+			on = true
+		}
+	}
+	for _, alias := range hosts {
+		if m.app.State.IsFavorite(alias) != on {
+			m.app.State.ToggleFavorite(alias)
+		}
+	}
+	_ = state.Save(m.app.StatePath, m.app.State)
+	switch {
+	case len(hosts) == 1 && on:
+		m.status = "favorite added"
+	case len(hosts) == 1:
+		m.status = "favorite removed"
+	case on:
+		m.status = fmt.Sprintf("%d favorites added", len(hosts))
+	default:
+		m.status = fmt.Sprintf("%d favorites removed", len(hosts))
+	}
+	m = m.rememberState("favorite "+countHosts(len(hosts)), before)
+	m.recompute()
+	return m, nil
+}
+
+// confirmDelete lists the targets and deletes their Host blocks on y.
+func (m model) confirmDelete() (tea.Model, tea.Cmd) {
+	hosts := m.targets()
+	if len(hosts) == 0 {
+		return m, nil
+	}
+	if m.app.RemoveHosts == nil {
+		m.status = "deleting hosts is not available"
+		return m, nil
+	}
+	m.confirm = &confirmModel{
+		hosts:     hosts,
+		title:     "Delete hosts",
+		intro:     "These Host blocks will be removed from your ssh config:",
+		yes:       "y delete",
+		cancelled: "delete cancelled",
+		run: func(m model) (tea.Model, tea.Cmd) {
+			blocks := m.hostsFor(hosts)
+			backup, err := m.app.RemoveHosts(blocks)
+			if err != nil {
+				m.status = err.Error()
+				return m, nil
+			}
+			m.status = "deleted " + countHosts(len(blocks))
+			m = m.rememberConfig("delete "+countHosts(len(blocks)), backup)
+			return m.reloadHosts(), nil
+		},
+	}
+	return m, nil
+}
+
+// hostsFor returns the hosts of the given aliases, in that order.
+func (m model) hostsFor(aliases []string) []sshconfig.Host {
+	hosts := make([]sshconfig.Host, 0, len(aliases))
+	for _, alias := range aliases {
+		if host, ok := m.hostByAlias(alias); ok {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// reloadHosts reads the ssh config again after it was edited, dropping
+// hosts that are gone from the selection.
+func (m model) reloadHosts() model {
+	load := m.app.LoadHosts
+	if load == nil {
+		load = sshconfig.LoadDefault
+	}
+	hosts, err := load()
+	if err != nil {
+		m.status = err.Error()
+		return m
+	}
+	m.candidates = buildCandidates(hosts)
+	for alias := range m.selectedAliases {
+		if _, ok := m.hostByAlias(alias); !ok {
+			delete(m.selectedAliases, alias)
+		}
+	}
+	m.recompute()
+	return m
+}
+
+func (m model) viewPrompt() string {
+	title := "Export"
+	switch m.prompt.action {
+	case ActionTagAdd:
+		title = "Add tags to"
+	case ActionTagRemove:
+		title = "Remove tags from"
+	case ActionRename:
+		title = "Rename"
+	}
+	parts := []string{
+		title + " " + countHosts(len(m.prompt.hosts)),
+		m.dimStyle.Render(strings.Join(m.prompt.hosts, ", ")),
+		"",
+		m.prompt.input.View(),
+		"",
+		m.helpStyle.Render("enter apply • esc cancel"),
+	}
+	if m.prompt.status != "" {
+		parts = append(parts, m.statusStyle.Render(m.prompt.status))
+	}
+	return strings.Join(parts, "\n")
+}
+
+func hostsLine(hosts []string) string {
+	if len(hosts) == 1 {
+		return "Host: " + hosts[0]
+	}
+	return "Hosts: " + strings.Join(hosts, ", ")
+}
+
+func countHosts(n int) string {
+	if n == 1 {
+		return "1 host"
+	}
+	return fmt.Sprintf("%d hosts", n)
+}
+
+// splitList splits a comma- or space-separated list.
+func splitList(raw string) []string {
+	return strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+}
@@ -0,0 +1,119 @@
+package tmuxui
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"tmux-ssh-manager/pkg/health"
+	"tmux-ssh-manager/pkg/state"
+)
+
+// healthMsg carries a finished check; more arrive on results.
+type healthMsg struct {
+	result  health.Result
+	results <-chan health.Result
+}
+
+// healthDoneMsg reports that every check of a round has finished.
+type healthDoneMsg struct{}
+
+// staleHealth returns the hosts whose cached check is missing or older than
+// the TTL.
+func (m model) staleHealth() []string {
+	if m.app.CheckHealth == nil {
+		return nil
+	}
+	var aliases []string
+	now := time.Now()
+	for _, c := range m.candidates {
+		if _, ok := m.app.State.FreshHealth(c.host.Alias, m.app.HealthTTL, now); !ok {
+			aliases = append(aliases, c.host.Alias)
+		}
+	}
+	return aliases
+}
+
+// checkHealth starts checking aliases in the background, unless a round is
+// already running.
+func (m *model) checkHealth(aliases []string) tea.Cmd {
+	if m.app.CheckHealth == nil || len(aliases) == 0 || len(m.checking) > 0 {
+		return nil
+	}
+	for _, alias := range aliases {
+		m.checking[alias] = true
+	}
+	return waitHealth(m.app.CheckHealth(m.ctx, aliases))
+}
+
+func waitHealth(results <-chan health.Result) tea.Cmd {
+	return func() tea.Msg {
+		result, ok := <-results
+		if !ok {
+			return healthDoneMsg{}
+		}
+		return healthMsg{result: result, results: results}
+	}
+}
+
+func (m model) applyHealth(msg healthMsg) (tea.Model, tea.Cmd) {
+	m.app.State.PutHealth(msg.result.Alias, msg.result.Record())
+	delete(m.checking, msg.result.Alias)
+	return m, waitHealth(msg.results)
+}
+
+func (m model) finishHealth() (tea.Model, tea.Cmd) {
+	m.checking = map[string]bool{}
+	_ = state.Save(m.app.StatePath, m.app.State)
+	return m, nil
+}
+
+// recheckHealth checks every filtered host again, ignoring the cache.
+func (m model) recheckHealth() (tea.Model, tea.Cmd) {
+	if m.app.CheckHealth == nil {
+		m.status = "health checks are disabled"
+		return m, nil
+	}
+	if len(m.checking) > 0 {
+		m.status = fmt.Sprintf("checking %d hosts...", len(m.checking))
+		return m, nil
+	}
+	aliases := make([]string, 0, len(m.filtered))
+	for _, c := range m.filtered {
+		aliases = append(aliases, c.host.Alias)
+	}
+	m.status = fmt.Sprintf("checking %d hosts...", len(aliases))
+	return m, m.checkHealth(aliases)
+}
+
+// healthColumn renders a host's reachability in a fixed width: its latency
+// when up, "down", "unknown" when its jump host needs a password, or "…"
+// while the first check runs.
+func (m model) healthColumn(alias string) string {
+	const width = 9
+	check, ok := m.app.State.Health[alias]
+	switch {
+	case !ok && m.checking[alias]:
+		return m.dimStyle.Render(fmt.Sprintf("%-*s", width, "…"))
+	case !ok:
+		return fmt.Sprintf("%-*s", width, "")
+	case check.Unknown:
+		return m.dimStyle.Render(fmt.Sprintf("%-*s", width, "? unknown"))
+	case !check.Up:
+		return m.downStyle.Render(fmt.Sprintf("%-*s", width, "✗ down"))
+	default:
+		return m.upStyle.Render(fmt.Sprintf("%-*s", width, "● "+formatLatency(check.LatencyMS)))
+	}
+}
+
+func formatLatency(ms float64) string {
+	switch {
+	case ms < 1:
+		return "<1ms"
+	case ms < 1000:
+		return fmt.Sprintf("%.0fms", ms)
+	default:
+		return fmt.Sprintf("%.1fs", ms/1000)
+	}
+}
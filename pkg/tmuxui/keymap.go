@@ -0,0 +1,271 @@
+package tmuxui
+
+import (
+	"fmt"
+	"strings"
+
+	"tmux-ssh-manager/pkg/config"
+)
+
+// Action is something the picker does in normal mode when its keys are
+// pressed.
+type Action string
+
+const (
+	ActionQuit             Action = "quit"
+	ActionSearch           Action = "search"
+	ActionUp               Action = "up"
+	ActionDown             Action = "down"
+	ActionHalfPageUp       Action = "half-page-up"
+	ActionHalfPageDown     Action = "half-page-down"
+	ActionTop              Action = "top"
+	ActionBottom           Action = "bottom"
+	ActionToggleSelect     Action = "toggle-select"
+	ActionSelectAll        Action = "select-all"
+	ActionConnect          Action = "connect"
+	ActionConnectPane      Action = "connect-pane"
+	ActionSplitV           Action = "split-v"
+	ActionSplitH           Action = "split-h"
+	ActionWindow           Action = "window"
+	ActionTiled            Action = "tiled"
+	ActionFavorite         Action = "favorite"
+	ActionFilterFavorites  Action = "filter-favorites"
+	ActionFilterRecents    Action = "filter-recents"
+	ActionAddHost          Action = "add-host"
+	ActionStoreCredential  Action = "store-credential"
+	ActionDeleteCredential Action = "delete-credential"
+	ActionWorkspaces       Action = "workspaces"
+	ActionTunnels          Action = "tunnels"
+	ActionLogs             Action = "logs"
+	ActionLogPolicy        Action = "log-policy"
+	ActionHelp             Action = "help"
+	ActionTree             Action = "tree"
+	ActionGroupBy          Action = "group-by"
+	ActionExpand           Action = "expand"
+	ActionCollapse         Action = "collapse"
+	ActionToggleGroup      Action = "toggle-group"
+	ActionExpandAll        Action = "expand-all"
+	ActionCollapseAll      Action = "collapse-all"
+	ActionCheckHealth      Action = "check-health"
+	ActionPalette          Action = "palette"
+	ActionSort             Action = "sort"
+	ActionClone            Action = "clone"
+	ActionSets             Action = "sets"
+	ActionFilterSet        Action = "filter-set"
+	ActionTagAdd           Action = "tag"
+	ActionTagRemove        Action = "untag"
+	ActionDeleteHosts      Action = "delete-hosts"
+	ActionExport           Action = "export"
+	ActionRename           Action = "rename"
+	ActionNextTab          Action = "next-tab"
+	ActionPrevTab          Action = "prev-tab"
+	ActionHostsTab         Action = "hosts"
+	ActionSessions         Action = "sessions"
+	ActionHistory          Action = "history"
+	ActionUndo             Action = "undo"
+	ActionRedo             Action = "redo"
+)
+
+// actionSpec describes an action: its default keys, its label in the
+// picker's footer (none when short is empty) and its help overlay line.
+type actionSpec struct {
+	action Action
+	short  string
+	help   string
+	keys   []string
+}
+
+// actions lists every action in help order.
+var actions = []actionSpec{
+	{ActionSearch, "search", "Focus the search input", []string{"/"}},
+	{ActionConnect, "connect", "Connect as --enter-mode says (selection: windows or splits)", []string{"enter"}},
+	{ActionConnectPane, "", "Connect in this pane", []string{"p"}},
+	{ActionToggleSelect, "select", "Toggle the highlighted host in the selection", []string{"space"}},
+	{ActionSelectAll, "", "Select all filtered hosts", []string{"ctrl+a"}},
+	{ActionSplitV, "split-v", "Open in a vertical split", []string{"v"}},
+	{ActionSplitH, "split-h", "Open in a horizontal split", []string{"s"}},
+	{ActionWindow, "window", "Open in a new window", []string{"w"}},
+	{ActionTiled, "tiled", "Open the selection tiled in one window", []string{"t"}},
+	{ActionUp, "", "Move up", []string{"k", "up"}},
+	{ActionDown, "", "Move down", []string{"j", "down"}},
+	{ActionHalfPageUp, "", "Scroll up half a page", []string{"ctrl+u"}},
+	{ActionHalfPageDown, "", "Scroll down half a page", []string{"ctrl+d"}},
+	{ActionTop, "", "Jump to the first host", []string{"g g"}},
+	{ActionBottom, "", "Jump to the last host", []string{"G"}},
+	{ActionTree, "tree", "Switch between the list and the grouped tree view", []string{"V"}},
+	{ActionGroupBy, "", "Group the tree by file, tag, bastion or domain (next)", []string{"b"}},
+	{ActionExpand, "", "Tree: expand the group", []string{"right"}},
+	{ActionCollapse, "", "Tree: collapse the group", []string{"left"}},
+	{ActionToggleGroup, "", "Tree: expand or collapse the group", []string{"o"}},
+	{ActionExpandAll, "", "Tree: expand every group", []string{"z R"}},
+	{ActionCollapseAll, "", "Tree: collapse every group", []string{"z M"}},
+	{ActionSort, "", "Sort hosts: config order, by name or recent first (next)", []string{"O"}},
+	{ActionCheckHealth, "", "Check again whether the listed hosts are reachable", []string{"r"}},
+	{ActionStoreCredential, "store cred", "Store a credential for the host (or the whole selection)", []string{"c"}},
+	{ActionDeleteCredential, "delete cred", "Delete a stored credential", []string{"d"}},
+	{ActionFavorite, "favorite", "Toggle favorite (selection: all on, or all off)", []string{"f"}},
+	{ActionTagAdd, "", "Add tags to the selection", []string{"+"}},
+	{ActionTagRemove, "", "Remove tags from the selection", []string{"-"}},
+	{ActionExport, "", "Export the selection's Host blocks to a file", []string{"E"}},
+	{ActionDeleteHosts, "", "Delete the selection's Host blocks from ssh config", []string{"D"}},
+	{ActionRename, "", "Rename the host in ssh config; its sets, favorites and workspaces follow", []string{"n"}},
+	{ActionUndo, "", "Undo the last change to favorites, sets, workspaces, ssh config or credentials", []string{"u"}},
+	{ActionRedo, "", "Redo the last undone change", []string{"ctrl+r"}},
+	{ActionFilterFavorites, "favorites", "Show only favorites", []string{"F"}},
+	{ActionFilterRecents, "recents", "Show only recent hosts", []string{"R"}},
+	{ActionFilterSet, "", "Show only the hosts of a set (next)", []string{"ctrl+s"}},
+	{ActionSets, "sets", "Save the selection as a set, or recall one", []string{"S"}},
+	{ActionWorkspaces, "workspaces", "Open or save workspaces", []string{"W"}},
+	{ActionNextTab, "tabs", "Next tab: hosts, open sessions, tunnels, history", []string{"tab"}},
+	{ActionPrevTab, "", "Previous tab", []string{"shift+tab"}},
+	{ActionHostsTab, "", "Hosts tab", []string{"1"}},
+	{ActionSessions, "", "Open sessions tab: jump to or kill panes opened by the picker", []string{"2"}},
+	{ActionTunnels, "tunnels", "Tunnels tab: show and manage tunnels", []string{"T", "3"}},
+	{ActionHistory, "", "History tab: reconnect to a recent connection", []string{"4"}},
+	{ActionLogs, "logs", "Browse the host's session logs", []string{"L"}},
+	{ActionLogPolicy, "log policy", "Cycle logging for the next connection", []string{"l"}},
+	{ActionAddHost, "add host", "Add a host to ssh config", []string{"a"}},
+	{ActionClone, "", "Clone the host into the add host form", []string{"y"}},
+	{ActionPalette, "commands", "Search and run any command", []string{":"}},
+	{ActionHelp, "help", "Show this help", []string{"?"}},
+	{ActionQuit, "quit", "Quit", []string{"q", "esc", "ctrl+c"}},
+}
+
+// Keymap maps key sequences to picker actions.
+type Keymap struct {
+	// bindings maps sequences, keys joined by spaces, to actions; prefixes
+	// holds every proper prefix of a sequence.
+	bindings map[string]Action
+	prefixes map[string]bool
+	keys     map[Action][]string
+}
+
+// DefaultKeymap returns the built-in bindings.
+func DefaultKeymap() Keymap {
+	keymap, err := NewKeymap(nil)
+	if err != nil {
+		panic(err)
+	}
+	return keymap
+}
+
+// NewKeymap applies overrides to the default bindings. It rejects unknown
+// actions, a sequence bound to two actions and a sequence that is a prefix
+// of another (its action would run before the longer one could be typed).
+func NewKeymap(overrides []config.KeyBinding) (Keymap, error) {
+	keys := make(map[Action][]string, len(actions))
+	sources := map[Action]string{}
+	for _, a := range actions {
+		keys[a.action] = a.keys
+		sources[a.action] = "default"
+	}
+	for _, override := range overrides {
+		action := Action(override.Action)
+		if _, ok := keys[action]; !ok {
+			return Keymap{}, fmt.Errorf("%s: unknown action %q", override.Source, override.Action)
+		}
+		keys[action] = override.Keys
+		sources[action] = override.Source
+	}
+
+	k := Keymap{bindings: map[string]Action{}, prefixes: map[string]bool{}, keys: keys}
+	for _, a := range actions {
+		for _, sequence := range keys[a.action] {
+			seq, err := config.ParseKeySequence(sequence)
+			if err != nil {
+				return Keymap{}, fmt.Errorf("%s: %s: %v", sources[a.action], a.action, err)
+			}
+			sequence = strings.Join(seq, " ")
+			if other, ok := k.bindings[sequence]; ok && other != a.action {
+				return Keymap{}, fmt.Errorf("%s: %q is bound to both %s and %s", conflictSource(sources, other, a.action), sequence, other, a.action)
+			}
+			k.bindings[sequence] = a.action
+			for i := 1; i < len(seq); i++ {
+				k.prefixes[strings.Join(seq[:i], " ")] = true
+			}
+		}
+	}
+	for _, a := range actions {
+		for _, sequence := range keys[a.action] {
+			seq := strings.Fields(sequence)
+			for i := 1; i < len(seq); i++ {
+				prefix := strings.Join(seq[:i], " ")
+				if other, ok := k.bindings[prefix]; ok {
+					return Keymap{}, fmt.Errorf("%s: %q (%s) is the start of %q (%s)", conflictSource(sources, other, a.action), prefix, other, strings.Join(seq, " "), a.action)
+				}
+			}
+		}
+	}
+	return k, nil
+}
+
+// conflictSource names the configured binding among a conflicting pair.
+func conflictSource(sources map[Action]string, a, b Action) string {
+	if sources[b] != "default" {
+		return sources[b]
+	}
+	return sources[a]
+}
+
+// lookup resolves keys pressed in order (bubbletea key names). It reports
+// the action they complete, or whether they may still become one.
+func (k Keymap) lookup(pressed []string) (action Action, ok, prefix bool) {
+	names := make([]string, len(pressed))
+	for i, key := range pressed {
+		if key == " " {
+			key = "space"
+		}
+		names[i] = key
+	}
+	sequence := strings.Join(names, " ")
+	action, ok = k.bindings[sequence]
+	return action, ok, k.prefixes[sequence]
+}
+
+// Keys returns the sequences bound to action, formatted for display.
+func (k Keymap) Keys(action Action) []string {
+	out := make([]string, 0, len(k.keys[action]))
+	for _, sequence := range k.keys[action] {
+		out = append(out, displayKeys(sequence))
+	}
+	return out
+}
+
+// displayKeys writes a sequence of single characters together ("gg"), the
+// way vim documents it.
+func displayKeys(sequence string) string {
+	keys := strings.Fields(sequence)
+	for _, key := range keys {
+		if len([]rune(key)) != 1 {
+			return sequence
+		}
+	}
+	return strings.Join(keys, "")
+}
+
+// footer renders the one-line key summary under the host list.
+func (k Keymap) footer() string {
+	var parts []string
+	for _, a := range actions {
+		if a.short == "" {
+			continue
+		}
+		if keys := k.Keys(a.action); len(keys) > 0 {
+			parts = append(parts, keys[0]+" "+a.short)
+		}
+	}
+	return strings.Join(parts, " • ")
+}
+
+// help lists every action with its keys, for the help overlay.
+func (k Keymap) help() [][2]string {
+	rows := make([][2]string, 0, len(actions))
+	for _, a := range actions {
+		keys := k.Keys(a.action)
+		if len(keys) == 0 {
+			keys = []string{"(unbound)"}
+		}
+		rows = append(rows, [2]string{strings.Join(keys, ", "), a.help})
+	}
+	return rows
+}
@@ -0,0 +1,94 @@
+package tmuxui
+
+import (
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// listTop is the screen line of the list's first row, below the header that
+// View renders. A terminal narrower than a header line wraps it onto more
+// lines.
+func (m model) listTop() int {
+	top := 0
+	for _, line := range strings.Split(strings.TrimSuffix(m.viewHeader(), "\n"), "\n") {
+		top++
+		if width := lipgloss.Width(line); m.width > 0 && width > m.width {
+			top += (width - 1) / m.width
+		}
+	}
+	return top
+}
+
+// doubleClickInterval is how soon a second click on the same row counts as
+// a double click.
+const doubleClickInterval = 400 * time.Millisecond
+
+// click is the last left click on a row of the list.
+type click struct {
+	row int
+	at  time.Time
+}
+
+// handleMouse drives the list: the wheel moves the cursor, a click puts it
+// on a row, a click on the "[ ]" column toggles the row's selection (or, on
+// a group header's arrow, the group) and a double click connects as enter
+// does. Overlays and the other tabs ignore the mouse.
+func (m model) handleMouse(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	if m.confirm != nil || m.showAddHost || m.showCredential || m.showWorkspaces || m.showSets || m.tab != tabHosts || m.showLogs || m.showPalette || m.showPrompt {
+		return m, nil
+	}
+	if m.showHelp {
+		if msg.Action == tea.MouseActionPress && msg.Button == tea.MouseButtonLeft {
+			m.showHelp = false
+		}
+		return m, nil
+	}
+	if msg.Action != tea.MouseActionPress {
+		return m, nil
+	}
+	switch msg.Button {
+	case tea.MouseButtonWheelUp:
+		m.move(-1)
+		return m, nil
+	case tea.MouseButtonWheelDown:
+		m.move(1)
+		return m, nil
+	case tea.MouseButtonLeft:
+	default:
+		return m, nil
+	}
+
+	top := m.listTop()
+	row := m.scroll + msg.Y - top
+	if msg.Y < top || row >= min(m.listLen(), m.scroll+m.listHeight()) {
+		return m, nil
+	}
+	m.selected = row
+	m.ensureVisible()
+
+	// Rows start with the two-column cursor; tree rows of hosts are
+	// indented by two more. Clicks there never add up to a double click.
+	column := 2
+	if m.treeView && m.rows[row].host >= 0 {
+		column = 4
+	}
+	switch {
+	case m.currentGroup() != "" && msg.X >= column && msg.X <= column+1:
+		m.lastClick = click{}
+		return m.setCollapsed(!m.collapsed[m.rows[row].group])
+	case m.currentGroup() == "" && msg.X >= column && msg.X <= column+2:
+		m.lastClick = click{}
+		return m.runPickerAction(ActionToggleSelect)
+	}
+
+	if m.lastClick.row == row && !m.lastClick.at.IsZero() && time.Since(m.lastClick.at) < doubleClickInterval {
+		// A third click starts over rather than connecting again.
+		m.lastClick = click{}
+		return m.runPickerAction(ActionConnect)
+	}
+	m.lastClick = click{row: row, at: time.Now()}
+	return m, nil
+}
@@ -0,0 +1,215 @@
+package tmuxui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// paletteLayouts are the layouts the palette offers for tiling the
+// selection, besides the configured one.
+var paletteLayouts = []string{"tiled", "even-horizontal", "even-vertical", "main-left", "main-top"}
+
+// SortModes are the orders the sort action cycles through: ssh config
+// order, alphabetical, and recently connected hosts first.
+var SortModes = []string{"config", "name", "recent"}
+
+// paletteItem is a command of the palette: an action, optionally with the
+// layout or sort order it applies.
+type paletteItem struct {
+	title  string
+	action Action
+	arg    string
+	keys   string
+}
+
+type paletteModel struct {
+	input    textinput.Model
+	items    []paletteItem
+	filtered []paletteItem
+	selected int
+}
+
+// paletteItems lists every action with its current keys, followed by the
+// commands only the palette has.
+func (m model) paletteItems() []paletteItem {
+	var items []paletteItem
+	for _, a := range actions {
+		if a.action == ActionPalette {
+			continue
+		}
+		items = append(items, paletteItem{title: a.help, action: a.action, keys: strings.Join(m.keys.Keys(a.action), ", ")})
+	}
+	for _, layout := range paletteLayouts {
+		items = append(items, paletteItem{title: "Open the selection tiled: " + layout, action: ActionTiled, arg: layout})
+	}
+	for _, mode := range SortModes {
+		items = append(items, paletteItem{title: "Sort hosts: " + sortTitle(mode), action: ActionSort, arg: mode})
+	}
+	return items
+}
+
+func sortTitle(mode string) string {
+	switch mode {
+	case "name":
+		return "by name"
+	case "recent":
+		return "recent first"
+	default:
+		return "ssh config order"
+	}
+}
+
+func (m model) openPalette() (tea.Model, tea.Cmd) {
+	m.palette.items = m.paletteItems()
+	m.palette.input.SetValue("")
+	m.palette.input.Focus()
+	m.palette.filterItems()
+	m.showPalette = true
+	return m, textinput.Blink
+}
+
+// filterItems keeps the commands matching the query: those containing it
+// first, then those matching it fuzzily.
+func (p *paletteModel) filterItems() {
+	query := strings.ToLower(strings.TrimSpace(p.input.Value()))
+	var exact, fuzzy []paletteItem
+	for _, item := range p.items {
+		text := strings.ToLower(item.title + " " + string(item.action) + " " + item.arg)
+		switch {
+		case strings.Contains(text, query):
+			exact = append(exact, item)
+		case fuzzyMatch(query, text):
+			fuzzy = append(fuzzy, item)
+		}
+	}
+	p.filtered = append(exact, fuzzy...)
+	p.selected = min(p.selected, max(len(p.filtered)-1, 0))
+}
+
+func (m model) handlePalette(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c", "esc":
+		m.showPalette = false
+		return m, nil
+	case "up", "ctrl+p", "ctrl+k":
+		if m.palette.selected > 0 {
+			m.palette.selected--
+		}
+		return m, nil
+	case "down", "ctrl+n", "ctrl+j":
+		if m.palette.selected < len(m.palette.filtered)-1 {
+			m.palette.selected++
+		}
+		return m, nil
+	case "enter":
+		if len(m.palette.filtered) == 0 {
+			return m, nil
+		}
+		m.showPalette = false
+		return m.runPaletteItem(m.palette.filtered[m.palette.selected])
+	}
+	var cmd tea.Cmd
+	m.palette.input, cmd = m.palette.input.Update(msg)
+	m.palette.selected = 0
+	m.palette.filterItems()
+	return m, cmd
+}
+
+// runPaletteItem runs a command on the selection, or the host under the
+// cursor, as its keys would.
+func (m model) runPaletteItem(item paletteItem) (tea.Model, tea.Cmd) {
+	switch {
+	case item.action == ActionTiled && item.arg != "":
+		// The layout stays in use for t until the picker closes.
+		m.app.Layout = item.arg
+		return m.runPickerAction(ActionTiled)
+	case item.action == ActionSort && item.arg != "":
+		return m.sortHosts(item.arg)
+	}
+	return m.runPickerAction(item.action)
+}
+
+// sortHosts orders the list by mode, keeping the cursor on its host.
+func (m model) sortHosts(mode string) (tea.Model, tea.Cmd) {
+	alias := ""
+	if current := m.current(); current != nil {
+		alias = current.host.Alias
+	}
+	m.sortBy = mode
+	m.recompute()
+	if m.treeView {
+		m.focusRow(alias, "")
+	} else {
+		for i, c := range m.filtered {
+			if c.host.Alias == alias {
+				m.selected = i
+				m.ensureVisible()
+			}
+		}
+	}
+	m.status = "sorted " + sortTitle(mode)
+	return m, nil
+}
+
+// nextSortMode follows mode in SortModes.
+func nextSortMode(mode string) string {
+	for i, s := range SortModes {
+		if s == mode {
+			return SortModes[(i+1)%len(SortModes)]
+		}
+	}
+	return SortModes[0]
+}
+
+// sortCandidates orders filtered hosts by m.sortBy; config order is the
+// order they were loaded in.
+func (m model) sortCandidates(candidates []candidate) {
+	switch m.sortBy {
+	case "name":
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return strings.ToLower(candidates[i].host.Alias) < strings.ToLower(candidates[j].host.Alias)
+		})
+	case "recent":
+		rank := make(map[string]int, len(m.app.State.Recents))
+		for i, alias := range m.app.State.Recents {
+			rank[alias] = i
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			a, okA := rank[candidates[i].host.Alias]
+			b, okB := rank[candidates[j].host.Alias]
+			if okA != okB {
+				return okA
+			}
+			return okA && a < b
+		})
+	}
+}
+
+func (m model) viewPalette() string {
+	parts := []string{"Commands", m.palette.input.View(), ""}
+	height := m.listHeight()
+	start := max(0, m.palette.selected-height+1)
+	end := min(len(m.palette.filtered), start+height)
+	width := 0
+	for _, item := range m.palette.filtered[start:end] {
+		width = max(width, lipgloss.Width(item.title))
+	}
+	for i := start; i < end; i++ {
+		item := m.palette.filtered[i]
+		line := fmt.Sprintf("  %-*s  %s", width, item.title, m.dimStyle.Render(item.keys))
+		if i == m.palette.selected {
+			line = m.selectedStyle.Render(fmt.Sprintf("> %-*s  %s", width, item.title, item.keys))
+		}
+		parts = append(parts, line)
+	}
+	if len(m.palette.filtered) == 0 {
+		parts = append(parts, m.dimStyle.Render("no commands matched"))
+	}
+	parts = append(parts, "", m.helpStyle.Render("enter run • up/down move • esc cancel"))
+	return strings.Join(parts, "\n")
+}
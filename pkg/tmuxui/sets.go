@@ -0,0 +1,245 @@
+package tmuxui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"tmux-ssh-manager/pkg/state"
+)
+
+type setsModel struct {
+	selected int
+	naming   bool
+	name     textinput.Model
+	status   string
+}
+
+func (m model) openSets() (tea.Model, tea.Cmd) {
+	m.showSets = true
+	m.sets.status = ""
+	m.sets.naming = false
+	m.clampSetSelection()
+	return m, nil
+}
+
+func (m model) handleSets(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.sets.naming {
+		switch msg.String() {
+		case "esc":
+			m.sets.naming = false
+			m.sets.name.Blur()
+			return m, nil
+		case "enter":
+			return m.saveSet()
+		}
+		var cmd tea.Cmd
+		m.sets.name, cmd = m.sets.name.Update(msg)
+		return m, cmd
+	}
+
+	switch msg.String() {
+	case "esc", "q":
+		m.showSets = false
+		return m, nil
+	case "down", "j":
+		m.sets.selected++
+		m.clampSetSelection()
+		return m, nil
+	case "up", "k":
+		m.sets.selected--
+		m.clampSetSelection()
+		return m, nil
+	case "n":
+		if len(m.targets()) == 0 {
+			m.sets.status = "select hosts in the picker first"
+			return m, nil
+		}
+		m.sets.naming = true
+		m.sets.status = ""
+		m.sets.name.SetValue("")
+		m.sets.name.Focus()
+		return m, textinput.Blink
+	case "d":
+		set := m.currentSet()
+		if set == nil {
+			return m, nil
+		}
+		name := set.Name
+		before := m.captureState()
+		m.app.State.DeleteSet(name)
+		_ = state.Save(m.app.StatePath, m.app.State)
+		m = m.rememberState("delete set "+name, before)
+		if m.filterSet == name {
+			m.filterSet = ""
+			m.recompute()
+		}
+		m.clampSetSelection()
+		m.sets.status = "deleted set " + name
+		return m, nil
+	case "space", " ":
+		set := m.currentSet()
+		if set == nil {
+			return m, nil
+		}
+		m.selectedAliases = map[string]struct{}{}
+		for _, alias := range m.knownAliases(set.Aliases) {
+			m.selectedAliases[alias] = struct{}{}
+		}
+		m.showSets = false
+		m.status = fmt.Sprintf("Selected: %d (set %s)", len(m.selectedAliases), set.Name)
+		return m, nil
+	case "enter":
+		set := m.currentSet()
+		if set == nil {
+			return m, nil
+		}
+		m.showSets = false
+		if m.filterSet == set.Name {
+			return m.setFilter("")
+		}
+		return m.setFilter(set.Name)
+	}
+	return m, nil
+}
+
+// saveSet stores the picker's current targets under the typed name.
+func (m model) saveSet() (tea.Model, tea.Cmd) {
+	name := strings.TrimSpace(m.sets.name.Value())
+	set := state.HostSet{Name: name, Aliases: m.targets()}
+	before := m.captureState()
+	if err := m.app.State.PutSet(set); err != nil {
+		m.sets.status = err.Error()
+		return m, nil
+	}
+	if err := state.Save(m.app.StatePath, m.app.State); err != nil {
+		m.sets.status = err.Error()
+		return m, nil
+	}
+	m = m.rememberState("save set "+name, before)
+	m.sets.naming = false
+	m.sets.name.Blur()
+	m.sets.status = fmt.Sprintf("saved set %s (%d hosts)", name, len(set.Aliases))
+	for i, existing := range m.app.State.Sets {
+		if existing.Name == name {
+			m.sets.selected = i
+		}
+	}
+	if m.filterSet == name {
+		m.recompute()
+	}
+	return m, nil
+}
+
+// setFilter shows only the hosts of the named set, or every host when name
+// is empty; like the favorites and recents filters, it replaces them.
+func (m model) setFilter(name string) (tea.Model, tea.Cmd) {
+	m.filterSet = name
+	if name != "" {
+		m.filterFavorites = false
+		m.filterRecents = false
+		m.status = "showing set " + name
+	} else {
+		m.status = "showing all hosts"
+	}
+	m.recompute()
+	return m, nil
+}
+
+// nextSetFilter cycles the set filter through the saved sets and back to
+// every host.
+func (m model) nextSetFilter() (tea.Model, tea.Cmd) {
+	if m.app.State == nil || len(m.app.State.Sets) == 0 {
+		m.status = "no saved sets"
+		return m, nil
+	}
+	sets := m.app.State.Sets
+	if m.filterSet == "" {
+		return m.setFilter(sets[0].Name)
+	}
+	for i, set := range sets {
+		if set.Name == m.filterSet && i+1 < len(sets) {
+			return m.setFilter(sets[i+1].Name)
+		}
+	}
+	return m.setFilter("")
+}
+
+// inFilterSet reports whether alias belongs to the set being filtered on.
+func (m model) inFilterSet(alias string) bool {
+	set, ok := m.app.State.Set(m.filterSet)
+	return ok && contains(set.Aliases, alias)
+}
+
+// knownAliases drops the aliases of hosts no longer in the ssh config.
+func (m model) knownAliases(aliases []string) []string {
+	var out []string
+	for _, alias := range aliases {
+		if _, ok := m.hostByAlias(alias); ok {
+			out = append(out, alias)
+		}
+	}
+	return out
+}
+
+func (m model) currentSet() *state.HostSet {
+	if m.app.State == nil {
+		return nil
+	}
+	index := m.sets.selected
+	if index < 0 || index >= len(m.app.State.Sets) {
+		return nil
+	}
+	return &m.app.State.Sets[index]
+}
+
+func (m *model) clampSetSelection() {
+	count := 0
+	if m.app.State != nil {
+		count = len(m.app.State.Sets)
+	}
+	if m.sets.selected >= count {
+		m.sets.selected = count - 1
+	}
+	if m.sets.selected < 0 {
+		m.sets.selected = 0
+	}
+}
+
+func (m model) viewSets() string {
+	parts := []string{"Host sets", ""}
+	var sets []state.HostSet
+	if m.app.State != nil {
+		sets = m.app.State.Sets
+	}
+	for index, set := range sets {
+		name := set.Name
+		if set.Name == m.filterSet {
+			name += " (filtering)"
+		}
+		label := fmt.Sprintf("%s (%d hosts)", name, len(set.Aliases))
+		if missing := len(set.Aliases) - len(m.knownAliases(set.Aliases)); missing > 0 {
+			label += fmt.Sprintf(", %d not in ssh config", missing)
+		}
+		line := fmt.Sprintf("  %s %s", label, m.dimStyle.Render(strings.Join(set.Aliases, ", ")))
+		if index == m.sets.selected {
+			line = m.selectedStyle.Render("> "+label) + " " + m.dimStyle.Render(strings.Join(set.Aliases, ", "))
+		}
+		parts = append(parts, line)
+	}
+	if len(sets) == 0 {
+		parts = append(parts, m.dimStyle.Render("no saved sets"))
+	}
+	parts = append(parts, "")
+	if m.sets.naming {
+		parts = append(parts, m.sets.name.View(), "", m.helpStyle.Render("enter save • esc cancel"))
+	} else {
+		parts = append(parts, m.helpStyle.Render("enter filter • space select • n save selection • d delete • j/k move • esc back"))
+	}
+	if m.sets.status != "" {
+		parts = append(parts, m.statusStyle.Render(m.sets.status))
+	}
+	return strings.Join(parts, "\n")
+}
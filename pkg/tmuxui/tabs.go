@@ -0,0 +1,347 @@
+package tmuxui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"tmux-ssh-manager/pkg/state"
+	"tmux-ssh-manager/pkg/tmuxrun"
+)
+
+// The picker's tabs, in the order the number keys select them.
+const (
+	tabHosts = iota
+	tabSessions
+	tabTunnels
+	tabHistory
+)
+
+var tabNames = []string{"Hosts", "Open Sessions", "Tunnels", "History"}
+
+type sessionsModel struct {
+	items    []tmuxrun.Pane
+	selected int
+	status   string
+}
+
+type historyModel struct {
+	// items are the connections read from the history when the tab was
+	// shown, newest first.
+	items    []state.Connection
+	selected int
+	status   string
+}
+
+// switchTab shows tab, refreshing what it lists.
+func (m model) switchTab(tab int) (tea.Model, tea.Cmd) {
+	m.tab = tab
+	switch tab {
+	case tabSessions:
+		m.sessions.status = ""
+		m.refreshSessions()
+	case tabTunnels:
+		m.tunnels.status = ""
+		m.refreshTunnels()
+	case tabHistory:
+		// The open sessions tell which connections are still running.
+		m.history.status = ""
+		m.refreshHistory()
+		m.refreshSessions()
+		m.sessions.status = ""
+		m.clampHistorySelection()
+	}
+	return m, nil
+}
+
+// handleTab handles keys on the tabs other than the hosts. The keys bound to
+// tab actions switch tabs there too.
+func (m model) handleTab(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.String() == "ctrl+c" {
+		m.quitting = true
+		return m, tea.Quit
+	}
+	if action, ok, _ := m.keys.lookup([]string{msg.String()}); ok {
+		switch action {
+		case ActionNextTab, ActionPrevTab, ActionHostsTab, ActionSessions, ActionTunnels, ActionHistory:
+			return m.runPickerAction(action)
+		}
+	}
+	switch m.tab {
+	case tabSessions:
+		return m.handleSessions(msg)
+	case tabTunnels:
+		return m.handleTunnels(msg)
+	case tabHistory:
+		return m.handleHistory(msg)
+	}
+	return m, nil
+}
+
+func (m model) handleSessions(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "q":
+		m.tab = tabHosts
+		return m, nil
+	case "down", "j":
+		m.sessions.selected++
+		m.clampSessionSelection()
+		return m, nil
+	case "up", "k":
+		m.sessions.selected--
+		m.clampSessionSelection()
+		return m, nil
+	case "r":
+		m.sessions.status = ""
+		m.refreshSessions()
+		return m, nil
+	case "enter":
+		pane, ok := m.currentPane()
+		if !ok || m.app.JumpToPane == nil {
+			return m, nil
+		}
+		return m, m.runAction(func() error {
+			return m.app.JumpToPane(pane.ID)
+		}, true, "")
+	case "x", "d":
+		pane, ok := m.currentPane()
+		if !ok || m.app.KillPane == nil {
+			return m, nil
+		}
+		m.confirm = &confirmModel{
+			hosts:     []string{pane.Alias + "  " + paneLocation(pane)},
+			title:     "Kill pane",
+			intro:     "This pane and its ssh connection will be closed:",
+			yes:       "y kill",
+			cancelled: "kill cancelled",
+			run: func(m model) (tea.Model, tea.Cmd) {
+				if err := m.app.KillPane(pane.ID); err != nil {
+					m.sessions.status = err.Error()
+				} else {
+					m.sessions.status = fmt.Sprintf("killed %s (%s)", pane.ID, pane.Alias)
+				}
+				m.refreshSessions()
+				return m, nil
+			},
+		}
+		return m, nil
+	}
+	return m, nil
+}
+
+// refreshSessions lists the panes opened by the picker again.
+func (m *model) refreshSessions() {
+	m.sessions.items = nil
+	switch {
+	case m.app.Panes == nil:
+		m.sessions.status = "open sessions not available"
+	case m.app.InTmux != nil && !m.app.InTmux():
+		m.sessions.status = "open sessions require running inside tmux"
+	default:
+		panes, err := m.app.Panes()
+		if err != nil {
+			m.sessions.status = err.Error()
+		}
+		m.sessions.items = panes
+	}
+	m.clampSessionSelection()
+}
+
+func (m model) currentPane() (tmuxrun.Pane, bool) {
+	if m.sessions.selected < 0 || m.sessions.selected >= len(m.sessions.items) {
+		return tmuxrun.Pane{}, false
+	}
+	return m.sessions.items[m.sessions.selected], true
+}
+
+func (m *model) clampSessionSelection() {
+	if m.sessions.selected >= len(m.sessions.items) {
+		m.sessions.selected = len(m.sessions.items) - 1
+	}
+	if m.sessions.selected < 0 {
+		m.sessions.selected = 0
+	}
+}
+
+func (m model) handleHistory(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "q":
+		m.tab = tabHosts
+		return m, nil
+	case "down", "j":
+		m.history.selected++
+		m.clampHistorySelection()
+		return m, nil
+	case "up", "k":
+		m.history.selected--
+		m.clampHistorySelection()
+		return m, nil
+	case "enter":
+		items := m.historyItems()
+		if m.history.selected >= len(items) {
+			return m, nil
+		}
+		return m.reconnect(items[m.history.selected].Alias)
+	}
+	return m, nil
+}
+
+// reconnect connects to alias again, as enter does for a single host.
+func (m model) reconnect(alias string) (tea.Model, tea.Cmd) {
+	if _, ok := m.hostByAlias(alias); !ok {
+		m.history.status = alias + " is no longer in ssh config"
+		return m, nil
+	}
+	return m.guardHosts([]string{alias}, func(m model) (tea.Model, tea.Cmd) {
+		targets := []string{alias}
+		switch m.app.EnterMode {
+		case "w":
+			return m.runOn(targets, m.app.NewWindow, "opened tmux window")
+		case "v":
+			return m.runOn(targets, m.app.SplitVert, "opened vertical split")
+		case "s":
+			return m.runOn(targets, m.app.SplitHoriz, "opened horizontal split")
+		default:
+			return m.connectHere(alias)
+		}
+	})
+}
+
+func (m *model) refreshHistory() {
+	items, err := state.History(m.app.StatePath)
+	if err != nil {
+		m.history.status = err.Error()
+	}
+	m.history.items = items
+}
+
+func (m model) historyItems() []state.Connection {
+	return m.history.items
+}
+
+func (m *model) clampHistorySelection() {
+	count := len(m.historyItems())
+	if m.history.selected >= count {
+		m.history.selected = count - 1
+	}
+	if m.history.selected < 0 {
+		m.history.selected = 0
+	}
+}
+
+// viewTabBar names the tabs with their number keys, the shown one
+// highlighted.
+func (m model) viewTabBar() string {
+	parts := make([]string, len(tabNames))
+	for i, name := range tabNames {
+		label := fmt.Sprintf("%d %s", i+1, name)
+		if i == m.tab {
+			parts[i] = m.selectedStyle.Render("[" + label + "]")
+		} else {
+			parts[i] = m.dimStyle.Render(" " + label + " ")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (m model) viewSessions() string {
+	parts := []string{m.viewTabBar(), ""}
+	now := time.Now()
+	for index, pane := range m.sessions.items {
+		line := fmt.Sprintf("%s  %s  %s", pane.ID, pane.Alias, paneLocation(pane))
+		if !pane.Started.IsZero() {
+			line += "  up " + formatDuration(now.Sub(pane.Started))
+		}
+		if pane.Logging != "" {
+			line += "  [log " + pane.Logging + "]"
+		}
+		if index == m.sessions.selected {
+			line = m.selectedStyle.Render("> " + line)
+		} else {
+			line = "  " + line
+		}
+		parts = append(parts, line)
+	}
+	if len(m.sessions.items) == 0 {
+		parts = append(parts, m.dimStyle.Render("no open sessions"))
+	}
+	parts = append(parts, "", m.helpStyle.Render("enter jump • x kill • r refresh • j/k move • tab next tab • esc hosts"))
+	if m.sessions.status != "" {
+		parts = append(parts, m.statusStyle.Render(m.sessions.status))
+	}
+	return strings.Join(parts, "\n")
+}
+
+func (m model) viewHistory() string {
+	parts := []string{m.viewTabBar(), ""}
+	items := m.historyItems()
+	for index, c := range items {
+		started := "-"
+		if at, err := time.Parse(time.RFC3339, c.StartedAt); err == nil {
+			started = at.Local().Format("2006-01-02 15:04")
+		}
+		line := fmt.Sprintf("%s  %s  %s", started, c.Alias, m.connectionDuration(c))
+		if c.Pane != "" {
+			line += "  " + m.dimStyle.Render(c.Pane)
+		}
+		if index == m.history.selected {
+			line = m.selectedStyle.Render("> ") + line
+		} else {
+			line = "  " + line
+		}
+		parts = append(parts, line)
+	}
+	if len(items) == 0 {
+		parts = append(parts, m.dimStyle.Render("no connections yet"))
+	}
+	parts = append(parts, "", m.helpStyle.Render("enter reconnect • j/k move • tab next tab • esc hosts"))
+	if m.history.status != "" {
+		parts = append(parts, m.statusStyle.Render(m.history.status))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// connectionDuration is how long c lasted, how long it has been running
+// when its pane is still open, or "-" when its end was not seen.
+func (m model) connectionDuration(c state.Connection) string {
+	if d, ok := c.Duration(); ok {
+		return formatDuration(d)
+	}
+	if c.EndedAt == "" && c.Pane != "" {
+		for _, pane := range m.sessions.items {
+			if pane.ID != c.Pane || pane.Alias != c.Alias {
+				continue
+			}
+			if started, err := time.Parse(time.RFC3339, c.StartedAt); err == nil {
+				return "running " + formatDuration(time.Since(started))
+			}
+			return "running"
+		}
+	}
+	return "-"
+}
+
+func paneLocation(pane tmuxrun.Pane) string {
+	return fmt.Sprintf("%s:%s %s", pane.Session, pane.WindowIndex, pane.WindowName)
+}
+
+// formatDuration rounds d to its two largest units: "45s", "12m30s",
+// "3h05m", "2d04h".
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	d = d.Round(time.Second)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dd%02dh", int(d.Hours())/24, int(d.Hours())%24)
+	}
+}
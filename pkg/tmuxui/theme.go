@@ -0,0 +1,208 @@
+package tmuxui
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+
+	"tmux-ssh-manager/pkg/config"
+)
+
+// builtinThemes are the themes that need no config, as config.TextStyle
+// strings by element. "dark" keeps the picker's original colors.
+var builtinThemes = map[string]map[string]string{
+	"dark": {
+		"help": "241", "status": "86", "selected": "fg=230,bg=24", "favorite": "220",
+		"dim": "244", "warn": "fg=196,bold", "prompt": "default", "placeholder": "240",
+		"group": "fg=111,bold", "up": "78", "down": "203",
+	},
+	"light": {
+		"help": "244", "status": "30", "selected": "fg=16,bg=153", "favorite": "172",
+		"dim": "245", "warn": "fg=160,bold", "prompt": "default", "placeholder": "249",
+		"group": "fg=25,bold", "up": "28", "down": "160",
+	},
+	"high-contrast": {
+		"help": "default", "status": "bold", "selected": "reverse,bold", "favorite": "fg=brightyellow,bold",
+		"dim": "default", "warn": "fg=brightred,bold,underscore", "prompt": "bold", "placeholder": "dim",
+		"group": "bold,underscore", "up": "fg=brightgreen,bold", "down": "fg=brightred,bold",
+	},
+	"nord": {
+		"help": "#7b88a1", "status": "#88c0d0", "selected": "fg=#eceff4,bg=#5e81ac", "favorite": "#ebcb8b",
+		"dim": "#616e88", "warn": "fg=#bf616a,bold", "prompt": "#81a1c1", "placeholder": "#4c566a",
+		"group": "fg=#81a1c1,bold", "up": "#a3be8c", "down": "#bf616a",
+	},
+	// mono is used without colors (NO_COLOR, colors = "none"): attributes
+	// only.
+	"mono": {
+		"help": "default", "status": "bold", "selected": "reverse", "favorite": "bold",
+		"dim": "dim", "warn": "bold,underscore", "prompt": "default", "placeholder": "dim",
+		"group": "bold", "up": "default", "down": "bold",
+	},
+}
+
+// Theme is the picker's styles and the color depth they are written with.
+type Theme struct {
+	// Name is the theme in use, after "auto" and NO_COLOR are resolved.
+	Name    string
+	Profile termenv.Profile
+	styles  map[string]lipgloss.Style
+}
+
+// DefaultTheme is the "dark" theme in 256 colors.
+func DefaultTheme() Theme {
+	theme, err := buildTheme("dark", config.ThemeDef{}, termenv.ANSI256)
+	if err != nil {
+		panic(err)
+	}
+	return theme
+}
+
+// ThemeNames lists the built-in themes.
+func ThemeNames() []string {
+	names := make([]string, 0, len(builtinThemes))
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewTheme resolves cfg's theme for the terminal described by the
+// environment getenv reads. The terminal itself is never queried: the
+// background comes from COLORFGBG (dark when unset) and the color depth from
+// NO_COLOR, COLORTERM and TERM unless cfg names one.
+func NewTheme(cfg *config.Config, getenv func(string) string) (Theme, error) {
+	for _, def := range cfg.Themes {
+		if _, ok := builtinThemes[def.Name]; ok {
+			return Theme{}, fmt.Errorf("%s: theme %q is built in; give the custom theme another name and base = %q", def.Source, def.Name, def.Name)
+		}
+		if _, ok := builtinThemes[baseTheme(def)]; !ok {
+			return Theme{}, fmt.Errorf("%s: theme %q: unknown base %q (expected %s)", def.Source, def.Name, def.Base, strings.Join(ThemeNames(), ", "))
+		}
+	}
+	for _, key := range []string{"theme.name", "theme.dark", "theme.light"} {
+		name := themeSetting(cfg.Theme, key)
+		if name == "auto" && key == "theme.name" {
+			continue
+		}
+		if _, ok := builtinThemes[name]; ok {
+			continue
+		}
+		if _, ok := cfg.ThemeDef(name); !ok {
+			return Theme{}, fmt.Errorf("%s: unknown theme %q (expected auto, %s or a [themes.<name>] table)", cfg.Source(key), name, strings.Join(ThemeNames(), ", "))
+		}
+	}
+
+	profile, colors := colorProfile(cfg.Theme.Colors, getenv)
+	name := cfg.Theme.Name
+	switch {
+	case !colors:
+		name = "mono"
+	case name == "auto" && darkBackground(getenv("COLORFGBG")):
+		name = cfg.Theme.Dark
+	case name == "auto":
+		name = cfg.Theme.Light
+	}
+	def, _ := cfg.ThemeDef(name)
+	return buildTheme(name, def, profile)
+}
+
+func themeSetting(t config.Theme, key string) string {
+	switch key {
+	case "theme.dark":
+		return t.Dark
+	case "theme.light":
+		return t.Light
+	default:
+		return t.Name
+	}
+}
+
+func baseTheme(def config.ThemeDef) string {
+	if def.Base == "" {
+		return "dark"
+	}
+	return def.Base
+}
+
+// buildTheme styles every element of the built-in theme name, or of the
+// custom theme def: its own styles where set, else its base's.
+func buildTheme(name string, def config.ThemeDef, profile termenv.Profile) (Theme, error) {
+	base, ok := builtinThemes[name]
+	if !ok {
+		base = builtinThemes[baseTheme(def)]
+	}
+	theme := Theme{Name: name, Profile: profile, styles: map[string]lipgloss.Style{}}
+	for _, element := range config.ThemeElements {
+		style, ok := def.Styles[element]
+		if !ok {
+			var err error
+			if style, err = config.ParseTextStyle(base[element]); err != nil {
+				return Theme{}, fmt.Errorf("theme %q: %s: %w", name, element, err)
+			}
+		}
+		theme.styles[element] = lipglossStyle(style)
+	}
+	return theme, nil
+}
+
+func lipglossStyle(s config.TextStyle) lipgloss.Style {
+	style := lipgloss.NewStyle().Bold(s.Bold).Faint(s.Faint).Italic(s.Italic).Underline(s.Underline).Reverse(s.Reverse)
+	if s.Fg != "" {
+		style = style.Foreground(lipgloss.Color(s.Fg))
+	}
+	if s.Bg != "" {
+		style = style.Background(lipgloss.Color(s.Bg))
+	}
+	return style
+}
+
+// Style returns the style of a config.ThemeElements element.
+func (t Theme) Style(element string) lipgloss.Style {
+	return t.styles[element]
+}
+
+// colorProfile picks the color depth for setting ("auto", "truecolor",
+// "256", "16" or "none") and reports whether colors may be used at all.
+// "auto" honors NO_COLOR, treats TERM=dumb as plain text and COLORTERM=
+// truecolor (or 24bit) as true color; otherwise it uses 256 colors.
+func colorProfile(setting string, getenv func(string) string) (termenv.Profile, bool) {
+	switch setting {
+	case "truecolor":
+		return termenv.TrueColor, true
+	case "256":
+		return termenv.ANSI256, true
+	case "16":
+		return termenv.ANSI, true
+	case "none":
+		// Attributes such as reverse still need escape sequences.
+		return termenv.ANSI, false
+	}
+	if getenv("NO_COLOR") != "" {
+		return termenv.ANSI, false
+	}
+	if getenv("TERM") == "dumb" {
+		return termenv.Ascii, false
+	}
+	switch strings.ToLower(getenv("COLORTERM")) {
+	case "truecolor", "24bit":
+		return termenv.TrueColor, true
+	}
+	return termenv.ANSI256, true
+}
+
+// darkBackground reads COLORFGBG ("fg;bg", as set by rxvt, Konsole and
+// others): background colors 0-6 and 8 are dark. Without it the background
+// is taken to be dark.
+func darkBackground(colorfgbg string) bool {
+	fields := strings.Split(colorfgbg, ";")
+	bg, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || bg < 0 || bg > 15 {
+		return true
+	}
+	return bg <= 6 || bg == 8
+}
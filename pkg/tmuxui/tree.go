@@ -0,0 +1,296 @@
+package tmuxui
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"tmux-ssh-manager/pkg/sshconfig"
+)
+
+// Groupings are the ways the tree view groups hosts, in the order the
+// group-by action cycles through them.
+var Groupings = []string{"file", "tag", "bastion", "domain"}
+
+// treeRow is a line of the tree view: a group's header, or one of its hosts.
+type treeRow struct {
+	group string
+	// host indexes model.filtered; -1 for the header.
+	host int
+	// count is the number of hosts in the group (headers only).
+	count int
+}
+
+// hostGroups returns the groups host belongs to. A host with several tags
+// is listed under each of them.
+func hostGroups(host sshconfig.Host, by string) []string {
+	switch by {
+	case "tag":
+		if len(host.Tags) == 0 {
+			return []string{"(untagged)"}
+		}
+		return host.Tags
+	case "bastion":
+		if host.ProxyJump == "" || strings.EqualFold(host.ProxyJump, "none") {
+			return []string{"(direct)"}
+		}
+		return []string{host.ProxyJump}
+	case "domain":
+		name := host.HostName
+		if name == "" {
+			name = host.Alias
+		}
+		if net.ParseIP(name) != nil {
+			return []string{"(ip address)"}
+		}
+		if _, domain, ok := strings.Cut(name, "."); ok && domain != "" {
+			return []string{strings.ToLower(domain)}
+		}
+		return []string{"(no domain)"}
+	default:
+		if host.SourcePath == "" {
+			return []string{"(unknown file)"}
+		}
+		return []string{displayPath(host.SourcePath)}
+	}
+}
+
+// displayPath abbreviates the home directory to ~.
+func displayPath(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return path
+	}
+	if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.Join("~", rel)
+	}
+	return path
+}
+
+// buildTree groups the filtered hosts into rows. Groups are sorted by name,
+// with the "(...)" catch-all groups last. While a search is typed every group
+// is shown expanded so that no match is hidden.
+func (m *model) buildTree() {
+	members := map[string][]int{}
+	var names []string
+	for i, c := range m.filtered {
+		for _, group := range hostGroups(c.host, m.groupBy) {
+			if _, ok := members[group]; !ok {
+				names = append(names, group)
+			}
+			members[group] = append(members[group], i)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := names[i], names[j]
+		if catchAllA, catchAllB := strings.HasPrefix(a, "("), strings.HasPrefix(b, "("); catchAllA != catchAllB {
+			return catchAllB
+		}
+		return a < b
+	})
+	searching := strings.TrimSpace(m.input.Value()) != ""
+	m.rows = m.rows[:0]
+	for _, name := range names {
+		m.rows = append(m.rows, treeRow{group: name, host: -1, count: len(members[name])})
+		if m.collapsed[name] && !searching {
+			continue
+		}
+		for _, index := range members[name] {
+			m.rows = append(m.rows, treeRow{group: name, host: index})
+		}
+	}
+}
+
+// skipHeader moves the cursor off a group header to the host after it, so
+// that enter on a search connects to a match.
+func (m *model) skipHeader() {
+	for i := m.selected; i < len(m.rows); i++ {
+		if m.rows[i].host >= 0 {
+			m.selected = i
+			return
+		}
+	}
+}
+
+// listLen is the number of lines the cursor moves over.
+func (m model) listLen() int {
+	if m.treeView {
+		return len(m.rows)
+	}
+	return len(m.filtered)
+}
+
+// currentGroup is the group whose header is under the cursor, if any.
+func (m model) currentGroup() string {
+	if !m.treeView || m.selected < 0 || m.selected >= len(m.rows) || m.rows[m.selected].host >= 0 {
+		return ""
+	}
+	return m.rows[m.selected].group
+}
+
+// groupAliases returns every filtered host of group, collapsed or not.
+func (m model) groupAliases(group string) []string {
+	var aliases []string
+	for _, c := range m.filtered {
+		if contains(hostGroups(c.host, m.groupBy), group) {
+			aliases = append(aliases, c.host.Alias)
+		}
+	}
+	return aliases
+}
+
+// focusRow puts the cursor on the first row of alias, or of group's header
+// when alias is empty or hidden.
+func (m *model) focusRow(alias, group string) {
+	for i, row := range m.rows {
+		if alias != "" && row.host >= 0 && m.filtered[row.host].host.Alias == alias {
+			m.selected = i
+			m.ensureVisible()
+			return
+		}
+	}
+	for i, row := range m.rows {
+		if row.host < 0 && row.group == group {
+			m.selected = i
+			m.ensureVisible()
+			return
+		}
+	}
+}
+
+func (m model) toggleTree() (tea.Model, tea.Cmd) {
+	alias := ""
+	if current := m.current(); current != nil {
+		alias = current.host.Alias
+	}
+	m.treeView = !m.treeView
+	m.recompute()
+	if m.treeView {
+		m.focusRow(alias, "")
+		m.status = "grouped by " + m.groupBy
+		return m, nil
+	}
+	m.status = ""
+	for i, c := range m.filtered {
+		if c.host.Alias == alias {
+			m.selected = i
+			m.ensureVisible()
+		}
+	}
+	return m, nil
+}
+
+func (m model) cycleGrouping() (tea.Model, tea.Cmd) {
+	alias := ""
+	if current := m.current(); current != nil {
+		alias = current.host.Alias
+	}
+	if m.treeView {
+		next := 0
+		for i, by := range Groupings {
+			if by == m.groupBy {
+				next = (i + 1) % len(Groupings)
+			}
+		}
+		m.groupBy = Groupings[next]
+	}
+	m.treeView = true
+	m.collapsed = map[string]bool{}
+	m.selected = 0
+	m.recompute()
+	m.focusRow(alias, "")
+	m.status = "grouped by " + m.groupBy
+	return m, nil
+}
+
+// setCollapsed folds or unfolds the group under the cursor (or holding the
+// host under it); the cursor stays on the group's header.
+func (m model) setCollapsed(collapse bool) (tea.Model, tea.Cmd) {
+	if !m.treeView || m.selected >= len(m.rows) {
+		return m, nil
+	}
+	group := m.rows[m.selected].group
+	m.collapsed[group] = collapse
+	m.recompute()
+	m.focusRow("", group)
+	return m, nil
+}
+
+func (m model) setAllCollapsed(collapse bool) (tea.Model, tea.Cmd) {
+	if !m.treeView {
+		return m, nil
+	}
+	group := ""
+	if m.selected < len(m.rows) {
+		group = m.rows[m.selected].group
+	}
+	for _, row := range m.rows {
+		if row.host < 0 {
+			m.collapsed[row.group] = collapse
+		}
+	}
+	m.recompute()
+	m.focusRow("", group)
+	return m, nil
+}
+
+// toggleGroupSelection selects every host of group, or deselects them all
+// when they already are.
+func (m model) toggleGroupSelection(group string) (tea.Model, tea.Cmd) {
+	aliases := m.groupAliases(group)
+	all := true
+	for _, alias := range aliases {
+		if _, ok := m.selectedAliases[alias]; !ok {
+			all = false
+		}
+	}
+	for _, alias := range aliases {
+		if all {
+			delete(m.selectedAliases, alias)
+		} else {
+			m.selectedAliases[alias] = struct{}{}
+		}
+	}
+	m.status = fmt.Sprintf("Selected: %d", len(m.selectedAliases))
+	return m, nil
+}
+
+// viewTreeRow renders a row of the tree view.
+func (m model) viewTreeRow(index int) string {
+	row := m.rows[index]
+	prefix := "  "
+	if index == m.selected {
+		prefix = "> "
+	}
+	if row.host >= 0 {
+		return m.viewHostRow(m.filtered[row.host], prefix+"  ", index == m.selected)
+	}
+	arrow := "▾"
+	if m.collapsed[row.group] && strings.TrimSpace(m.input.Value()) == "" {
+		arrow = "▸"
+	}
+	counts := fmt.Sprintf("(%d)", row.count)
+	if selected := m.countSelected(m.groupAliases(row.group)); selected > 0 {
+		counts = fmt.Sprintf("(%d, %d selected)", row.count, selected)
+	}
+	line := prefix + m.groupStyle.Render(arrow+" "+row.group) + " " + m.dimStyle.Render(counts)
+	if index == m.selected {
+		line = m.selectedStyle.Render(prefix + arrow + " " + row.group + " " + counts)
+	}
+	return line
+}
+
+func (m model) countSelected(aliases []string) int {
+	n := 0
+	for _, alias := range aliases {
+		if _, ok := m.selectedAliases[alias]; ok {
+			n++
+		}
+	}
+	return n
+}
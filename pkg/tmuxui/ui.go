@@ -1,20 +1,28 @@
 package tmuxui
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/muesli/termenv"
 
+	"tmux-ssh-manager/pkg/config"
+	"tmux-ssh-manager/pkg/health"
+	"tmux-ssh-manager/pkg/sessionlog"
 	"tmux-ssh-manager/pkg/sshconfig"
 	"tmux-ssh-manager/pkg/state"
 	"tmux-ssh-manager/pkg/termio"
+	"tmux-ssh-manager/pkg/tmuxrun"
+	"tmux-ssh-manager/pkg/tunnel"
 )
 
 type App struct {
@@ -24,7 +32,30 @@ type App struct {
 	StartInSearch  bool
 	ImplicitSelect bool
 	EnterMode      string
-	AddHost        func(sshconfig.AddHostInput) error
+	// Layout is the spec used by the tiled action; empty means "tiled".
+	Layout string
+	// AddHost appends a Host block to the ssh config file at path, one of
+	// HostFiles (the primary config first, then the files it includes).
+	AddHost   func(path string, input sshconfig.AddHostInput) (sshconfig.Backup, error)
+	HostFiles []string
+	// RemoveHosts, EditTags and ExportHosts act on the selection's Host
+	// blocks, RenameHost on the highlighted host's; LoadHosts reads the ssh
+	// config again after an edit (nil means sshconfig.LoadDefault).
+	RemoveHosts func(hosts []sshconfig.Host) (sshconfig.Backup, error)
+	EditTags    func(hosts []sshconfig.Host, add, remove []string) (sshconfig.Backup, error)
+	RenameHost  func(host sshconfig.Host, alias string) (sshconfig.Backup, error)
+	ExportHosts func(hosts []sshconfig.Host) (string, error)
+	LoadHosts   func() ([]sshconfig.Host, error)
+	// The edits above return the backup they take before
+	// writing; RestoreBackup writes one back and returns the backup of the
+	// files it replaced. Undo uses them.
+	RestoreBackup func(id string) (sshconfig.Backup, error)
+	// DeleteCredential deletes a credential in the picker, so that it can
+	// be undone: restore stores it again, and is nil when it cannot. When
+	// nil, deletes go through ExecCredential.
+	DeleteCredential func(host, user, kind string) (restore func() error, err error)
+	// ExecCredential returns the command that stores or deletes a
+	// credential: action, hosts (aliases joined by commas), user and kind.
 	ExecCredential func(string, string, string, string) (*exec.Cmd, error)
 	InTmux         func() bool
 	Connect        func(string) *exec.Cmd
@@ -33,6 +64,49 @@ type App struct {
 	SplitHoriz     func(string) error
 	Tiled          func([]string, string) error
 	SetupLogging   func(string)
+	OpenWorkspace  func(state.Workspace) error
+	// Confirm reports hosts that need a confirmation before connecting.
+	Confirm func(alias string) bool
+	// Tunnels lists running tunnels and StopTunnel ends one by ID.
+	// StartTunnel checks the forwards configured for a host and returns the
+	// function that starts ssh, which the picker runs off its event loop;
+	// AddTunnel then records the started tunnel.
+	Tunnels     func() []state.Tunnel
+	StartTunnel func(alias string) (func() (state.Tunnel, error), error)
+	AddTunnel   func(state.Tunnel) (state.Tunnel, error)
+	StopTunnel  func(id string) error
+	// Panes lists the tmux panes opened for hosts, for the open sessions
+	// tab; JumpToPane switches to one and KillPane closes it.
+	Panes      func() ([]tmuxrun.Pane, error)
+	JumpToPane func(id string) error
+	KillPane   func(id string) error
+	// Logs lists the sessions logged for a host, oldest first; ViewLog
+	// returns the command that pages one of them and PlayLog the one that
+	// replays its recording.
+	Logs    func(alias string) ([]sessionlog.Session, error)
+	ViewLog func(alias string, session sessionlog.Session) *exec.Cmd
+	PlayLog func(session sessionlog.Session) *exec.Cmd
+	// LogPolicy is how a host is logged by default; SetLogPolicy overrides
+	// it for the connection the picker opens ("" restores the default).
+	LogPolicy    func(alias string) config.LogPolicy
+	SetLogPolicy func(config.LogPolicy)
+	// Keymap binds normal-mode keys to actions; the zero value means
+	// DefaultKeymap.
+	Keymap Keymap
+	// Theme styles the picker; the zero value means DefaultTheme.
+	Theme Theme
+	// TreeView starts the picker in the grouped tree view; GroupBy is one of
+	// Groupings ("file" when empty).
+	TreeView bool
+	GroupBy  string
+	// CheckHealth checks hosts in the background, sending each result on
+	// the channel and closing it when done or when ctx, which the picker
+	// cancels as it exits, is done; nil hides the health column. Checks
+	// cached in State younger than HealthTTL are not repeated.
+	CheckHealth func(ctx context.Context, aliases []string) <-chan health.Result
+	HealthTTL   time.Duration
+	// Mouse enables clicks and the wheel in the picker.
+	Mouse bool
 }
 
 func (a App) Run() error {
@@ -42,28 +116,52 @@ func (a App) Run() error {
 	// DSR cursor position). Some terminals write the responses back onto stdin.
 	// If those responses escape the TUI lifecycle, they can be interpreted as
 	// user input by the next exec'd program (ssh) or your shell.
-	restore := disableTermQueries()
+	theme := a.Theme
+	if theme.styles == nil {
+		theme = DefaultTheme()
+	}
+	restore := disableTermQueries(theme.Profile)
 	defer restore()
 
-	program := tea.NewProgram(
-		newModel(a),
+	options := []tea.ProgramOption{
 		tea.WithInput(os.Stdin),
 		tea.WithOutput(os.Stdout),
 		tea.WithAltScreen(),
-	)
+	}
+	if a.Mouse {
+		// Cell motion reports presses and the wheel; tmux forwards them to
+		// display-popup as well once the program asks for them.
+		options = append(options, tea.WithMouseCellMotion())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := newModel(a)
+	m.ctx = ctx
+	program := tea.NewProgram(m, options...)
 	defer func() { _ = program.ReleaseTerminal() }()
 
 	final, err := program.Run()
+	cancel()
 	if err != nil {
 		return err
 	}
 	if m, ok := final.(model); ok && m.execAfterExit != nil {
 		termio.SanitizeStdinBeforeExec(os.Stdin, os.Stderr)
-		return m.execAfterExit.Run()
+		err := m.execAfterExit.Run()
+		if m.connected != "" {
+			a.endConnection(m.connected)
+		}
+		return err
 	}
 	return nil
 }
 
+// endConnection records in the history that the connection the picker
+// opened in this pane is over.
+func (a App) endConnection(alias string) {
+	_ = state.EndConnection(a.StatePath, alias, os.Getenv("TMUX_PANE"), time.Now())
+}
+
 type candidate struct {
 	host   sshconfig.Host
 	search string
@@ -77,24 +175,73 @@ type addHostModel struct {
 	port         textinput.Model
 	proxyJump    textinput.Model
 	identityFile textinput.Model
+	tags         textinput.Model
 	field        int
-	status       string
+	// file indexes App.HostFiles.
+	file int
+	// cloneOf is the host the form was filled from, whose other
+	// directives and annotations are copied as extra and annotations.
+	cloneOf     string
+	extra       []sshconfig.Directive
+	annotations map[string]string
+	// submitted is set once saving was tried, so that empty required
+	// fields are flagged from then on.
+	submitted bool
+	status    string
 }
 
 type credentialModel struct {
 	action string
-	host   string
+	hosts  []string
 	user   textinput.Model
 	kind   textinput.Model
 	field  int
 	status string
 }
 
+type workspaceModel struct {
+	selected int
+	naming   bool
+	name     textinput.Model
+	status   string
+}
+
+type tunnelModel struct {
+	items    []state.Tunnel
+	selected int
+	status   string
+}
+
+type logsModel struct {
+	alias    string
+	items    []sessionlog.Session
+	selected int
+	status   string
+}
+
+// confirmModel is a pending connection, or another action on hosts,
+// waiting for a y/n answer. Empty texts mean those of a connection.
+type confirmModel struct {
+	hosts     []string
+	title     string
+	intro     string
+	yes       string
+	cancelled string
+	run       func(model) (tea.Model, tea.Cmd)
+}
+
 type model struct {
 	app             App
+	confirm         *confirmModel
 	input           textinput.Model
 	add             addHostModel
 	credential      credentialModel
+	workspaces      workspaceModel
+	sets            setsModel
+	tunnels         tunnelModel
+	sessions        sessionsModel
+	history         historyModel
+	logs            logsModel
 	candidates      []candidate
 	filtered        []candidate
 	selected        int
@@ -102,34 +249,88 @@ type model struct {
 	selectedAliases map[string]struct{}
 	filterFavorites bool
 	filterRecents   bool
-	showAddHost     bool
-	showCredential  bool
-	status          string
-	width           int
-	height          int
-	pendingG        bool
-	quitting        bool
-	execAfterExit   *exec.Cmd
-	helpStyle       lipgloss.Style
-	statusStyle     lipgloss.Style
-	selectedStyle   lipgloss.Style
-	favoriteStyle   lipgloss.Style
-	dimStyle        lipgloss.Style
+	// filterSet names the host set the list is limited to.
+	filterSet   string
+	logOverride config.LogPolicy
+	keys        Keymap
+	// treeView shows the filtered hosts as rows, grouped by groupBy; there
+	// the cursor indexes rows instead of filtered.
+	treeView  bool
+	groupBy   string
+	collapsed map[string]bool
+	rows      []treeRow
+	// checking holds the hosts of the health check round that is running.
+	checking map[string]bool
+	// ctx is cancelled when the picker exits, which stops its checks.
+	ctx            context.Context
+	showHelp       bool
+	showAddHost    bool
+	showCredential bool
+	showWorkspaces bool
+	showSets       bool
+	showLogs       bool
+	showPalette    bool
+	showPrompt     bool
+	prompt         promptModel
+	palette        paletteModel
+	// tab is the view shown under the overlays: one of the tab* constants.
+	tab int
+	// sortBy is one of SortModes.
+	sortBy string
+	status string
+	width  int
+	height int
+	// lastClick tells a double click from two single ones.
+	lastClick click
+	// pendingKeys are the keys typed so far of a multi-key sequence.
+	pendingKeys []string
+	// undoStack holds the changes u undoes, newest last; redoStack those
+	// ctrl+r redoes.
+	undoStack     []change
+	redoStack     []change
+	quitting      bool
+	execAfterExit *exec.Cmd
+	// connected is the host execAfterExit connects to in this pane.
+	connected     string
+	helpStyle     lipgloss.Style
+	statusStyle   lipgloss.Style
+	selectedStyle lipgloss.Style
+	favoriteStyle lipgloss.Style
+	dimStyle      lipgloss.Style
+	warnStyle     lipgloss.Style
+	groupStyle    lipgloss.Style
+	upStyle       lipgloss.Style
+	downStyle     lipgloss.Style
 }
 
 type errMsg struct{ err error }
 type actionMsg struct{ text string }
+type logViewedMsg struct{ err error }
+
+// tunnelStartedMsg reports a tunnel started in the background.
+type tunnelStartedMsg struct {
+	tunnel state.Tunnel
+	err    error
+}
 
 func newModel(app App) model {
+	theme := app.Theme
+	if theme.styles == nil {
+		theme = DefaultTheme()
+	}
 	search := textinput.New()
 	search.Prompt = "/ "
 	search.Placeholder = "search hosts"
+	search.PromptStyle = theme.Style("prompt")
+	search.PlaceholderStyle = theme.Style("placeholder")
 	search.Blur()
 
 	newField := func(prompt, placeholder string) textinput.Model {
 		field := textinput.New()
 		field.Prompt = prompt
 		field.Placeholder = placeholder
+		field.PromptStyle = theme.Style("prompt")
+		field.PlaceholderStyle = theme.Style("placeholder")
 		field.CharLimit = 512
 		field.Blur()
 		return field
@@ -137,24 +338,46 @@ func newModel(app App) model {
 
 	m := model{
 		app:             app,
+		keys:            app.Keymap,
 		input:           search,
 		candidates:      buildCandidates(app.Hosts),
 		selectedAliases: map[string]struct{}{},
-		helpStyle:       lipgloss.NewStyle().Foreground(lipgloss.Color("241")),
-		statusStyle:     lipgloss.NewStyle().Foreground(lipgloss.Color("86")),
-		selectedStyle:   lipgloss.NewStyle().Foreground(lipgloss.Color("230")).Background(lipgloss.Color("24")),
-		favoriteStyle:   lipgloss.NewStyle().Foreground(lipgloss.Color("220")),
-		dimStyle:        lipgloss.NewStyle().Foreground(lipgloss.Color("244")),
+		helpStyle:       theme.Style("help"),
+		statusStyle:     theme.Style("status"),
+		selectedStyle:   theme.Style("selected"),
+		favoriteStyle:   theme.Style("favorite"),
+		dimStyle:        theme.Style("dim"),
+		warnStyle:       theme.Style("warn"),
+		groupStyle:      theme.Style("group"),
+		upStyle:         theme.Style("up"),
+		downStyle:       theme.Style("down"),
+		treeView:        app.TreeView,
+		groupBy:         app.GroupBy,
+		collapsed:       map[string]bool{},
+		checking:        map[string]bool{},
+		ctx:             context.Background(),
+		sortBy:          "config",
 	}
+	m.palette.input = newField(": ", "type a command")
 	m.add.alias = newField("Alias: ", "edge1")
 	m.add.hostName = newField("HostName: ", "10.0.0.10")
 	m.add.user = newField("User: ", "optional")
 	m.add.port = newField("Port: ", "22")
 	m.add.proxyJump = newField("ProxyJump: ", "optional")
 	m.add.identityFile = newField("IdentityFile: ", "optional")
+	m.add.tags = newField("Tags: ", "optional, comma separated")
 	m.credential.user = newField("User: ", "optional")
 	m.credential.kind = newField("Kind: ", "password")
 	m.credential.kind.SetValue("password")
+	m.workspaces.name = newField("Name: ", "workspace name")
+	m.sets.name = newField("Name: ", "set name")
+	m.prompt.input = newField("Tags: ", "comma separated")
+	if m.keys.bindings == nil {
+		m.keys = DefaultKeymap()
+	}
+	if m.groupBy == "" {
+		m.groupBy = Groupings[0]
+	}
 	m.recompute()
 	if app.StartInSearch {
 		m.input.Focus()
@@ -178,14 +401,17 @@ func buildCandidates(hosts []sshconfig.Host) []candidate {
 		if host.HostName != "" && host.HostName != host.Alias {
 			parts = append(parts, "-> "+host.HostName)
 		}
-		search := strings.ToLower(strings.Join([]string{host.Alias, host.HostName, host.User, host.ProxyJump}, " "))
+		if len(host.Tags) > 0 {
+			parts = append(parts, "["+strings.Join(host.Tags, ",")+"]")
+		}
+		search := strings.ToLower(strings.Join(append([]string{host.Alias, host.HostName, host.User, host.ProxyJump}, host.Tags...), " "))
 		out = append(out, candidate{host: host, search: search, line: strings.Join(parts, " ")})
 	}
 	return out
 }
 
 func (m model) Init() tea.Cmd {
-	return textinput.Blink
+	return tea.Batch(textinput.Blink, m.checkHealth(m.staleHealth()))
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -200,13 +426,61 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case actionMsg:
 		m.status = msg.text
 		return m, nil
+	case logViewedMsg:
+		if msg.err != nil {
+			m.logs.status = msg.err.Error()
+		}
+		return m, nil
+	case tunnelStartedMsg:
+		if msg.err == nil && m.app.AddTunnel != nil {
+			msg.tunnel, msg.err = m.app.AddTunnel(msg.tunnel)
+		}
+		if msg.err != nil {
+			m.tunnels.status = msg.err.Error()
+		} else {
+			m.tunnels.status = fmt.Sprintf("started tunnel %s to %s", msg.tunnel.ID, msg.tunnel.Alias)
+		}
+		m.refreshTunnels()
+		return m, nil
+	case healthMsg:
+		return m.applyHealth(msg)
+	case healthDoneMsg:
+		return m.finishHealth()
+	case tea.MouseMsg:
+		return m.handleMouse(msg)
 	case tea.KeyMsg:
+		if m.confirm != nil {
+			return m.handleConfirm(msg)
+		}
 		if m.showAddHost {
 			return m.handleAddHost(msg)
 		}
 		if m.showCredential {
 			return m.handleCredential(msg)
 		}
+		if m.showWorkspaces {
+			return m.handleWorkspaces(msg)
+		}
+		if m.showSets {
+			return m.handleSets(msg)
+		}
+		if m.showLogs {
+			return m.handleLogs(msg)
+		}
+		if m.showPalette {
+			return m.handlePalette(msg)
+		}
+		if m.showPrompt {
+			return m.handlePrompt(msg)
+		}
+		if m.showHelp {
+			// Any key closes the help.
+			m.showHelp = false
+			return m, nil
+		}
+		if m.tab != tabHosts {
+			return m.handleTab(msg)
+		}
 		return m.handlePicker(msg)
 	}
 	return m, nil
@@ -231,7 +505,7 @@ func (m model) handlePicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			if m.app.ImplicitSelect {
 				m.input.Blur()
 				m.recompute()
-				return m.enterDefault()
+				return m.guard(model.enterDefault)
 			}
 			m.input.Blur()
 			m.recompute()
@@ -254,42 +528,55 @@ func (m model) handlePicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, cmd
 	}
 
-	switch msg.String() {
-	case "ctrl+c", "q", "esc":
+	key := msg.String()
+	pressed := append(append([]string(nil), m.pendingKeys...), key)
+	action, ok, prefix := m.keys.lookup(pressed)
+	if !ok && !prefix && len(pressed) > 1 {
+		// An abandoned sequence: the key counts on its own.
+		pressed = []string{key}
+		action, ok, prefix = m.keys.lookup(pressed)
+	}
+	m.pendingKeys = nil
+	if prefix {
+		m.pendingKeys = pressed
+		return m, nil
+	}
+	if !ok {
+		return m, nil
+	}
+	return m.runPickerAction(action)
+}
+
+// runPickerAction performs a normal-mode action.
+func (m model) runPickerAction(action Action) (tea.Model, tea.Cmd) {
+	switch action {
+	case ActionQuit:
 		m.quitting = true
 		return m, tea.Quit
-	case "/":
+	case ActionSearch:
 		m.input.Focus()
-		return m, nil
-	case "up", "k":
+	case ActionHelp:
+		m.showHelp = true
+	case ActionUp:
 		m.move(-1)
-		return m, nil
-	case "down", "j":
+	case ActionDown:
 		m.move(1)
-		return m, nil
-	case "ctrl+u":
+	case ActionHalfPageUp:
 		m.move(-(m.listHeight() / 2))
-		return m, nil
-	case "ctrl+d":
+	case ActionHalfPageDown:
 		m.move(m.listHeight() / 2)
-		return m, nil
-	case "g":
-		if m.pendingG {
-			m.selected = 0
-			m.scroll = 0
-			m.pendingG = false
-			return m, nil
-		}
-		m.pendingG = true
-		return m, nil
-	case "G":
-		if len(m.filtered) > 0 {
-			m.selected = len(m.filtered) - 1
+	case ActionTop:
+		m.selected = 0
+		m.scroll = 0
+	case ActionBottom:
+		if m.listLen() > 0 {
+			m.selected = m.listLen() - 1
 			m.ensureVisible()
 		}
-		m.pendingG = false
-		return m, nil
-	case " ":
+	case ActionToggleSelect:
+		if group := m.currentGroup(); group != "" {
+			return m.toggleGroupSelection(group)
+		}
 		if current := m.current(); current != nil {
 			alias := current.host.Alias
 			if _, ok := m.selectedAliases[alias]; ok {
@@ -298,38 +585,27 @@ func (m model) handlePicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				m.selectedAliases[alias] = struct{}{}
 			}
 		}
-		m.pendingG = false
-		return m, nil
-	case "f":
-		if current := m.current(); current != nil {
-			on := m.app.State.ToggleFavorite(current.host.Alias)
-			_ = state.Save(m.app.StatePath, m.app.State)
-			if on {
-				m.status = "favorite added"
-			} else {
-				m.status = "favorite removed"
-			}
-			m.recompute()
-		}
-		m.pendingG = false
-		return m, nil
-	case "F":
+	case ActionFavorite:
+		return m.toggleFavorites()
+	case ActionTagAdd, ActionTagRemove, ActionExport, ActionRename:
+		return m.openPrompt(action)
+	case ActionDeleteHosts:
+		return m.confirmDelete()
+	case ActionFilterFavorites:
 		m.filterFavorites = !m.filterFavorites
 		if m.filterFavorites {
 			m.filterRecents = false
+			m.filterSet = ""
 		}
 		m.recompute()
-		m.pendingG = false
-		return m, nil
-	case "R":
+	case ActionFilterRecents:
 		m.filterRecents = !m.filterRecents
 		if m.filterRecents {
 			m.filterFavorites = false
+			m.filterSet = ""
 		}
 		m.recompute()
-		m.pendingG = false
-		return m, nil
-	case "ctrl+a":
+	case ActionSelectAll:
 		if len(m.filtered) == 0 {
 			m.status = "Selected: 0"
 			return m, nil
@@ -338,66 +614,176 @@ func (m model) handlePicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.selectedAliases[c.host.Alias] = struct{}{}
 		}
 		m.status = fmt.Sprintf("Selected: %d", len(m.selectedAliases))
-		m.pendingG = false
-		return m, nil
-	case "a":
+	case ActionAddHost:
 		m.showAddHost = true
 		m.add.field = 0
 		m.add.status = ""
 		m.resetAddHostFields()
 		m.focusAddField()
-		m.pendingG = false
-		return m, nil
-	case "c":
-		m.pendingG = false
+	case ActionClone:
+		return m.openClone()
+	case ActionSets:
+		return m.openSets()
+	case ActionFilterSet:
+		return m.nextSetFilter()
+	case ActionWorkspaces:
+		m.showWorkspaces = true
+		m.workspaces.status = ""
+		m.workspaces.naming = false
+		m.clampWorkspaceSelection()
+	case ActionNextTab:
+		return m.switchTab((m.tab + 1) % len(tabNames))
+	case ActionPrevTab:
+		return m.switchTab((m.tab + len(tabNames) - 1) % len(tabNames))
+	case ActionHostsTab:
+		return m.switchTab(tabHosts)
+	case ActionSessions:
+		return m.switchTab(tabSessions)
+	case ActionTunnels:
+		return m.switchTab(tabTunnels)
+	case ActionHistory:
+		return m.switchTab(tabHistory)
+	case ActionUndo:
+		return m.undo()
+	case ActionRedo:
+		return m.redo()
+	case ActionLogs:
+		return m.openLogs()
+	case ActionLogPolicy:
+		return m.cycleLogPolicy()
+	case ActionStoreCredential:
 		return m.openCredentialEditor("set")
-	case "d":
-		m.pendingG = false
+	case ActionDeleteCredential:
 		return m.openCredentialEditor("delete")
-	case "enter":
-		m.pendingG = false
-		return m.enterDefault()
-	case "v":
-		m.pendingG = false
-		return m.runMulti(m.app.SplitVert, "opened vertical splits")
-	case "s":
-		m.pendingG = false
-		return m.runMulti(m.app.SplitHoriz, "opened horizontal splits")
-	case "w":
-		m.pendingG = false
-		return m.runMulti(m.app.NewWindow, "opened tmux windows")
-	case "t":
-		m.pendingG = false
-		return m.runTiled()
-	case "p":
-		m.pendingG = false
-		current := m.current()
-		if current == nil {
+	case ActionConnect:
+		if group := m.currentGroup(); group != "" && len(m.selectedAliases) == 0 {
+			return m.setCollapsed(!m.collapsed[group])
+		}
+		return m.guard(model.enterDefault)
+	case ActionTree:
+		return m.toggleTree()
+	case ActionCheckHealth:
+		return m.recheckHealth()
+	case ActionPalette:
+		return m.openPalette()
+	case ActionSort:
+		return m.sortHosts(nextSortMode(m.sortBy))
+	case ActionGroupBy:
+		return m.cycleGrouping()
+	case ActionExpand:
+		return m.setCollapsed(false)
+	case ActionCollapse:
+		return m.setCollapsed(true)
+	case ActionToggleGroup:
+		if m.treeView && m.selected < len(m.rows) {
+			return m.setCollapsed(!m.collapsed[m.rows[m.selected].group])
+		}
+	case ActionExpandAll:
+		return m.setAllCollapsed(false)
+	case ActionCollapseAll:
+		return m.setAllCollapsed(true)
+	case ActionSplitV:
+		return m.guard(func(m model) (tea.Model, tea.Cmd) {
+			return m.runMulti(m.app.SplitVert, "opened vertical splits")
+		})
+	case ActionSplitH:
+		return m.guard(func(m model) (tea.Model, tea.Cmd) {
+			return m.runMulti(m.app.SplitHoriz, "opened horizontal splits")
+		})
+	case ActionWindow:
+		return m.guard(func(m model) (tea.Model, tea.Cmd) {
+			return m.runMulti(m.app.NewWindow, "opened tmux windows")
+		})
+	case ActionTiled:
+		return m.guard(model.runTiled)
+	case ActionConnectPane:
+		if m.current() == nil {
 			return m, nil
 		}
-		m.app.State.AddRecent(current.host.Alias)
-		_ = state.Save(m.app.StatePath, m.app.State)
-		m.enableLogging(current.host.Alias)
-		m.execAfterExit = m.app.Connect(current.host.Alias)
+		return m.guardHosts([]string{m.current().host.Alias}, model.connectInPane)
+	}
+	return m, nil
+}
+
+func (m model) connectInPane() (tea.Model, tea.Cmd) {
+	current := m.current()
+	if current == nil {
+		return m, nil
+	}
+	return m.connectHere(current.host.Alias)
+}
+
+// connectHere quits the picker to connect to alias in this pane.
+func (m model) connectHere(alias string) (tea.Model, tea.Cmd) {
+	m.app.State.AddRecent(alias)
+	_ = state.Save(m.app.StatePath, m.app.State)
+	_ = state.StartConnection(m.app.StatePath, alias, os.Getenv("TMUX_PANE"), time.Now())
+	m.enableLogging(alias)
+	if m.logOverride != "" {
+		m.logOverride = ""
+		m.app.SetLogPolicy("")
+	}
+	m.execAfterExit = m.app.Connect(alias)
+	m.connected = alias
+	m.quitting = true
+	return m, tea.Quit
+}
+
+// guard runs a connect action on the current targets, asking first when any
+// of them is marked as needing confirmation.
+func (m model) guard(action func(model) (tea.Model, tea.Cmd)) (tea.Model, tea.Cmd) {
+	return m.guardHosts(m.targets(), action)
+}
+
+func (m model) guardHosts(aliases []string, action func(model) (tea.Model, tea.Cmd)) (tea.Model, tea.Cmd) {
+	var flagged []string
+	if m.app.Confirm != nil {
+		for _, alias := range aliases {
+			if m.app.Confirm(alias) {
+				flagged = append(flagged, alias)
+			}
+		}
+	}
+	if len(flagged) == 0 {
+		return action(m)
+	}
+	m.confirm = &confirmModel{hosts: flagged, run: action}
+	return m, nil
+}
+
+func (m model) handleConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	pending := m.confirm
+	m.confirm = nil
+	switch msg.String() {
+	case "y", "Y":
+		return pending.run(m)
+	case "ctrl+c":
 		m.quitting = true
 		return m, tea.Quit
 	default:
-		m.pendingG = false
+		m.status = "connection cancelled"
+		if pending.cancelled != "" {
+			m.status = pending.cancelled
+		}
 		return m, nil
 	}
 }
 
 func (m model) openCredentialEditor(action string) (tea.Model, tea.Cmd) {
-	current := m.current()
-	if current == nil {
+	hosts := m.targets()
+	if len(hosts) == 0 {
 		return m, nil
 	}
 	m.showCredential = true
 	m.credential.action = action
-	m.credential.host = current.host.Alias
+	m.credential.hosts = hosts
 	m.credential.status = ""
 	m.credential.field = 0
-	m.credential.user.SetValue(current.host.User)
+	// A single user is only a sensible default for a single host.
+	m.credential.user.SetValue("")
+	if host, ok := m.hostByAlias(hosts[0]); ok && len(hosts) == 1 {
+		m.credential.user.SetValue(host.User)
+	}
 	m.credential.kind.SetValue("password")
 	m.focusCredentialField()
 	return m, nil
@@ -409,52 +795,56 @@ func (m model) handleAddHost(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.showAddHost = false
 		m.add.status = ""
 		return m, nil
-	case "tab", "down", "j":
-		m.add.field = (m.add.field + 1) % 6
+	case "tab", "down":
+		m.add.field = (m.add.field + 1) % addFieldCount
 		m.focusAddField()
 		return m, nil
-	case "shift+tab", "up", "k":
-		m.add.field = (m.add.field + 5) % 6
+	case "shift+tab", "up":
+		m.add.field = (m.add.field + addFieldCount - 1) % addFieldCount
 		m.focusAddField()
 		return m, nil
+	case "left", "right", " ":
+		if m.add.field == addFile {
+			if msg.String() == "left" {
+				m.cycleAddFile(-1)
+			} else {
+				m.cycleAddFile(1)
+			}
+			return m, nil
+		}
 	case "enter":
+		m.add.submitted = true
+		for _, err := range m.addHostErrors() {
+			if err != "" {
+				m.add.status = "fix the fields marked ✗ first"
+				return m, nil
+			}
+		}
 		input, err := m.addInput()
 		if err != nil {
 			m.add.status = err.Error()
 			return m, nil
 		}
-		if err := m.app.AddHost(input); err != nil {
-			m.add.status = err.Error()
-			return m, nil
-		}
-		hosts, err := sshconfig.LoadDefault()
+		target := m.addTarget()
+		backup, err := m.app.AddHost(target, input)
 		if err != nil {
 			m.add.status = err.Error()
 			return m, nil
 		}
-		m.candidates = buildCandidates(hosts)
-		m.recompute()
 		m.showAddHost = false
-		m.status = "host added to ~/.ssh/config"
+		m.status = "host added to " + displayPath(target)
 		m.resetAddHostFields()
-		return m, nil
+		m = m.rememberConfig("add "+input.Alias, backup)
+		return m.reloadHosts(), nil
 	}
 
-	var cmd tea.Cmd
-	switch m.add.field {
-	case 0:
-		m.add.alias, cmd = m.add.alias.Update(msg)
-	case 1:
-		m.add.hostName, cmd = m.add.hostName.Update(msg)
-	case 2:
-		m.add.user, cmd = m.add.user.Update(msg)
-	case 3:
-		m.add.port, cmd = m.add.port.Update(msg)
-	case 4:
-		m.add.proxyJump, cmd = m.add.proxyJump.Update(msg)
-	case 5:
-		m.add.identityFile, cmd = m.add.identityFile.Update(msg)
+	if m.add.field == addFile {
+		return m, nil
 	}
+	field := m.addFields()[m.add.field]
+	var cmd tea.Cmd
+	*field, cmd = field.Update(msg)
+	m.add.status = ""
 	return m, cmd
 }
 
@@ -473,16 +863,19 @@ func (m model) handleCredential(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.focusCredentialField()
 		return m, nil
 	case "enter":
-		if m.app.ExecCredential == nil {
-			m.credential.status = "credential execution is not configured"
-			return m, nil
-		}
 		user := strings.TrimSpace(m.credential.user.Value())
 		kind := strings.TrimSpace(m.credential.kind.Value())
 		if kind == "" {
 			kind = "password"
 		}
-		cmd, err := m.app.ExecCredential(m.credential.action, m.credential.host, user, kind)
+		if m.credential.action == "delete" && m.app.DeleteCredential != nil {
+			return m.deleteCredentials(m.credential.hosts, user, kind)
+		}
+		if m.app.ExecCredential == nil {
+			m.credential.status = "credential execution is not configured"
+			return m, nil
+		}
+		cmd, err := m.app.ExecCredential(m.credential.action, strings.Join(m.credential.hosts, ","), user, kind)
 		if err != nil {
 			m.credential.status = err.Error()
 			return m, nil
@@ -503,6 +896,302 @@ func (m model) handleCredential(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+func (m model) handleWorkspaces(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.workspaces.naming {
+		switch msg.String() {
+		case "esc":
+			m.workspaces.naming = false
+			m.workspaces.name.Blur()
+			return m, nil
+		case "enter":
+			return m.saveWorkspace()
+		}
+		var cmd tea.Cmd
+		m.workspaces.name, cmd = m.workspaces.name.Update(msg)
+		return m, cmd
+	}
+
+	switch msg.String() {
+	case "esc", "q":
+		m.showWorkspaces = false
+		return m, nil
+	case "down", "j":
+		m.workspaces.selected++
+		m.clampWorkspaceSelection()
+		return m, nil
+	case "up", "k":
+		m.workspaces.selected--
+		m.clampWorkspaceSelection()
+		return m, nil
+	case "n":
+		if len(m.targets()) == 0 {
+			m.workspaces.status = "select hosts in the picker first"
+			return m, nil
+		}
+		m.workspaces.naming = true
+		m.workspaces.status = ""
+		m.workspaces.name.SetValue("")
+		m.workspaces.name.Focus()
+		return m, nil
+	case "d":
+		ws := m.currentWorkspace()
+		if ws == nil {
+			return m, nil
+		}
+		name := ws.Name
+		before := m.captureState()
+		m.app.State.DeleteWorkspace(name)
+		_ = state.Save(m.app.StatePath, m.app.State)
+		m = m.rememberState("delete workspace "+name, before)
+		m.clampWorkspaceSelection()
+		m.workspaces.status = "deleted workspace " + name
+		return m, nil
+	case "enter":
+		ws := m.currentWorkspace()
+		if ws == nil {
+			return m, nil
+		}
+		target := *ws
+		var aliases []string
+		for _, window := range target.Windows {
+			for _, pane := range window.Panes {
+				aliases = append(aliases, pane.Alias)
+			}
+		}
+		return m.guardHosts(aliases, func(m model) (tea.Model, tea.Cmd) {
+			for _, alias := range aliases {
+				m.app.State.AddRecent(alias)
+			}
+			_ = state.Save(m.app.StatePath, m.app.State)
+			m.showWorkspaces = false
+			return m.runConnect(func() error {
+				if !m.app.InTmux() {
+					return fmt.Errorf("workspaces require running inside tmux")
+				}
+				if m.app.OpenWorkspace == nil {
+					return fmt.Errorf("workspaces not available")
+				}
+				return m.app.OpenWorkspace(target)
+			}, "opened workspace "+target.Name)
+		})
+	}
+	return m, nil
+}
+
+// saveWorkspace stores the picker's current targets as a single tiled window.
+func (m model) saveWorkspace() (tea.Model, tea.Cmd) {
+	name := strings.TrimSpace(m.workspaces.name.Value())
+	ws := state.Workspace{Name: name, Windows: []state.WorkspaceWindow{{Name: name, Layout: "tiled"}}}
+	for i, alias := range m.targets() {
+		pane := state.WorkspacePane{Alias: alias}
+		if i > 0 {
+			pane.Split = "v"
+		}
+		ws.Windows[0].Panes = append(ws.Windows[0].Panes, pane)
+	}
+	before := m.captureState()
+	if err := m.app.State.PutWorkspace(ws); err != nil {
+		m.workspaces.status = err.Error()
+		return m, nil
+	}
+	if err := state.Save(m.app.StatePath, m.app.State); err != nil {
+		m.workspaces.status = err.Error()
+		return m, nil
+	}
+	m = m.rememberState("save workspace "+name, before)
+	m.workspaces.naming = false
+	m.workspaces.name.Blur()
+	m.workspaces.status = fmt.Sprintf("saved workspace %s (%d panes)", name, len(ws.Windows[0].Panes))
+	for i, existing := range m.app.State.Workspaces {
+		if existing.Name == name {
+			m.workspaces.selected = i
+		}
+	}
+	return m, nil
+}
+
+func (m model) currentWorkspace() *state.Workspace {
+	if m.app.State == nil {
+		return nil
+	}
+	index := m.workspaces.selected
+	if index < 0 || index >= len(m.app.State.Workspaces) {
+		return nil
+	}
+	return &m.app.State.Workspaces[index]
+}
+
+func (m *model) clampWorkspaceSelection() {
+	count := 0
+	if m.app.State != nil {
+		count = len(m.app.State.Workspaces)
+	}
+	if m.workspaces.selected >= count {
+		m.workspaces.selected = count - 1
+	}
+	if m.workspaces.selected < 0 {
+		m.workspaces.selected = 0
+	}
+}
+
+func (m model) handleTunnels(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "q":
+		m.tab = tabHosts
+		return m, nil
+	case "down", "j":
+		m.tunnels.selected++
+		m.refreshTunnels()
+		return m, nil
+	case "up", "k":
+		m.tunnels.selected--
+		m.refreshTunnels()
+		return m, nil
+	case "n":
+		current := m.current()
+		if current == nil {
+			return m, nil
+		}
+		if m.app.StartTunnel == nil {
+			m.tunnels.status = "tunnels not available"
+			return m, nil
+		}
+		alias := current.host.Alias
+		return m.guardHosts([]string{alias}, func(m model) (tea.Model, tea.Cmd) {
+			launch, err := m.app.StartTunnel(alias)
+			if err != nil {
+				m.tunnels.status = err.Error()
+				return m, nil
+			}
+			m.tunnels.status = "starting tunnel to " + alias + "..."
+			return m, func() tea.Msg {
+				started, err := launch()
+				return tunnelStartedMsg{tunnel: started, err: err}
+			}
+		})
+	case "x", "d":
+		if m.tunnels.selected >= len(m.tunnels.items) || m.app.StopTunnel == nil {
+			return m, nil
+		}
+		target := m.tunnels.items[m.tunnels.selected]
+		if err := m.app.StopTunnel(target.ID); err != nil {
+			m.tunnels.status = err.Error()
+		} else {
+			m.tunnels.status = fmt.Sprintf("stopped tunnel %s to %s", target.ID, target.Alias)
+		}
+		m.refreshTunnels()
+		return m, nil
+	}
+	return m, nil
+}
+
+// refreshTunnels reloads the running tunnels and clamps the selection.
+func (m *model) refreshTunnels() {
+	m.tunnels.items = nil
+	if m.app.Tunnels != nil {
+		m.tunnels.items = m.app.Tunnels()
+	}
+	if m.tunnels.selected >= len(m.tunnels.items) {
+		m.tunnels.selected = len(m.tunnels.items) - 1
+	}
+	if m.tunnels.selected < 0 {
+		m.tunnels.selected = 0
+	}
+}
+
+// cycleLogPolicy steps the logging override for the next connection through
+// the policies and back to the hosts' defaults.
+func (m model) cycleLogPolicy() (tea.Model, tea.Cmd) {
+	if m.app.SetLogPolicy == nil {
+		m.status = "logging policy not available"
+		return m, nil
+	}
+	next := config.LogPolicies[0]
+	for i, policy := range config.LogPolicies {
+		if policy == m.logOverride {
+			next = ""
+			if i+1 < len(config.LogPolicies) {
+				next = config.LogPolicies[i+1]
+			}
+		}
+	}
+	m.logOverride = next
+	m.app.SetLogPolicy(next)
+	if next == "" {
+		m.status = "next connection: default logging"
+		if current := m.current(); current != nil && m.app.LogPolicy != nil {
+			m.status += fmt.Sprintf(" (%s for %s)", m.app.LogPolicy(current.host.Alias), current.host.Alias)
+		}
+	} else {
+		m.status = "next connection: logging " + string(next)
+	}
+	return m, nil
+}
+
+// openLogs lists the highlighted host's logged sessions, newest first.
+func (m model) openLogs() (tea.Model, tea.Cmd) {
+	current := m.current()
+	if current == nil {
+		return m, nil
+	}
+	m.showLogs = true
+	m.logs = logsModel{alias: current.host.Alias}
+	if m.app.Logs == nil {
+		m.logs.status = "logs not available"
+		return m, nil
+	}
+	sessions, err := m.app.Logs(current.host.Alias)
+	if err != nil {
+		m.logs.status = err.Error()
+		return m, nil
+	}
+	for i := len(sessions) - 1; i >= 0; i-- {
+		m.logs.items = append(m.logs.items, sessions[i])
+	}
+	return m, nil
+}
+
+func (m model) handleLogs(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "q":
+		m.showLogs = false
+		return m, nil
+	case "down", "j":
+		if m.logs.selected < len(m.logs.items)-1 {
+			m.logs.selected++
+		}
+		return m, nil
+	case "up", "k":
+		if m.logs.selected > 0 {
+			m.logs.selected--
+		}
+		return m, nil
+	case "enter":
+		if m.logs.selected >= len(m.logs.items) || m.app.ViewLog == nil {
+			return m, nil
+		}
+		cmd := m.app.ViewLog(m.logs.alias, m.logs.items[m.logs.selected])
+		m.logs.status = ""
+		return m, tea.ExecProcess(cmd, func(err error) tea.Msg {
+			return logViewedMsg{err: err}
+		})
+	case "p":
+		if m.logs.selected >= len(m.logs.items) || m.app.PlayLog == nil {
+			return m, nil
+		}
+		session := m.logs.items[m.logs.selected]
+		if session.Recording == "" {
+			m.logs.status = "session was not recorded"
+			return m, nil
+		}
+		m.logs.status = ""
+		return m, tea.ExecProcess(m.app.PlayLog(session), func(err error) tea.Msg {
+			return logViewedMsg{err: err}
+		})
+	}
+	return m, nil
+}
+
 func (m *model) addInput() (sshconfig.AddHostInput, error) {
 	port := 0
 	if value := strings.TrimSpace(m.add.port.Value()); value != "" {
@@ -519,12 +1208,14 @@ func (m *model) addInput() (sshconfig.AddHostInput, error) {
 		Port:         port,
 		ProxyJump:    strings.TrimSpace(m.add.proxyJump.Value()),
 		IdentityFile: strings.TrimSpace(m.add.identityFile.Value()),
+		Tags:         splitList(m.add.tags.Value()),
+		Extra:        m.add.extra,
+		Annotations:  m.add.annotations,
 	}, nil
 }
 
 func (m *model) focusAddField() {
-	fields := []*textinput.Model{&m.add.alias, &m.add.hostName, &m.add.user, &m.add.port, &m.add.proxyJump, &m.add.identityFile}
-	for index, field := range fields {
+	for index, field := range m.addFields() {
 		if index == m.add.field {
 			field.Focus()
 		} else {
@@ -551,6 +1242,12 @@ func (m *model) resetAddHostFields() {
 	m.add.port.SetValue("")
 	m.add.proxyJump.SetValue("")
 	m.add.identityFile.SetValue("")
+	m.add.tags.SetValue("")
+	m.add.file = 0
+	m.add.submitted = false
+	m.add.cloneOf = ""
+	m.add.extra = nil
+	m.add.annotations = nil
 }
 
 func (m model) enterDefault() (tea.Model, tea.Cmd) {
@@ -570,8 +1267,6 @@ func (m model) enterDefault() (tea.Model, tea.Cmd) {
 	if current == nil {
 		return m, nil
 	}
-	m.app.State.AddRecent(current.host.Alias)
-	_ = state.Save(m.app.StatePath, m.app.State)
 	switch m.app.EnterMode {
 	case "w":
 		return m.runMulti(m.app.NewWindow, "opened tmux window")
@@ -580,11 +1275,7 @@ func (m model) enterDefault() (tea.Model, tea.Cmd) {
 	case "s":
 		return m.runMulti(m.app.SplitHoriz, "opened horizontal split")
 	default:
-		m.enableLogging(current.host.Alias)
-		cmd := m.app.Connect(current.host.Alias)
-		m.execAfterExit = cmd
-		m.quitting = true
-		return m, tea.Quit
+		return m.connectHere(current.host.Alias)
 	}
 }
 
@@ -607,19 +1298,27 @@ func (m model) runTiled() (tea.Model, tea.Cmd) {
 	if len(targets) == 1 {
 		return m.runMulti(m.app.NewWindow, "opened tmux window")
 	}
-	return m, m.runAction(func() error {
+	return m.runConnect(func() error {
 		if !m.app.InTmux() {
 			return fmt.Errorf("tiled layout requires running inside tmux")
 		}
 		if m.app.Tiled == nil {
 			return fmt.Errorf("tiled layout not available")
 		}
-		return m.app.Tiled(targets, "tiled")
-	}, true, "opened tiled layout")
+		layout := m.app.Layout
+		if layout == "" {
+			layout = "tiled"
+		}
+		return m.app.Tiled(targets, layout)
+	}, "opened tiled layout")
 }
 
 func (m model) runMulti(action func(string) error, statusText string) (tea.Model, tea.Cmd) {
-	targets := m.targets()
+	return m.runOn(m.targets(), action, statusText)
+}
+
+// runOn opens a tmux window or split for each of targets.
+func (m model) runOn(targets []string, action func(string) error, statusText string) (tea.Model, tea.Cmd) {
 	if len(targets) == 0 {
 		return m, nil
 	}
@@ -627,7 +1326,7 @@ func (m model) runMulti(action func(string) error, statusText string) (tea.Model
 		m.app.State.AddRecent(alias)
 	}
 	_ = state.Save(m.app.StatePath, m.app.State)
-	return m, m.runAction(func() error {
+	return m.runConnect(func() error {
 		if !m.app.InTmux() {
 			return fmt.Errorf("tmux actions require running inside tmux")
 		}
@@ -637,7 +1336,21 @@ func (m model) runMulti(action func(string) error, statusText string) (tea.Model
 			}
 		}
 		return nil
-	}, true, statusText)
+	}, statusText)
+}
+
+// runConnect runs action, which opens connections, and quits. The logging
+// override covers only these connections: it is dropped once action has
+// run, whether or not it succeeded.
+func (m model) runConnect(action func() error, success string) (model, tea.Cmd) {
+	override := m.logOverride != ""
+	m.logOverride = ""
+	return m, m.runAction(func() error {
+		if override {
+			defer m.app.SetLogPolicy("")
+		}
+		return action()
+	}, true, success)
 }
 
 func (m model) runAction(action func() error, quit bool, success string) tea.Cmd {
@@ -662,17 +1375,27 @@ func (m *model) recompute() {
 		if m.filterRecents && !contains(m.app.State.Recents, candidate.host.Alias) {
 			continue
 		}
+		if m.filterSet != "" && !m.inFilterSet(candidate.host.Alias) {
+			continue
+		}
 		if query == "" || fuzzyMatch(query, candidate.search) {
 			out = append(out, candidate)
 		}
 	}
+	m.sortCandidates(out)
 	m.filtered = out
-	if m.selected >= len(m.filtered) {
-		m.selected = len(m.filtered) - 1
+	if m.treeView {
+		m.buildTree()
+	}
+	if m.selected >= m.listLen() {
+		m.selected = m.listLen() - 1
 	}
 	if m.selected < 0 {
 		m.selected = 0
 	}
+	if m.treeView && query != "" {
+		m.skipHeader()
+	}
 	m.ensureVisible()
 }
 
@@ -700,15 +1423,15 @@ func contains(items []string, target string) bool {
 }
 
 func (m *model) move(delta int) {
-	if len(m.filtered) == 0 {
+	if m.listLen() == 0 {
 		return
 	}
 	m.selected += delta
 	if m.selected < 0 {
 		m.selected = 0
 	}
-	if m.selected >= len(m.filtered) {
-		m.selected = len(m.filtered) - 1
+	if m.selected >= m.listLen() {
+		m.selected = m.listLen() - 1
 	}
 	m.ensureVisible()
 }
@@ -730,18 +1453,28 @@ func (m model) listHeight() int {
 	if m.height <= 0 {
 		return 12
 	}
-	height := m.height - 8
+	// Below the list: a blank line, the key hints and the status.
+	height := m.height - 5 - m.listTop()
 	if height < 5 {
 		return 5
 	}
 	return height
 }
 
+// current is the host under the cursor; nil on a group header of the tree
+// view.
 func (m model) current() *candidate {
-	if len(m.filtered) == 0 || m.selected < 0 || m.selected >= len(m.filtered) {
+	index := m.selected
+	if m.treeView {
+		if m.selected < 0 || m.selected >= len(m.rows) {
+			return nil
+		}
+		index = m.rows[m.selected].host
+	}
+	if index < 0 || index >= len(m.filtered) {
 		return nil
 	}
-	return &m.filtered[m.selected]
+	return &m.filtered[index]
 }
 
 func (m model) targets() []string {
@@ -765,39 +1498,71 @@ func (m model) targets() []string {
 	return items
 }
 
+// viewHeader renders the lines above the host list: the title with the tab
+// bar and the logging override, the search input and a blank line.
+func (m model) viewHeader() string {
+	var builder strings.Builder
+	builder.WriteString("tmux-ssh-manager  " + m.viewTabBar())
+	if m.logOverride != "" {
+		builder.WriteString("  " + m.warnStyle.Render("logging "+string(m.logOverride)+" for next connection"))
+	}
+	builder.WriteString("\n")
+	builder.WriteString(m.input.View())
+	builder.WriteString("\n\n")
+	return builder.String()
+}
+
 func (m model) View() string {
+	if m.confirm != nil {
+		return m.viewConfirm()
+	}
 	if m.showAddHost {
 		return m.viewAddHost()
 	}
 	if m.showCredential {
 		return m.viewCredential()
 	}
+	if m.showWorkspaces {
+		return m.viewWorkspaces()
+	}
+	if m.showSets {
+		return m.viewSets()
+	}
+	if m.showLogs {
+		return m.viewLogs()
+	}
+	if m.showPalette {
+		return m.viewPalette()
+	}
+	if m.showPrompt {
+		return m.viewPrompt()
+	}
+	if m.showHelp {
+		return m.viewHelp()
+	}
+	switch m.tab {
+	case tabSessions:
+		return m.viewSessions()
+	case tabTunnels:
+		return m.viewTunnels()
+	case tabHistory:
+		return m.viewHistory()
+	}
 	var builder strings.Builder
-	builder.WriteString("tmux-ssh-manager\n")
-	builder.WriteString(m.input.View())
-	builder.WriteString("\n\n")
+	builder.WriteString(m.viewHeader())
 
 	height := m.listHeight()
-	end := min(len(m.filtered), m.scroll+height)
+	end := min(m.listLen(), m.scroll+height)
 	for index := m.scroll; index < end; index++ {
-		candidate := m.filtered[index]
-		prefix := "  "
-		if index == m.selected {
-			prefix = "> "
-		}
-		selection := " "
-		if _, ok := m.selectedAliases[candidate.host.Alias]; ok {
-			selection = "x"
-		}
-		star := " "
-		if m.app.State.IsFavorite(candidate.host.Alias) {
-			star = m.favoriteStyle.Render("★")
-		}
-		line := fmt.Sprintf("%s[%s] %s %s", prefix, selection, star, candidate.line)
-		if index == m.selected {
-			line = m.selectedStyle.Render(line)
+		if m.treeView {
+			builder.WriteString(m.viewTreeRow(index))
+		} else {
+			prefix := "  "
+			if index == m.selected {
+				prefix = "> "
+			}
+			builder.WriteString(m.viewHostRow(m.filtered[index], prefix, index == m.selected))
 		}
-		builder.WriteString(line)
 		builder.WriteByte('\n')
 	}
 	if len(m.filtered) == 0 {
@@ -805,7 +1570,7 @@ func (m model) View() string {
 		builder.WriteByte('\n')
 	}
 	builder.WriteByte('\n')
-	builder.WriteString(m.helpStyle.Render("/ search • enter connect • space select • v split-v • s split-h • w window • t tiled • c store cred • d delete cred • f favorite • F favorites • R recents • a add host • q quit"))
+	builder.WriteString(m.helpStyle.Render(m.keys.footer()))
 	builder.WriteByte('\n')
 	if m.status != "" {
 		builder.WriteString(m.statusStyle.Render(m.status))
@@ -814,6 +1579,61 @@ func (m model) View() string {
 	return builder.String()
 }
 
+// viewHostRow renders a host of the list after prefix (the cursor and, in
+// the tree view, the indentation).
+func (m model) viewHostRow(candidate candidate, prefix string, highlighted bool) string {
+	selection := " "
+	if _, ok := m.selectedAliases[candidate.host.Alias]; ok {
+		selection = "x"
+	}
+	star := " "
+	if m.app.State.IsFavorite(candidate.host.Alias) {
+		star = m.favoriteStyle.Render("★")
+	}
+	line := fmt.Sprintf("%s[%s] %s %s", prefix, selection, star, candidate.line)
+	if m.app.CheckHealth != nil {
+		line = fmt.Sprintf("%s[%s] %s %s %s", prefix, selection, star, m.healthColumn(candidate.host.Alias), candidate.line)
+	}
+	if highlighted {
+		line = m.selectedStyle.Render(line)
+	}
+	return line
+}
+
+func (m model) viewHelp() string {
+	rows := m.keys.help()
+	width := 0
+	for _, row := range rows {
+		width = max(width, lipgloss.Width(row[0]))
+	}
+	parts := []string{"Keys", ""}
+	for _, row := range rows {
+		parts = append(parts, fmt.Sprintf("  %-*s  %s", width, row[0], m.dimStyle.Render(row[1])))
+	}
+	parts = append(parts, "",
+		"In search mode, typing filters the list; esc returns to these keys.",
+		"", m.helpStyle.Render("any key close"))
+	return strings.Join(parts, "\n")
+}
+
+func (m model) viewConfirm() string {
+	title, intro, yes := "Confirm connection", "These hosts are marked as requiring confirmation:", "y connect"
+	if m.confirm.title != "" {
+		title, intro, yes = m.confirm.title, m.confirm.intro, m.confirm.yes
+	}
+	parts := []string{
+		m.warnStyle.Render(title),
+		"",
+		intro,
+		"",
+	}
+	for _, alias := range m.confirm.hosts {
+		parts = append(parts, "  "+m.warnStyle.Render(alias))
+	}
+	parts = append(parts, "", m.helpStyle.Render(yes+" • any other key cancel"))
+	return strings.Join(parts, "\n")
+}
+
 func (m model) viewCredential() string {
 	actionText := "Store"
 	if m.credential.action == "delete" {
@@ -822,7 +1642,7 @@ func (m model) viewCredential() string {
 	parts := []string{
 		actionText + " Credential",
 		"",
-		"Host: " + m.credential.host,
+		hostsLine(m.credential.hosts),
 		m.credential.user.View(),
 		m.credential.kind.View(),
 		"",
@@ -834,19 +1654,141 @@ func (m model) viewCredential() string {
 	return strings.Join(parts, "\n")
 }
 
+func (m model) viewWorkspaces() string {
+	parts := []string{"Workspaces", ""}
+	var workspaces []state.Workspace
+	if m.app.State != nil {
+		workspaces = m.app.State.Workspaces
+	}
+	for index, ws := range workspaces {
+		panes := 0
+		aliases := make([]string, 0, 4)
+		for _, window := range ws.Windows {
+			for _, pane := range window.Panes {
+				panes++
+				aliases = append(aliases, pane.Alias)
+			}
+		}
+		line := fmt.Sprintf("  %s (%d panes) %s", ws.Name, panes, m.dimStyle.Render(strings.Join(aliases, ", ")))
+		if index == m.workspaces.selected {
+			line = m.selectedStyle.Render(fmt.Sprintf("> %s (%d panes)", ws.Name, panes)) + " " + m.dimStyle.Render(strings.Join(aliases, ", "))
+		}
+		parts = append(parts, line)
+	}
+	if len(workspaces) == 0 {
+		parts = append(parts, m.dimStyle.Render("no saved workspaces"))
+	}
+	parts = append(parts, "")
+	if m.workspaces.naming {
+		parts = append(parts, m.workspaces.name.View(), "", m.helpStyle.Render("enter save • esc cancel"))
+	} else {
+		parts = append(parts, m.helpStyle.Render("enter open • n save selection • d delete • j/k move • esc back"))
+	}
+	if m.workspaces.status != "" {
+		parts = append(parts, m.statusStyle.Render(m.workspaces.status))
+	}
+	return strings.Join(parts, "\n")
+}
+
+func (m model) viewTunnels() string {
+	parts := []string{m.viewTabBar(), ""}
+	for index, t := range m.tunnels.items {
+		line := fmt.Sprintf("%s  %s  pid %d  %s", t.ID, t.Alias, t.PID, strings.Join(t.Forwards, " "))
+		if index == m.tunnels.selected {
+			line = m.selectedStyle.Render("> " + line)
+		} else {
+			line = "  " + line
+		}
+		parts = append(parts, line)
+	}
+	if len(m.tunnels.items) == 0 {
+		parts = append(parts, m.dimStyle.Render("no active tunnels"))
+	}
+	parts = append(parts, "")
+	if current := m.current(); current != nil {
+		var configured []string
+		for _, f := range tunnel.Configured(current.host) {
+			configured = append(configured, f.String())
+		}
+		if len(configured) > 0 {
+			parts = append(parts, "Configured for "+current.host.Alias+": "+strings.Join(configured, " "))
+		} else {
+			parts = append(parts, m.dimStyle.Render("no forwards configured for "+current.host.Alias))
+		}
+		parts = append(parts, "")
+	}
+	parts = append(parts, m.helpStyle.Render("n start configured forwards • x stop • j/k move • tab next tab • esc hosts"))
+	if m.tunnels.status != "" {
+		parts = append(parts, m.statusStyle.Render(m.tunnels.status))
+	}
+	return strings.Join(parts, "\n")
+}
+
+func (m model) viewLogs() string {
+	parts := []string{"Logs: " + m.logs.alias, ""}
+	for index, s := range m.logs.items {
+		id := s.ID
+		if id == "" && len(s.Files) > 0 {
+			id = filepath.Base(s.Files[0])
+		}
+		line := fmt.Sprintf("%s  %d lines  %s", logSpan(s), s.Lines, id)
+		if s.Recording != "" {
+			line += "  [rec]"
+		}
+		if index == m.logs.selected {
+			line = m.selectedStyle.Render("> " + line)
+		} else {
+			line = "  " + line
+		}
+		parts = append(parts, line)
+	}
+	if len(m.logs.items) == 0 {
+		parts = append(parts, m.dimStyle.Render("no logs for "+m.logs.alias))
+	}
+	parts = append(parts, "", m.helpStyle.Render("enter view in $PAGER • p play recording • j/k move • esc back"))
+	if m.logs.status != "" {
+		parts = append(parts, m.statusStyle.Render(m.logs.status))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// logSpan formats when a session started and, if on the same day, when it
+// ended.
+func logSpan(s sessionlog.Session) string {
+	if s.Start.IsZero() {
+		return "-"
+	}
+	start, end := s.Start.Local(), s.End.Local()
+	if end.IsZero() || end.Format("2006-01-02") != start.Format("2006-01-02") {
+		return start.Format("2006-01-02 15:04")
+	}
+	return start.Format("2006-01-02 15:04") + "-" + end.Format("15:04")
+}
+
 func (m model) viewAddHost() string {
-	parts := []string{
-		"Add SSH Host",
-		"",
-		m.add.alias.View(),
-		m.add.hostName.View(),
-		m.add.user.View(),
-		m.add.port.View(),
-		m.add.proxyJump.View(),
-		m.add.identityFile.View(),
-		"",
-		m.helpStyle.Render("enter save • tab/j/k move • esc cancel"),
+	title := "Add SSH Host"
+	if m.add.cloneOf != "" {
+		title = "Clone " + m.add.cloneOf
+	}
+	parts := []string{title, ""}
+	errs := m.addHostErrors()
+	for index, field := range m.addFields() {
+		line := field.View()
+		if errs[index] != "" {
+			line += "  " + m.warnStyle.Render("✗ "+errs[index])
+		}
+		parts = append(parts, line)
+	}
+	parts = append(parts, m.viewAddFile(), "")
+	if preview := m.viewAddPreview(); len(preview) > 0 {
+		parts = append(parts, preview...)
+		parts = append(parts, "")
+	}
+	help := "enter save • tab/up/down move • esc cancel"
+	if m.add.field == addFile && len(m.app.HostFiles) > 1 {
+		help = "enter save • left/right choose file • tab/up/down move • esc cancel"
 	}
+	parts = append(parts, m.helpStyle.Render(help))
 	if m.add.status != "" {
 		parts = append(parts, m.statusStyle.Render(m.add.status))
 	}
@@ -866,20 +1808,20 @@ func min(a, b int) int {
 // cursor position) by writing escape sequences back to the app's stdin. If those
 // responses escape the TUI lifecycle, the next exec'd program (ssh) or your
 // local shell can interpret them as literal input.
-func disableTermQueries() func() {
+func disableTermQueries(profile termenv.Profile) func() {
 	// Lipgloss uses termenv for terminal capability detection.
 	//
 	// Some detection paths can send OSC/DSR queries (like OSC 11), which can
 	// cause certain terminals to write replies back onto stdin. If those replies
 	// outlive the TUI, they can leak into the next program as literal input.
 	//
-	// Force a fixed profile for the duration of the picker.
+	// Force the theme's profile for the duration of the picker.
 	prevOut := termenv.DefaultOutput()
 	prevProfile := lipgloss.ColorProfile()
 
-	forced := termenv.NewOutput(os.Stdout, termenv.WithProfile(termenv.ANSI256), termenv.WithTTY(true))
+	forced := termenv.NewOutput(os.Stdout, termenv.WithProfile(profile), termenv.WithTTY(true))
 	termenv.SetDefaultOutput(forced)
-	lipgloss.SetColorProfile(termenv.ANSI256)
+	lipgloss.SetColorProfile(profile)
 
 	return func() {
 		termenv.SetDefaultOutput(prevOut)
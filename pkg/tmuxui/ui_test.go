@@ -1,13 +1,25 @@
 package tmuxui
 
 import (
+	"context"
+	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
 
+	"tmux-ssh-manager/pkg/config"
+	"tmux-ssh-manager/pkg/health"
+	"tmux-ssh-manager/pkg/sessionlog"
 	"tmux-ssh-manager/pkg/sshconfig"
 	"tmux-ssh-manager/pkg/state"
+	"tmux-ssh-manager/pkg/tmuxrun"
 )
 
 func TestNewModelDefaultSearchMode(t *testing.T) {
@@ -440,3 +452,1467 @@ func TestTiledInSearchMode(t *testing.T) {
 		t.Fatalf("expected 2 tiled aliases, got %d", len(tiledAliases))
 	}
 }
+
+func TestSaveWorkspaceFromSelection(t *testing.T) {
+	store := &state.Store{}
+	m := newModel(App{
+		Hosts: []sshconfig.Host{
+			{Alias: "h1", HostName: "10.0.0.1"},
+			{Alias: "h2", HostName: "10.0.0.2"},
+		},
+		State:     store,
+		StatePath: t.TempDir() + "/state.json",
+	})
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlA})
+	m = updated.(model)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'W'}})
+	m = updated.(model)
+	if !m.showWorkspaces {
+		t.Fatal("expected workspace list to open")
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	m = updated.(model)
+	for _, r := range "pair" {
+		updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		m = updated.(model)
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+
+	ws, ok := store.Workspace("pair")
+	if !ok {
+		t.Fatalf("expected workspace to be saved, status %q", m.workspaces.status)
+	}
+	if panes := ws.Windows[0].Panes; len(panes) != 2 || panes[0].Alias != "h1" || panes[1].Split != "v" {
+		t.Fatalf("unexpected panes: %+v", panes)
+	}
+}
+
+func TestOpenWorkspaceFromList(t *testing.T) {
+	store := &state.Store{}
+	_ = store.PutWorkspace(state.Workspace{Name: "db", Windows: []state.WorkspaceWindow{{Panes: []state.WorkspacePane{{Alias: "db1"}}}}})
+	var opened string
+	m := newModel(App{
+		Hosts:     []sshconfig.Host{{Alias: "db1"}},
+		State:     store,
+		StatePath: t.TempDir() + "/state.json",
+		InTmux:    func() bool { return true },
+		OpenWorkspace: func(ws state.Workspace) error {
+			opened = ws.Name
+			return nil
+		},
+	})
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'W'}})
+	m = updated.(model)
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd == nil {
+		t.Fatal("expected a command from enter")
+	}
+	if _, ok := cmd().(tea.QuitMsg); !ok {
+		t.Fatal("expected picker to quit after opening workspace")
+	}
+	if opened != "db" {
+		t.Fatalf("expected workspace db to open, got %q", opened)
+	}
+}
+
+func TestTiledUsesConfiguredLayout(t *testing.T) {
+	var tiledLayout string
+	m := newModel(App{
+		Hosts:     []sshconfig.Host{{Alias: "h1"}, {Alias: "h2"}},
+		Layout:    "2x1",
+		State:     &state.Store{},
+		StatePath: t.TempDir() + "/state.json",
+		InTmux:    func() bool { return true },
+		Tiled: func(aliases []string, layout string) error {
+			tiledLayout = layout
+			return nil
+		},
+	})
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlA})
+	m = updated.(model)
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'t'}})
+	cmd()
+	if tiledLayout != "2x1" {
+		t.Fatalf("expected layout 2x1, got %q", tiledLayout)
+	}
+}
+
+func TestConfirmBeforeConnectingToFlaggedHost(t *testing.T) {
+	var connected string
+	m := newModel(App{
+		Hosts:     []sshconfig.Host{{Alias: "prod-db", Tags: []string{"prod"}}},
+		State:     &state.Store{},
+		StatePath: t.TempDir() + "/state.json",
+		Confirm:   func(alias string) bool { return alias == "prod-db" },
+		Connect: func(alias string) *exec.Cmd {
+			connected = alias
+			return exec.Command("true")
+		},
+	})
+
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	if cmd != nil || connected != "" {
+		t.Fatal("expected enter to wait for confirmation")
+	}
+	if m.confirm == nil || m.confirm.hosts[0] != "prod-db" {
+		t.Fatalf("expected pending confirmation, got %+v", m.confirm)
+	}
+
+	// Anything but y cancels.
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	m = updated.(model)
+	if m.confirm != nil || connected != "" || m.status != "connection cancelled" {
+		t.Fatalf("expected cancellation, status %q", m.status)
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	_, cmd = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}})
+	if cmd == nil || connected != "prod-db" {
+		t.Fatalf("expected connection after y, got %q", connected)
+	}
+}
+
+func TestTagsAreSearchable(t *testing.T) {
+	m := newModel(App{
+		Hosts: []sshconfig.Host{
+			{Alias: "db1", Tags: []string{"prod"}},
+			{Alias: "db2", Tags: []string{"dev"}},
+		},
+		StartInSearch: true,
+	})
+	for _, r := range "prod" {
+		updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		m = updated.(model)
+	}
+	if len(m.filtered) != 1 || m.filtered[0].host.Alias != "db1" {
+		t.Fatalf("expected tag search to match db1, got %d hosts", len(m.filtered))
+	}
+}
+
+func TestTunnelsOverlayStartsAndStops(t *testing.T) {
+	var running []state.Tunnel
+	m := newModel(App{
+		Hosts: []sshconfig.Host{{Alias: "db1", LocalForwards: []string{"5432:localhost:5432"}}},
+		State: &state.Store{},
+		Tunnels: func() []state.Tunnel {
+			return running
+		},
+		StartTunnel: func(alias string) (func() (state.Tunnel, error), error) {
+			return func() (state.Tunnel, error) {
+				return state.Tunnel{Alias: alias, Forwards: []string{"-L 5432:localhost:5432"}}, nil
+			}, nil
+		},
+		AddTunnel: func(started state.Tunnel) (state.Tunnel, error) {
+			started.ID = "1"
+			running = append(running, started)
+			return started, nil
+		},
+		StopTunnel: func(id string) error {
+			running = nil
+			return nil
+		},
+	})
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'T'}})
+	m = updated.(model)
+	if m.tab != tabTunnels {
+		t.Fatal("expected tunnels tab")
+	}
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	m = updated.(model)
+	if cmd == nil || len(m.tunnels.items) != 0 {
+		t.Fatalf("expected the tunnel to start in the background, got %+v", m.tunnels.items)
+	}
+	updated, _ = m.Update(cmd())
+	m = updated.(model)
+	if len(m.tunnels.items) != 1 || m.tunnels.status != "started tunnel 1 to db1" {
+		t.Fatalf("expected started tunnel, got %+v (%q)", m.tunnels.items, m.tunnels.status)
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'x'}})
+	m = updated.(model)
+	if len(m.tunnels.items) != 0 || m.tunnels.status != "stopped tunnel 1 to db1" {
+		t.Fatalf("expected stopped tunnel, got %+v (%q)", m.tunnels.items, m.tunnels.status)
+	}
+}
+
+func TestLogsOverlayListsNewestFirst(t *testing.T) {
+	var viewed sessionlog.Session
+	m := newModel(App{
+		Hosts: []sshconfig.Host{{Alias: "db1"}},
+		State: &state.Store{},
+		Logs: func(alias string) ([]sessionlog.Session, error) {
+			return []sessionlog.Session{{Alias: alias, ID: "old"}, {Alias: alias, ID: "new"}}, nil
+		},
+		ViewLog: func(alias string, session sessionlog.Session) *exec.Cmd {
+			viewed = session
+			return exec.Command("true")
+		},
+	})
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'L'}})
+	m = updated.(model)
+	if !m.showLogs || m.logs.alias != "db1" || len(m.logs.items) != 2 || m.logs.items[0].ID != "new" {
+		t.Fatalf("expected logs overlay with newest first, got %+v", m.logs)
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'j'}})
+	m = updated.(model)
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd == nil || viewed.ID != "old" {
+		t.Fatalf("expected pager for session old, got %+v", viewed)
+	}
+}
+
+func TestLogsOverlayPlaysRecordedSessions(t *testing.T) {
+	var played string
+	m := newModel(App{
+		Hosts: []sshconfig.Host{{Alias: "db1"}},
+		State: &state.Store{},
+		Logs: func(alias string) ([]sessionlog.Session, error) {
+			return []sessionlog.Session{{ID: "plain"}, {ID: "recorded", Recording: "/logs/db1/x.cast"}}, nil
+		},
+		PlayLog: func(session sessionlog.Session) *exec.Cmd {
+			played = session.Recording
+			return exec.Command("true")
+		},
+	})
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'L'}})
+	m = updated.(model)
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'p'}})
+	m = updated.(model)
+	if cmd == nil || played != "/logs/db1/x.cast" {
+		t.Fatalf("expected recording to play, got %q", played)
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'j'}})
+	m = updated.(model)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'p'}})
+	m = updated.(model)
+	if m.logs.status != "session was not recorded" {
+		t.Fatalf("expected not recorded status, got %q", m.logs.status)
+	}
+}
+
+func TestLogPolicyToggleCyclesOverride(t *testing.T) {
+	var override config.LogPolicy = "unset"
+	m := newModel(App{
+		Hosts:        []sshconfig.Host{{Alias: "db1"}},
+		State:        &state.Store{},
+		LogPolicy:    func(string) config.LogPolicy { return config.LogRecording },
+		SetLogPolicy: func(policy config.LogPolicy) { override = policy },
+	})
+	var seen []string
+	for range len(config.LogPolicies) + 1 {
+		updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'l'}})
+		m = updated.(model)
+		seen = append(seen, string(override))
+	}
+	if strings.Join(seen, ",") != "off,text,raw,recording," {
+		t.Fatalf("unexpected cycle %q", seen)
+	}
+	if m.status != "next connection: default logging (recording for db1)" {
+		t.Fatalf("unexpected status %q", m.status)
+	}
+}
+
+func TestLogPolicyOverrideLastsOneConnection(t *testing.T) {
+	var override, used config.LogPolicy
+	m := newModel(App{
+		Hosts:        []sshconfig.Host{{Alias: "db1"}},
+		State:        &state.Store{},
+		InTmux:       func() bool { return true },
+		LogPolicy:    func(string) config.LogPolicy { return config.LogText },
+		SetLogPolicy: func(policy config.LogPolicy) { override = policy },
+	})
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'l'}})
+	m = updated.(model)
+	if override != config.LogOff {
+		t.Fatalf("expected off override, got %q", override)
+	}
+	updated, cmd := m.runOn([]string{"db1"}, func(string) error {
+		used = override
+		return nil
+	}, "opened")
+	if updated.(model).logOverride != "" {
+		t.Fatalf("expected the header to drop the override")
+	}
+	cmd()
+	if used != config.LogOff || override != "" {
+		t.Fatalf("expected the override for one connection only, used %q then %q", used, override)
+	}
+}
+
+func TestKeymapOverridesAndConflicts(t *testing.T) {
+	keymap, err := NewKeymap([]config.KeyBinding{
+		{Action: "split-v", Keys: []string{"|", "ctrl+v"}, Source: "config.toml:2"},
+		{Action: "favorite", Keys: []string{}, Source: "config.toml:3"},
+		{Action: "tiled", Keys: []string{"space t"}, Source: "config.toml:4"},
+		{Action: "toggle-select", Keys: []string{"x"}, Source: "config.toml:5"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		pressed []string
+		action  Action
+		ok      bool
+		prefix  bool
+	}{
+		{[]string{"|"}, ActionSplitV, true, false},
+		{[]string{"v"}, "", false, false},
+		{[]string{"f"}, "", false, false},
+		{[]string{" "}, "", false, true},
+		{[]string{" ", "t"}, ActionTiled, true, false},
+		{[]string{"g"}, "", false, true},
+		{[]string{"g", "g"}, ActionTop, true, false},
+	} {
+		action, ok, prefix := keymap.lookup(tc.pressed)
+		if action != tc.action || ok != tc.ok || prefix != tc.prefix {
+			t.Errorf("lookup(%q) = %q %v %v, want %q %v %v", tc.pressed, action, ok, prefix, tc.action, tc.ok, tc.prefix)
+		}
+	}
+	if got := strings.Join(keymap.Keys(ActionSplitV), ","); got != "|,ctrl+v" {
+		t.Fatalf("unexpected split-v keys %q", got)
+	}
+
+	for _, tc := range []struct {
+		bindings []config.KeyBinding
+		want     string
+	}{
+		{[]config.KeyBinding{{Action: "split-v", Keys: []string{"f"}, Source: "config.toml:7"}}, `config.toml:7: "f" is bound to both split-v and favorite`},
+		{[]config.KeyBinding{{Action: "tiled", Keys: []string{"g"}, Source: "config.toml:8"}}, `config.toml:8: "g" (tiled) is the start of "g g" (top)`},
+		{[]config.KeyBinding{{Action: "teleport", Keys: []string{"x"}, Source: "config.toml:9"}}, `config.toml:9: unknown action "teleport"`},
+	} {
+		if _, err := NewKeymap(tc.bindings); err == nil || err.Error() != tc.want {
+			t.Errorf("NewKeymap(%+v) error = %v, want %q", tc.bindings, err, tc.want)
+		}
+	}
+}
+
+func TestCustomKeymapDrivesPicker(t *testing.T) {
+	keymap, err := NewKeymap([]config.KeyBinding{
+		{Action: "split-v", Keys: []string{"|"}},
+		{Action: "top", Keys: []string{"H"}},
+		{Action: "connect-pane", Keys: []string{"g o"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var split []string
+	m := newModel(App{
+		Hosts:     []sshconfig.Host{{Alias: "h1"}, {Alias: "h2"}, {Alias: "h3"}},
+		State:     &state.Store{},
+		StatePath: t.TempDir() + "/state.json",
+		InTmux:    func() bool { return true },
+		SplitVert: func(alias string) error {
+			split = append(split, alias)
+			return nil
+		},
+		Connect: func(alias string) *exec.Cmd { return exec.Command("true", alias) },
+		Keymap:  keymap,
+	})
+	press := func(keys ...string) tea.Cmd {
+		var cmd tea.Cmd
+		for _, key := range keys {
+			var updated tea.Model
+			updated, cmd = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)})
+			m = updated.(model)
+		}
+		return cmd
+	}
+
+	press("j", "j")
+	if m.selected != 2 {
+		t.Fatalf("expected j to still move down, got %d", m.selected)
+	}
+	press("H")
+	if m.selected != 0 {
+		t.Fatalf("expected H to jump to the top, got %d", m.selected)
+	}
+	// g no longer starts "g g"; an unfinished "g" followed by j still moves.
+	press("g", "j")
+	if m.selected != 1 || len(m.pendingKeys) != 0 {
+		t.Fatalf("expected abandoned sequence to fall back to j, got %d %v", m.selected, m.pendingKeys)
+	}
+	if cmd := press("v"); cmd != nil || len(split) != 0 {
+		t.Fatalf("expected v to be unbound, got %v", split)
+	}
+	if cmd := press("|"); cmd == nil {
+		t.Fatal("expected | to split")
+	} else {
+		cmd()
+	}
+	if len(split) != 1 || split[0] != "h2" {
+		t.Fatalf("unexpected splits %v", split)
+	}
+	if cmd := press("g", "o"); cmd == nil || m.execAfterExit == nil {
+		t.Fatal("expected g o to connect in this pane")
+	}
+}
+
+func TestHelpOverlayShowsActiveKeymap(t *testing.T) {
+	keymap, err := NewKeymap([]config.KeyBinding{{Action: "favorite", Keys: []string{"ctrl+f"}}, {Action: "tunnels", Keys: []string{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newModel(App{Hosts: []sshconfig.Host{{Alias: "h1"}}, State: &state.Store{}, Keymap: keymap})
+	if footer := m.View(); !strings.Contains(footer, "ctrl+f favorite") || strings.Contains(footer, "T tunnels") || !strings.Contains(footer, "? help") {
+		t.Fatalf("unexpected footer:\n%s", footer)
+	}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'?'}})
+	m = updated.(model)
+	view := m.View()
+	for _, want := range []string{"ctrl+f", "Toggle favorite", "gg", "Jump to the first host", "(unbound)", "q, esc, ctrl+c"} {
+		if !strings.Contains(view, want) {
+			t.Fatalf("help lacks %q:\n%s", want, view)
+		}
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'q'}})
+	m = updated.(model)
+	if m.showHelp || m.quitting {
+		t.Fatal("expected any key to close the help without quitting")
+	}
+}
+
+func TestNewThemeFollowsEnvironment(t *testing.T) {
+	for _, name := range ThemeNames() {
+		if _, err := buildTheme(name, config.ThemeDef{}, termenv.ANSI256); err != nil {
+			t.Fatalf("built-in theme %s: %v", name, err)
+		}
+	}
+	cfg := config.Default()
+	cfg.Themes = []config.ThemeDef{{
+		Name:   "ocean",
+		Base:   "nord",
+		Styles: map[string]config.TextStyle{"selected": {Fg: "#ffffff", Bg: "#005f87"}},
+		Source: "config.toml:4",
+	}}
+	for _, tc := range []struct {
+		name    string
+		theme   config.Theme
+		env     map[string]string
+		want    string
+		profile termenv.Profile
+	}{
+		{"unset environment", config.DefaultTheme, nil, "dark", termenv.ANSI256},
+		{"light background", config.DefaultTheme, map[string]string{"COLORFGBG": "0;15"}, "light", termenv.ANSI256},
+		{"dark background", config.DefaultTheme, map[string]string{"COLORFGBG": "15;default;0"}, "dark", termenv.ANSI256},
+		{"true color", config.DefaultTheme, map[string]string{"COLORTERM": "truecolor"}, "dark", termenv.TrueColor},
+		{"NO_COLOR", config.DefaultTheme, map[string]string{"NO_COLOR": "1", "COLORTERM": "truecolor"}, "mono", termenv.ANSI},
+		{"dumb terminal", config.DefaultTheme, map[string]string{"TERM": "dumb"}, "mono", termenv.Ascii},
+		{"custom light theme", config.Theme{Name: "auto", Dark: "dark", Light: "ocean", Colors: "auto"}, map[string]string{"COLORFGBG": "0;7"}, "ocean", termenv.ANSI256},
+		{"explicit colors win over NO_COLOR", config.Theme{Name: "high-contrast", Colors: "16"}, map[string]string{"NO_COLOR": "1"}, "high-contrast", termenv.ANSI},
+		{"colors none", config.Theme{Name: "ocean", Colors: "none"}, nil, "mono", termenv.ANSI},
+	} {
+		cfg.Theme = tc.theme
+		if cfg.Theme.Dark == "" {
+			cfg.Theme.Dark, cfg.Theme.Light = "dark", "light"
+		}
+		theme, err := NewTheme(cfg, func(key string) string { return tc.env[key] })
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if theme.Name != tc.want || theme.Profile != tc.profile {
+			t.Errorf("%s: got %s/%v, want %s/%v", tc.name, theme.Name, theme.Profile, tc.want, tc.profile)
+		}
+	}
+
+	cfg.Theme = config.Theme{Name: "ocean", Dark: "dark", Light: "light", Colors: "truecolor"}
+	theme, err := NewTheme(cfg, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := theme.Style("selected").GetBackground(); got != lipgloss.Color("#005f87") {
+		t.Fatalf("expected the custom selected style, got %v", got)
+	}
+	if got := theme.Style("favorite").GetForeground(); got != lipgloss.Color("#ebcb8b") {
+		t.Fatalf("expected favorite from the nord base, got %v", got)
+	}
+}
+
+func TestNewThemeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		theme  config.Theme
+		themes []config.ThemeDef
+		want   string
+	}{
+		{config.Theme{Name: "solarized", Dark: "dark", Light: "light"}, nil, `default: unknown theme "solarized" (expected auto, dark, high-contrast, light, mono, nord or a [themes.<name>] table)`},
+		{config.Theme{Name: "auto", Dark: "dark", Light: "paper"}, nil, `unknown theme "paper"`},
+		{config.DefaultTheme, []config.ThemeDef{{Name: "dark", Source: "config.toml:3"}}, `config.toml:3: theme "dark" is built in`},
+		{config.DefaultTheme, []config.ThemeDef{{Name: "x", Base: "x", Source: "config.toml:5"}}, `config.toml:5: theme "x": unknown base "x"`},
+	} {
+		cfg := config.Default()
+		cfg.Theme, cfg.Themes = tc.theme, tc.themes
+		if _, err := NewTheme(cfg, func(string) string { return "" }); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("NewTheme(%+v, %+v): expected %q, got %v", tc.theme, tc.themes, tc.want, err)
+		}
+	}
+}
+
+func TestPickerRendersWithTheme(t *testing.T) {
+	prev := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(termenv.ANSI)
+	defer lipgloss.SetColorProfile(prev)
+
+	cfg := config.Default()
+	theme, err := NewTheme(cfg, func(key string) string {
+		if key == "NO_COLOR" {
+			return "1"
+		}
+		return ""
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newModel(App{Hosts: []sshconfig.Host{{Alias: "h1"}, {Alias: "h2"}}, State: &state.Store{}, Theme: theme})
+	view := m.View()
+	if !strings.Contains(view, "\x1b[7m> [ ]") {
+		t.Fatalf("expected the highlighted host in reverse video:\n%q", view)
+	}
+	if strings.Contains(view, "\x1b[38;") || strings.Contains(view, "\x1b[48;") || strings.Contains(view, "\x1b[3") {
+		t.Fatalf("expected no colors with NO_COLOR:\n%q", view)
+	}
+}
+
+func TestHostGroups(t *testing.T) {
+	web := sshconfig.Host{Alias: "web1", HostName: "web1.Prod.example.com", Tags: []string{"prod", "web"}, ProxyJump: "bastion", SourcePath: "/etc/ssh/ssh_config.d/prod.conf"}
+	db := sshconfig.Host{Alias: "db1", HostName: "10.0.0.5", ProxyJump: "none"}
+	lab := sshconfig.Host{Alias: "lab"}
+	for _, tc := range []struct {
+		host sshconfig.Host
+		by   string
+		want string
+	}{
+		{web, "file", "/etc/ssh/ssh_config.d/prod.conf"},
+		{lab, "file", "(unknown file)"},
+		{web, "tag", "prod,web"},
+		{db, "tag", "(untagged)"},
+		{web, "bastion", "bastion"},
+		{db, "bastion", "(direct)"},
+		{web, "domain", "prod.example.com"},
+		{db, "domain", "(ip address)"},
+		{lab, "domain", "(no domain)"},
+	} {
+		if got := strings.Join(hostGroups(tc.host, tc.by), ","); got != tc.want {
+			t.Errorf("hostGroups(%s, %s) = %q, want %q", tc.host.Alias, tc.by, got, tc.want)
+		}
+	}
+}
+
+func TestTreeViewGroupsCollapsesAndSelects(t *testing.T) {
+	m := newModel(App{
+		Hosts: []sshconfig.Host{
+			{Alias: "web1", Tags: []string{"prod", "web"}, ProxyJump: "bastion"},
+			{Alias: "db1"},
+			{Alias: "web2", Tags: []string{"prod"}, ProxyJump: "bastion"},
+		},
+		State:    &state.Store{},
+		TreeView: true,
+		GroupBy:  "tag",
+	})
+	press := func(keys ...tea.KeyMsg) {
+		for _, key := range keys {
+			updated, _ := m.Update(key)
+			m = updated.(model)
+		}
+	}
+	runes := func(s string) tea.KeyMsg { return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)} }
+
+	view := m.View()
+	for _, want := range []string{"▾ prod (2)", "    [ ]   web1", "▾ web (1)", "▾ (untagged) (1)", "    [ ]   db1"} {
+		if !strings.Contains(view, want) {
+			t.Fatalf("tree lacks %q:\n%s", want, view)
+		}
+	}
+	if len(m.rows) != 7 || m.current() != nil || m.currentGroup() != "prod" {
+		t.Fatalf("unexpected rows %+v", m.rows)
+	}
+
+	// space on a header selects the whole group, and again clears it.
+	press(runes(" "))
+	if len(m.selectedAliases) != 2 || !strings.Contains(m.View(), "(2, 2 selected)") {
+		t.Fatalf("expected the group to be selected, got %v", m.selectedAliases)
+	}
+	press(runes(" "))
+	if len(m.selectedAliases) != 0 {
+		t.Fatalf("expected the group to be deselected, got %v", m.selectedAliases)
+	}
+
+	// left collapses the group from one of its hosts; enter on the header
+	// expands it again.
+	press(runes("j"))
+	if current := m.current(); current == nil || current.host.Alias != "web1" {
+		t.Fatalf("expected web1 under the cursor, got %+v", current)
+	}
+	press(tea.KeyMsg{Type: tea.KeyLeft})
+	if len(m.rows) != 5 || m.currentGroup() != "prod" || !strings.Contains(m.View(), "▸ prod (2)") {
+		t.Fatalf("expected prod collapsed, got %+v", m.rows)
+	}
+	press(tea.KeyMsg{Type: tea.KeyEnter})
+	if len(m.rows) != 7 {
+		t.Fatalf("expected prod expanded, got %+v", m.rows)
+	}
+	press(runes("z"), runes("M"))
+	if len(m.rows) != 3 {
+		t.Fatalf("expected every group collapsed, got %+v", m.rows)
+	}
+
+	// A search shows matches of collapsed groups.
+	press(runes("/"), runes("d"), runes("b"))
+	if !strings.Contains(m.View(), "db1") {
+		t.Fatalf("expected the match to be shown:\n%s", m.View())
+	}
+	press(tea.KeyMsg{Type: tea.KeyBackspace}, tea.KeyMsg{Type: tea.KeyBackspace}, tea.KeyMsg{Type: tea.KeyEsc})
+
+	press(runes("b"))
+	if m.groupBy != "bastion" || m.status != "grouped by bastion" || !strings.Contains(m.View(), "▾ bastion (2)") {
+		t.Fatalf("expected grouping by bastion, got %s:\n%s", m.groupBy, m.View())
+	}
+	press(runes("j"), runes("j"), runes("V"))
+	if m.treeView || m.current() == nil || m.current().host.Alias != "web2" {
+		t.Fatalf("expected the list view on web2, got %v %+v", m.treeView, m.current())
+	}
+}
+
+func TestTreeViewSearchEnterConnectsToMatch(t *testing.T) {
+	var opened []string
+	m := newModel(App{
+		Hosts:          []sshconfig.Host{{Alias: "web1", Tags: []string{"prod"}}, {Alias: "db1"}},
+		State:          &state.Store{},
+		TreeView:       true,
+		GroupBy:        "tag",
+		ImplicitSelect: true,
+		EnterMode:      "w",
+		InTmux:         func() bool { return true },
+		NewWindow: func(alias string) error {
+			opened = append(opened, alias)
+			return nil
+		},
+	})
+	var cmd tea.Cmd
+	for _, key := range []tea.KeyMsg{
+		{Type: tea.KeyRunes, Runes: []rune("/")},
+		{Type: tea.KeyRunes, Runes: []rune("d")},
+		{Type: tea.KeyRunes, Runes: []rune("b")},
+		{Type: tea.KeyEnter},
+	} {
+		var updated tea.Model
+		updated, cmd = m.Update(key)
+		m = updated.(model)
+	}
+	if current := m.current(); current == nil || current.host.Alias != "db1" {
+		t.Fatalf("expected db1 under the cursor, got rows %+v at %d", m.rows, m.selected)
+	}
+	if cmd == nil {
+		t.Fatal("expected enter to connect")
+	}
+	cmd()
+	if strings.Join(opened, ",") != "db1" {
+		t.Fatalf("expected a window for db1, got %v", opened)
+	}
+}
+
+func TestHealthColumnChecksStaleHostsAndRechecks(t *testing.T) {
+	store := &state.Store{}
+	store.PutHealth("h2", state.HealthCheck{Up: true, LatencyMS: 3.4, CheckedAt: time.Now().UTC().Format(time.RFC3339)})
+	var checked [][]string
+	app := App{
+		Hosts:     []sshconfig.Host{{Alias: "h1"}, {Alias: "h2"}, {Alias: "h3"}},
+		State:     store,
+		StatePath: filepath.Join(t.TempDir(), "state.json"),
+		HealthTTL: time.Minute,
+		CheckHealth: func(ctx context.Context, aliases []string) <-chan health.Result {
+			checked = append(checked, aliases)
+			results := make(chan health.Result, len(aliases))
+			for _, alias := range aliases {
+				results <- health.Result{Target: health.Target{Alias: alias}, Up: alias == "h1", Latency: 1500 * time.Millisecond, CheckedAt: time.Now()}
+			}
+			close(results)
+			return results
+		},
+	}
+	m := newModel(app)
+
+	// Init checks the hosts without a fresh result.
+	var pending []tea.Cmd
+	for _, cmd := range m.Init()().(tea.BatchMsg) {
+		pending = append(pending, cmd)
+	}
+	if len(checked) != 1 || strings.Join(checked[0], ",") != "h1,h3" {
+		t.Fatalf("unexpected checks %v", checked)
+	}
+	if view := m.View(); !strings.Contains(view, "…") || !strings.Contains(view, "● 3ms") {
+		t.Fatalf("expected pending and cached results:\n%s", view)
+	}
+	drain := func(m model, cmds []tea.Cmd) model {
+		for len(cmds) > 0 {
+			cmd := cmds[0]
+			cmds = cmds[1:]
+			switch msg := cmd().(type) {
+			case healthMsg, healthDoneMsg:
+				updated, next := m.Update(msg)
+				m = updated.(model)
+				if next != nil {
+					cmds = append(cmds, next)
+				}
+			}
+		}
+		return m
+	}
+	m = drain(m, pending)
+	view := m.View()
+	if !strings.Contains(view, "● 1.5s") || !strings.Contains(view, "✗ down") || strings.Contains(view, "…") {
+		t.Fatalf("expected health results:\n%s", view)
+	}
+	saved, err := state.Load(app.StatePath)
+	if err != nil || len(saved.Health) != 3 || saved.Health["h3"].Up {
+		t.Fatalf("expected results to be cached, got %+v (%v)", saved.Health, err)
+	}
+	store.PutHealth("h2", state.HealthCheck{Unknown: true, CheckedAt: time.Now().UTC().Format(time.RFC3339)})
+	if !strings.Contains(m.View(), "? unknown") {
+		t.Fatalf("expected a host behind a password jump to be unknown:\n%s", m.View())
+	}
+
+	// r checks every listed host again, cached or not.
+	m.input.Blur()
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	m = drain(updated.(model), []tea.Cmd{cmd})
+	if len(checked) != 2 || strings.Join(checked[1], ",") != "h1,h2,h3" || !strings.Contains(m.View(), "checking 3 hosts") {
+		t.Fatalf("unexpected recheck %v:\n%s", checked, m.View())
+	}
+
+	// Without a checker there is no column.
+	plain := newModel(App{Hosts: app.Hosts, State: store})
+	if plain.Init() == nil || strings.Contains(plain.View(), "●") {
+		t.Fatalf("expected no health column:\n%s", plain.View())
+	}
+}
+
+func TestMouseMovesSelectsAndConnects(t *testing.T) {
+	var opened []string
+	hosts := make([]sshconfig.Host, 20)
+	for i := range hosts {
+		hosts[i] = sshconfig.Host{Alias: fmt.Sprintf("h%02d", i)}
+	}
+	m := newModel(App{
+		Hosts:     hosts,
+		EnterMode: "w",
+		State:     &state.Store{},
+		StatePath: t.TempDir() + "/state.json",
+		InTmux:    func() bool { return true },
+		NewWindow: func(alias string) error {
+			opened = append(opened, alias)
+			return nil
+		},
+	})
+	mouse := func(x, y int, button tea.MouseButton) tea.Cmd {
+		t.Helper()
+		updated, cmd := m.Update(tea.MouseMsg{X: x, Y: y, Button: button, Action: tea.MouseActionPress})
+		m = updated.(model)
+		return cmd
+	}
+
+	// The wheel moves the cursor and scrolls to keep it visible.
+	for range 14 {
+		mouse(10, 5, tea.MouseButtonWheelDown)
+	}
+	if m.selected != 14 || m.scroll != 14-m.listHeight()+1 {
+		t.Fatalf("expected the cursor on row 14 in view, got %d (scroll %d)", m.selected, m.scroll)
+	}
+	mouse(10, 5, tea.MouseButtonWheelUp)
+	if m.selected != 13 {
+		t.Fatalf("expected the wheel to move up, got %d", m.selected)
+	}
+
+	// A click puts the cursor on the row; the "[ ]" column toggles it.
+	mouse(10, m.listTop()+1, tea.MouseButtonLeft)
+	if got := m.current().host.Alias; got != fmt.Sprintf("h%02d", m.scroll+1) {
+		t.Fatalf("expected the clicked row, got %s", got)
+	}
+	// Two quick clicks there toggle twice rather than connecting.
+	mouse(3, m.listTop(), tea.MouseButtonLeft)
+	mouse(3, m.listTop(), tea.MouseButtonLeft)
+	mouse(2, m.listTop()+2, tea.MouseButtonLeft)
+	if len(m.selectedAliases) != 1 || len(opened) != 0 {
+		t.Fatalf("expected one selected host and no connection, got %v %v", m.selectedAliases, opened)
+	}
+	delete(m.selectedAliases, m.current().host.Alias)
+
+	// A double click connects with the enter mode.
+	mouse(10, m.listTop(), tea.MouseButtonLeft)
+	cmd := mouse(10, m.listTop(), tea.MouseButtonLeft)
+	if cmd == nil {
+		t.Fatal("expected the double click to connect")
+	}
+	if _, ok := cmd().(tea.QuitMsg); !ok || len(opened) != 1 || opened[0] != fmt.Sprintf("h%02d", m.scroll) {
+		t.Fatalf("expected a window for the double-clicked host, got %v", opened)
+	}
+
+	// Clicks below the list are ignored.
+	before := m.selected
+	mouse(10, m.listTop()+m.listHeight()+1, tea.MouseButtonLeft)
+	if m.selected != before {
+		t.Fatalf("expected the cursor to stay on %d, got %d", before, m.selected)
+	}
+}
+
+func TestMouseTogglesTreeGroups(t *testing.T) {
+	m := newModel(App{
+		Hosts:    []sshconfig.Host{{Alias: "a", Tags: []string{"web"}}, {Alias: "b", Tags: []string{"db"}}},
+		State:    &state.Store{},
+		TreeView: true,
+		GroupBy:  "tag",
+	})
+	m.recompute()
+	click := func(x, y int) {
+		updated, _ := m.Update(tea.MouseMsg{X: x, Y: y, Button: tea.MouseButtonLeft, Action: tea.MouseActionPress})
+		m = updated.(model)
+	}
+	// Rows: ▾ db, b, ▾ web, a. The arrow folds the group.
+	click(2, m.listTop())
+	if !m.collapsed["db"] || m.listLen() != 3 {
+		t.Fatalf("expected db collapsed, got %v with %d rows", m.collapsed, m.listLen())
+	}
+	// The indented "[ ]" of a host in the tree selects it.
+	click(4, m.listTop()+2)
+	if _, ok := m.selectedAliases["a"]; !ok {
+		t.Fatalf("expected a selected, got %v", m.selectedAliases)
+	}
+}
+
+func TestMouseFollowsAWrappedHeader(t *testing.T) {
+	m := newModel(App{
+		Hosts:        []sshconfig.Host{{Alias: "a"}, {Alias: "b"}, {Alias: "c"}},
+		State:        &state.Store{},
+		SetLogPolicy: func(config.LogPolicy) {},
+	})
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 200, Height: 40})
+	m = updated.(model)
+	if m.listTop() != 3 {
+		t.Fatalf("expected the list on line 3, got %d", m.listTop())
+	}
+	// The logging override makes the title wrap in a narrow terminal.
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("l")})
+	m = updated.(model)
+	updated, _ = m.Update(tea.WindowSizeMsg{Width: 40, Height: 40})
+	m = updated.(model)
+	lines := strings.Split(m.View(), "\n")
+	top := m.listTop()
+	wrapped := 0
+	for _, line := range lines[:3] {
+		wrapped += max(1, (lipgloss.Width(line)+39)/40)
+	}
+	if top <= 3 || top != wrapped || !strings.Contains(lines[3], "a") {
+		t.Fatalf("expected the list below %d wrapped header lines, got %d:\n%s", wrapped, top, m.View())
+	}
+	updated, _ = m.Update(tea.MouseMsg{X: 10, Y: top + 1, Button: tea.MouseButtonLeft, Action: tea.MouseActionPress})
+	m = updated.(model)
+	if current := m.current(); current == nil || current.host.Alias != "b" {
+		t.Fatalf("expected the click on b, got %+v", current)
+	}
+}
+
+func TestCommandPaletteRunsActionsOnTargets(t *testing.T) {
+	var tiledAliases []string
+	var tiledLayout string
+	m := newModel(App{
+		Hosts:     []sshconfig.Host{{Alias: "web"}, {Alias: "db"}, {Alias: "cache"}},
+		State:     &state.Store{Recents: []string{"cache"}},
+		StatePath: t.TempDir() + "/state.json",
+		InTmux:    func() bool { return true },
+		Tiled: func(aliases []string, layout string) error {
+			tiledAliases, tiledLayout = aliases, layout
+			return nil
+		},
+	})
+	send := func(msg tea.KeyMsg) tea.Cmd {
+		t.Helper()
+		updated, cmd := m.Update(msg)
+		m = updated.(model)
+		return cmd
+	}
+	typeText := func(text string) {
+		for _, r := range text {
+			send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		}
+	}
+
+	// The palette lists commands with their keys and fuzzy-filters them.
+	typeText(":")
+	if !m.showPalette || !strings.Contains(m.View(), "Connect in this pane") || !strings.Contains(m.View(), "ctrl+a") {
+		t.Fatalf("expected the palette with keys:\n%s", m.View())
+	}
+	typeText("sort name")
+	if len(m.palette.filtered) == 0 || m.palette.filtered[0].arg != "name" {
+		t.Fatalf("expected sort by name first, got %+v", m.palette.filtered)
+	}
+	send(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.showPalette || m.filtered[0].host.Alias != "cache" || m.filtered[2].host.Alias != "web" {
+		t.Fatalf("expected hosts sorted by name, got %v", m.filtered)
+	}
+
+	// Commands act on the selection.
+	send(tea.KeyMsg{Type: tea.KeyCtrlA})
+	typeText(":")
+	typeText("tldmainleft")
+	cmd := send(tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd == nil {
+		t.Fatal("expected the tiled command to run")
+	}
+	cmd()
+	if strings.Join(tiledAliases, ",") != "cache,db,web" || tiledLayout != "main-left" {
+		t.Fatalf("unexpected tiling %v with %q", tiledAliases, tiledLayout)
+	}
+
+	// esc closes the palette without running anything.
+	typeText(":")
+	typeText("quit")
+	send(tea.KeyMsg{Type: tea.KeyEsc})
+	if m.showPalette || m.quitting {
+		t.Fatal("expected esc to close the palette only")
+	}
+
+	// O cycles the sort order: after name comes recent first (tiling made
+	// web the latest).
+	typeText("O")
+	if m.sortBy != "recent" || m.filtered[0].host.Alias != "web" || m.filtered[2].host.Alias != "cache" {
+		t.Fatalf("expected recent hosts first, got %s %v", m.sortBy, m.filtered)
+	}
+}
+
+func TestAddHostFormValidatesAsYouType(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(key, []byte("key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	primary, extra := filepath.Join(dir, "config"), filepath.Join(dir, "work.conf")
+	var addedTo string
+	var added sshconfig.AddHostInput
+	m := newModel(App{
+		Hosts:     []sshconfig.Host{{Alias: "web", SourcePath: primary}, {Alias: "bastion", SourcePath: primary}},
+		State:     &state.Store{},
+		StatePath: filepath.Join(dir, "state.json"),
+		HostFiles: []string{primary, extra},
+		AddHost: func(path string, input sshconfig.AddHostInput) (sshconfig.Backup, error) {
+			addedTo, added = path, input
+			return sshconfig.Backup{}, nil
+		},
+	})
+	send := func(msg tea.KeyMsg) {
+		t.Helper()
+		updated, _ := m.Update(msg)
+		m = updated.(model)
+	}
+	typeText := func(text string) {
+		for _, r := range text {
+			send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		}
+	}
+	tab := func() { send(tea.KeyMsg{Type: tea.KeyTab}) }
+
+	typeText("a")
+	if view := m.View(); !m.showAddHost || strings.Contains(view, "✗") {
+		t.Fatalf("expected a clean form:\n%s", view)
+	}
+	typeText("web")
+	if view := m.View(); !strings.Contains(view, "✗ already defined in "+primary) {
+		t.Fatalf("expected a duplicate alias error:\n%s", view)
+	}
+	typeText("2")
+	tab()
+	tab()
+	tab()
+	typeText("70000")
+	tab()
+	typeText("jump")
+	tab()
+	typeText(filepath.Join(dir, "missing"))
+	view := m.View()
+	for _, want := range []string{"✗ must be 1-65535", `✗ unknown host "jump"`, "✗ no such file"} {
+		if !strings.Contains(view, want) {
+			t.Fatalf("expected %q:\n%s", want, view)
+		}
+	}
+	send(tea.KeyMsg{Type: tea.KeyEnter})
+	if addedTo != "" || !strings.Contains(m.View(), "fix the fields marked ✗ first") {
+		t.Fatalf("expected saving to be refused:\n%s", m.View())
+	}
+
+	// Fix the fields: the errors go away and the preview shows the block.
+	fix := func(field int, value string) {
+		m.addFields()[field].SetValue(value)
+	}
+	fix(addPort, "2222")
+	fix(addProxyJump, "bastion,admin@gw.example.com")
+	fix(addIdentityFile, key)
+	view = m.View()
+	if m.addHostErrors() != [addFile]string{} || !strings.Contains(view, "  Host web2") || !strings.Contains(view, "  ProxyJump bastion,admin@gw.example.com") {
+		t.Fatalf("expected a valid form with a preview:\n%s", view)
+	}
+
+	// The file chooser, after the tags, picks an included file.
+	tab()
+	tab()
+	send(tea.KeyMsg{Type: tea.KeyRight})
+	if !strings.Contains(m.View(), "File: ◂ "+extra+" ▸") {
+		t.Fatalf("expected the included file:\n%s", m.View())
+	}
+	send(tea.KeyMsg{Type: tea.KeyEnter})
+	if addedTo != extra || added.Alias != "web2" || added.Port != 2222 {
+		t.Fatalf("unexpected add %q %+v", addedTo, added)
+	}
+}
+
+func TestCloneFillsAddFormFromHost(t *testing.T) {
+	primary, extra := "/etc/ssh/config", "/etc/ssh/conf.d/db.conf"
+	var addedTo string
+	var added sshconfig.AddHostInput
+	m := newModel(App{
+		Hosts: []sshconfig.Host{
+			{Alias: "web", SourcePath: primary},
+			{
+				Alias: "db", HostName: "10.0.0.7", User: "admin", Port: 2222, Tags: []string{"prod"}, SourcePath: extra,
+				Directives: []sshconfig.Directive{{Key: "HostName", Value: "10.0.0.7"}, {Key: "User", Value: "admin"}, {Key: "Port", Value: "2222"}, {Key: "ForwardAgent", Value: "yes"}},
+			},
+		},
+		State:     &state.Store{},
+		HostFiles: []string{primary, extra},
+		AddHost: func(path string, input sshconfig.AddHostInput) (sshconfig.Backup, error) {
+			addedTo, added = path, input
+			return sshconfig.Backup{}, nil
+		},
+	})
+	send := func(msg tea.KeyMsg) {
+		t.Helper()
+		updated, _ := m.Update(msg)
+		m = updated.(model)
+	}
+	send(tea.KeyMsg{Type: tea.KeyDown})
+	send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	view := m.View()
+	if !m.showAddHost || !strings.Contains(view, "Clone db") || m.add.hostName.Value() != "10.0.0.7" || m.add.tags.Value() != "prod" || !strings.Contains(view, "File: ◂ "+extra+" ▸") {
+		t.Fatalf("expected the form filled from db:\n%s", view)
+	}
+	for _, r := range "db2" {
+		send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	if view := m.View(); !strings.Contains(view, "  ForwardAgent yes") {
+		t.Fatalf("expected the extra directive in the preview:\n%s", view)
+	}
+	send(tea.KeyMsg{Type: tea.KeyEnter})
+	if addedTo != extra || added.Alias != "db2" || added.Port != 2222 || len(added.Extra) != 1 || strings.Join(added.Tags, ",") != "prod" {
+		t.Fatalf("unexpected clone %q %+v", addedTo, added)
+	}
+}
+
+func TestHostSetsSaveFilterAndRecall(t *testing.T) {
+	store := &state.Store{}
+	_ = store.PutSet(state.HostSet{Name: "old", Aliases: []string{"web", "gone"}})
+	m := newModel(App{
+		Hosts:     []sshconfig.Host{{Alias: "web"}, {Alias: "db1"}, {Alias: "db2"}},
+		State:     store,
+		StatePath: filepath.Join(t.TempDir(), "state.json"),
+	})
+	send := func(msg tea.KeyMsg) {
+		t.Helper()
+		updated, _ := m.Update(msg)
+		m = updated.(model)
+	}
+	keys := func(text string) {
+		for _, r := range text {
+			send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		}
+	}
+
+	// Select db1 and db2 and save them as "db".
+	send(tea.KeyMsg{Type: tea.KeyEsc})
+	keys("j")
+	send(tea.KeyMsg{Type: tea.KeySpace})
+	keys("j")
+	send(tea.KeyMsg{Type: tea.KeySpace})
+	keys("Sn")
+	keys("db")
+	send(tea.KeyMsg{Type: tea.KeyEnter})
+	set, ok := store.Set("db")
+	if !ok || strings.Join(set.Aliases, ",") != "db1,db2" {
+		t.Fatalf("expected the set to be saved, got %+v (%q)", set, m.sets.status)
+	}
+	if view := m.View(); !strings.Contains(view, "old (2 hosts), 1 not in ssh config") {
+		t.Fatalf("expected the missing host to be reported:\n%s", view)
+	}
+
+	// enter filters the list on the set; F replaces the filter.
+	send(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.showSets || len(m.filtered) != 2 || m.filtered[0].host.Alias != "db1" {
+		t.Fatalf("expected the list filtered on db, got %d hosts", len(m.filtered))
+	}
+	keys("F")
+	if m.filterSet != "" {
+		t.Fatal("expected the favorites filter to replace the set filter")
+	}
+	keys("F")
+
+	// ctrl+s cycles the filter through the sets and back to every host.
+	for _, want := range []string{"old", "db", ""} {
+		send(tea.KeyMsg{Type: tea.KeyCtrlS})
+		if m.filterSet != want {
+			t.Fatalf("expected filter %q, got %q", want, m.filterSet)
+		}
+	}
+	if len(m.filtered) != 3 {
+		t.Fatalf("expected every host, got %d", len(m.filtered))
+	}
+
+	// space selects the hosts of a set that still exist.
+	m.selectedAliases = map[string]struct{}{}
+	keys("Sk")
+	send(tea.KeyMsg{Type: tea.KeySpace})
+	if _, ok := m.selectedAliases["web"]; !ok || len(m.selectedAliases) != 1 || m.showSets {
+		t.Fatalf("expected web selected from old, got %v", m.selectedAliases)
+	}
+}
+
+func TestBulkActionsOnSelection(t *testing.T) {
+	hosts := []sshconfig.Host{{Alias: "web1"}, {Alias: "web2"}, {Alias: "db"}}
+	var tagged, removed []sshconfig.Host
+	var added []string
+	var credential string
+	m := newModel(App{
+		Hosts:     hosts,
+		State:     &state.Store{},
+		StatePath: filepath.Join(t.TempDir(), "state.json"),
+		EditTags: func(hosts []sshconfig.Host, add, remove []string) (sshconfig.Backup, error) {
+			tagged, added = hosts, add
+			return sshconfig.Backup{}, nil
+		},
+		RemoveHosts: func(hosts []sshconfig.Host) (sshconfig.Backup, error) {
+			removed = hosts
+			return sshconfig.Backup{}, nil
+		},
+		ExportHosts: func(hosts []sshconfig.Host) (string, error) {
+			return fmt.Sprintf("# %d blocks\n", len(hosts)), nil
+		},
+		LoadHosts: func() ([]sshconfig.Host, error) {
+			if removed != nil {
+				return hosts[2:], nil
+			}
+			return hosts, nil
+		},
+		ExecCredential: func(action, host, user, kind string) (*exec.Cmd, error) {
+			credential = action + " " + host
+			return exec.Command("true"), nil
+		},
+	})
+	send := func(msg tea.KeyMsg) {
+		t.Helper()
+		updated, _ := m.Update(msg)
+		m = updated.(model)
+	}
+	keys := func(text string) {
+		for _, r := range text {
+			send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		}
+	}
+	send(tea.KeyMsg{Type: tea.KeyEsc})
+	send(tea.KeyMsg{Type: tea.KeySpace})
+	keys("j")
+	send(tea.KeyMsg{Type: tea.KeySpace})
+
+	keys("f")
+	if !m.app.State.IsFavorite("web1") || !m.app.State.IsFavorite("web2") || m.app.State.IsFavorite("db") {
+		t.Fatalf("expected the selection favorited: %v", m.app.State.Favorites)
+	}
+	keys("f")
+	if len(m.app.State.Favorites) != 0 {
+		t.Fatalf("expected the selection unfavorited: %v", m.app.State.Favorites)
+	}
+
+	keys("+prod, web")
+	send(tea.KeyMsg{Type: tea.KeyEnter})
+	if len(tagged) != 2 || strings.Join(added, ",") != "prod,web" || m.showPrompt {
+		t.Fatalf("unexpected tags %v on %v", added, tagged)
+	}
+
+	export := filepath.Join(t.TempDir(), "hosts.conf")
+	keys("E" + export)
+	send(tea.KeyMsg{Type: tea.KeyEnter})
+	if data, err := os.ReadFile(export); err != nil || string(data) != "# 2 blocks\n" {
+		t.Fatalf("unexpected export %q (%v)", data, err)
+	}
+
+	keys("c")
+	if view := m.View(); !strings.Contains(view, "Hosts: web1, web2") {
+		t.Fatalf("expected the credential editor for both hosts:\n%s", view)
+	}
+	send(tea.KeyMsg{Type: tea.KeyEnter})
+	if credential != "set web1,web2" {
+		t.Fatalf("unexpected credential command %q", credential)
+	}
+	m.quitting = false
+
+	keys("D")
+	if view := m.View(); !strings.Contains(view, "Delete hosts") || !strings.Contains(view, "web2") || removed != nil {
+		t.Fatalf("expected a confirmation listing:\n%s", view)
+	}
+	keys("n")
+	if removed != nil || m.status != "delete cancelled" {
+		t.Fatalf("expected the delete cancelled, status %q", m.status)
+	}
+	keys("Dy")
+	if len(removed) != 2 || len(m.candidates) != 1 || len(m.selectedAliases) != 0 {
+		t.Fatalf("expected both hosts deleted, got %v, %d hosts, selection %v", removed, len(m.candidates), m.selectedAliases)
+	}
+}
+
+func TestTabsListSessionsAndReconnectFromHistory(t *testing.T) {
+	started := time.Now().Add(-10 * time.Minute).UTC()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	for _, err := range []error{
+		state.StartConnection(statePath, "db1", "", started),
+		state.EndConnection(statePath, "db1", "", started.Add(5*time.Minute)),
+		state.StartConnection(statePath, "web1", "%4", started),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	store := &state.Store{}
+	panes := []tmuxrun.Pane{{ID: "%4", Alias: "web1", Session: "work", WindowIndex: "1", WindowName: "web1"}}
+	var killed string
+	m := newModel(App{
+		Hosts:     []sshconfig.Host{{Alias: "web1"}, {Alias: "db1"}},
+		State:     store,
+		StatePath: statePath,
+		InTmux:    func() bool { return true },
+		Panes: func() ([]tmuxrun.Pane, error) {
+			return panes, nil
+		},
+		KillPane: func(id string) error {
+			killed = id
+			panes = nil
+			return nil
+		},
+		Connect: func(alias string) *exec.Cmd {
+			return exec.Command("true")
+		},
+	})
+	send := func(msg tea.KeyMsg) {
+		t.Helper()
+		updated, _ := m.Update(msg)
+		m = updated.(model)
+	}
+	keys := func(typed string) {
+		t.Helper()
+		for _, r := range typed {
+			send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		}
+	}
+
+	send(tea.KeyMsg{Type: tea.KeyTab})
+	if view := m.View(); m.tab != tabSessions || !strings.Contains(view, "%4  web1  work:1 web1") {
+		t.Fatalf("expected the open sessions tab:\n%s", view)
+	}
+	keys("x")
+	if view := m.View(); !strings.Contains(view, "Kill pane") || killed != "" {
+		t.Fatalf("expected a confirmation first:\n%s", view)
+	}
+	keys("y")
+	if killed != "%4" || len(m.sessions.items) != 0 || m.sessions.status != "killed %4 (web1)" {
+		t.Fatalf("expected the pane killed, got %q, %+v (%q)", killed, m.sessions.items, m.sessions.status)
+	}
+
+	panes = []tmuxrun.Pane{{ID: "%4", Alias: "web1"}}
+	keys("4")
+	view := m.View()
+	if m.tab != tabHistory || !strings.Contains(view, "web1  running 10m") || !strings.Contains(view, "db1  5m00s") {
+		t.Fatalf("expected the history with durations:\n%s", view)
+	}
+	keys("1")
+	if m.tab != tabHosts {
+		t.Fatal("expected 1 to go back to the hosts")
+	}
+	keys("4j")
+	send(tea.KeyMsg{Type: tea.KeyEnter})
+	history, err := state.History(statePath)
+	if err != nil || m.connected != "db1" || m.execAfterExit == nil || history[0].Alias != "db1" || store.Recents[0] != "db1" {
+		t.Fatalf("expected a reconnect to db1, got %q, history %+v (%v)", m.connected, history, err)
+	}
+}
+
+func TestRenameHostCarriesItsSetsAndUndoes(t *testing.T) {
+	config := []sshconfig.Host{{Alias: "web"}, {Alias: "db"}}
+	backups := map[string][]sshconfig.Host{}
+	backup := func() sshconfig.Backup {
+		id := fmt.Sprintf("b%d", len(backups)+1)
+		backups[id] = append([]sshconfig.Host(nil), config...)
+		return sshconfig.Backup{ID: id}
+	}
+	store := &state.Store{Favorites: []string{"web"}, Sets: []state.HostSet{{Name: "front", Aliases: []string{"web", "db"}}}}
+	m := newModel(App{
+		Hosts:     config,
+		State:     store,
+		StatePath: filepath.Join(t.TempDir(), "state.json"),
+		RenameHost: func(host sshconfig.Host, alias string) (sshconfig.Backup, error) {
+			taken := backup()
+			config = []sshconfig.Host{{Alias: alias}, config[1]}
+			return taken, nil
+		},
+		LoadHosts: func() ([]sshconfig.Host, error) { return config, nil },
+		RestoreBackup: func(id string) (sshconfig.Backup, error) {
+			current := backup()
+			config = backups[id]
+			return current, nil
+		},
+	})
+	send := func(msg tea.KeyMsg) {
+		t.Helper()
+		updated, _ := m.Update(msg)
+		m = updated.(model)
+	}
+	send(tea.KeyMsg{Type: tea.KeyEsc})
+	send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("n")})
+	if !m.showPrompt || m.prompt.input.Value() != "web" {
+		t.Fatalf("expected the rename prompt filled with the alias, got %q", m.prompt.input.Value())
+	}
+	m.prompt.input.SetValue("www")
+	send(tea.KeyMsg{Type: tea.KeyEnter})
+	set, _ := store.Set("front")
+	if m.showPrompt || m.candidates[0].host.Alias != "www" || strings.Join(set.Aliases, ",") != "www,db" || !store.IsFavorite("www") {
+		t.Fatalf("expected web renamed everywhere, got %+v %v (%q)", set, store.Favorites, m.status)
+	}
+
+	send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("u")})
+	set, _ = m.app.State.Set("front")
+	if m.candidates[0].host.Alias != "web" || strings.Join(set.Aliases, ",") != "web,db" || m.status != "undid rename web" {
+		t.Fatalf("expected the rename undone, got %+v (%q)", set, m.status)
+	}
+	send(tea.KeyMsg{Type: tea.KeyCtrlR})
+	set, _ = m.app.State.Set("front")
+	if m.candidates[0].host.Alias != "www" || strings.Join(set.Aliases, ",") != "www,db" {
+		t.Fatalf("expected the rename redone, got %+v (%q)", set, m.status)
+	}
+}
+
+func TestUndoRedoStateConfigAndCredentials(t *testing.T) {
+	config := []sshconfig.Host{{Alias: "web"}, {Alias: "db"}}
+	backups := map[string][]sshconfig.Host{}
+	backup := func() sshconfig.Backup {
+		id := fmt.Sprintf("b%d", len(backups)+1)
+		backups[id] = append([]sshconfig.Host(nil), config...)
+		return sshconfig.Backup{ID: id}
+	}
+	secrets := map[string]string{"web/password": "hunter2", "db/password": "s3cret"}
+	unreadable := map[string]bool{"db/password": true}
+	m := newModel(App{
+		Hosts:     config,
+		State:     &state.Store{},
+		StatePath: filepath.Join(t.TempDir(), "state.json"),
+		RemoveHosts: func(hosts []sshconfig.Host) (sshconfig.Backup, error) {
+			taken := backup()
+			config = config[1:]
+			return taken, nil
+		},
+		LoadHosts: func() ([]sshconfig.Host, error) { return config, nil },
+		RestoreBackup: func(id string) (sshconfig.Backup, error) {
+			current := backup()
+			config = backups[id]
+			return current, nil
+		},
+		DeleteCredential: func(host, user, kind string) (func() error, error) {
+			key := host + "/" + kind
+			secret, ok := secrets[key]
+			if !ok {
+				return nil, fmt.Errorf("no %s for %s", kind, host)
+			}
+			delete(secrets, key)
+			if unreadable[key] {
+				return nil, nil
+			}
+			return func() error {
+				secrets[key] = secret
+				return nil
+			}, nil
+		},
+	})
+	send := func(msg tea.KeyMsg) {
+		t.Helper()
+		updated, _ := m.Update(msg)
+		m = updated.(model)
+	}
+	keys := func(text string) {
+		for _, r := range text {
+			send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		}
+	}
+	send(tea.KeyMsg{Type: tea.KeyEsc})
+
+	keys("u")
+	if m.status != "nothing to undo" {
+		t.Fatalf("expected nothing to undo, got %q", m.status)
+	}
+
+	keys("f")
+	keys("u")
+	if m.app.State.IsFavorite("web") || m.status != "undid favorite 1 host" {
+		t.Fatalf("expected the favorite undone, got %v (%q)", m.app.State.Favorites, m.status)
+	}
+	send(tea.KeyMsg{Type: tea.KeyCtrlR})
+	if !m.app.State.IsFavorite("web") {
+		t.Fatalf("expected the favorite redone (%q)", m.status)
+	}
+	stored, err := state.Load(m.app.StatePath)
+	if err != nil || !stored.IsFavorite("web") {
+		t.Fatalf("expected the redo saved, got %v, %v", stored, err)
+	}
+
+	// Deleting a host, then undoing and redoing it, restores backups.
+	keys("D")
+	keys("y")
+	if len(m.candidates) != 1 {
+		t.Fatalf("expected web deleted, got %d hosts", len(m.candidates))
+	}
+	// A newer backup, taken by another process, is not the one undone.
+	backup()
+	keys("u")
+	if len(m.candidates) != 2 || m.status != "undid delete 1 host" {
+		t.Fatalf("expected web back, got %d hosts (%q)", len(m.candidates), m.status)
+	}
+	send(tea.KeyMsg{Type: tea.KeyCtrlR})
+	if len(m.candidates) != 1 || m.candidates[0].host.Alias != "db" {
+		t.Fatalf("expected web deleted again, got %d hosts (%q)", len(m.candidates), m.status)
+	}
+	keys("u")
+
+	// A credential deleted in the picker can be put back.
+	keys("d")
+	send(tea.KeyMsg{Type: tea.KeyEnter})
+	if _, ok := secrets["web/password"]; ok || m.showCredential || m.execAfterExit != nil {
+		t.Fatalf("expected the password deleted in the picker (%q)", m.credential.status)
+	}
+	keys("u")
+	if secrets["web/password"] != "hunter2" {
+		t.Fatalf("expected the password restored (%q)", m.status)
+	}
+
+	// One that cannot be kept for undo is deleted all the same.
+	undoable := len(m.undoStack)
+	keys("j")
+	keys("d")
+	send(tea.KeyMsg{Type: tea.KeyEnter})
+	if _, ok := secrets["db/password"]; ok || !strings.Contains(m.status, "1 host cannot be undone") {
+		t.Fatalf("expected the password deleted without undo (%q)", m.status)
+	}
+	if len(m.undoStack) != undoable {
+		t.Fatalf("expected the delete kept out of the undo stack, got %d changes", len(m.undoStack))
+	}
+
+	// A new change clears what could be redone.
+	keys("f")
+	send(tea.KeyMsg{Type: tea.KeyCtrlR})
+	if m.status != "nothing to redo" {
+		t.Fatalf("expected nothing to redo, got %q", m.status)
+	}
+}
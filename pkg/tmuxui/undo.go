@@ -0,0 +1,226 @@
+package tmuxui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"tmux-ssh-manager/pkg/sshconfig"
+	"tmux-ssh-manager/pkg/state"
+)
+
+// undoLimit caps the changes the picker can undo.
+const undoLimit = 50
+
+// change is a picker action that u undoes and ctrl+r redoes.
+type change struct {
+	label string
+	undo  func(m model) (model, error)
+	redo  func(m model) (model, error)
+}
+
+// remember records c as the newest change; a new change clears the redo
+// stack.
+func (m model) remember(c change) model {
+	m.undoStack = append(m.undoStack, c)
+	if len(m.undoStack) > undoLimit {
+		m.undoStack = m.undoStack[len(m.undoStack)-undoLimit:]
+	}
+	m.redoStack = nil
+	return m
+}
+
+func (m model) undo() (tea.Model, tea.Cmd) {
+	if len(m.undoStack) == 0 {
+		m.status = "nothing to undo"
+		return m, nil
+	}
+	c := m.undoStack[len(m.undoStack)-1]
+	m.undoStack = m.undoStack[:len(m.undoStack)-1]
+	m, err := c.undo(m)
+	if err != nil {
+		m.status = fmt.Sprintf("undo %s: %v", c.label, err)
+		return m, nil
+	}
+	m.redoStack = append(m.redoStack, c)
+	m.status = "undid " + c.label
+	return m, nil
+}
+
+func (m model) redo() (tea.Model, tea.Cmd) {
+	if len(m.redoStack) == 0 {
+		m.status = "nothing to redo"
+		return m, nil
+	}
+	c := m.redoStack[len(m.redoStack)-1]
+	m.redoStack = m.redoStack[:len(m.redoStack)-1]
+	m, err := c.redo(m)
+	if err != nil {
+		m.status = fmt.Sprintf("redo %s: %v", c.label, err)
+		return m, nil
+	}
+	m.undoStack = append(m.undoStack, c)
+	m.status = "redid " + c.label
+	return m, nil
+}
+
+// stateParts are the parts of the state that the picker's undoable actions
+// change: favorites, sets and workspaces.
+type stateParts struct {
+	favorites  []string
+	sets       []state.HostSet
+	workspaces []state.Workspace
+}
+
+// captureState copies the parts of the state an action may change, before
+// and after it.
+func (m model) captureState() stateParts {
+	if m.app.State == nil {
+		return stateParts{}
+	}
+	return stateParts{
+		favorites:  m.app.State.Favorites,
+		sets:       m.app.State.Sets,
+		workspaces: m.app.State.Workspaces,
+	}.clone()
+}
+
+// clone copies parts deeply, so that later changes to the state do not
+// reach it.
+func (p stateParts) clone() stateParts {
+	out := stateParts{favorites: append([]string(nil), p.favorites...)}
+	for _, set := range p.sets {
+		set.Aliases = append([]string(nil), set.Aliases...)
+		out.sets = append(out.sets, set)
+	}
+	for _, ws := range p.workspaces {
+		windows := make([]state.WorkspaceWindow, len(ws.Windows))
+		for i, window := range ws.Windows {
+			window.Panes = append([]state.WorkspacePane(nil), window.Panes...)
+			windows[i] = window
+		}
+		ws.Windows = windows
+		out.workspaces = append(out.workspaces, ws)
+	}
+	return out
+}
+
+// rememberState records the action that changed the state from before.
+func (m model) rememberState(label string, before stateParts) model {
+	after := m.captureState()
+	return m.remember(change{label: label, undo: restoreState(before), redo: restoreState(after)})
+}
+
+// restoreState puts parts back into the state.
+func restoreState(parts stateParts) func(m model) (model, error) {
+	return func(m model) (model, error) {
+		parts := parts.clone()
+		m.app.State.Favorites = parts.favorites
+		m.app.State.Sets = parts.sets
+		m.app.State.Workspaces = parts.workspaces
+		if err := state.Save(m.app.StatePath, m.app.State); err != nil {
+			return m, err
+		}
+		if _, ok := m.app.State.Set(m.filterSet); !ok {
+			m.filterSet = ""
+		}
+		m.recompute()
+		return m, nil
+	}
+}
+
+// rememberConfig records the ssh config edit that was just made. The edit
+// backed the files up first, into backup; undoing it restores that backup,
+// which backs the edited files up in turn for the redo.
+func (m model) rememberConfig(label string, backup sshconfig.Backup) model {
+	if m.app.RestoreBackup == nil || backup.ID == "" {
+		return m
+	}
+	swap := swapBackup(backup.ID)
+	return m.remember(change{label: label, undo: swap, redo: swap})
+}
+
+// rememberRename records a host rename: the ssh config edit, undone as
+// rememberConfig's are, and the state that followed the new alias.
+func (m model) rememberRename(label string, backup sshconfig.Backup, before stateParts) model {
+	if m.app.State == nil || m.app.RestoreBackup == nil || backup.ID == "" {
+		return m.rememberConfig(label, backup)
+	}
+	swap := swapBackup(backup.ID)
+	both := func(parts stateParts) func(m model) (model, error) {
+		return func(m model) (model, error) {
+			m, err := swap(m)
+			if err != nil {
+				return m, err
+			}
+			return restoreState(parts)(m)
+		}
+	}
+	return m.remember(change{label: label, undo: both(before), redo: both(m.captureState())})
+}
+
+// swapBackup restores backup id, then the backup that restore took, and so
+// on, each call undoing the one before.
+func swapBackup(id string) func(m model) (model, error) {
+	return func(m model) (model, error) {
+		backup, err := m.app.RestoreBackup(id)
+		if err != nil {
+			return m, err
+		}
+		id = backup.ID
+		return m.reloadHosts(), nil
+	}
+}
+
+// deleteCredentials deletes the credential of each host without leaving
+// the picker, so that the deletion can be undone.
+func (m model) deleteCredentials(hosts []string, user, kind string) (tea.Model, tea.Cmd) {
+	var restores []func() error
+	deleted := 0
+	del := func(m model) (model, error) {
+		restores, deleted = nil, 0
+		for _, host := range hosts {
+			restore, err := m.app.DeleteCredential(host, user, kind)
+			if err != nil {
+				return m, err
+			}
+			deleted++
+			if restore != nil {
+				restores = append(restores, restore)
+			}
+		}
+		return m, nil
+	}
+	m, err := del(m)
+	switch {
+	case err != nil && deleted == 0:
+		m.credential.status = err.Error()
+		return m, nil
+	case err != nil:
+		// Some were deleted: they can still be put back.
+		m.status = err.Error()
+	case len(restores) < deleted:
+		m.status = fmt.Sprintf("deleted %s for %s; %s cannot be undone", kind, strings.Join(hosts, ", "), countHosts(deleted-len(restores)))
+	default:
+		m.status = fmt.Sprintf("deleted %s for %s", kind, strings.Join(hosts, ", "))
+	}
+	m.showCredential = false
+	if len(restores) == 0 {
+		return m, nil
+	}
+	label := fmt.Sprintf("delete %s for %s", kind, strings.Join(hosts, ", "))
+	m = m.remember(change{
+		label: label,
+		undo: func(m model) (model, error) {
+			for _, restore := range restores {
+				if err := restore(); err != nil {
+					return m, err
+				}
+			}
+			return m, nil
+		},
+		redo: del,
+	})
+	return m, nil
+}
@@ -0,0 +1,73 @@
+//go:build !windows
+
+package tunnel
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fakeSSH(t *testing.T, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ssh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	prevBinary, prevGrace := sshBinary, startupGrace
+	sshBinary, startupGrace = path, 200*time.Millisecond
+	t.Cleanup(func() { sshBinary, startupGrace = prevBinary, prevGrace })
+}
+
+func TestStartDetachedAndStop(t *testing.T) {
+	fakeSSH(t, "exec sleep 30")
+	pid, err := StartDetached([]string{"-N", "db1"}, filepath.Join(t.TempDir(), "tunnel.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := Identity(pid)
+	if !Running(pid, id) {
+		t.Fatalf("expected pid %d to be running", pid)
+	}
+	if err := Stop(pid, id); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for Running(pid, id) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if Running(pid, id) {
+		t.Fatalf("expected pid %d to be stopped", pid)
+	}
+	if err := Stop(pid, id); err != nil {
+		t.Fatalf("stopping a dead tunnel should be a no-op, got %v", err)
+	}
+}
+
+func TestStartDetachedReportsEarlyExit(t *testing.T) {
+	fakeSSH(t, "echo 'bind [127.0.0.1]:5432: Address already in use' >&2\nexit 255")
+	_, err := StartDetached([]string{"-N", "db1"}, filepath.Join(t.TempDir(), "tunnel.log"))
+	if err == nil || !strings.Contains(err.Error(), "Address already in use") {
+		t.Fatalf("expected ssh output in error, got %v", err)
+	}
+}
+
+func TestStopLeavesReusedPIDAlone(t *testing.T) {
+	fakeSSH(t, "exec sleep 30")
+	pid, err := StartDetached([]string{"-N", "db1"}, filepath.Join(t.TempDir(), "tunnel.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = Stop(pid, Identity(pid)) })
+	// A record from an earlier process that had the same PID.
+	if err := Stop(pid, "Mon Jan  1 00:00:00 2024 ssh -N db1"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if !Running(pid, Identity(pid)) {
+		t.Fatalf("expected pid %d to survive a stale stop", pid)
+	}
+}
@@ -0,0 +1,256 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"tmux-ssh-manager/pkg/sshconfig"
+)
+
+// Forward is one ssh port forward.
+type Forward struct {
+	// Kind is "L" (local), "R" (remote) or "D" (dynamic SOCKS).
+	Kind string
+	// Spec is the forward in ssh's command-line syntax, e.g.
+	// "5432:localhost:5432".
+	Spec string
+	// Bind and Port are the listening side: local for L and D, remote for R.
+	// Port is 0 when the forward listens on a unix socket.
+	Bind string
+	Port int
+}
+
+// ParseForward parses the value of an ssh -L, -R or -D option.
+func ParseForward(kind, spec string) (Forward, error) {
+	kind = strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(kind), "-"))
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Forward{}, fmt.Errorf("empty -%s forward", kind)
+	}
+	f := Forward{Kind: kind, Spec: spec}
+	parts := splitSpec(spec)
+
+	var bind, port string
+	switch kind {
+	case "D":
+		switch len(parts) {
+		case 1:
+			port = parts[0]
+		case 2:
+			bind, port = parts[0], parts[1]
+		default:
+			return Forward{}, fmt.Errorf("invalid -D forward %q (expected [bind:]port)", spec)
+		}
+	case "L", "R":
+		switch {
+		case len(parts) >= 4:
+			bind, port = parts[0], parts[1]
+		case len(parts) == 3:
+			port = parts[0]
+		case len(parts) == 2 && strings.Contains(parts[1], "/"):
+			port = parts[0] // port:remote_socket
+		case kind == "R" && len(parts) == 2:
+			bind, port = parts[0], parts[1] // remote dynamic forward
+		case kind == "R" && len(parts) == 1:
+			port = parts[0]
+		default:
+			return Forward{}, fmt.Errorf("invalid -%s forward %q (expected [bind:]port:host:hostport)", kind, spec)
+		}
+	default:
+		return Forward{}, fmt.Errorf("unknown forward kind %q (expected L, R or D)", kind)
+	}
+
+	if strings.Contains(port, "/") {
+		// Listening on a unix socket: nothing to check for conflicts.
+		f.Bind = port
+		return f, nil
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 || (n == 0 && kind != "R") {
+		return Forward{}, fmt.Errorf("invalid port %q in -%s forward %q", port, kind, spec)
+	}
+	f.Bind = strings.Trim(bind, "[]")
+	f.Port = n
+	return f, nil
+}
+
+// splitSpec splits a forward spec on colons outside [IPv6] brackets.
+func splitSpec(spec string) []string {
+	var parts []string
+	depth := 0
+	start := 0
+	for i, r := range spec {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ':':
+			if depth == 0 {
+				parts = append(parts, spec[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, spec[start:])
+}
+
+// String renders the forward as ssh arguments, e.g. "-L 5432:localhost:5432".
+func (f Forward) String() string {
+	return "-" + f.Kind + " " + f.Spec
+}
+
+// Local reports whether the forward listens on a local TCP port.
+func (f Forward) Local() bool {
+	return f.Kind != "R" && f.Port > 0
+}
+
+// Configured returns the forwards declared for host in ssh config. Entries
+// ssh itself would reject are skipped.
+func Configured(host sshconfig.Host) []Forward {
+	var out []Forward
+	add := func(kind string, specs []string) {
+		for _, spec := range specs {
+			if f, err := ParseForward(kind, spec); err == nil {
+				out = append(out, f)
+			}
+		}
+	}
+	add("L", host.LocalForwards)
+	add("R", host.RemoteForwards)
+	add("D", host.DynamicForwards)
+	return out
+}
+
+// Merge appends the forwards of extra that are not already in forwards.
+func Merge(forwards, extra []Forward) []Forward {
+	out := append([]Forward(nil), forwards...)
+	for _, f := range extra {
+		duplicate := false
+		for _, existing := range out {
+			if existing.Kind == f.Kind && existing.Spec == f.Spec {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// Args returns the ssh arguments that hold forwards open for alias without
+// running a remote command. ExitOnForwardFailure makes ssh exit instead of
+// staying up with a forward missing.
+func Args(alias string, forwards []Forward) []string {
+	args := []string{"-N", "-o", "ExitOnForwardFailure=yes"}
+	for _, f := range forwards {
+		args = append(args, "-"+f.Kind, f.Spec)
+	}
+	return append(args, alias)
+}
+
+// CheckPort reports an error when the local listening port of f is taken.
+func CheckPort(f Forward) error {
+	if !f.Local() {
+		return nil
+	}
+	host := f.Bind
+	switch host {
+	case "", "localhost":
+		host = "127.0.0.1"
+	case "*":
+		host = ""
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(f.Port)))
+	if err != nil {
+		return fmt.Errorf("port %d is already in use", f.Port)
+	}
+	return ln.Close()
+}
+
+// sshBinary and startupGrace are variables so tests can substitute them.
+var (
+	sshBinary    = "ssh"
+	startupGrace = 1500 * time.Millisecond
+)
+
+// StartDetached runs ssh with args as a background process detached from the
+// terminal, appending its output to logPath. It returns the PID once ssh has
+// survived a short grace period; an ssh that exits before then (auth failure,
+// forward already bound, unknown host) is reported with its last output line.
+func StartDetached(args []string, logPath string) (int, error) {
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("open tunnel log: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(sshBinary, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("start ssh: %w", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		msg := lastLine(logPath)
+		if msg == "" && err != nil {
+			msg = err.Error()
+		}
+		if msg == "" {
+			msg = "exited immediately"
+		}
+		return 0, fmt.Errorf("ssh tunnel failed: %s", msg)
+	case <-time.After(startupGrace):
+		return cmd.Process.Pid, nil
+	}
+}
+
+func lastLine(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// Identity describes the process pid well enough to tell it apart from a
+// later process that reuses the PID: its start time and command line. It is
+// empty when the process cannot be inspected.
+func Identity(pid int) string {
+	if pid <= 0 {
+		return ""
+	}
+	return identity(pid)
+}
+
+// Running reports whether pid is still the process that Identity described
+// as id.
+func Running(pid int, id string) bool {
+	return pid > 0 && id != "" && alive(pid) && identity(pid) == id
+}
+
+// Stop terminates the process pid if it is still the one Identity described
+// as id. A process that is already gone, or whose PID now belongs to another
+// process, is not an error.
+func Stop(pid int, id string) error {
+	if !Running(pid, id) {
+		return nil
+	}
+	if err := terminate(pid); err != nil {
+		return fmt.Errorf("stop tunnel process %d: %w", pid, err)
+	}
+	return nil
+}
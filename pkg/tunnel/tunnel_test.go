@@ -0,0 +1,104 @@
+package tunnel
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"tmux-ssh-manager/pkg/sshconfig"
+)
+
+func TestParseForward(t *testing.T) {
+	tests := []struct {
+		kind, spec string
+		bind       string
+		port       int
+	}{
+		{"L", "5432:localhost:5432", "", 5432},
+		{"-L", "127.0.0.1:6379:cache:6379", "127.0.0.1", 6379},
+		{"L", "[::1]:8080:web:80", "::1", 8080},
+		{"L", "8080:/run/app.sock", "", 8080},
+		{"R", "9000:localhost:3000", "", 9000},
+		{"R", "0.0.0.0:9000", "0.0.0.0", 9000},
+		{"D", "1080", "", 1080},
+		{"d", "localhost:1080", "localhost", 1080},
+	}
+	for _, tt := range tests {
+		f, err := ParseForward(tt.kind, tt.spec)
+		if err != nil {
+			t.Errorf("ParseForward(%q, %q): %v", tt.kind, tt.spec, err)
+			continue
+		}
+		if f.Bind != tt.bind || f.Port != tt.port || f.Spec != tt.spec {
+			t.Errorf("ParseForward(%q, %q) = %+v", tt.kind, tt.spec, f)
+		}
+	}
+}
+
+func TestParseForwardRejectsInvalid(t *testing.T) {
+	for _, tt := range [][2]string{
+		{"L", "5432"},
+		{"L", "db:5432"},
+		{"L", "99999:db:5432"},
+		{"D", "a:b:c"},
+		{"D", "0"},
+		{"X", "1:a:1"},
+		{"L", ""},
+	} {
+		if _, err := ParseForward(tt[0], tt[1]); err == nil {
+			t.Errorf("ParseForward(%q, %q) expected error", tt[0], tt[1])
+		}
+	}
+}
+
+func TestArgs(t *testing.T) {
+	l, _ := ParseForward("L", "5432:localhost:5432")
+	d, _ := ParseForward("D", "1080")
+	got := Args("db1", []Forward{l, d})
+	want := []string{"-N", "-o", "ExitOnForwardFailure=yes", "-L", "5432:localhost:5432", "-D", "1080", "db1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Args = %v, want %v", got, want)
+	}
+	if l.String() != "-L 5432:localhost:5432" {
+		t.Fatalf("unexpected String %q", l.String())
+	}
+}
+
+func TestConfiguredAndMerge(t *testing.T) {
+	host := sshconfig.Host{
+		Alias:           "db1",
+		LocalForwards:   []string{"5432:localhost:5432", "bogus"},
+		DynamicForwards: []string{"1080"},
+	}
+	configured := Configured(host)
+	if len(configured) != 2 || configured[0].Kind != "L" || configured[1].Kind != "D" {
+		t.Fatalf("unexpected configured forwards %+v", configured)
+	}
+	extra, _ := ParseForward("L", "6379:cache:6379")
+	merged := Merge([]Forward{extra}, configured)
+	if len(merged) != 3 {
+		t.Fatalf("expected 3 merged forwards, got %+v", merged)
+	}
+	if again := Merge(merged, configured); len(again) != 3 {
+		t.Fatalf("expected duplicates to be skipped, got %+v", again)
+	}
+}
+
+func TestCheckPortDetectsConflict(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	busy := Forward{Kind: "L", Spec: "x", Port: port}
+	if err := CheckPort(busy); err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+	remote := Forward{Kind: "R", Spec: "x", Port: port}
+	if err := CheckPort(remote); err != nil {
+		t.Fatalf("remote forwards are not checked locally, got %v", err)
+	}
+}